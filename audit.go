@@ -0,0 +1,402 @@
+package ecrud
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+)
+
+// Operations recorded in AuditRecord.Op
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+)
+
+// DefaultAuditRingSize is how many records an AuditRing keeps
+const DefaultAuditRingSize = 10000
+
+// FieldChange is the change of a single field, by JSON name. From is
+// null for creates and To for deletes, or when the field was cleared.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// AuditRecord describes a single mutation. Actor is the subject of the
+// principal that made it, empty when the request was not authenticated.
+type AuditRecord struct {
+	Time      time.Time     `json:"time"`
+	Actor     string        `json:"actor"`
+	RequestID string        `json:"requestId,omitempty"`
+	Op        string        `json:"op"`
+	TargetID  int           `json:"targetId"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+// AuditQuery selects audit records. Zero fields match everything.
+type AuditQuery struct {
+	TargetID int
+	Actor    string
+	Op       string
+	// Field only matches records that changed it
+	Field string
+	// Since and Until are an inclusive range
+	Since *time.Time
+	Until *time.Time
+	// Limit caps the number of records returned, the most recent first
+	Limit int
+}
+
+func (q AuditQuery) matches(rec AuditRecord) bool {
+	switch {
+	case q.TargetID != 0 && rec.TargetID != q.TargetID,
+		q.Actor != "" && rec.Actor != q.Actor,
+		q.Op != "" && rec.Op != q.Op,
+		q.Since != nil && rec.Time.Before(*q.Since),
+		q.Until != nil && rec.Time.After(*q.Until):
+		return false
+	case q.Field != "":
+		for _, c := range rec.Changes {
+			if c.Field == q.Field {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// AuditSink stores audit records. Records are only ever appended.
+type AuditSink interface {
+	Append(ctx context.Context, rec AuditRecord) error
+	// Query returns the matching records, the most recent first
+	Query(ctx context.Context, q AuditQuery) ([]AuditRecord, error)
+}
+
+// AuditRing is an AuditSink keeping the most recent records in memory
+type AuditRing struct {
+	mtx     sync.Mutex
+	records []AuditRecord
+	next    int
+	full    bool
+}
+
+var _ AuditSink = (*AuditRing)(nil)
+
+// NewAuditRing returns an AuditRing keeping up to size records.
+// size <= 0 uses DefaultAuditRingSize.
+func NewAuditRing(size int) *AuditRing {
+	if size <= 0 {
+		size = DefaultAuditRingSize
+	}
+
+	return &AuditRing{records: make([]AuditRecord, size)}
+}
+
+func (ar *AuditRing) Append(ctx context.Context, rec AuditRecord) error {
+	ar.mtx.Lock()
+	defer ar.mtx.Unlock()
+
+	ar.records[ar.next] = rec
+	ar.next = (ar.next + 1) % len(ar.records)
+	ar.full = ar.full || ar.next == 0
+
+	return nil
+}
+
+func (ar *AuditRing) Query(ctx context.Context, q AuditQuery) ([]AuditRecord, error) {
+	ar.mtx.Lock()
+	defer ar.mtx.Unlock()
+
+	n := ar.next
+	if ar.full {
+		n = len(ar.records)
+	}
+	matched := []AuditRecord{}
+	for i := 1; i <= n && (q.Limit <= 0 || len(matched) < q.Limit); i++ {
+		rec := ar.records[(ar.next-i+len(ar.records))%len(ar.records)]
+		if q.matches(rec) {
+			matched = append(matched, rec)
+		}
+	}
+
+	return matched, nil
+}
+
+// AuditFile is an AuditSink appending records to a JSON-lines file.
+// Every record is synced to disk before Append returns. Queries scan the
+// whole file.
+type AuditFile struct {
+	mtx  sync.Mutex
+	path string
+	f    *os.File
+}
+
+var _ AuditSink = (*AuditFile)(nil)
+
+// OpenAuditFile opens the audit file at path, creating it if needed
+func OpenAuditFile(path string) (*AuditFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuditFile{path: path, f: f}, nil
+}
+
+func (af *AuditFile) Close() error {
+	return af.f.Close()
+}
+
+func (af *AuditFile) Append(ctx context.Context, rec AuditRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	af.mtx.Lock()
+	defer af.mtx.Unlock()
+
+	if _, err = af.f.Write(b); err != nil {
+		return err
+	}
+
+	return af.f.Sync()
+}
+
+func (af *AuditFile) Query(ctx context.Context, q AuditQuery) ([]AuditRecord, error) {
+	f, err := os.Open(af.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	matched := []AuditRecord{}
+	lines := bufio.NewScanner(f)
+	lines.Buffer(nil, 1<<20)
+	for lines.Scan() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var rec AuditRecord
+		if err := json.Unmarshal(lines.Bytes(), &rec); err != nil {
+			// a torn last line left by a crash
+			continue
+		}
+		if q.matches(rec) {
+			matched = append(matched, rec)
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+
+	// lines are in append order
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+	}
+
+	return matched, nil
+}
+
+// diffEmployees lists the fields that differ between before and after,
+// either of which may be nil, in field name order. id and version
+// are bookkeeping and left out.
+func diffEmployees(before, after *Employee) []FieldChange {
+	fields := func(e *Employee) map[string]any {
+		m := map[string]any{}
+		if e != nil {
+			b, _ := json.Marshal(e)
+			json.Unmarshal(b, &m)
+			delete(m, "id")
+			delete(m, "version")
+		}
+		return m
+	}
+	from, to := fields(before), fields(after)
+
+	changes := []FieldChange{}
+	for name := range from {
+		if _, ok := to[name]; !ok {
+			changes = append(changes, FieldChange{Field: name, From: from[name]})
+		}
+	}
+	for name, v := range to {
+		if !reflect.DeepEqual(from[name], v) {
+			changes = append(changes, FieldChange{Field: name, From: from[name], To: v})
+		}
+	}
+	sort.Slice(changes, func(a, b int) bool {
+		return changes[a].Field < changes[b].Field
+	})
+
+	return changes
+}
+
+// ServiceAuditMiddleware is a middleware that records every successful
+// mutation in an AuditSink. Records are appended after the mutation has
+// been applied; a sink failing to store one is logged as an error but
+// does not fail the request, which can no longer be undone.
+type ServiceAuditMiddleware struct {
+	inner Service
+	sink  AuditSink
+	log   *zerolog.Logger
+}
+
+var _ Service = (*ServiceAuditMiddleware)(nil)
+
+func NewServiceAuditMiddleware(svc Service, sink AuditSink, log *zerolog.Logger) *ServiceAuditMiddleware {
+	return &ServiceAuditMiddleware{
+		inner: svc,
+		sink:  sink,
+		log:   log,
+	}
+}
+
+func (mw *ServiceAuditMiddleware) List(ctx context.Context, opts ListOptions) (EmployeePage, error) {
+	return mw.inner.List(ctx, opts)
+}
+
+func (mw *ServiceAuditMiddleware) Get(ctx context.Context, id int, opts ...GetOption) (Employee, error) {
+	return mw.inner.Get(ctx, id, opts...)
+}
+
+func (mw *ServiceAuditMiddleware) Create(ctx context.Context, attrs EmployeeAttrs) (int, error) {
+	id, err := mw.inner.Create(ctx, attrs)
+	if err != nil {
+		return id, err
+	}
+	// the request may be cancelled now that the record was created,
+	// but the creation must still be recorded
+	if after, err := mw.inner.Get(context.WithoutCancel(ctx), id); err == nil {
+		mw.record(ctx, AuditCreate, id, nil, &after)
+	} else {
+		mw.record(ctx, AuditCreate, id, nil, nil)
+	}
+
+	return id, nil
+}
+
+// Update records the change against the state it was applied to, see
+// pinnedUpdate
+func (mw *ServiceAuditMiddleware) Update(ctx context.Context, id int, attrs EmployeeAttrs) (Employee, error) {
+	before, after, err := pinnedUpdate(ctx, mw.inner, id, attrs)
+	if err != nil {
+		return after, err
+	}
+	mw.record(ctx, AuditUpdate, id, &before, &after)
+
+	return after, nil
+}
+
+// Delete records the state that was deleted, see deletedState
+func (mw *ServiceAuditMiddleware) Delete(ctx context.Context, id int) error {
+	before, err := mw.inner.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := mw.inner.Delete(ctx, id); err != nil {
+		return err
+	}
+	before = deletedState(context.WithoutCancel(ctx), mw.inner, before)
+	mw.record(ctx, AuditDelete, id, &before, nil)
+
+	return nil
+}
+
+func (mw *ServiceAuditMiddleware) Restore(ctx context.Context, id int) (Employee, error) {
+	before, err := mw.inner.Get(ctx, id, WithDeleted())
+	if err != nil {
+		return before, err
+	}
+	after, err := mw.inner.Restore(ctx, id)
+	if err != nil {
+		return after, err
+	}
+	if before.DeletedAt != nil {
+		mw.record(ctx, AuditRestore, id, &before, &after)
+	}
+
+	return after, nil
+}
+
+func (mw *ServiceAuditMiddleware) Batch(ctx context.Context, req BatchRequest) ([]BatchResult, error) {
+	if req.DryRun {
+		return mw.inner.Batch(ctx, req)
+	}
+
+	befores, results, err := pinnedBatch(ctx, mw.inner, req)
+	if err != nil {
+		return results, err
+	}
+
+	// operations on the same record are recorded as one change each,
+	// from the state the previous one left
+	ctx = context.WithoutCancel(ctx)
+	current, applied := map[int]*Employee{}, map[int]bool{}
+	for id, before := range befores {
+		before := before
+		current[id] = &before
+	}
+	for _, res := range results {
+		op := req.Ops[res.Index]
+		var after *Employee
+		switch {
+		case op.Op == BatchUpdate && current[res.ID] != nil:
+			e := op.Attrs.applyTo(*current[res.ID])
+			after = &e
+		case op.Op == BatchDelete && current[res.ID] != nil && !applied[res.ID]:
+			// deletes carry no version, so one that is the first
+			// operation on its record was not pinned
+			before := deletedState(ctx, mw.inner, *current[res.ID])
+			current[res.ID] = &before
+		case op.Op == BatchCreate:
+			if e, err := mw.inner.Get(ctx, res.ID); err == nil {
+				after = &e
+			}
+		}
+		// batch operations are named like audited ones
+		mw.record(ctx, op.Op, res.ID, current[res.ID], after)
+		current[res.ID], applied[res.ID] = after, true
+	}
+
+	return results, nil
+}
+
+func (mw *ServiceAuditMiddleware) record(ctx context.Context, op string, id int, before, after *Employee) {
+	rec := AuditRecord{
+		Time:      time.Now().UTC(),
+		RequestID: middleware.GetReqID(ctx),
+		Op:        op,
+		TargetID:  id,
+		Changes:   diffEmployees(before, after),
+	}
+	if p, ok := PrincipalFromContext(ctx); ok {
+		rec.Actor = p.Subject
+	}
+
+	if err := mw.sink.Append(context.WithoutCancel(ctx), rec); err != nil {
+		ctxLogger(ctx, mw.log).Error().
+			Err(errors.Join(ErrServerError, err)).
+			Str("op", op).
+			Int("id", id).
+			Msg("audit record was lost")
+	}
+}
@@ -0,0 +1,329 @@
+package ecrud_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+)
+
+// racingWrites runs race, as another writer would, right before each
+// of the next `races` writes that go through it
+type racingWrites struct {
+	ecrud.Service
+	race  func()
+	races int
+}
+
+func (r *racingWrites) Update(ctx context.Context, id int, attrs ecrud.EmployeeAttrs) (ecrud.Employee, error) {
+	r.interleave()
+	return r.Service.Update(ctx, id, attrs)
+}
+
+func (r *racingWrites) Delete(ctx context.Context, id int) error {
+	r.interleave()
+	return r.Service.Delete(ctx, id)
+}
+
+func (r *racingWrites) Batch(ctx context.Context, req ecrud.BatchRequest) ([]ecrud.BatchResult, error) {
+	r.interleave()
+	return r.Service.Batch(ctx, req)
+}
+
+func (r *racingWrites) interleave() {
+	if r.races > 0 {
+		r.races--
+		r.race()
+	}
+}
+
+func TestServiceAuditMiddleware(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	newService := func(sink ecrud.AuditSink) ecrud.Service {
+		stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+		}, &log)
+		return ecrud.NewServiceValidationMiddleware(ecrud.NewServiceAuditMiddleware(stub, sink, &log), &log)
+	}
+	pctx := ecrud.ContextWithPrincipal(ctx, ecrud.Principal{Subject: "payroll", Roles: []string{ecrud.RoleHR}})
+	pctx = context.WithValue(pctx, middleware.RequestIDKey, "req-1")
+	fn, ln, dob, em := "Phil", "Schiller", "1960-07-08", "phil@apple.com"
+	ro := "CEO"
+
+	t.Run("records field changes of every mutation", func(tt *testing.T) {
+		as := assert.New(tt)
+		ring := ecrud.NewAuditRing(0)
+		svc := newService(ring)
+
+		id, err := svc.Create(pctx, ecrud.EmployeeAttrs{FirstName: &fn, LastName: &ln, DateOfBirth: &dob, Email: &em})
+		as.NoError(err)
+		_, err = svc.Update(pctx, id, ecrud.EmployeeAttrs{Role: &ro})
+		as.NoError(err)
+		as.NoError(svc.Delete(pctx, id))
+		// rejected changes are not recorded
+		_, err = svc.Update(pctx, 1, ecrud.EmployeeAttrs{Email: &fn})
+		as.Error(err)
+
+		records, err := ring.Query(ctx, ecrud.AuditQuery{})
+		as.NoError(err)
+		if as.Len(records, 3) {
+			as.Equal(ecrud.AuditDelete, records[0].Op)
+			as.Equal(ecrud.AuditUpdate, records[1].Op)
+			as.Equal(ecrud.AuditCreate, records[2].Op)
+			as.Equal([]ecrud.FieldChange{{Field: "role", From: nil, To: "CEO"}}, records[1].Changes)
+			as.Contains(records[2].Changes, ecrud.FieldChange{Field: "email", From: nil, To: "phil@apple.com"})
+			as.Contains(records[0].Changes, ecrud.FieldChange{Field: "role", From: "CEO", To: nil})
+			for _, rec := range records {
+				as.Equal(id, rec.TargetID)
+				as.Equal("payroll", rec.Actor)
+				as.Equal("req-1", rec.RequestID)
+			}
+		}
+	})
+
+	t.Run("diffs against the state a change was applied to", func(tt *testing.T) {
+		as := assert.New(tt)
+		ring := ecrud.NewAuditRing(0)
+		stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+		}, &log)
+		racing := &racingWrites{Service: stub}
+		svc := ecrud.NewServiceAuditMiddleware(racing, ring, &log)
+		dept, cto := "Retail", "CTO"
+
+		racing.race, racing.races = func() {
+			_, err := stub.Update(ctx, 1, ecrud.EmployeeAttrs{Department: &dept})
+			as.NoError(err)
+		}, 1
+		_, err := svc.Update(pctx, 1, ecrud.EmployeeAttrs{Role: &ro})
+		as.NoError(err)
+
+		// but gives up when other writers keep getting in between
+		racing.race, racing.races = func() {
+			_, err := stub.Update(ctx, 1, ecrud.EmployeeAttrs{Role: &cto})
+			as.NoError(err)
+		}, 3
+		_, err = svc.Update(pctx, 1, ecrud.EmployeeAttrs{Role: &ro})
+		as.ErrorAs(err, &ecrud.ErrConflict{})
+
+		racing.race, racing.races = func() {
+			_, err := stub.Update(ctx, 1, ecrud.EmployeeAttrs{Role: &cto})
+			as.NoError(err)
+		}, 1
+		as.NoError(svc.Delete(pctx, 1))
+
+		records, err := ring.Query(ctx, ecrud.AuditQuery{TargetID: 1})
+		as.NoError(err)
+		if as.Len(records, 2) {
+			as.Contains(records[0].Changes, ecrud.FieldChange{Field: "role", From: "CTO", To: nil})
+			as.Equal([]ecrud.FieldChange{{Field: "role", From: nil, To: "CEO"}}, records[1].Changes)
+		}
+	})
+
+	t.Run("diffs batches against the state they were applied to", func(tt *testing.T) {
+		as := assert.New(tt)
+		ring := ecrud.NewAuditRing(0)
+		stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+			2: {FirstName: "Phil", LastName: "Schiller", DateOfBirth: "1960-07-08", Email: "phil@apple.com"},
+		}, &log)
+		racing := &racingWrites{Service: stub}
+		svc := ecrud.NewServiceAuditMiddleware(racing, ring, &log)
+		dept, cto := "Retail", "CTO"
+
+		racing.race, racing.races = func() {
+			_, err := stub.Update(ctx, 1, ecrud.EmployeeAttrs{Department: &dept})
+			as.NoError(err)
+			_, err = stub.Update(ctx, 2, ecrud.EmployeeAttrs{Role: &cto})
+			as.NoError(err)
+		}, 1
+		_, err := svc.Batch(pctx, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			{Op: ecrud.BatchUpdate, ID: 1, Attrs: ecrud.EmployeeAttrs{Role: &ro}},
+			{Op: ecrud.BatchDelete, ID: 2},
+		}})
+		as.NoError(err)
+
+		records, err := ring.Query(ctx, ecrud.AuditQuery{})
+		as.NoError(err)
+		if as.Len(records, 2) {
+			as.Equal(ecrud.AuditDelete, records[0].Op)
+			as.Contains(records[0].Changes, ecrud.FieldChange{Field: "role", From: "CTO", To: nil})
+			as.Equal([]ecrud.FieldChange{{Field: "role", From: nil, To: "CEO"}}, records[1].Changes)
+		}
+
+		// but gives up when other writers keep getting in between
+		racing.race, racing.races = func() {
+			_, err := stub.Update(ctx, 1, ecrud.EmployeeAttrs{Role: &cto})
+			as.NoError(err)
+		}, 3
+		_, err = svc.Batch(pctx, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			{Op: ecrud.BatchUpdate, ID: 1, Attrs: ecrud.EmployeeAttrs{Role: &ro}},
+		}})
+		as.ErrorAs(err, &ecrud.ErrBatchFailed{})
+		records, err = ring.Query(ctx, ecrud.AuditQuery{})
+		as.NoError(err)
+		as.Len(records, 2)
+	})
+
+	t.Run("records each operation of a batch", func(tt *testing.T) {
+		as := assert.New(tt)
+		ring := ecrud.NewAuditRing(0)
+		svc := newService(ring)
+		cto := "CTO"
+
+		_, err := svc.Batch(pctx, ecrud.BatchRequest{DryRun: true, Ops: []ecrud.BatchOp{
+			{Op: ecrud.BatchUpdate, ID: 1, Attrs: ecrud.EmployeeAttrs{Role: &ro}},
+		}})
+		as.NoError(err)
+		_, err = svc.Batch(pctx, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			{Op: ecrud.BatchUpdate, ID: 1, Attrs: ecrud.EmployeeAttrs{Role: &ro}},
+			{Op: ecrud.BatchUpdate, ID: 1, Attrs: ecrud.EmployeeAttrs{Role: &cto}},
+		}})
+		as.NoError(err)
+
+		records, err := ring.Query(ctx, ecrud.AuditQuery{TargetID: 1})
+		as.NoError(err)
+		if as.Len(records, 2) {
+			as.Equal([]ecrud.FieldChange{{Field: "role", From: "CEO", To: "CTO"}}, records[0].Changes)
+			as.Equal([]ecrud.FieldChange{{Field: "role", From: nil, To: "CEO"}}, records[1].Changes)
+		}
+	})
+}
+
+func TestAuditSinks(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	records := []ecrud.AuditRecord{
+		{Time: start, Actor: "payroll", Op: ecrud.AuditCreate, TargetID: 1, Changes: []ecrud.FieldChange{{Field: "email", To: "hire@me.com"}}},
+		{Time: start.Add(time.Hour), Actor: "david", Op: ecrud.AuditUpdate, TargetID: 1, Changes: []ecrud.FieldChange{{Field: "lastName", From: "Ebreo", To: "E"}}},
+		{Time: start.Add(2 * time.Hour), Actor: "payroll", Op: ecrud.AuditUpdate, TargetID: 2, Changes: []ecrud.FieldChange{{Field: "role", To: "CEO"}}},
+	}
+	since := start.Add(30 * time.Minute)
+	queries := []struct {
+		name  string
+		query ecrud.AuditQuery
+		want  []int
+	}{
+		{"everything", ecrud.AuditQuery{}, []int{2, 1, 0}},
+		{"by target", ecrud.AuditQuery{TargetID: 1}, []int{1, 0}},
+		{"by actor and op", ecrud.AuditQuery{Actor: "payroll", Op: ecrud.AuditUpdate}, []int{2}},
+		{"by field", ecrud.AuditQuery{Field: "lastName"}, []int{1}},
+		{"by time", ecrud.AuditQuery{Since: &since, Until: &records[1].Time}, []int{1}},
+		{"limited", ecrud.AuditQuery{Limit: 1}, []int{2}},
+	}
+	check := func(tt *testing.T, sink ecrud.AuditSink) {
+		as := assert.New(tt)
+		for _, q := range queries {
+			got, err := sink.Query(ctx, q.query)
+			as.NoError(err)
+			want := []ecrud.AuditRecord{}
+			for _, i := range q.want {
+				want = append(want, records[i])
+			}
+			as.Equal(len(want), len(got), q.name)
+			for i := range want {
+				if i < len(got) {
+					as.Equal(want[i].Time.Unix(), got[i].Time.Unix(), q.name)
+					as.Equal(want[i].Changes[0].Field, got[i].Changes[0].Field, q.name)
+				}
+			}
+		}
+	}
+
+	t.Run("queries the memory ring", func(tt *testing.T) {
+		ring := ecrud.NewAuditRing(0)
+		for _, rec := range records {
+			ring.Append(ctx, rec)
+		}
+		check(tt, ring)
+	})
+
+	t.Run("keeps the most recent records in the ring", func(tt *testing.T) {
+		as := assert.New(tt)
+		ring := ecrud.NewAuditRing(2)
+		for _, rec := range records {
+			ring.Append(ctx, rec)
+		}
+		got, err := ring.Query(ctx, ecrud.AuditQuery{})
+		as.NoError(err)
+		if as.Len(got, 2) {
+			as.Equal(2, got[0].TargetID)
+			as.Equal("david", got[1].Actor)
+		}
+	})
+
+	t.Run("queries the file across reopens", func(tt *testing.T) {
+		as := assert.New(tt)
+		path := filepath.Join(tt.TempDir(), "audit.jsonl")
+		f, err := ecrud.OpenAuditFile(path)
+		as.NoError(err)
+		as.NoError(f.Append(ctx, records[0]))
+		as.NoError(f.Close())
+
+		f, err = ecrud.OpenAuditFile(path)
+		as.NoError(err)
+		defer f.Close()
+		for _, rec := range records[1:] {
+			as.NoError(f.Append(ctx, rec))
+		}
+		check(tt, f)
+	})
+}
+
+func TestHTTPAudit(t *testing.T) {
+	log := zerolog.Nop()
+	stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+		1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+	}, &log)
+	ring := ecrud.NewAuditRing(0)
+	svc := ecrud.NewServiceAuthorizationMiddleware(ecrud.NewServiceAuditMiddleware(stub, ring, &log), &log)
+	hndlr := ecrud.NewHTTPServer(svc, &log, ecrud.WithAuditLog(ring), ecrud.WithAuthentication(
+		ecrud.NewAPIKeyAuthenticator(map[string]ecrud.Principal{
+			"reader": {Subject: "reader"},
+			"hr":     {Subject: "payroll", Roles: []string{ecrud.RoleHR}},
+		}),
+	))
+	do := func(method, target, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		r.Header.Set(ecrud.APIKeyHeader, key)
+		w := httptest.NewRecorder()
+		hndlr.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("serves the history of deleted employees", func(tt *testing.T) {
+		as := assert.New(tt)
+		as.Equal(http.StatusOK, do(http.MethodDelete, "/employees/1", "hr").Code)
+
+		w := do(http.MethodGet, "/employees/1/history", "hr")
+		as.Equal(http.StatusOK, w.Code)
+		records := []ecrud.AuditRecord{}
+		as.NoError(json.NewDecoder(w.Body).Decode(&records))
+		if as.Len(records, 1) {
+			as.Equal(ecrud.AuditDelete, records[0].Op)
+			as.Equal("payroll", records[0].Actor)
+			as.NotEmpty(records[0].RequestID)
+		}
+
+		w = do(http.MethodGet, "/audit?actor=reader", "hr")
+		as.Equal(http.StatusOK, w.Code)
+		as.JSONEq(`[]`, w.Body.String())
+		as.Equal(http.StatusBadRequest, do(http.MethodGet, "/audit?limit=0", "hr").Code)
+	})
+
+	t.Run("requires the hr role", func(tt *testing.T) {
+		as := assert.New(tt)
+		as.Equal(http.StatusForbidden, do(http.MethodGet, "/audit", "reader").Code)
+		as.Equal(http.StatusForbidden, do(http.MethodGet, "/employees/1/history", "reader").Code)
+	})
+}
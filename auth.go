@@ -0,0 +1,406 @@
+package ecrud
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Authentication methods recorded in Principal.Method
+const (
+	AuthMethodAPIKey = "api_key"
+	AuthMethodJWT    = "jwt"
+)
+
+// APIKeyHeader carries the static API keys checked by
+// APIKeyAuthenticator
+const APIKeyHeader = "X-API-Key"
+
+// jwtLeeway tolerates clock skew between the token issuer and us when
+// checking exp and nbf
+const jwtLeeway = time.Minute
+
+// Principal is the authenticated caller of a request. EmployeeID links
+// it to its own employee record and Department to the one it manages,
+// if any.
+type Principal struct {
+	Subject    string   `json:"sub"`
+	Roles      []string `json:"roles,omitempty"`
+	EmployeeID int      `json:"employeeId,omitempty"`
+	Department string   `json:"department,omitempty"`
+	Method     string   `json:"-"`
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying p
+func ContextWithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal attached to ctx by the
+// authentication middleware, if any
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// ErrNoCredentials is returned by an Authenticator when a request
+// carries none of the credentials it understands, so that the next one
+// may be tried
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator identifies the caller of a request. It returns
+// ErrNoCredentials when the request carries no credentials it
+// understands, and ErrUnauthenticated when they are invalid.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// authenticate returns the principal identified by the first of auths
+// that finds credentials in r
+func authenticate(r *http.Request, auths []Authenticator) (Principal, error) {
+	for _, auth := range auths {
+		p, err := auth.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+
+	return Principal{}, ErrUnauthenticated{Reason: ErrNoCredentials.Error()}
+}
+
+// APIKeyAuthenticator authenticates requests by the static API key in
+// their APIKeyHeader
+type APIKeyAuthenticator struct {
+	// keys are indexed by their hash, so that looking them up does not
+	// leak how much of a key matched
+	keys map[[sha256.Size]byte]Principal
+}
+
+// NewAPIKeyAuthenticator returns an APIKeyAuthenticator accepting the
+// given keys, each identifying a principal
+func NewAPIKeyAuthenticator(keys map[string]Principal) *APIKeyAuthenticator {
+	a := &APIKeyAuthenticator{keys: map[[sha256.Size]byte]Principal{}}
+	for key, p := range keys {
+		p.Method = AuthMethodAPIKey
+		a.keys[sha256.Sum256([]byte(key))] = p
+	}
+
+	return a
+}
+
+// LoadAPIKeys reads API keys from a JSON file mapping each key to its
+// principal, ie. {"<key>": {"sub": "payroll", "roles": ["hr"]}}
+func LoadAPIKeys(path string) (map[string]Principal, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keys := map[string]Principal{}
+	if err := json.NewDecoder(f).Decode(&keys); err != nil {
+		return nil, err
+	}
+	for key, p := range keys {
+		if key == "" || p.Subject == "" {
+			return nil, errors.New("API keys must be non-empty and have a sub")
+		}
+	}
+
+	return keys, nil
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return Principal{}, ErrNoCredentials
+	}
+	p, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return Principal{}, ErrUnauthenticated{Reason: "unknown API key"}
+	}
+
+	return p, nil
+}
+
+// JWKS is a set of JSON Web Keys (RFC 7517) that JWTs are verified
+// against. Symmetric ("oct"), RSA and Ed25519 ("OKP") keys are
+// supported.
+type JWKS struct {
+	keys []jwk
+}
+
+type jwk struct {
+	kid string
+	alg string
+	key any
+}
+
+// LoadJWKS reads a JWKS document, ie. {"keys": [{"kty": "RSA", ...}]}
+func LoadJWKS(path string) (*JWKS, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseJWKS(b)
+}
+
+// ParseJWKS parses a JWKS document
+func ParseJWKS(b []byte) (*JWKS, error) {
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			K   string `json:"k"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	set := &JWKS{}
+	for i, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key := jwk{kid: k.Kid}
+		switch k.Kty {
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil || len(secret) == 0 {
+				return nil, jwksError(i, "malformed k")
+			}
+			key.alg, key.key = "HS256", secret
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil || len(n) == 0 {
+				return nil, jwksError(i, "malformed n")
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil || len(e) == 0 || len(e) > 4 {
+				return nil, jwksError(i, "malformed e")
+			}
+			pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			if pub.N.BitLen() < 2048 {
+				return nil, jwksError(i, "RSA keys must be at least 2048 bits")
+			}
+			key.alg, key.key = "RS256", pub
+		case "OKP":
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if k.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+				return nil, jwksError(i, "only Ed25519 OKP keys are supported")
+			}
+			key.alg, key.key = "EdDSA", ed25519.PublicKey(x)
+		default:
+			return nil, jwksError(i, "unsupported kty "+k.Kty)
+		}
+		if k.Alg != "" && k.Alg != key.alg {
+			return nil, jwksError(i, "unsupported alg "+k.Alg)
+		}
+		set.keys = append(set.keys, key)
+	}
+
+	return set, nil
+}
+
+func jwksError(i int, reason string) error {
+	return errors.New("JWKS key #" + strconv.Itoa(i) + ": " + reason)
+}
+
+// JWTAuthenticator authenticates requests by the JWT sent as their
+// "Authorization: Bearer" token. Tokens are signed with HS256, RS256 or
+// EdDSA by a key of a JWKS, must not be expired and name a sub. The
+// rest of the Principal is read from the "roles", "employeeId" and
+// "department" claims.
+type JWTAuthenticator struct {
+	keys     *JWKS
+	issuer   string
+	audience string
+}
+
+// JWTOption configures optional JWTAuthenticator checks
+type JWTOption func(*JWTAuthenticator)
+
+// WithJWTIssuer only accepts tokens whose iss is issuer
+func WithJWTIssuer(issuer string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.issuer = issuer
+	}
+}
+
+// WithJWTAudience only accepts tokens whose aud includes audience
+func WithJWTAudience(audience string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.audience = audience
+	}
+}
+
+func NewJWTAuthenticator(keys *JWKS, opts ...JWTOption) *JWTAuthenticator {
+	a := &JWTAuthenticator{
+		keys: keys,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+// jwtClaims are the registered claims checked, plus those describing
+// the Principal. Dates are numbers of seconds which may have a fraction.
+type jwtClaims struct {
+	Subject    string      `json:"sub"`
+	Issuer     string      `json:"iss"`
+	Audience   jwtAudience `json:"aud"`
+	ExpiresAt  *float64    `json:"exp"`
+	NotBefore  *float64    `json:"nbf"`
+	Roles      []string    `json:"roles"`
+	EmployeeID int         `json:"employeeId"`
+	Department string      `json:"department"`
+}
+
+// jwtAudience is either a single string or an array of them
+type jwtAudience []string
+
+func (aud *jwtAudience) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(b, []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*aud = jwtAudience{s}
+		return nil
+	}
+
+	return json.Unmarshal(b, (*[]string)(aud))
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return Principal{}, ErrNoCredentials
+	}
+	claims, err := a.verify(token)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	return Principal{
+		Subject:    claims.Subject,
+		Roles:      claims.Roles,
+		EmployeeID: claims.EmployeeID,
+		Department: claims.Department,
+		Method:     AuthMethodJWT,
+	}, nil
+}
+
+// verify checks the signature and claims of a compact JWS token
+func (a *JWTAuthenticator) verify(token string) (jwtClaims, error) {
+	var claims jwtClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrUnauthenticated{Reason: "malformed token"}
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return claims, ErrUnauthenticated{Reason: "malformed token header"}
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrUnauthenticated{Reason: "malformed token signature"}
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range a.keys.keys {
+		// the alg must be the key's own so that, ie. an RSA public key
+		// cannot be used as an HMAC secret
+		if k.alg != header.Alg || (header.Kid != "" && k.kid != header.Kid) {
+			continue
+		}
+		if verifyJWS(k, signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return claims, ErrUnauthenticated{Reason: "invalid token signature"}
+	}
+
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return claims, ErrUnauthenticated{Reason: "malformed token claims"}
+	}
+	now := time.Now()
+	switch {
+	case claims.Subject == "":
+		return claims, ErrUnauthenticated{Reason: "token has no sub"}
+	case claims.ExpiresAt == nil:
+		return claims, ErrUnauthenticated{Reason: "token has no exp"}
+	case now.After(jwtTime(*claims.ExpiresAt).Add(jwtLeeway)):
+		return claims, ErrUnauthenticated{Reason: "token expired"}
+	case claims.NotBefore != nil && now.Before(jwtTime(*claims.NotBefore).Add(-jwtLeeway)):
+		return claims, ErrUnauthenticated{Reason: "token not yet valid"}
+	case a.issuer != "" && claims.Issuer != a.issuer:
+		return claims, ErrUnauthenticated{Reason: "token has wrong iss"}
+	case a.audience != "" && !slices.Contains(claims.Audience, a.audience):
+		return claims, ErrUnauthenticated{Reason: "token has wrong aud"}
+	}
+
+	return claims, nil
+}
+
+func verifyJWS(k jwk, signed, sig []byte) bool {
+	switch key := k.key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signed)
+		return hmac.Equal(sig, mac.Sum(nil))
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, signed, sig)
+	default:
+		return false
+	}
+}
+
+func decodeJWTSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func jwtTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
@@ -0,0 +1,196 @@
+package ecrud_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+)
+
+// principalRecorder remembers the principal of the last Get
+type principalRecorder struct {
+	ecrud.Service
+	principal *ecrud.Principal
+}
+
+func (pr principalRecorder) Get(ctx context.Context, id int, opts ...ecrud.GetOption) (ecrud.Employee, error) {
+	*pr.principal, _ = ecrud.PrincipalFromContext(ctx)
+	return pr.Service.Get(ctx, id, opts...)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// signJWT returns a compact JWS of claims signed with key for alg
+func signJWT(tt *testing.T, alg, kid string, key any, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			tt.Fatal(err)
+		}
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	}
+
+	return signed + "." + b64(sig)
+}
+
+func TestAuthentication(t *testing.T) {
+	log := zerolog.Nop()
+	stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+		1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+	}, &log)
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "oct", "kid": "hs", "k": b64(secret)},
+		{"kty": "RSA", "kid": "rs", "alg": "RS256", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPub)},
+	}})
+	keys, err := ecrud.ParseJWKS(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var principal ecrud.Principal
+	hndlr := ecrud.NewHTTPServer(principalRecorder{Service: stub, principal: &principal}, &log, ecrud.WithAuthentication(
+		ecrud.NewAPIKeyAuthenticator(map[string]ecrud.Principal{
+			"s3cr3t": {Subject: "payroll", Roles: []string{"hr"}},
+		}),
+		ecrud.NewJWTAuthenticator(keys, ecrud.WithJWTIssuer("https://id.example.com"), ecrud.WithJWTAudience("ecrud")),
+	))
+	get := func(header http.Header) *http.Response {
+		principal = ecrud.Principal{}
+		r := httptest.NewRequest(http.MethodGet, "/employees/1", nil)
+		for k, v := range header {
+			r.Header.Set(k, v[0])
+		}
+		w := httptest.NewRecorder()
+		hndlr.ServeHTTP(w, r)
+		return w.Result()
+	}
+	bearer := func(token string) http.Header {
+		return http.Header{"Authorization": {"Bearer " + token}}
+	}
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"sub":   "alice",
+			"iss":   "https://id.example.com",
+			"aud":   []string{"ecrud", "other"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"roles": []string{"manager"},
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	t.Run("accepts API keys", func(tt *testing.T) {
+		as := assert.New(tt)
+		resp := get(http.Header{ecrud.APIKeyHeader: {"s3cr3t"}})
+		as.Equal(http.StatusOK, resp.StatusCode)
+		as.Equal(ecrud.Principal{Subject: "payroll", Roles: []string{"hr"}, Method: ecrud.AuthMethodAPIKey}, principal)
+	})
+
+	t.Run("accepts JWTs signed by a JWKS key", func(tt *testing.T) {
+		as := assert.New(tt)
+		for _, token := range []string{
+			signJWT(tt, "HS256", "hs", secret, claims(nil)),
+			signJWT(tt, "RS256", "rs", rsaKey, claims(nil)),
+			signJWT(tt, "EdDSA", "", edKey, claims(map[string]any{"aud": "ecrud"})),
+		} {
+			resp := get(bearer(token))
+			as.Equal(http.StatusOK, resp.StatusCode)
+			as.Equal(ecrud.Principal{Subject: "alice", Roles: []string{"manager"}, Method: ecrud.AuthMethodJWT}, principal)
+		}
+	})
+
+	t.Run("rejects missing and invalid credentials", func(tt *testing.T) {
+		as := assert.New(tt)
+		_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+		for name, header := range map[string]http.Header{
+			"no credentials":     {},
+			"unknown API key":    {ecrud.APIKeyHeader: {"guess"}},
+			"malformed token":    bearer("not.a.jwt"),
+			"unknown key":        bearer(signJWT(tt, "EdDSA", "ed", otherKey, claims(nil))),
+			"alg of another key": bearer(signJWT(tt, "HS256", "rs", secret, claims(nil))),
+			"unsigned":           bearer(signJWT(tt, "none", "", nil, claims(nil))),
+			"expired":            bearer(signJWT(tt, "HS256", "hs", secret, claims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}))),
+			"no exp":             bearer(signJWT(tt, "HS256", "hs", secret, claims(map[string]any{"exp": nil}))),
+			"not yet valid":      bearer(signJWT(tt, "HS256", "hs", secret, claims(map[string]any{"nbf": time.Now().Add(time.Hour).Unix()}))),
+			"wrong issuer":       bearer(signJWT(tt, "HS256", "hs", secret, claims(map[string]any{"iss": "https://evil.example.com"}))),
+			"wrong audience":     bearer(signJWT(tt, "HS256", "hs", secret, claims(map[string]any{"aud": "other"}))),
+			"no subject":         bearer(signJWT(tt, "HS256", "hs", secret, claims(map[string]any{"sub": ""}))),
+		} {
+			resp := get(header)
+			as.Equal(http.StatusUnauthorized, resp.StatusCode, name)
+			as.NotEmpty(resp.Header.Get("WWW-Authenticate"), name)
+			p := ecrud.Problem{}
+			as.NoError(json.NewDecoder(resp.Body).Decode(&p), name)
+			as.Equal(ecrud.CodeUnauthenticated, p.Code, name)
+			as.ErrorAs(p.Err(), &ecrud.ErrUnauthenticated{}, name)
+			as.Empty(principal.Subject, name)
+		}
+	})
+
+	t.Run("serves the OpenAPI document to anyone", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := httptest.NewRecorder()
+		hndlr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ecrud.OpenAPIPath, nil))
+		as.Equal(http.StatusOK, w.Code)
+		doc := struct {
+			Security   []map[string][]string `json:"security"`
+			Components struct {
+				SecuritySchemes map[string]any `json:"securitySchemes"`
+			} `json:"components"`
+		}{}
+		as.NoError(json.NewDecoder(w.Body).Decode(&doc))
+		as.Len(doc.Security, 2)
+		as.Contains(doc.Components.SecuritySchemes, "apiKey")
+		as.Contains(doc.Components.SecuritySchemes, "bearer")
+	})
+
+	t.Run("rejects unsupported JWKS keys", func(tt *testing.T) {
+		as := assert.New(tt)
+		_, err := ecrud.ParseJWKS([]byte(`{"keys": [{"kty": "EC", "crv": "P-256"}]}`))
+		as.Error(err)
+		_, err = ecrud.ParseJWKS([]byte(`{"keys": [{"kty": "oct", "alg": "HS512", "k": "c2VjcmV0"}]}`))
+		as.Error(err)
+	})
+}
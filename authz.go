@@ -0,0 +1,291 @@
+package ecrud
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/rs/zerolog"
+)
+
+// Roles a Principal may hold. Principals without any of them may only
+// read, and update the personal details of their own record.
+const (
+	// RoleAdmin may do anything
+	RoleAdmin = "admin"
+	// RoleHR may create, update and delete any employee
+	RoleHR = "hr"
+	// RoleManager may create, update and delete the employees of the
+	// principal's Department, but not move them to another one
+	RoleManager = "manager"
+)
+
+// HasRole reports whether p holds role
+func (p Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// ServiceAuthorizationMiddleware is a middleware that checks the
+// principal attached to the context may perform a request. Requests
+// without a principal are forbidden, so it must only wrap a Service
+// served behind authentication.
+type ServiceAuthorizationMiddleware struct {
+	inner Service
+	depts *Departments
+	log   *zerolog.Logger
+}
+
+var _ Service = (*ServiceAuthorizationMiddleware)(nil)
+
+// AuthorizationOption configures optional ServiceAuthorizationMiddleware
+// behavior
+type AuthorizationOption func(*ServiceAuthorizationMiddleware)
+
+// WithDepartmentNames compares departments by the name depts resolves
+// them to, as ServiceDepartmentMiddleware stores them, so that managers
+// may give theirs by code or in any case
+func WithDepartmentNames(depts *Departments) AuthorizationOption {
+	return func(mw *ServiceAuthorizationMiddleware) {
+		mw.depts = depts
+	}
+}
+
+func NewServiceAuthorizationMiddleware(svc Service, log *zerolog.Logger, opts ...AuthorizationOption) *ServiceAuthorizationMiddleware {
+	mw := &ServiceAuthorizationMiddleware{
+		inner: svc,
+		log:   log,
+	}
+	for _, opt := range opts {
+		opt(mw)
+	}
+
+	return mw
+}
+
+func (mw *ServiceAuthorizationMiddleware) List(ctx context.Context, opts ListOptions) (EmployeePage, error) {
+	if _, err := mw.principal(ctx, "List"); err != nil {
+		return EmployeePage{}, err
+	}
+
+	return mw.inner.List(ctx, opts)
+}
+
+func (mw *ServiceAuthorizationMiddleware) Get(ctx context.Context, id int, opts ...GetOption) (Employee, error) {
+	if _, err := mw.principal(ctx, "Get"); err != nil {
+		return Employee{}, err
+	}
+
+	return mw.inner.Get(ctx, id, opts...)
+}
+
+func (mw *ServiceAuthorizationMiddleware) Create(ctx context.Context, attrs EmployeeAttrs) (int, error) {
+	p, err := mw.principal(ctx, "Create")
+	if err != nil {
+		return 0, err
+	}
+	if err := mw.authorize(p, nil, &attrs); err != nil {
+		mw.forbidden(ctx, "Create", p, 0, err)
+		return 0, err
+	}
+
+	return mw.inner.Create(ctx, attrs)
+}
+
+func (mw *ServiceAuthorizationMiddleware) Update(ctx context.Context, id int, attrs EmployeeAttrs) (Employee, error) {
+	p, err := mw.principal(ctx, "Update")
+	if err != nil {
+		return Employee{}, err
+	}
+	if err := mw.authorizeTarget(ctx, p, id, &attrs); err != nil {
+		mw.forbidden(ctx, "Update", p, id, err)
+		return Employee{}, err
+	}
+
+	return mw.inner.Update(ctx, id, attrs)
+}
+
+func (mw *ServiceAuthorizationMiddleware) Delete(ctx context.Context, id int) error {
+	p, err := mw.principal(ctx, "Delete")
+	if err != nil {
+		return err
+	}
+	if err := mw.authorizeTarget(ctx, p, id, nil); err != nil {
+		mw.forbidden(ctx, "Delete", p, id, err)
+		return err
+	}
+
+	return mw.inner.Delete(ctx, id)
+}
+
+// Restore is authorized as deleting the record again would be
+func (mw *ServiceAuthorizationMiddleware) Restore(ctx context.Context, id int) (Employee, error) {
+	p, err := mw.principal(ctx, "Restore")
+	if err != nil {
+		return Employee{}, err
+	}
+	if err := mw.authorizeTarget(ctx, p, id, nil); err != nil {
+		mw.forbidden(ctx, "Restore", p, id, err)
+		return Employee{}, err
+	}
+
+	return mw.inner.Restore(ctx, id)
+}
+
+// Batch authorizes every operation up front so that a batch with any
+// forbidden operation never reaches the store
+func (mw *ServiceAuthorizationMiddleware) Batch(ctx context.Context, req BatchRequest) ([]BatchResult, error) {
+	p, err := mw.principal(ctx, "Batch")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		results = make([]BatchResult, len(req.Ops))
+		failed  bool
+	)
+	for i, op := range req.Ops {
+		results[i] = BatchResult{Index: i, Op: op.Op, ID: op.ID}
+
+		var err error
+		switch op.Op {
+		case BatchCreate:
+			err = mw.authorize(p, nil, &op.Attrs)
+		case BatchUpdate:
+			err = mw.authorizeTarget(ctx, p, op.ID, &op.Attrs)
+		case BatchDelete:
+			err = mw.authorizeTarget(ctx, p, op.ID, nil)
+		}
+		if err != nil {
+			results[i].Err = err
+			failed = true
+		}
+	}
+
+	if failed {
+		mw.forbidden(ctx, "Batch", p, 0, nil)
+		return results, ErrBatchFailed{Results: results}
+	}
+
+	return mw.inner.Batch(ctx, req)
+}
+
+// principal returns the caller of a request, which must have one
+func (mw *ServiceAuthorizationMiddleware) principal(ctx context.Context, method string) (Principal, error) {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		ctxLogger(ctx, mw.log).Info().
+			Msgf("`%s` forbidden without principal", method)
+		return Principal{}, ErrForbidden{Reason: "request is not authenticated"}
+	}
+
+	return p, nil
+}
+
+// authorizeTarget authorizes changing, or deleting when attrs is nil,
+// the record id. Records that do not exist are left to the inner
+// Service to report.
+func (mw *ServiceAuthorizationMiddleware) authorizeTarget(ctx context.Context, p Principal, id int, attrs *EmployeeAttrs) error {
+	if p.HasRole(RoleAdmin) || p.HasRole(RoleHR) {
+		return nil
+	}
+	target, err := mw.inner.Get(ctx, id, WithDeleted())
+	if errors.As(err, &ErrNotFound{}) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return mw.authorize(p, &target, attrs)
+}
+
+// authorize is the package authorize with departments compared by the
+// names they resolve to, if any
+func (mw *ServiceAuthorizationMiddleware) authorize(p Principal, target *Employee, attrs *EmployeeAttrs) error {
+	if mw.depts == nil {
+		return authorize(p, target, attrs)
+	}
+
+	if name, ok := mw.depts.resolve(p.Department); ok {
+		p.Department = name
+	}
+	if target != nil {
+		e := *target
+		e.Department = mw.depts.canonical(e.Department)
+		target = &e
+	}
+	if attrs != nil {
+		a := *attrs
+		a.Department = mw.depts.canonical(a.Department)
+		attrs = &a
+	}
+
+	return authorize(p, target, attrs)
+}
+
+func (mw *ServiceAuthorizationMiddleware) forbidden(ctx context.Context, method string, p Principal, id int, err error) {
+	ctxLogger(ctx, mw.log).Info().
+		Str("principal", p.Subject).
+		Int("id", id).
+		Err(err).
+		Msgf("`%s` forbidden", method)
+}
+
+// authorize evaluates the policy for p applying attrs to target. target
+// is nil for creates and attrs for deletes.
+func authorize(p Principal, target *Employee, attrs *EmployeeAttrs) error {
+	if p.HasRole(RoleAdmin) || p.HasRole(RoleHR) {
+		return nil
+	}
+
+	var before, after Employee
+	if target != nil {
+		before = *target
+	}
+	if attrs != nil {
+		after = attrs.applyTo(before)
+	}
+
+	err := ErrForbidden{Reason: "principal may only read employees"}
+	if p.HasRole(RoleManager) && p.Department != "" {
+		inDepartment := func(e Employee) bool {
+			return e.Department != nil && *e.Department == p.Department
+		}
+		switch {
+		case target != nil && !inDepartment(before):
+			err.Reason = "managers may only change employees of their own department"
+		case attrs != nil && !inDepartment(after):
+			err.Reason = "managers may not move employees out of their department"
+		default:
+			return nil
+		}
+	}
+
+	// everybody may edit their own personal details
+	if target != nil && attrs != nil && p.EmployeeID != 0 && p.EmployeeID == target.ID {
+		if !equalStringPtr(before.Role, after.Role) ||
+			!equalStringPtr(before.Department, after.Department) ||
+			!equalBoolPtr(before.IsActive, after.IsActive) ||
+			!equalIntPtr(before.ManagerID, after.ManagerID) {
+			return ErrForbidden{Reason: "employees may not change their own role, department, manager or status"}
+		}
+		return nil
+	}
+
+	return err
+}
+
+func equalBoolPtr(a, b *bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+func equalIntPtr(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
@@ -0,0 +1,187 @@
+package ecrud_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+)
+
+func TestServiceAuthorizationMiddleware(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	eng, sales := "Engineering", "Sales"
+	newService := func() ecrud.Service {
+		stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com", Department: &eng},
+			2: {FirstName: "Tim", LastName: "Cook", DateOfBirth: "1960-11-01", Email: "tim@apple.com", Department: &sales},
+		}, &log)
+		return ecrud.NewServiceAuthorizationMiddleware(stub, &log)
+	}
+	withPrincipal := func(p ecrud.Principal) context.Context {
+		return ecrud.ContextWithPrincipal(ctx, p)
+	}
+	fn, ln, dob, em := "Phil", "Schiller", "1960-07-08", "phil@apple.com"
+	newHire := func(dept *string) ecrud.EmployeeAttrs {
+		return ecrud.EmployeeAttrs{FirstName: &fn, LastName: &ln, DateOfBirth: &dob, Email: &em, Department: dept}
+	}
+	ro := "CTO"
+
+	t.Run("forbids requests without a principal", func(tt *testing.T) {
+		as := assert.New(tt)
+		svc := newService()
+		_, err := svc.Get(ctx, 1)
+		as.ErrorAs(err, &ecrud.ErrForbidden{})
+		_, err = svc.List(ctx, ecrud.ListOptions{})
+		as.ErrorAs(err, &ecrud.ErrForbidden{})
+	})
+
+	t.Run("lets admins and HR change anyone", func(tt *testing.T) {
+		as := assert.New(tt)
+		svc := newService()
+		for _, role := range []string{ecrud.RoleAdmin, ecrud.RoleHR} {
+			pctx := withPrincipal(ecrud.Principal{Subject: role, Roles: []string{role}})
+			_, err := svc.Update(pctx, 2, ecrud.EmployeeAttrs{Role: &ro})
+			as.NoError(err)
+		}
+		pctx := withPrincipal(ecrud.Principal{Subject: "hr", Roles: []string{ecrud.RoleHR}})
+		id, err := svc.Create(pctx, newHire(nil))
+		as.NoError(err)
+		as.NoError(svc.Delete(pctx, id))
+	})
+
+	t.Run("confines managers to their department", func(tt *testing.T) {
+		as := assert.New(tt)
+		svc := newService()
+		pctx := withPrincipal(ecrud.Principal{Subject: "cto", Roles: []string{ecrud.RoleManager}, Department: eng})
+
+		_, err := svc.Update(pctx, 1, ecrud.EmployeeAttrs{Role: &ro})
+		as.NoError(err)
+		_, err = svc.Update(pctx, 2, ecrud.EmployeeAttrs{Role: &ro})
+		as.ErrorAs(err, &ecrud.ErrForbidden{})
+		as.ErrorAs(svc.Delete(pctx, 2), &ecrud.ErrForbidden{})
+		_, err = svc.Update(pctx, 1, ecrud.EmployeeAttrs{Department: &sales})
+		as.ErrorAs(err, &ecrud.ErrForbidden{})
+		_, err = svc.Update(pctx, 1, ecrud.EmployeeAttrs{Clear: []string{"department"}})
+		as.ErrorAs(err, &ecrud.ErrForbidden{})
+
+		_, err = svc.Create(pctx, newHire(&sales))
+		as.ErrorAs(err, &ecrud.ErrForbidden{})
+		id, err := svc.Create(pctx, newHire(&eng))
+		as.NoError(err)
+		as.NoError(svc.Delete(pctx, id))
+	})
+
+	t.Run("compares departments by the names they resolve to", func(tt *testing.T) {
+		as := assert.New(tt)
+		stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com", Department: &eng},
+		}, &log)
+		depts := ecrud.NewDepartments(stub, &log)
+		code := "ENG"
+		_, err := depts.Create(ctx, ecrud.DepartmentAttrs{Code: &code, Name: &eng})
+		as.NoError(err)
+		svc := ecrud.NewServiceAuthorizationMiddleware(ecrud.NewServiceDepartmentMiddleware(stub, depts, &log), &log, ecrud.WithDepartmentNames(depts))
+		pctx := withPrincipal(ecrud.Principal{Subject: "cto", Roles: []string{ecrud.RoleManager}, Department: "engineering"})
+
+		_, err = svc.Update(pctx, 1, ecrud.EmployeeAttrs{Role: &ro})
+		as.NoError(err)
+		lower := "eng"
+		id, err := svc.Create(pctx, newHire(&lower))
+		as.NoError(err)
+		e, err := svc.Get(pctx, id)
+		as.NoError(err)
+		as.Equal(&eng, e.Department)
+		_, err = svc.Update(pctx, id, ecrud.EmployeeAttrs{Department: &code})
+		as.NoError(err)
+		_, err = svc.Update(pctx, id, ecrud.EmployeeAttrs{Department: &sales})
+		as.ErrorAs(err, &ecrud.ErrForbidden{})
+	})
+
+	t.Run("lets employees edit their own personal details", func(tt *testing.T) {
+		as := assert.New(tt)
+		svc := newService()
+		pctx := withPrincipal(ecrud.Principal{Subject: "david", EmployeeID: 1})
+
+		_, err := svc.Get(pctx, 2)
+		as.NoError(err)
+		name := "Dave"
+		_, err = svc.Update(pctx, 1, ecrud.EmployeeAttrs{FirstName: &name})
+		as.NoError(err)
+		_, err = svc.Update(pctx, 1, ecrud.EmployeeAttrs{Role: &ro})
+		as.ErrorAs(err, &ecrud.ErrForbidden{})
+		_, err = svc.Update(pctx, 2, ecrud.EmployeeAttrs{FirstName: &name})
+		as.ErrorAs(err, &ecrud.ErrForbidden{})
+		as.ErrorAs(svc.Delete(pctx, 1), &ecrud.ErrForbidden{})
+		_, err = svc.Create(pctx, newHire(nil))
+		as.ErrorAs(err, &ecrud.ErrForbidden{})
+		// missing records are reported as such
+		_, err = svc.Update(pctx, 99, ecrud.EmployeeAttrs{FirstName: &name})
+		as.ErrorAs(err, &ecrud.ErrNotFound{})
+	})
+
+	t.Run("fails batches with any forbidden operation", func(tt *testing.T) {
+		as := assert.New(tt)
+		svc := newService()
+		pctx := withPrincipal(ecrud.Principal{Subject: "cto", Roles: []string{ecrud.RoleManager}, Department: eng})
+
+		results, err := svc.Batch(pctx, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			{Op: ecrud.BatchUpdate, ID: 1, Attrs: ecrud.EmployeeAttrs{Role: &ro}},
+			{Op: ecrud.BatchDelete, ID: 2},
+		}})
+		bf := ecrud.ErrBatchFailed{}
+		if as.ErrorAs(err, &bf) && as.Len(results, 2) {
+			as.NoError(results[0].Err)
+			as.ErrorAs(results[1].Err, &ecrud.ErrForbidden{})
+		}
+		e, err := svc.Get(pctx, 1)
+		as.NoError(err)
+		as.Nil(e.Role)
+	})
+}
+
+func TestHTTPAuthorization(t *testing.T) {
+	log := zerolog.Nop()
+	stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+		1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+	}, &log)
+	hooks := ecrud.NewWebhooks(&log)
+	defer hooks.Close()
+	svc := ecrud.NewServiceAuthorizationMiddleware(ecrud.NewServiceValidationMiddleware(stub, &log), &log)
+	hndlr := ecrud.NewHTTPServer(svc, &log, ecrud.WithWebhookAdmin(hooks), ecrud.WithAuthentication(
+		ecrud.NewAPIKeyAuthenticator(map[string]ecrud.Principal{
+			"reader": {Subject: "reader"},
+			"admin":  {Subject: "admin", Roles: []string{ecrud.RoleAdmin}},
+		}),
+	))
+	do := func(method, target, key string) *http.Response {
+		r := httptest.NewRequest(method, target, nil)
+		r.Header.Set(ecrud.APIKeyHeader, key)
+		w := httptest.NewRecorder()
+		hndlr.ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	t.Run("answers forbidden requests with 403", func(tt *testing.T) {
+		as := assert.New(tt)
+		as.Equal(http.StatusOK, do(http.MethodGet, "/employees/1", "reader").StatusCode)
+		resp := do(http.MethodDelete, "/employees/1", "reader")
+		as.Equal(http.StatusForbidden, resp.StatusCode)
+		p := ecrud.Problem{}
+		as.NoError(json.NewDecoder(resp.Body).Decode(&p))
+		as.Equal(ecrud.CodeForbidden, p.Code)
+		as.ErrorAs(p.Err(), &ecrud.ErrForbidden{})
+	})
+
+	t.Run("only lets admins manage webhooks", func(tt *testing.T) {
+		as := assert.New(tt)
+		as.Equal(http.StatusForbidden, do(http.MethodGet, "/webhooks", "reader").StatusCode)
+		as.Equal(http.StatusOK, do(http.MethodGet, "/webhooks", "admin").StatusCode)
+	})
+}
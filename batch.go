@@ -0,0 +1,50 @@
+package ecrud
+
+// Operations a BatchOp can perform
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// MaxBatchOps is the largest number of operations a single batch may hold
+const MaxBatchOps = 1000
+
+// BatchOp is a single operation of a batch. ID is ignored for creates,
+// Attrs for deletes.
+type BatchOp struct {
+	Op    string        `json:"op"`
+	ID    int           `json:"id,omitempty"`
+	Attrs EmployeeAttrs `json:"attrs"`
+}
+
+// BatchRequest is the input of Service.Batch
+type BatchRequest struct {
+	Ops []BatchOp `json:"ops"`
+	// DryRun checks every operation as usual but never applies any.
+	// Ids reported for creates are the ones the records would get.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// BatchResult reports the outcome of the operation at Index. For creates
+// ID is the id of the new record. Err is nil for operations that
+// succeeded, or that were only rolled back because another one failed.
+type BatchResult struct {
+	Index int    `json:"index"`
+	Op    string `json:"op"`
+	ID    int    `json:"id,omitempty"`
+	// Line is the CSV line the operation was read from, for imports
+	Line int   `json:"line,omitempty"`
+	Err  error `json:"-"`
+}
+
+// ErrBatchFailed is returned when at least one operation of a batch
+// failed. None of the operations were applied. Results holds one entry
+// per operation, in request order.
+type ErrBatchFailed struct {
+	Results []BatchResult
+}
+
+func (e ErrBatchFailed) Error() string {
+	return "batch failed, no operation was applied"
+}
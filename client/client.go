@@ -0,0 +1,397 @@
+// Package client implements ecrud.Service on top of the eCRUD HTTP API,
+// so that a remote eCRUD can be used anywhere a local Service is.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arhyth/ecrud"
+)
+
+const (
+	// DefaultRetries is how often a failed idempotent request is
+	// retried unless WithRetries says otherwise
+	DefaultRetries = 2
+	// DefaultBackoff is the delay before the first retry; it doubles
+	// with every further attempt
+	DefaultBackoff = 100 * time.Millisecond
+	// maxBackoff caps the delay between two attempts
+	maxBackoff = 5 * time.Second
+)
+
+// Client is an ecrud.Service backed by a remote eCRUD HTTP API
+type Client struct {
+	base    *url.URL
+	hc      *http.Client
+	retries int
+	backoff time.Duration
+	timeout time.Duration
+	apiKey  string
+	token   string
+}
+
+var _ ecrud.Service = (*Client)(nil)
+
+// Option configures optional Client behavior
+type Option func(*Client)
+
+// WithHTTPClient sends requests through hc instead of
+// http.DefaultClient, ie. to add transport middleware or TLS settings.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.hc = hc
+	}
+}
+
+// WithRetries retries idempotent requests up to n times when the server
+// cannot be reached or answers 429, 502, 503 or 504, waiting backoff
+// before the first retry and twice as long before each next one.
+// Creates and batches are never retried since they may have been
+// applied already.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = n
+		c.backoff = backoff
+	}
+}
+
+// WithTimeout bounds every single attempt to d. The context passed to
+// a method still bounds the call as a whole, retries included.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithAPIKey authenticates every request with a static API key
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithBearerToken authenticates every request with a bearer token, ie.
+// a JWT
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// New returns a Client for the eCRUD API at baseURL, ie.
+// "http://localhost:3000".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("base URL %q must be absolute", baseURL)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+
+	c := &Client{
+		base:    base,
+		hc:      http.DefaultClient,
+		retries: DefaultRetries,
+		backoff: DefaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// List fetches a single page, or every page when opts.Limit is 0 as
+// the HTTP API caps page sizes at ecrud.MaxListLimit.
+func (c *Client) List(ctx context.Context, opts ecrud.ListOptions) (ecrud.EmployeePage, error) {
+	if opts.Limit != 0 {
+		return c.listPage(ctx, opts)
+	}
+
+	opts.Limit = ecrud.MaxListLimit
+	all := ecrud.EmployeePage{Employees: []ecrud.Employee{}}
+	for {
+		page, err := c.listPage(ctx, opts)
+		if err != nil {
+			return ecrud.EmployeePage{}, err
+		}
+		all.Employees = append(all.Employees, page.Employees...)
+		all.Total = page.Total
+		if page.NextCursor == "" {
+			return all, nil
+		}
+		opts.Offset, opts.Cursor = 0, page.NextCursor
+	}
+}
+
+func (c *Client) listPage(ctx context.Context, opts ecrud.ListOptions) (ecrud.EmployeePage, error) {
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(opts.Limit))
+	if opts.Offset != 0 {
+		q.Set("offset", strconv.Itoa(opts.Offset))
+	}
+	if opts.Cursor != "" {
+		q.Set("cursor", opts.Cursor)
+	}
+	if opts.Sort != "" {
+		q.Set("sort", opts.Sort)
+	}
+	if opts.Desc {
+		q.Set("order", "desc")
+	}
+	if opts.Department != nil {
+		q.Set("department", *opts.Department)
+	}
+	if opts.Role != nil {
+		q.Set("role", *opts.Role)
+	}
+	if opts.IsActive != nil {
+		q.Set("isActive", strconv.FormatBool(*opts.IsActive))
+	}
+	if opts.ManagerID != nil {
+		q.Set("managerId", strconv.Itoa(*opts.ManagerID))
+	}
+	if opts.DateOfBirthFrom != nil {
+		q.Set("dateOfBirthFrom", *opts.DateOfBirthFrom)
+	}
+	if opts.DateOfBirthTo != nil {
+		q.Set("dateOfBirthTo", *opts.DateOfBirthTo)
+	}
+	if opts.IncludeDeleted {
+		q.Set("includeDeleted", "true")
+	}
+	if opts.AsOf != nil {
+		q.Set("asOf", opts.AsOf.Format(time.RFC3339Nano))
+	}
+
+	page := ecrud.EmployeePage{}
+	resp, err := c.do(ctx, http.MethodGet, "/employees?"+q.Encode(), nil, &page.Employees)
+	if err != nil {
+		return ecrud.EmployeePage{}, err
+	}
+	page.NextCursor = resp.Header.Get("X-Next-Cursor")
+	if page.Total, err = strconv.Atoi(resp.Header.Get("X-Total-Count")); err != nil {
+		return ecrud.EmployeePage{}, fmt.Errorf("%w: malformed X-Total-Count", ecrud.ErrServerError)
+	}
+
+	return page, nil
+}
+
+func (c *Client) Get(ctx context.Context, id int, opts ...ecrud.GetOption) (ecrud.Employee, error) {
+	var o ecrud.GetOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	q := url.Values{}
+	if o.IncludeDeleted {
+		q.Set("includeDeleted", "true")
+	}
+	if o.AsOf != nil {
+		q.Set("asOf", o.AsOf.Format(time.RFC3339Nano))
+	}
+	path := employeePath(id)
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+
+	var e ecrud.Employee
+	_, err := c.do(ctx, http.MethodGet, path, nil, &e)
+
+	return e, err
+}
+
+func (c *Client) Create(ctx context.Context, attrs ecrud.EmployeeAttrs) (int, error) {
+	var created struct {
+		ID int `json:"id"`
+	}
+	_, err := c.do(ctx, http.MethodPost, "/employees", attrs, &created)
+
+	return created.ID, err
+}
+
+func (c *Client) Update(ctx context.Context, id int, attrs ecrud.EmployeeAttrs) (ecrud.Employee, error) {
+	var e ecrud.Employee
+	_, err := c.do(ctx, http.MethodPut, employeePath(id), attrs, &e)
+
+	return e, err
+}
+
+func (c *Client) Delete(ctx context.Context, id int) error {
+	_, err := c.do(ctx, http.MethodDelete, employeePath(id), nil, nil)
+
+	return err
+}
+
+func (c *Client) Restore(ctx context.Context, id int) (ecrud.Employee, error) {
+	var e ecrud.Employee
+	_, err := c.do(ctx, http.MethodPost, employeePath(id)+":restore", nil, &e)
+
+	return e, err
+}
+
+func (c *Client) Batch(ctx context.Context, req ecrud.BatchRequest) ([]ecrud.BatchResult, error) {
+	var resp struct {
+		Results []ecrud.BatchResult `json:"results"`
+	}
+	_, err := c.do(ctx, http.MethodPost, "/employees:batch", req, &resp)
+	var ebf ecrud.ErrBatchFailed
+	if errors.As(err, &ebf) {
+		return ebf.Results, err
+	}
+
+	return resp.Results, err
+}
+
+func employeePath(id int) string {
+	return "/employees/" + strconv.Itoa(id)
+}
+
+// do sends a request with in as its JSON body, if any, and decodes a
+// successful response into out. Error responses are turned back into
+// the domain errors they describe.
+func (c *Client) do(ctx context.Context, method, path string, in, out any) (*http.Response, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+	retries := c.retries
+	if method == http.MethodPost {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, payload, err := c.attempt(ctx, method, path, body)
+		if attempt < retries && retryable(resp, err) {
+			if werr := c.wait(ctx, attempt, resp); werr != nil {
+				return nil, werr
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 300 {
+			return resp, responseError(resp, payload)
+		}
+		if out != nil {
+			if err = json.Unmarshal(payload, out); err != nil {
+				return resp, fmt.Errorf("%w: malformed response: %v", ecrud.ErrServerError, err)
+			}
+		}
+
+		return resp, nil
+	}
+}
+
+// attempt sends a single request and reads the whole response so that
+// the per-attempt timeout also covers the body
+func (c *Client) attempt(ctx context.Context, method, path string, body []byte) (*http.Response, []byte, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base.String()+path, rd)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set(ecrud.APIKeyHeader, c.apiKey)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	payload, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp, payload, nil
+}
+
+// retryable reports whether an attempt failed in a way that another
+// attempt may not
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		// the caller's own context is checked before waiting
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// wait sleeps before the next attempt, honoring a Retry-After in
+// seconds, unless ctx is done first
+func (c *Client) wait(ctx context.Context, attempt int, resp *http.Response) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	delay := min(c.backoff<<attempt, maxBackoff)
+	// jitter spreads out clients that failed at the same time
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	if resp != nil {
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			delay = time.Duration(s) * time.Second
+		}
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// responseError decodes a problem document into its domain error.
+// Responses that are not problem documents, ie. from a proxy, are
+// reported as server errors.
+func responseError(resp *http.Response, payload []byte) error {
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	var p ecrud.Problem
+	if mt == ecrud.ProblemContentType && json.Unmarshal(payload, &p) == nil && p.Code != "" {
+		return p.Err()
+	}
+
+	return fmt.Errorf("%w: unexpected status %s", ecrud.ErrServerError, resp.Status)
+}
@@ -0,0 +1,171 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+	"github.com/arhyth/ecrud/client"
+)
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+		1: {
+			FirstName:   "David",
+			LastName:    "Ebreo",
+			DateOfBirth: "2001-04-15",
+			Email:       "hire@me.com",
+		},
+	}, &log)
+	svc := ecrud.NewServiceValidationMiddleware(stub, &log)
+	srv := httptest.NewServer(ecrud.NewHTTPServer(svc, &log))
+	defer srv.Close()
+	c, err := client.New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := func(s string) *string { return &s }
+
+	t.Run("implements CRUD over HTTP", func(tt *testing.T) {
+		as := assert.New(tt)
+		id, err := c.Create(ctx, ecrud.EmployeeAttrs{
+			FirstName:   str("Tim"),
+			LastName:    str("Cook"),
+			DateOfBirth: str("1960-11-01"),
+			Email:       str("tim@apple.com"),
+		})
+		as.NoError(err)
+
+		e, err := c.Get(ctx, id)
+		as.NoError(err)
+		as.Equal("Tim", e.FirstName)
+
+		e, err = c.Update(ctx, id, ecrud.EmployeeAttrs{Role: str("CEO"), Version: &e.Version})
+		as.NoError(err)
+		as.Equal("CEO", *e.Role)
+
+		page, err := c.List(ctx, ecrud.ListOptions{Limit: 1})
+		as.NoError(err)
+		as.Equal(2, page.Total)
+		as.Len(page.Employees, 1)
+		as.NotEmpty(page.NextCursor)
+
+		page, err = c.List(ctx, ecrud.ListOptions{})
+		as.NoError(err)
+		as.Len(page.Employees, 2)
+
+		deleted := time.Now()
+		as.NoError(c.Delete(ctx, id))
+		e, err = c.Get(ctx, id, ecrud.AsOf(deleted))
+		as.NoError(err)
+		as.Equal("CEO", *e.Role)
+		e, err = c.Get(ctx, id, ecrud.WithDeleted())
+		as.NoError(err)
+		as.NotNil(e.DeletedAt)
+		e, err = c.Restore(ctx, id)
+		as.NoError(err)
+		as.Nil(e.DeletedAt)
+		as.NoError(c.Delete(ctx, id))
+	})
+
+	t.Run("decodes errors into domain errors", func(tt *testing.T) {
+		as := assert.New(tt)
+		_, err := c.Get(ctx, 99)
+		as.ErrorIs(err, ecrud.ErrNotFound{ID: 99})
+
+		_, err = c.Create(ctx, ecrud.EmployeeAttrs{FirstName: str("Tim")})
+		ebr := ecrud.ErrBadRequest{}
+		if as.ErrorAs(err, &ebr) {
+			as.Contains(ebr.Fields, "email")
+		}
+
+		e, err := c.Get(ctx, 1)
+		as.NoError(err)
+		_, err = c.Update(ctx, 1, ecrud.EmployeeAttrs{Role: str("CTO")})
+		as.NoError(err)
+		_, err = c.Update(ctx, 1, ecrud.EmployeeAttrs{Role: str("CFO"), Version: &e.Version})
+		as.ErrorAs(err, &ecrud.ErrConflict{})
+
+		results, err := c.Batch(ctx, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			{Op: ecrud.BatchUpdate, ID: 1, Attrs: ecrud.EmployeeAttrs{Role: str("CTO")}},
+			{Op: ecrud.BatchDelete, ID: 99},
+		}})
+		ebf := ecrud.ErrBatchFailed{}
+		if as.ErrorAs(err, &ebf) && as.Len(results, 2) {
+			as.NoError(results[0].Err)
+			as.ErrorIs(results[1].Err, ecrud.ErrNotFound{ID: 99})
+		}
+	})
+
+	t.Run("retries idempotent requests", func(tt *testing.T) {
+		as := assert.New(tt)
+		var calls atomic.Int32
+		flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			srv.Config.Handler.ServeHTTP(w, r)
+		}))
+		defer flaky.Close()
+
+		fc, err := client.New(flaky.URL, client.WithRetries(2, time.Millisecond))
+		as.NoError(err)
+		_, err = fc.Get(ctx, 1)
+		as.NoError(err)
+		as.Equal(int32(3), calls.Load())
+
+		calls.Store(0)
+		_, err = fc.Create(ctx, ecrud.EmployeeAttrs{})
+		as.ErrorIs(err, ecrud.ErrServerError)
+		as.Equal(int32(1), calls.Load())
+	})
+
+	t.Run("times out slow attempts", func(tt *testing.T) {
+		as := assert.New(tt)
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}))
+		defer slow.Close()
+
+		sc, err := client.New(slow.URL,
+			client.WithTimeout(10*time.Millisecond),
+			client.WithRetries(0, 0),
+			client.WithHTTPClient(&http.Client{}),
+		)
+		as.NoError(err)
+		_, err = sc.Get(ctx, 1)
+		as.True(errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("authenticates with an API key", func(tt *testing.T) {
+		as := assert.New(tt)
+		authed := httptest.NewServer(ecrud.NewHTTPServer(svc, &log, ecrud.WithAuthentication(
+			ecrud.NewAPIKeyAuthenticator(map[string]ecrud.Principal{"s3cr3t": {Subject: "sdk"}}),
+		)))
+		defer authed.Close()
+
+		anon, err := client.New(authed.URL)
+		as.NoError(err)
+		_, err = anon.Get(ctx, 1)
+		as.ErrorAs(err, &ecrud.ErrUnauthenticated{})
+
+		ac, err := client.New(authed.URL, client.WithAPIKey("s3cr3t"))
+		as.NoError(err)
+		_, err = ac.Get(ctx, 1)
+		as.NoError(err)
+	})
+}
@@ -1,22 +1,176 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
+	"net"
 	"net/http"
 	"os"
 
 	"github.com/arhyth/ecrud"
 	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
 )
 
 func main() {
+	dbpath := flag.String("sqlite", "", "path to a SQLite database file; records are kept in memory when empty")
+	journaldir := flag.String("journal", "", "directory for the in-memory store's journal and snapshots; disables persistence when empty")
+	grpcaddr := flag.String("grpc", "", "address to serve gRPC on, ie. :3001; gRPC is disabled when empty")
+	apikeys := flag.String("api-keys", "", "path to a JSON file mapping API keys to principals")
+	jwks := flag.String("jwks", "", "path to a JWKS file to verify JWT bearer tokens against")
+	issuer := flag.String("jwt-issuer", "", "iss required of JWTs; any when empty")
+	audience := flag.String("jwt-audience", "", "aud required of JWTs; any when empty")
+	auditpath := flag.String("audit-log", "", "path to a JSON-lines file to append the audit log to; the most recent records are kept in memory when empty")
+	pendingpath := flag.String("pending", "", "path to a JSON file to keep scheduled changes in; they are kept in memory when empty")
+	deptspath := flag.String("departments", "", "path to a JSON file to keep departments in; they are kept in memory when empty")
+	retention := flag.Duration("retention", ecrud.DefaultRetention, "how long deleted employees can be restored before they are purged")
+	dobVisibility := flag.String("dob-visibility", ecrud.DateOfBirthRedacted, "how dates of birth are shown to callers without the hr role when authentication is required: redacted or month-day")
+	flag.Parse()
+
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
 
+	if *retention <= 0 {
+		logger.Fatal().Dur("retention", *retention).Msg("retention must be positive")
+	}
+
+	var (
+		store    ecrud.Service
+		purger   ecrud.Purger
+		httpOpts []ecrud.HTTPOption
+	)
+	if *dbpath != "" {
+		sqlite, err := ecrud.NewServiceSQLite(*dbpath, &logger)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("opening database failed")
+		}
+		defer sqlite.Close()
+		store, purger = sqlite, sqlite
+	} else {
+		// only the in-memory store publishes change events
+		feed := ecrud.NewChangeFeed(ecrud.DefaultChangeFeedSize)
+		opts := []ecrud.StubOption{ecrud.WithChangeFeed(feed)}
+		httpOpts = append(httpOpts, ecrud.WithEventStream(feed))
+		if *journaldir != "" {
+			journal, err := ecrud.OpenJournal(*journaldir, ecrud.DefaultSnapshotEvery)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("opening journal failed")
+			}
+			defer journal.Close()
+			opts = append(opts, ecrud.WithJournal(journal))
+		}
+		// seed records are ignored when the journal already holds state
+		stub := ecrud.NewServiceStub(loadSeed(&logger), &logger, opts...)
+		store, purger = stub, stub
+	}
+	defer ecrud.NewRetentionPurger(purger, *retention, &logger).Close()
+
+	var auths []ecrud.Authenticator
+	if *apikeys != "" {
+		keys, err := ecrud.LoadAPIKeys(*apikeys)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("loading API keys failed")
+		}
+		auths = append(auths, ecrud.NewAPIKeyAuthenticator(keys))
+	}
+	if *jwks != "" {
+		keys, err := ecrud.LoadJWKS(*jwks)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("loading JWKS failed")
+		}
+		auths = append(auths, ecrud.NewJWTAuthenticator(keys, ecrud.WithJWTIssuer(*issuer), ecrud.WithJWTAudience(*audience)))
+	}
+	policy := ecrud.VisibilityPolicy{DateOfBirth: *dobVisibility}
+	if policy.DateOfBirth != ecrud.DateOfBirthRedacted && policy.DateOfBirth != ecrud.DateOfBirthMonthDay {
+		logger.Fatal().Str("dob-visibility", policy.DateOfBirth).Msg("unknown date of birth visibility")
+	}
+	if len(auths) > 0 {
+		httpOpts = append(httpOpts, ecrud.WithAuthentication(auths...), ecrud.WithVisibilityPolicy(policy))
+	} else {
+		logger.Warn().Msg("neither -api-keys nor -jwks given, the HTTP API is open to anyone")
+	}
+
+	hooks := ecrud.NewWebhooks(&logger)
+	defer hooks.Close()
+	httpOpts = append(httpOpts, ecrud.WithWebhookAdmin(hooks))
+
+	var audit ecrud.AuditSink = ecrud.NewAuditRing(ecrud.DefaultAuditRingSize)
+	if *auditpath != "" {
+		f, err := ecrud.OpenAuditFile(*auditpath)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("opening audit log failed")
+		}
+		defer f.Close()
+		audit = f
+	}
+	httpOpts = append(httpOpts, ecrud.WithAuditLog(audit))
+
+	var pending ecrud.PendingStore = ecrud.NewPendingMemory()
+	if *pendingpath != "" {
+		f, err := ecrud.OpenPendingFile(*pendingpath)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("opening pending changes failed")
+		}
+		pending = f
+	}
+	core := ecrud.NewServiceAuditMiddleware(ecrud.NewServiceWebhookMiddleware(store, hooks), audit, &logger)
+	sched := ecrud.NewServiceSchedulerMiddleware(core, pending, &logger)
+	defer sched.Close()
+	httpOpts = append(httpOpts, ecrud.WithScheduler(sched))
+
+	// renames cascade through core so that moved employees are
+	// audited and published
+	depts := ecrud.NewDepartments(core, &logger, ecrud.WithPendingChanges(pending))
+	if *deptspath != "" {
+		f, err := ecrud.OpenDepartmentsFile(*deptspath, core, &logger, ecrud.WithPendingChanges(pending))
+		if err != nil {
+			logger.Fatal().Err(err).Msg("opening departments failed")
+		}
+		depts = f
+	}
+	seeded, err := depts.Seed(context.Background())
+	if err != nil {
+		logger.Fatal().Err(err).Msg("seeding departments failed")
+	}
+	for _, dept := range seeded {
+		logger.Info().
+			Int("id", dept.ID).
+			Str("code", dept.Code).
+			Str("name", dept.Name).
+			Msg("department seeded from employees")
+	}
+	httpOpts = append(httpOpts, ecrud.WithDepartments(depts))
+
+	var svc ecrud.Service = ecrud.NewServiceValidationMiddleware(ecrud.NewServiceDepartmentMiddleware(sched, depts, &logger), &logger)
+	var grpcOpts []grpc.ServerOption
+	if len(auths) > 0 {
+		svc = ecrud.NewServiceAuthorizationMiddleware(ecrud.NewServiceVisibilityMiddleware(svc, policy, &logger), &logger, ecrud.WithDepartmentNames(depts))
+		grpcOpts = append(grpcOpts, ecrud.GRPCAuthentication(auths...))
+	}
+	hndlr := ecrud.NewHTTPServer(svc, &logger, httpOpts...)
+
+	if *grpcaddr != "" {
+		lis, err := net.Listen("tcp", *grpcaddr)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("listening for gRPC failed")
+		}
+		go func() {
+			if err := ecrud.NewGRPCServer(svc, &logger, grpcOpts...).Serve(lis); err != nil {
+				logger.Fatal().Err(err).Msg("serving gRPC failed")
+			}
+		}()
+	}
+
+	http.ListenAndServe(":3000", hndlr)
+}
+
+func loadSeed(logger *zerolog.Logger) map[int]ecrud.Employee {
 	f, err := os.Open("./seed.json")
 	if err != nil {
 		logger.Fatal().Err(err).Msg("opening file failed")
 	}
+	defer f.Close()
 
 	var seed map[string][]ecrud.Employee
 	err = json.NewDecoder(f).Decode(&seed)
@@ -29,9 +183,5 @@ func main() {
 		records[e.ID] = e
 	}
 
-	stub := ecrud.NewServiceStub(records, &logger)
-	svc := ecrud.NewServiceValidationMiddleware(stub, &logger)
-	hndlr := ecrud.NewHTTPServer(svc, &logger)
-
-	http.ListenAndServe(":3000", hndlr)
+	return records
 }
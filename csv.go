@@ -0,0 +1,267 @@
+package ecrud
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CSVContentType is the media type of CSV exports and imports
+const CSVContentType = "text/csv"
+
+// csvColumns are the columns of a CSV export, in order. Imports accept
+// the same header, so an export can be edited and imported again.
+var csvColumns = []string{
+	"id",
+	"firstName",
+	"lastName",
+	"dateOfBirth",
+	"email",
+	"isActive",
+	"department",
+	"role",
+	"managerId",
+	"version",
+}
+
+// csvImportIgnored are export columns an import skips since they are
+// assigned by the service
+var csvImportIgnored = map[string]struct{}{
+	"id":      {},
+	"version": {},
+}
+
+// csvImportRequired are the columns every import must have
+var csvImportRequired = []string{"firstName", "lastName", "dateOfBirth", "email"}
+
+// csvIgnore maps a column onto nothing, dropping it from the import
+const csvIgnore = "-"
+
+func employeeCSVRecord(e Employee) []string {
+	record := []string{
+		strconv.Itoa(e.ID),
+		e.FirstName,
+		e.LastName,
+		e.DateOfBirth,
+		e.Email,
+		"",
+		"",
+		"",
+		"",
+		strconv.Itoa(e.Version),
+	}
+	if e.IsActive != nil {
+		record[5] = strconv.FormatBool(*e.IsActive)
+	}
+	if e.Department != nil {
+		record[6] = *e.Department
+	}
+	if e.Role != nil {
+		record[7] = *e.Role
+	}
+	if e.ManagerID != nil {
+		record[8] = strconv.Itoa(*e.ManagerID)
+	}
+
+	return record
+}
+
+// csvHeaderKey folds a header so that "First Name", "first_name" and
+// "firstName" all match the firstName field
+func csvHeaderKey(header string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '_', '-':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(header)))
+}
+
+// csvImport is a parsed import file: a create for every row and the
+// line each was read from. Invalid holds, by op index, the cells that
+// could not be decoded; such a row is still validated to report every
+// reason at once, but the import can no longer succeed.
+type csvImport struct {
+	Ops     []BatchOp
+	Lines   []int
+	Invalid map[int]ErrBadRequest
+}
+
+// parseCSVImport reads employee rows from r. Columns are matched to
+// fields by name, ignoring case, spaces, dashes and underscores, unless
+// mapping names the field (or csvIgnore) for a header explicitly.
+func parseCSVImport(r io.Reader, mapping map[string]string) (csvImport, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return csvImport{}, badRequest("header", ReasonRequired)
+	}
+	if err != nil {
+		return csvImport{}, ErrMalformedBody{Reason: err.Error()}
+	}
+
+	fields, err := csvImportFields(header, mapping)
+	if err != nil {
+		return csvImport{}, err
+	}
+
+	imp := csvImport{Invalid: map[int]ErrBadRequest{}}
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return csvImport{}, ErrMalformedBody{Reason: err.Error()}
+		}
+		line, _ := cr.FieldPos(0)
+
+		attrs, ebr := csvAttrs(fields, record)
+		if !ebr.Empty() {
+			imp.Invalid[len(imp.Ops)] = ebr
+		}
+		imp.Ops = append(imp.Ops, BatchOp{Op: BatchCreate, Attrs: attrs})
+		imp.Lines = append(imp.Lines, line)
+	}
+
+	return imp, nil
+}
+
+// importCSV creates a record for every row of imp, all-or-nothing. On
+// failure the ErrBatchFailed results carry the line of each row and,
+// for rows with undecodable cells, those reasons ahead of the ones
+// given by svc.
+func importCSV(ctx context.Context, svc Service, imp csvImport, dryRun bool) ([]BatchResult, error) {
+	if len(imp.Ops) == 0 || len(imp.Ops) > MaxBatchOps {
+		return nil, badRequest("rows", ReasonOutOfRange)
+	}
+
+	results, err := svc.Batch(ctx, BatchRequest{
+		Ops: imp.Ops,
+		// rows that failed to decode must not be imported incomplete
+		DryRun: dryRun || len(imp.Invalid) > 0,
+	})
+	var ebf ErrBatchFailed
+	if err != nil && !errors.As(err, &ebf) {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Line = imp.Lines[i]
+		invalid, ok := imp.Invalid[i]
+		if !ok {
+			continue
+		}
+		var ebr ErrBadRequest
+		if errors.As(results[i].Err, &ebr) {
+			for _, fe := range ebr.Errors {
+				invalid.Add(fe.Field, fe.Reason)
+			}
+		}
+		results[i].Err = invalid
+	}
+	if err != nil || len(imp.Invalid) > 0 {
+		return results, ErrBatchFailed{Results: results}
+	}
+
+	return results, nil
+}
+
+// csvImportFields resolves the field each column is imported into; ""
+// for columns that are skipped
+func csvImportFields(header []string, mapping map[string]string) ([]string, error) {
+	known := map[string]string{}
+	for _, col := range csvColumns {
+		known[csvHeaderKey(col)] = col
+	}
+
+	var (
+		ebr    ErrBadRequest
+		fields = make([]string, len(header))
+		seen   = map[string]struct{}{}
+	)
+	for i, h := range header {
+		field, mapped := mapping[h]
+		if !mapped {
+			field = known[csvHeaderKey(h)]
+		} else if field != csvIgnore {
+			field = known[csvHeaderKey(field)]
+		}
+		switch {
+		case field == csvIgnore:
+			continue
+		case field == "":
+			ebr.Add(h, ReasonUnknown)
+			continue
+		}
+		if _, skip := csvImportIgnored[field]; skip {
+			continue
+		}
+		if _, dup := seen[field]; dup {
+			ebr.Add(h, ReasonExclusive)
+			continue
+		}
+		seen[field] = struct{}{}
+		fields[i] = field
+	}
+	for _, field := range csvImportRequired {
+		if _, ok := seen[field]; !ok {
+			ebr.Add(field, ReasonRequired)
+		}
+	}
+	if !ebr.Empty() {
+		return nil, ebr
+	}
+
+	return fields, nil
+}
+
+// csvAttrs decodes a single row. Empty cells leave optional fields
+// unset.
+func csvAttrs(fields, record []string) (EmployeeAttrs, ErrBadRequest) {
+	var (
+		attrs EmployeeAttrs
+		ebr   ErrBadRequest
+	)
+	for i, field := range fields {
+		v := strings.TrimSpace(record[i])
+		if field == "" || v == "" {
+			continue
+		}
+		switch field {
+		case "firstName":
+			attrs.FirstName = &v
+		case "lastName":
+			attrs.LastName = &v
+		case "dateOfBirth":
+			attrs.DateOfBirth = &v
+		case "email":
+			attrs.Email = &v
+		case "isActive":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				ebr.Add(field, ReasonMalformed)
+				continue
+			}
+			attrs.IsActive = &b
+		case "department":
+			attrs.Department = &v
+		case "role":
+			attrs.Role = &v
+		case "managerId":
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				ebr.Add(field, ReasonMalformed)
+				continue
+			}
+			attrs.ManagerID = &id
+		}
+	}
+
+	return attrs, ebr
+}
@@ -0,0 +1,726 @@
+package ecrud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// Department is an organizational unit. Employees belong to one by its
+// name, in Employee.Department.
+type Department struct {
+	ID   int    `json:"id"`
+	Code string `json:"code"`
+	Name string `json:"name"`
+	// CostCenter is the accounting reference salaries are booked on
+	CostCenter *string `json:"costCenter,omitempty"`
+	// HeadID is the id of the employee heading the department
+	HeadID *int `json:"headId,omitempty"`
+}
+
+// DepartmentAttrs is used to create/update a department. Like
+// EmployeeAttrs, nil fields are left unchanged on update.
+type DepartmentAttrs struct {
+	Code       *string `json:"code"`
+	Name       *string `json:"name"`
+	CostCenter *string `json:"costCenter,omitempty"`
+	HeadID     *int    `json:"headId,omitempty"`
+	// Clear lists the optional fields to reset, "costCenter" or
+	// "headId"
+	Clear []string `json:"clear,omitempty"`
+}
+
+// DepartmentMembers are the live employees of a department
+type DepartmentMembers struct {
+	Headcount int        `json:"headcount"`
+	Employees []Employee `json:"employees"`
+}
+
+func (attrs DepartmentAttrs) clears(field string) bool {
+	for _, f := range attrs.Clear {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (attrs DepartmentAttrs) applyTo(d Department) Department {
+	if attrs.Code != nil {
+		d.Code = *attrs.Code
+	}
+	if attrs.Name != nil {
+		d.Name = *attrs.Name
+	}
+	if attrs.CostCenter != nil {
+		d.CostCenter = attrs.CostCenter
+	} else if attrs.clears("costCenter") {
+		d.CostCenter = nil
+	}
+	if attrs.HeadID != nil {
+		d.HeadID = attrs.HeadID
+	} else if attrs.clears("headId") {
+		d.HeadID = nil
+	}
+
+	return d
+}
+
+func validateDepartment(attrs DepartmentAttrs) ErrBadRequest {
+	var ebr ErrBadRequest
+	if attrs.Code != nil {
+		if len(*attrs.Code) <= 1 {
+			ebr.Add("code", ReasonTooShort)
+		} else if strings.ContainsAny(*attrs.Code, " \t\r\n") {
+			ebr.Add("code", ReasonMalformed)
+		}
+	}
+	if attrs.Name != nil && len(strings.TrimSpace(*attrs.Name)) <= 1 {
+		ebr.Add("name", ReasonTooShort)
+	}
+	if attrs.CostCenter != nil && *attrs.CostCenter == "" {
+		ebr.Add("costCenter", ReasonTooShort)
+	}
+	if attrs.HeadID != nil && *attrs.HeadID < 1 {
+		ebr.Add("headId", ReasonOutOfRange)
+	}
+	for _, field := range attrs.Clear {
+		if field != "costCenter" && field != "headId" {
+			ebr.Add("clear", ReasonUnknown)
+			break
+		}
+	}
+	if (attrs.CostCenter != nil && attrs.clears("costCenter")) ||
+		(attrs.HeadID != nil && attrs.clears("headId")) {
+		ebr.Add("clear", ReasonExclusive)
+	}
+
+	return ebr
+}
+
+type departmentSnapshot struct {
+	Seq         int          `json:"seq"`
+	Departments []Department `json:"departments"`
+}
+
+// Departments keeps the departments employees may belong to. Heads are
+// checked against, and renames cascade to, the employees of a Service,
+// which must sit below the middlewares that validate employees against
+// departments, as they hold departments while changes go through, but
+// above those that record or publish changes.
+type Departments struct {
+	mtx       sync.RWMutex
+	depts     map[int]Department
+	seq       int
+	path      string
+	employees Service
+	pending   PendingStore
+	log       *zerolog.Logger
+}
+
+// DepartmentsOption configures optional Departments behavior
+type DepartmentsOption func(*Departments)
+
+// WithPendingChanges keeps departments from being renamed while
+// changes scheduled in store still move employees into them
+func WithPendingChanges(store PendingStore) DepartmentsOption {
+	return func(d *Departments) {
+		d.pending = store
+	}
+}
+
+// NewDepartments keeps departments in memory only
+func NewDepartments(employees Service, log *zerolog.Logger, opts ...DepartmentsOption) *Departments {
+	d := &Departments{
+		depts:     map[int]Department{},
+		employees: employees,
+		log:       log,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// OpenDepartmentsFile loads the departments saved at path, if any, and
+// rewrites the file, synced to disk, on every change
+func OpenDepartmentsFile(path string, employees Service, log *zerolog.Logger, opts ...DepartmentsOption) (*Departments, error) {
+	d := NewDepartments(employees, log, opts...)
+	d.path = path
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snap departmentSnapshot
+	if err = json.Unmarshal(b, &snap); err != nil {
+		return nil, err
+	}
+	for _, dept := range snap.Departments {
+		d.depts[dept.ID] = dept
+		d.seq = max(d.seq, dept.ID)
+	}
+	d.seq = max(d.seq, snap.Seq)
+
+	return d, nil
+}
+
+// List returns every department ordered by id
+func (d *Departments) List(ctx context.Context) ([]Department, error) {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+
+	return d.list(), nil
+}
+
+func (d *Departments) list() []Department {
+	depts := make([]Department, 0, len(d.depts))
+	for _, dept := range d.depts {
+		depts = append(depts, dept)
+	}
+	sort.Slice(depts, func(i, j int) bool { return depts[i].ID < depts[j].ID })
+
+	return depts
+}
+
+func (d *Departments) Get(ctx context.Context, id int) (Department, error) {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+
+	dept, found := d.depts[id]
+	if !found {
+		return Department{}, ErrNotFound{ID: id}
+	}
+
+	return dept, nil
+}
+
+func (d *Departments) Create(ctx context.Context, attrs DepartmentAttrs) (Department, error) {
+	ebr := validateDepartment(attrs)
+	if attrs.Code == nil {
+		ebr.Add("code", ReasonRequired)
+	}
+	if attrs.Name == nil {
+		ebr.Add("name", ReasonRequired)
+	}
+	if !ebr.Empty() {
+		return Department{}, ebr
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	dept := attrs.applyTo(Department{ID: d.seq + 1})
+	if err := d.check(ctx, dept); err != nil {
+		return Department{}, err
+	}
+	d.depts[dept.ID] = dept
+	d.seq++
+	if err := d.save(); err != nil {
+		delete(d.depts, dept.ID)
+		return Department{}, err
+	}
+
+	return dept, nil
+}
+
+// Update changes a department. A new name is first given to its
+// employees, so that none is left in a department that no longer
+// exists; if that fails half way, the employees that were moved keep
+// the new name and the update can be retried. Renames fail with
+// ErrDepartmentInUse while deleted employees or scheduled changes
+// still use the name, since those cannot be renamed along.
+func (d *Departments) Update(ctx context.Context, id int, attrs DepartmentAttrs) (Department, error) {
+	if ebr := validateDepartment(attrs); !ebr.Empty() {
+		return Department{}, ebr
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	before, found := d.depts[id]
+	if !found {
+		return Department{}, ErrNotFound{ID: id}
+	}
+	dept := attrs.applyTo(before)
+	if err := d.check(ctx, dept); err != nil {
+		return Department{}, err
+	}
+	if dept.Name != before.Name {
+		if err := d.rename(ctx, id, before.Name, dept.Name); err != nil {
+			return Department{}, err
+		}
+	}
+	d.depts[id] = dept
+	if err := d.save(); err != nil {
+		d.depts[id] = before
+		return Department{}, err
+	}
+
+	return dept, nil
+}
+
+// Delete removes a department, ErrDepartmentNotEmpty while employees
+// still belong to it and ErrDepartmentInUse while deleted employees or
+// scheduled changes do, which restoring them would otherwise leave in a
+// department that is gone
+func (d *Departments) Delete(ctx context.Context, id int) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	dept, found := d.depts[id]
+	if !found {
+		return ErrNotFound{ID: id}
+	}
+	page, err := d.employees.List(ctx, ListOptions{Limit: 1, Department: &dept.Name})
+	if err != nil {
+		return err
+	}
+	if page.Total > 0 {
+		return ErrDepartmentNotEmpty{ID: id, Headcount: page.Total}
+	}
+	if _, err = d.inUse(ctx, id, dept.Name); err != nil {
+		return err
+	}
+	delete(d.depts, id)
+	if err = d.save(); err != nil {
+		d.depts[id] = dept
+		return err
+	}
+
+	return nil
+}
+
+// check rejects dept if it takes the code or name of another
+// department, ignoring case, or if its head is not a live employee.
+// Callers must hold mtx.
+func (d *Departments) check(ctx context.Context, dept Department) error {
+	var ebr ErrBadRequest
+	for _, other := range d.depts {
+		if other.ID == dept.ID {
+			continue
+		}
+		if strings.EqualFold(other.Code, dept.Code) {
+			ebr.Add("code", ReasonTaken)
+		}
+		if strings.EqualFold(other.Name, dept.Name) {
+			ebr.Add("name", ReasonTaken)
+		}
+	}
+	if dept.HeadID != nil {
+		_, err := d.employees.Get(ctx, *dept.HeadID)
+		if errors.As(err, &ErrNotFound{}) {
+			ebr.Add("headId", ReasonUnknown)
+		} else if err != nil {
+			return err
+		}
+	}
+	if !ebr.Empty() {
+		return ebr
+	}
+
+	return nil
+}
+
+// rename moves the live employees of department id from onto to, a
+// batch at a time. Callers must hold mtx.
+func (d *Departments) rename(ctx context.Context, id int, from, to string) error {
+	members, err := d.inUse(ctx, id, from)
+	if err != nil {
+		return err
+	}
+
+	for len(members) > 0 {
+		n := min(len(members), MaxBatchOps)
+		ops := make([]BatchOp, n)
+		for i, e := range members[:n] {
+			ops[i] = BatchOp{Op: BatchUpdate, ID: e.ID, Attrs: EmployeeAttrs{Department: &to}}
+		}
+		if _, err = d.employees.Batch(ctx, BatchRequest{Ops: ops}); err != nil {
+			ctxLogger(ctx, d.log).Error().
+				Err(err).
+				Str("from", from).
+				Str("to", to).
+				Msg("renaming department employees failed")
+			return err
+		}
+		members = members[n:]
+	}
+
+	return nil
+}
+
+// inUse returns the live employees of department id, named name, or
+// ErrDepartmentInUse while deleted employees or scheduled changes
+// refer to it, which cannot follow it being renamed or deleted
+func (d *Departments) inUse(ctx context.Context, id int, name string) ([]Employee, error) {
+	all, err := listAll(ctx, d.employees, ListOptions{Department: &name, IncludeDeleted: true})
+	if err != nil {
+		return nil, err
+	}
+	var (
+		members []Employee
+		inUse   = ErrDepartmentInUse{ID: id}
+	)
+	for _, e := range all {
+		if e.DeletedAt != nil {
+			inUse.Employees = append(inUse.Employees, e.ID)
+		} else {
+			members = append(members, e)
+		}
+	}
+	if d.pending != nil {
+		changes, err := d.pending.List(ctx, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range changes {
+			if c.Attrs.Department != nil && *c.Attrs.Department == name {
+				inUse.Changes = append(inUse.Changes, c.ID)
+			}
+		}
+	}
+	if len(inUse.Employees) > 0 || len(inUse.Changes) > 0 {
+		ctxLogger(ctx, d.log).Info().
+			Int("id", id).
+			Ints("employees", inUse.Employees).
+			Ints("changes", inUse.Changes).
+			Msg("department in use")
+		return nil, inUse
+	}
+
+	return members, nil
+}
+
+// Seed registers a department for every department live employees
+// belong to but that none is known by yet, ie. when the registry is
+// introduced to existing records. The code of each is its name in upper
+// case with dashes for spaces. Names too short to be valid are left
+// alone. Deleted departments are not brought back, since they had no
+// live employees left.
+func (d *Departments) Seed(ctx context.Context) ([]Department, error) {
+	all, err := listAll(ctx, d.employees, ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]struct{}{}
+	for _, e := range all {
+		if e.Department != nil {
+			names[*e.Department] = struct{}{}
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	var seeded []Department
+	for _, name := range sorted {
+		if _, known := d.lookup(name); known {
+			continue
+		}
+		base := strings.ToUpper(strings.Join(strings.Fields(name), "-"))
+		if ebr := validateDepartment(DepartmentAttrs{Code: &base, Name: &name}); !ebr.Empty() {
+			ctxLogger(ctx, d.log).Warn().
+				Str("department", name).
+				Msg("seeding invalid department skipped")
+			continue
+		}
+		code := base
+		for n := 2; d.codeTaken(code); n++ {
+			code = base + "-" + strconv.Itoa(n)
+		}
+		dept := Department{ID: d.seq + 1, Code: code, Name: name}
+		d.depts[dept.ID] = dept
+		d.seq++
+		seeded = append(seeded, dept)
+	}
+	if len(seeded) == 0 {
+		return nil, nil
+	}
+	if err = d.save(); err != nil {
+		for _, dept := range seeded {
+			delete(d.depts, dept.ID)
+		}
+		return nil, err
+	}
+
+	return seeded, nil
+}
+
+// codeTaken reports whether a department has code, ignoring case.
+// Callers must hold mtx.
+func (d *Departments) codeTaken(code string) bool {
+	for _, dept := range d.depts {
+		if strings.EqualFold(dept.Code, code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hold keeps departments from being changed until the returned func is
+// called, so that employees moved into one join it under the name it
+// was resolved to, before any rename cascades. It must not be called
+// again before that.
+func (d *Departments) hold() func() {
+	d.mtx.RLock()
+
+	return d.mtx.RUnlock
+}
+
+// resolve is lookup for callers that do not hold mtx
+func (d *Departments) resolve(value string) (string, bool) {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+
+	return d.lookup(value)
+}
+
+// canonical returns the name of the department dept refers to, or dept
+// itself if it refers to none
+func (d *Departments) canonical(dept *string) *string {
+	if dept == nil {
+		return nil
+	}
+	if name, ok := d.resolve(*dept); ok {
+		return &name
+	}
+
+	return dept
+}
+
+// lookup returns the name of the department whose code or name is
+// value, ignoring case. Callers must hold mtx.
+func (d *Departments) lookup(value string) (string, bool) {
+	for _, dept := range d.depts {
+		if strings.EqualFold(dept.Name, value) || strings.EqualFold(dept.Code, value) {
+			return dept.Name, true
+		}
+	}
+
+	return "", false
+}
+
+// vacate clears the head of the departments headed by employee id
+func (d *Departments) vacate(ctx context.Context, id int) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	before := map[int]Department{}
+	for _, dept := range d.depts {
+		if dept.HeadID != nil && *dept.HeadID == id {
+			before[dept.ID] = dept
+			dept.HeadID = nil
+			d.depts[dept.ID] = dept
+		}
+	}
+	if len(before) == 0 {
+		return
+	}
+	if err := d.save(); err != nil {
+		// the departments keep pointing at the deleted head
+		for deptID, dept := range before {
+			d.depts[deptID] = dept
+		}
+		ctxLogger(ctx, d.log).Error().
+			Err(err).
+			Int("id", id).
+			Msg("clearing department head failed")
+	}
+}
+
+// save rewrites the file, if there is one. Callers must hold mtx.
+func (d *Departments) save() error {
+	if d.path == "" {
+		return nil
+	}
+
+	return replaceJSONFile(d.path, departmentSnapshot{Seq: d.seq, Departments: d.list()})
+}
+
+// departmentMembers lists the live employees of the department named
+// name through svc, so that they are masked for the caller
+func departmentMembers(ctx context.Context, svc Service, name string) (DepartmentMembers, error) {
+	employees, err := listAll(ctx, svc, ListOptions{Department: &name})
+	if err != nil {
+		return DepartmentMembers{}, err
+	}
+
+	return DepartmentMembers{Headcount: len(employees), Employees: employees}, nil
+}
+
+// ServiceDepartmentMiddleware is a middleware that only lets employees
+// join departments known to Departments. A department may be given by
+// its code or name, ignoring case, and is stored by its name. Records
+// keep a department that predates the registry until it is changed,
+// but are not restored into one. Deleting an employee clears them as
+// head of their departments.
+type ServiceDepartmentMiddleware struct {
+	inner Service
+	depts *Departments
+	log   *zerolog.Logger
+}
+
+var _ Service = (*ServiceDepartmentMiddleware)(nil)
+
+func NewServiceDepartmentMiddleware(svc Service, depts *Departments, log *zerolog.Logger) *ServiceDepartmentMiddleware {
+	return &ServiceDepartmentMiddleware{
+		inner: svc,
+		depts: depts,
+		log:   log,
+	}
+}
+
+func (mw *ServiceDepartmentMiddleware) List(ctx context.Context, opts ListOptions) (EmployeePage, error) {
+	return mw.inner.List(ctx, opts)
+}
+
+func (mw *ServiceDepartmentMiddleware) Get(ctx context.Context, id int, opts ...GetOption) (Employee, error) {
+	return mw.inner.Get(ctx, id, opts...)
+}
+
+func (mw *ServiceDepartmentMiddleware) Create(ctx context.Context, attrs EmployeeAttrs) (int, error) {
+	defer mw.depts.hold()()
+
+	if err := mw.resolve(ctx, 0, &attrs); err != nil {
+		mw.logUnknown(ctx, "`Create`", attrs)
+		return 0, err
+	}
+
+	return mw.inner.Create(ctx, attrs)
+}
+
+func (mw *ServiceDepartmentMiddleware) Update(ctx context.Context, id int, attrs EmployeeAttrs) (Employee, error) {
+	defer mw.depts.hold()()
+
+	if err := mw.resolve(ctx, id, &attrs); err != nil {
+		mw.logUnknown(ctx, "`Update`", attrs)
+		return Employee{}, err
+	}
+
+	return mw.inner.Update(ctx, id, attrs)
+}
+
+func (mw *ServiceDepartmentMiddleware) Delete(ctx context.Context, id int) error {
+	if err := mw.inner.Delete(ctx, id); err != nil {
+		return err
+	}
+	mw.depts.vacate(context.WithoutCancel(ctx), id)
+
+	return nil
+}
+
+// Restore rejects records whose department is no longer known, as any
+// change to it would be
+func (mw *ServiceDepartmentMiddleware) Restore(ctx context.Context, id int) (Employee, error) {
+	defer mw.depts.hold()()
+
+	e, err := mw.inner.Get(ctx, id, WithDeleted())
+	if err != nil {
+		return e, err
+	}
+	if e.Department != nil {
+		if _, ok := mw.depts.lookup(*e.Department); !ok {
+			ctxLogger(ctx, mw.log).Info().
+				Int("id", id).
+				Str("department", *e.Department).
+				Msg("`Restore` unknown department")
+			return Employee{}, badRequest("department", ReasonUnknown)
+		}
+	}
+
+	return mw.inner.Restore(ctx, id)
+}
+
+func (mw *ServiceDepartmentMiddleware) Batch(ctx context.Context, req BatchRequest) ([]BatchResult, error) {
+	results, err := mw.batch(ctx, req)
+	if err != nil || req.DryRun {
+		return results, err
+	}
+	for _, op := range req.Ops {
+		if op.Op == BatchDelete {
+			mw.depts.vacate(context.WithoutCancel(ctx), op.ID)
+		}
+	}
+
+	return results, nil
+}
+
+// batch resolves the departments of req and applies it while holding
+// them
+func (mw *ServiceDepartmentMiddleware) batch(ctx context.Context, req BatchRequest) ([]BatchResult, error) {
+	defer mw.depts.hold()()
+
+	var (
+		ops     = make([]BatchOp, len(req.Ops))
+		results = make([]BatchResult, len(req.Ops))
+		failed  bool
+	)
+	for i, op := range req.Ops {
+		results[i] = BatchResult{Index: i, Op: op.Op, ID: op.ID}
+		id := op.ID
+		if op.Op == BatchCreate {
+			id = 0
+		}
+		if op.Op != BatchDelete {
+			if err := mw.resolve(ctx, id, &op.Attrs); err != nil {
+				results[i].Err = err
+				failed = true
+			}
+		}
+		ops[i] = op
+	}
+	if failed {
+		ctxLogger(ctx, mw.log).Info().
+			Int("ops", len(req.Ops)).
+			Msg("`Batch` unknown department")
+		return results, ErrBatchFailed{Results: results}
+	}
+	req.Ops = ops
+
+	return mw.inner.Batch(ctx, req)
+}
+
+// resolve replaces the department of attrs with the name of the one it
+// refers to. id is 0 for new records. Callers must hold depts.
+func (mw *ServiceDepartmentMiddleware) resolve(ctx context.Context, id int, attrs *EmployeeAttrs) error {
+	if attrs.Department == nil {
+		return nil
+	}
+	if name, ok := mw.depts.lookup(*attrs.Department); ok {
+		attrs.Department = &name
+		return nil
+	}
+	if id != 0 {
+		current, err := mw.inner.Get(ctx, id)
+		if err == nil && equalStringPtr(current.Department, attrs.Department) {
+			return nil
+		}
+	}
+
+	return badRequest("department", ReasonUnknown)
+}
+
+func (mw *ServiceDepartmentMiddleware) logUnknown(ctx context.Context, op string, attrs EmployeeAttrs) {
+	ctxLogger(ctx, mw.log).Info().
+		Str("department", *attrs.Department).
+		Msg(op + " unknown department")
+}
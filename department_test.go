@@ -0,0 +1,262 @@
+package ecrud_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+)
+
+func TestDepartments(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	legacy := "R&D"
+	stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+		1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com", Department: &legacy},
+		2: {FirstName: "Tim", LastName: "Cook", DateOfBirth: "1960-11-01", Email: "tim@apple.com"},
+	}, &log)
+	depts := ecrud.NewDepartments(stub, &log)
+	svc := ecrud.NewServiceValidationMiddleware(ecrud.NewServiceDepartmentMiddleware(stub, depts, &log), &log)
+	code, name, cc := "ENG", "Engineering", "CC-100"
+	eng, err := depts.Create(ctx, ecrud.DepartmentAttrs{Code: &code, Name: &name, CostCenter: &cc})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("`Create` validates departments", func(tt *testing.T) {
+		as := assert.New(tt)
+		var ebr ecrud.ErrBadRequest
+		_, err := depts.Create(ctx, ecrud.DepartmentAttrs{})
+		if as.ErrorAs(err, &ebr) {
+			as.ElementsMatch([]string{"code", "name"}, ebr.Fields)
+		}
+		code, name, head := "eng", "ENGINEERING", 99
+		_, err = depts.Create(ctx, ecrud.DepartmentAttrs{Code: &code, Name: &name, HeadID: &head})
+		if as.ErrorAs(err, &ebr) {
+			as.Equal([]ecrud.FieldError{
+				{Field: "code", Reason: ecrud.ReasonTaken},
+				{Field: "name", Reason: ecrud.ReasonTaken},
+				{Field: "headId", Reason: ecrud.ReasonUnknown},
+			}, ebr.Errors)
+		}
+	})
+
+	t.Run("employees join departments by code or name", func(tt *testing.T) {
+		as := assert.New(tt)
+		code := "eng"
+		e, err := svc.Update(ctx, 2, ecrud.EmployeeAttrs{Department: &code})
+		as.NoError(err)
+		as.Equal(name, *e.Department)
+		unknown := "Sales"
+		_, err = svc.Update(ctx, 2, ecrud.EmployeeAttrs{Department: &unknown})
+		as.ErrorAs(err, &ecrud.ErrBadRequest{})
+		_, err = svc.Batch(ctx, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			{Op: ecrud.BatchUpdate, ID: 2, Attrs: ecrud.EmployeeAttrs{Department: &unknown}},
+		}})
+		as.ErrorAs(err, &ecrud.ErrBatchFailed{})
+
+		// records keep the department they had before the registry
+		_, err = svc.Update(ctx, 1, ecrud.EmployeeAttrs{Department: &legacy})
+		as.NoError(err)
+	})
+
+	t.Run("renames cascade to employees", func(tt *testing.T) {
+		as := assert.New(tt)
+		renamed := "Software"
+		dept, err := depts.Update(ctx, eng.ID, ecrud.DepartmentAttrs{Name: &renamed, Clear: []string{"costCenter"}})
+		as.NoError(err)
+		as.Nil(dept.CostCenter)
+		e, err := svc.Get(ctx, 2)
+		as.NoError(err)
+		as.Equal(renamed, *e.Department)
+		e, err = svc.Get(ctx, 1)
+		as.NoError(err)
+		as.Equal(legacy, *e.Department)
+	})
+
+	t.Run("`Delete` keeps departments with employees", func(tt *testing.T) {
+		as := assert.New(tt)
+		head := 2
+		_, err := depts.Update(ctx, eng.ID, ecrud.DepartmentAttrs{HeadID: &head})
+		as.NoError(err)
+		var ednf ecrud.ErrDepartmentNotEmpty
+		if as.ErrorAs(depts.Delete(ctx, eng.ID), &ednf) {
+			as.Equal(1, ednf.Headcount)
+		}
+
+		// deleted employees no longer head their department, but still
+		// belong to it
+		as.NoError(svc.Delete(ctx, 2))
+		dept, err := depts.Get(ctx, eng.ID)
+		as.NoError(err)
+		as.Nil(dept.HeadID)
+		var eiu ecrud.ErrDepartmentInUse
+		if as.ErrorAs(depts.Delete(ctx, eng.ID), &eiu) {
+			as.Equal([]int{2}, eiu.Employees)
+		}
+
+		_, err = svc.Restore(ctx, 2)
+		as.NoError(err)
+		_, err = svc.Update(ctx, 2, ecrud.EmployeeAttrs{Clear: []string{"department"}})
+		as.NoError(err)
+		as.NoError(depts.Delete(ctx, eng.ID))
+		as.ErrorAs(depts.Delete(ctx, eng.ID), &ecrud.ErrNotFound{})
+	})
+
+	t.Run("employees are only restored into known departments", func(tt *testing.T) {
+		as := assert.New(tt)
+		as.NoError(svc.Delete(ctx, 1))
+		_, err := svc.Restore(ctx, 1)
+		var ebr ecrud.ErrBadRequest
+		if as.ErrorAs(err, &ebr) {
+			as.Equal([]string{"department"}, ebr.Fields)
+		}
+		_, err = svc.Get(ctx, 1)
+		as.ErrorAs(err, &ecrud.ErrNotFound{})
+
+		_, err = stub.Restore(ctx, 1)
+		as.NoError(err)
+	})
+
+	t.Run("renames and deletes wait for deleted employees and scheduled changes", func(tt *testing.T) {
+		as := assert.New(tt)
+		ops := "Field Ops"
+		stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com", Department: &ops},
+			2: {FirstName: "Tim", LastName: "Cook", DateOfBirth: "1960-11-01", Email: "tim@apple.com", Department: &ops},
+			3: {FirstName: "Phil", LastName: "Schiller", DateOfBirth: "1960-07-08", Email: "phil@apple.com"},
+		}, &log)
+		pending := ecrud.NewPendingMemory()
+		sched := ecrud.NewServiceSchedulerMiddleware(stub, pending, &log)
+		defer sched.Close()
+		depts := ecrud.NewDepartments(stub, &log, ecrud.WithPendingChanges(pending))
+		svc := ecrud.NewServiceValidationMiddleware(ecrud.NewServiceDepartmentMiddleware(sched, depts, &log), &log)
+
+		seeded, err := depts.Seed(ctx)
+		as.NoError(err)
+		if !as.Len(seeded, 1) {
+			return
+		}
+		as.Equal("FIELD-OPS", seeded[0].Code)
+		seeded, err = depts.Seed(ctx)
+		as.NoError(err)
+		as.Empty(seeded)
+		all, err := depts.List(ctx)
+		as.NoError(err)
+		dept := all[0]
+
+		as.NoError(svc.Delete(ctx, 2))
+		renamed := "Operations"
+		var eiu ecrud.ErrDepartmentInUse
+		_, err = depts.Update(ctx, dept.ID, ecrud.DepartmentAttrs{Name: &renamed})
+		if as.ErrorAs(err, &eiu) {
+			as.Equal([]int{2}, eiu.Employees)
+			as.Empty(eiu.Changes)
+		}
+		_, err = svc.Restore(ctx, 2)
+		as.NoError(err)
+
+		at := time.Now().Add(time.Hour)
+		code := "field-ops"
+		_, err = svc.Update(ctx, 3, ecrud.EmployeeAttrs{Department: &code, EffectiveAt: &at})
+		as.NoError(err)
+		changes, err := sched.Pending(ctx, 3)
+		as.NoError(err)
+		if !as.Len(changes, 1) {
+			return
+		}
+		_, err = depts.Update(ctx, dept.ID, ecrud.DepartmentAttrs{Name: &renamed})
+		if as.ErrorAs(err, &eiu) {
+			as.Empty(eiu.Employees)
+			as.Equal([]int{changes[0].ID}, eiu.Changes)
+		}
+
+		as.NoError(sched.Cancel(ctx, 3, changes[0].ID))
+		_, err = depts.Update(ctx, dept.ID, ecrud.DepartmentAttrs{Name: &renamed})
+		as.NoError(err)
+		members, err := stub.List(ctx, ecrud.ListOptions{Department: &renamed})
+		as.NoError(err)
+		as.Equal(2, members.Total)
+
+		code, name := "HR", "People"
+		hr, err := depts.Create(ctx, ecrud.DepartmentAttrs{Code: &code, Name: &name})
+		as.NoError(err)
+		_, err = svc.Update(ctx, 3, ecrud.EmployeeAttrs{Department: &code, EffectiveAt: &at})
+		as.NoError(err)
+		changes, err = sched.Pending(ctx, 3)
+		as.NoError(err)
+		if !as.Len(changes, 1) {
+			return
+		}
+		if as.ErrorAs(depts.Delete(ctx, hr.ID), &eiu) {
+			as.Empty(eiu.Employees)
+			as.Equal([]int{changes[0].ID}, eiu.Changes)
+		}
+		as.NoError(sched.Cancel(ctx, 3, changes[0].ID))
+		as.NoError(depts.Delete(ctx, hr.ID))
+	})
+
+	t.Run("renames wait for employees joining under the old name", func(tt *testing.T) {
+		as := assert.New(tt)
+		stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+		}, &log)
+		depts := ecrud.NewDepartments(stub, &log)
+		slow := &slowUpdates{Service: stub, entered: make(chan struct{}), release: make(chan struct{})}
+		svc := ecrud.NewServiceDepartmentMiddleware(slow, depts, &log)
+		code, name := "OPS", "Operations"
+		dept, err := depts.Create(ctx, ecrud.DepartmentAttrs{Code: &code, Name: &name})
+		as.NoError(err)
+
+		joined := make(chan error, 1)
+		go func() {
+			_, err := svc.Update(ctx, 1, ecrud.EmployeeAttrs{Department: &code})
+			joined <- err
+		}()
+		<-slow.entered
+		renamed := make(chan error, 1)
+		go func() {
+			name := "Field Ops"
+			_, err := depts.Update(ctx, dept.ID, ecrud.DepartmentAttrs{Name: &name})
+			renamed <- err
+		}()
+		as.Never(func() bool { return len(renamed) > 0 }, 50*time.Millisecond, 5*time.Millisecond)
+		close(slow.release)
+		as.NoError(<-joined)
+		as.NoError(<-renamed)
+		e, err := stub.Get(ctx, 1)
+		as.NoError(err)
+		if as.NotNil(e.Department) {
+			as.Equal("Field Ops", *e.Department)
+		}
+	})
+
+	t.Run("departments survive reopening", func(tt *testing.T) {
+		as := assert.New(tt)
+		path := filepath.Join(tt.TempDir(), "departments.json")
+		f, err := ecrud.OpenDepartmentsFile(path, stub, &log)
+		as.NoError(err)
+		code, name := "OPS", "Operations"
+		first, err := f.Create(ctx, ecrud.DepartmentAttrs{Code: &code, Name: &name})
+		as.NoError(err)
+		code, name = "HR", "People"
+		second, err := f.Create(ctx, ecrud.DepartmentAttrs{Code: &code, Name: &name})
+		as.NoError(err)
+		as.NoError(f.Delete(ctx, second.ID))
+
+		f, err = ecrud.OpenDepartmentsFile(path, stub, &log)
+		as.NoError(err)
+		all, err := f.List(ctx)
+		as.NoError(err)
+		as.Equal([]ecrud.Department{first}, all)
+		// ids are never reused
+		third, err := f.Create(ctx, ecrud.DepartmentAttrs{Code: &code, Name: &name})
+		as.NoError(err)
+		as.Greater(third.ID, second.ID)
+	})
+}
@@ -1,5 +1,7 @@
 package ecrud
 
+import "time"
+
 // Employee represents an employee record
 type Employee struct {
 	ID          int     `json:"id"`
@@ -10,12 +12,19 @@ type Employee struct {
 	IsActive    *bool   `json:"isActive,omitempty"`
 	Department  *string `json:"department,omitempty"`
 	Role        *string `json:"role,omitempty"`
+	// ManagerID is the id of the employee this one reports to
+	ManagerID *int `json:"managerId,omitempty"`
+	// Version starts at 1 and is incremented on every update
+	Version int `json:"version"`
+	// DeletedAt is set on tombstoned records
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
 }
 
 // EmployeeAttrs is used to create/update an employee record
 // All fields are optional to avoid overwriting most recent change
 // with values that are not specified by the user but is populated
-// by an older read.
+// by an older read. Concurrent edits of the same field are caught
+// by setting Version.
 type EmployeeAttrs struct {
 	FirstName   *string `json:"firstName"`
 	LastName    *string `json:"lastName"`
@@ -24,4 +33,76 @@ type EmployeeAttrs struct {
 	IsActive    *bool   `json:"isActive,omitempty"`
 	Department  *string `json:"department,omitempty"`
 	Role        *string `json:"role,omitempty"`
+	// ManagerID must be a live employee that does not, directly or
+	// not, report to this one
+	ManagerID *int `json:"managerId,omitempty"`
+	// Version, when set, is the version the update was based on. The
+	// update is rejected with ErrConflict if the record has since
+	// changed. It is ignored on create.
+	Version *int `json:"version,omitempty"`
+	// Clear lists optional fields, by JSON name, to reset to null on
+	// update since a nil field means "leave unchanged".
+	Clear []string `json:"clear,omitempty"`
+	// EffectiveAt, when in the future, makes an update a pending change
+	// applied at that time by ServiceSchedulerMiddleware. It is not
+	// supported on create or in batches.
+	EffectiveAt *time.Time `json:"effectiveAt,omitempty"`
+}
+
+// clearableFields are the optional Employee fields EmployeeAttrs.Clear
+// may name
+var clearableFields = map[string]struct{}{
+	"isActive":   {},
+	"department": {},
+	"role":       {},
+	"managerId":  {},
+}
+
+// clears reports whether field is listed in Clear
+func (attrs EmployeeAttrs) clears(field string) bool {
+	for _, f := range attrs.Clear {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyTo returns e with the changes described by attrs
+func (attrs EmployeeAttrs) applyTo(e Employee) Employee {
+	if attrs.FirstName != nil {
+		e.FirstName = *attrs.FirstName
+	}
+	if attrs.LastName != nil {
+		e.LastName = *attrs.LastName
+	}
+	if attrs.DateOfBirth != nil {
+		e.DateOfBirth = *attrs.DateOfBirth
+	}
+	if attrs.Email != nil {
+		e.Email = *attrs.Email
+	}
+	if attrs.IsActive != nil {
+		e.IsActive = attrs.IsActive
+	} else if attrs.clears("isActive") {
+		e.IsActive = nil
+	}
+	if attrs.Department != nil {
+		e.Department = attrs.Department
+	} else if attrs.clears("department") {
+		e.Department = nil
+	}
+	if attrs.Role != nil {
+		e.Role = attrs.Role
+	} else if attrs.clears("role") {
+		e.Role = nil
+	}
+	if attrs.ManagerID != nil {
+		e.ManagerID = attrs.ManagerID
+	} else if attrs.clears("managerId") {
+		e.ManagerID = nil
+	}
+
+	return e
 }
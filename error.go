@@ -2,20 +2,76 @@ package ecrud
 
 import (
 	"errors"
+	"strings"
 )
 
 var (
 	ErrServerError = errors.New("server error")
 )
 
+// Reasons given for rejecting a field in ErrBadRequest
+const (
+	ReasonRequired    = "required"
+	ReasonTooShort    = "too short"
+	ReasonMalformed   = "malformed"
+	ReasonTaken       = "already taken"
+	ReasonOutOfRange  = "out of range"
+	ReasonUnknown     = "unknown value"
+	ReasonExclusive   = "conflicts with another field"
+	ReasonReadOnly    = "read only"
+	ReasonUnsupported = "not supported"
+	ReasonCycle       = "creates a reporting cycle"
+)
+
+// FieldError explains why a single field was rejected
+type FieldError struct {
+	Field  string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func (fe FieldError) String() string {
+	return fe.Field + ": " + fe.Reason
+}
+
+// ErrBadRequest lists every rejected field. Fields holds just the names
+// for clients that only need to highlight inputs, Errors the reason for
+// each.
 type ErrBadRequest struct {
-	Fields []string `json:"fields"`
+	Fields []string     `json:"fields"`
+	Errors []FieldError `json:"invalidParams,omitempty"`
+}
+
+func badRequest(field, reason string) ErrBadRequest {
+	var ebr ErrBadRequest
+	ebr.Add(field, reason)
+	return ebr
+}
+
+// Add rejects field for the given reason
+func (e *ErrBadRequest) Add(field, reason string) {
+	e.Fields = append(e.Fields, field)
+	e.Errors = append(e.Errors, FieldError{Field: field, Reason: reason})
+}
+
+// Empty reports whether no field has been rejected
+func (e ErrBadRequest) Empty() bool {
+	return len(e.Fields) == 0
 }
 
 func (e ErrBadRequest) Error() string {
 	return "missing/invalid params"
 }
 
+// Detail is a human readable summary, ie. "email: already taken"
+func (e ErrBadRequest) Detail() string {
+	reasons := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		reasons = append(reasons, fe.String())
+	}
+
+	return strings.Join(reasons, "; ")
+}
+
 type ErrNotFound struct {
 	ID int `json:"id"`
 }
@@ -23,3 +79,110 @@ type ErrNotFound struct {
 func (e ErrNotFound) Error() string {
 	return "record not found"
 }
+
+// ErrConflict is returned when an update is based on a stale version
+// of a record. Version is the record's current version.
+type ErrConflict struct {
+	ID      int `json:"id"`
+	Version int `json:"version"`
+}
+
+func (e ErrConflict) Error() string {
+	return "record was modified concurrently"
+}
+
+// ErrHasReports is returned when deleting an employee that other live
+// employees still report to. They have to be reassigned first.
+type ErrHasReports struct {
+	ID      int   `json:"id"`
+	Reports []int `json:"reports"`
+}
+
+func (e ErrHasReports) Error() string {
+	return "employee still has reports"
+}
+
+// ErrDepartmentNotEmpty is returned when deleting a department that
+// employees still belong to. They have to be moved first.
+type ErrDepartmentNotEmpty struct {
+	ID        int `json:"id"`
+	Headcount int `json:"headcount"`
+}
+
+func (e ErrDepartmentNotEmpty) Error() string {
+	return "department still has employees"
+}
+
+// ErrDepartmentInUse is returned when renaming or deleting a department
+// that deleted employees or scheduled changes still refer to by its
+// name, since they cannot follow. They have to be purged, or restored,
+// or cancelled first.
+type ErrDepartmentInUse struct {
+	ID        int   `json:"id"`
+	Employees []int `json:"employees,omitempty"`
+	Changes   []int `json:"changes,omitempty"`
+}
+
+func (e ErrDepartmentInUse) Error() string {
+	return "department is still used by deleted employees or scheduled changes"
+}
+
+// ErrUnsupportedMediaType is returned when a request body is in a
+// format the endpoint does not accept
+type ErrUnsupportedMediaType struct {
+	ContentType string   `json:"contentType"`
+	Supported   []string `json:"supported"`
+}
+
+func (e ErrUnsupportedMediaType) Error() string {
+	return "unsupported media type " + e.ContentType
+}
+
+// ErrMalformedBody is returned when a request body cannot be decoded
+type ErrMalformedBody struct {
+	Reason string `json:"reason"`
+}
+
+func (e ErrMalformedBody) Error() string {
+	return "malformed request body: " + e.Reason
+}
+
+// ErrPatchFailed is returned when a well formed patch document cannot be
+// applied to a record, ie. a JSON Patch "test" operation failed
+type ErrPatchFailed struct {
+	Reason string `json:"reason"`
+}
+
+func (e ErrPatchFailed) Error() string {
+	return "patch could not be applied: " + e.Reason
+}
+
+// ErrEventsExpired is returned when change events after LastEventID are
+// no longer available to resume from. The subscriber has to reload the
+// records it tracks and subscribe afresh.
+type ErrEventsExpired struct {
+	LastEventID uint64 `json:"lastEventId"`
+}
+
+func (e ErrEventsExpired) Error() string {
+	return "events after the last event ID are no longer available"
+}
+
+// ErrUnauthenticated is returned when a request carries no valid
+// credentials
+type ErrUnauthenticated struct {
+	Reason string `json:"reason"`
+}
+
+func (e ErrUnauthenticated) Error() string {
+	return "authentication failed: " + e.Reason
+}
+
+// ErrForbidden is returned when the caller may not perform a request
+type ErrForbidden struct {
+	Reason string `json:"reason"`
+}
+
+func (e ErrForbidden) Error() string {
+	return "forbidden: " + e.Reason
+}
@@ -0,0 +1,147 @@
+package ecrud
+
+import (
+	"sync"
+	"time"
+)
+
+// Change event types
+const (
+	EventCreated  = "created"
+	EventUpdated  = "updated"
+	EventDeleted  = "deleted"
+	EventRestored = "restored"
+)
+
+const (
+	// DefaultChangeFeedSize is how many recent events a ChangeFeed keeps
+	// for subscribers resuming after a disconnect
+	DefaultChangeFeedSize = 1000
+	// subscriberBuffer is how many events a subscriber may fall behind
+	// before it is dropped
+	subscriberBuffer = 64
+)
+
+// ChangeEvent describes a single mutation. Before is nil for creates
+// and After is nil for deletes. Restores go from the tombstone to the
+// live record.
+type ChangeEvent struct {
+	// Seq increases by one with every event. It restarts with the
+	// process.
+	Seq    uint64    `json:"seq"`
+	Type   string    `json:"type"`
+	ID     int       `json:"id"`
+	Before *Employee `json:"before"`
+	After  *Employee `json:"after"`
+	Time   time.Time `json:"time"`
+}
+
+// ChangeFeed fans out the change events published by a ServiceStub to
+// subscribers, keeping the most recent ones so that subscribers can
+// resume where they left off.
+type ChangeFeed struct {
+	mtx    sync.Mutex
+	size   int
+	recent []ChangeEvent
+	seq    uint64
+	subs   map[*ChangeSubscription]struct{}
+}
+
+func NewChangeFeed(size int) *ChangeFeed {
+	return &ChangeFeed{
+		size: size,
+		subs: map[*ChangeSubscription]struct{}{},
+	}
+}
+
+// ChangeSubscription receives every event published after it was
+// created. Backlog holds the events a resumed subscription missed, C the
+// ones that follow. C is closed when the subscriber falls too far behind
+// to keep up; it can then resume from the last event it handled.
+type ChangeSubscription struct {
+	Backlog []ChangeEvent
+	C       <-chan ChangeEvent
+	c       chan ChangeEvent
+	feed    *ChangeFeed
+}
+
+// Subscribe returns a subscription to the events published from now on
+func (f *ChangeFeed) Subscribe() *ChangeSubscription {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.subscribe(nil)
+}
+
+// Resume returns a subscription to the events published after the one
+// numbered after. It fails with ErrEventsExpired if some of those events
+// are no longer kept, or were published by a previous process.
+func (f *ChangeFeed) Resume(after uint64) (*ChangeSubscription, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if after > f.seq || f.seq-after > uint64(len(f.recent)) {
+		return nil, ErrEventsExpired{LastEventID: after}
+	}
+	missed := f.recent[uint64(len(f.recent))-(f.seq-after):]
+
+	return f.subscribe(append([]ChangeEvent(nil), missed...)), nil
+}
+
+func (f *ChangeFeed) subscribe(backlog []ChangeEvent) *ChangeSubscription {
+	c := make(chan ChangeEvent, subscriberBuffer)
+	sub := &ChangeSubscription{
+		Backlog: backlog,
+		C:       c,
+		c:       c,
+		feed:    f,
+	}
+	f.subs[sub] = struct{}{}
+
+	return sub
+}
+
+// Close stops delivery to the subscription
+func (sub *ChangeSubscription) Close() {
+	sub.feed.mtx.Lock()
+	defer sub.feed.mtx.Unlock()
+
+	sub.feed.drop(sub)
+}
+
+// drop closes sub unless it already is. Callers must hold the lock.
+func (f *ChangeFeed) drop(sub *ChangeSubscription) {
+	if _, ok := f.subs[sub]; ok {
+		delete(f.subs, sub)
+		close(sub.c)
+	}
+}
+
+// publish numbers and delivers an event. It never blocks on a
+// subscriber, since it is called while the ServiceStub holds its lock.
+func (f *ChangeFeed) publish(typ string, id int, before, after *Employee) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.seq++
+	ev := ChangeEvent{
+		Seq:    f.seq,
+		Type:   typ,
+		ID:     id,
+		Before: before,
+		After:  after,
+		Time:   time.Now().UTC(),
+	}
+	f.recent = append(f.recent, ev)
+	if len(f.recent) > f.size {
+		f.recent = f.recent[len(f.recent)-f.size:]
+	}
+
+	for sub := range f.subs {
+		select {
+		case sub.c <- ev:
+		default:
+			f.drop(sub)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package ecrud_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+)
+
+func TestChangeFeed(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+
+	t.Run("`ServiceStub` publishes every mutation", func(tt *testing.T) {
+		as := assert.New(tt)
+		feed := ecrud.NewChangeFeed(ecrud.DefaultChangeFeedSize)
+		stub := ecrud.NewServiceStub(nil, &log, ecrud.WithChangeFeed(feed))
+		sub := feed.Subscribe()
+		defer sub.Close()
+
+		fn, ln, dob, em, ro := "Tim", "Cook", "1960-11-01", "tim@apple.com", "CEO"
+		id, err := stub.Create(ctx, ecrud.EmployeeAttrs{FirstName: &fn, LastName: &ln, DateOfBirth: &dob, Email: &em})
+		as.NoError(err)
+		_, err = stub.Update(ctx, id, ecrud.EmployeeAttrs{Role: &ro})
+		as.NoError(err)
+		as.NoError(stub.Delete(ctx, id))
+		as.Error(stub.Delete(ctx, id))
+
+		created, updated, deleted := <-sub.C, <-sub.C, <-sub.C
+		as.Equal([]uint64{1, 2, 3}, []uint64{created.Seq, updated.Seq, deleted.Seq})
+		as.Equal(ecrud.EventCreated, created.Type)
+		as.Nil(created.Before)
+		as.Equal(id, created.After.ID)
+		as.Equal(ecrud.EventUpdated, updated.Type)
+		as.Nil(updated.Before.Role)
+		as.Equal("CEO", *updated.After.Role)
+		as.Equal(ecrud.EventDeleted, deleted.Type)
+		as.Equal(2, deleted.Before.Version)
+		as.Nil(deleted.After)
+		as.Empty(sub.C)
+	})
+
+	t.Run("batches publish an event per operation once applied", func(tt *testing.T) {
+		as := assert.New(tt)
+		feed := ecrud.NewChangeFeed(ecrud.DefaultChangeFeedSize)
+		stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+		}, &log, ecrud.WithChangeFeed(feed))
+		sub := feed.Subscribe()
+		defer sub.Close()
+
+		ro := "CTO"
+		_, err := stub.Batch(ctx, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			{Op: ecrud.BatchUpdate, ID: 1, Attrs: ecrud.EmployeeAttrs{Role: &ro}},
+			{Op: ecrud.BatchDelete, ID: 99},
+		}})
+		as.Error(err)
+		as.Empty(sub.C)
+
+		_, err = stub.Batch(ctx, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			{Op: ecrud.BatchUpdate, ID: 1, Attrs: ecrud.EmployeeAttrs{Role: &ro}},
+			{Op: ecrud.BatchDelete, ID: 1},
+		}})
+		as.NoError(err)
+		updated, deleted := <-sub.C, <-sub.C
+		as.Equal(ecrud.EventUpdated, updated.Type)
+		as.Equal(1, updated.Before.Version)
+		as.Equal(ecrud.EventDeleted, deleted.Type)
+		as.Equal(2, deleted.Before.Version)
+	})
+
+	t.Run("resumes from recent events only", func(tt *testing.T) {
+		as := assert.New(tt)
+		feed := ecrud.NewChangeFeed(2)
+		stub := ecrud.NewServiceStub(nil, &log, ecrud.WithChangeFeed(feed))
+		for _, em := range []string{"a@x.com", "b@x.com", "c@x.com"} {
+			fn, ln, dob, em := "Tim", "Cook", "1960-11-01", em
+			_, err := stub.Create(ctx, ecrud.EmployeeAttrs{FirstName: &fn, LastName: &ln, DateOfBirth: &dob, Email: &em})
+			as.NoError(err)
+		}
+
+		sub, err := feed.Resume(1)
+		if as.NoError(err) {
+			defer sub.Close()
+			if as.Len(sub.Backlog, 2) {
+				as.Equal(uint64(2), sub.Backlog[0].Seq)
+				as.Equal(uint64(3), sub.Backlog[1].Seq)
+			}
+		}
+		_, err = feed.Resume(0)
+		as.ErrorAs(err, &ecrud.ErrEventsExpired{})
+		_, err = feed.Resume(4)
+		as.ErrorAs(err, &ecrud.ErrEventsExpired{})
+	})
+
+	t.Run("drops subscribers that fall behind", func(tt *testing.T) {
+		as := assert.New(tt)
+		feed := ecrud.NewChangeFeed(ecrud.DefaultChangeFeedSize)
+		stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+		}, &log, ecrud.WithChangeFeed(feed))
+		sub := feed.Subscribe()
+		defer sub.Close()
+
+		ro := "CTO"
+		for i := 0; i < 100; i++ {
+			_, err := stub.Update(ctx, 1, ecrud.EmployeeAttrs{Role: &ro})
+			as.NoError(err)
+		}
+		received := 0
+		for range sub.C {
+			received++
+		}
+		as.Less(received, 100)
+	})
+}
+
+func TestHTTPEvents(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	feed := ecrud.NewChangeFeed(ecrud.DefaultChangeFeedSize)
+	stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+		1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+	}, &log, ecrud.WithChangeFeed(feed))
+	svc := ecrud.NewServiceValidationMiddleware(stub, &log)
+	srv := httptest.NewServer(ecrud.NewHTTPServer(svc, &log, ecrud.WithEventStream(feed)))
+	defer srv.Close()
+
+	type sse struct {
+		id, event string
+		data      ecrud.ChangeEvent
+	}
+	// connect returns a reader of the events sent by the server
+	connect := func(tt *testing.T, lastEventID string) (func() sse, func()) {
+		reqCtx, cancel := context.WithCancel(ctx)
+		r, _ := http.NewRequestWithContext(reqCtx, http.MethodGet, srv.URL+"/employees/events", nil)
+		if lastEventID != "" {
+			r.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			tt.Fatalf("unexpected status %d", resp.StatusCode)
+		}
+		lines := bufio.NewScanner(resp.Body)
+		next := func() sse {
+			var ev sse
+			for lines.Scan() {
+				field, value, _ := strings.Cut(lines.Text(), ": ")
+				switch field {
+				case "id":
+					ev.id = value
+				case "event":
+					ev.event = value
+				case "data":
+					if err := json.Unmarshal([]byte(value), &ev.data); err != nil {
+						tt.Fatal(err)
+					}
+				case "":
+					if ev.id != "" {
+						return ev
+					}
+				}
+			}
+			tt.Fatal("stream ended")
+			return ev
+		}
+		return next, func() {
+			cancel()
+			resp.Body.Close()
+		}
+	}
+
+	t.Run("streams changes and resumes from `Last-Event-ID`", func(tt *testing.T) {
+		as := assert.New(tt)
+		next, disconnect := connect(tt, "")
+		ro := "CEO"
+		_, err := svc.Update(ctx, 1, ecrud.EmployeeAttrs{Role: &ro})
+		as.NoError(err)
+		ev := next()
+		as.Equal("1", ev.id)
+		as.Equal(ecrud.EventUpdated, ev.event)
+		as.Equal("CEO", *ev.data.After.Role)
+		disconnect()
+
+		as.NoError(svc.Delete(ctx, 1))
+		next, disconnect = connect(tt, ev.id)
+		defer disconnect()
+		ev = next()
+		as.Equal("2", ev.id)
+		as.Equal(ecrud.EventDeleted, ev.event)
+		as.Equal(1, ev.data.Before.ID)
+	})
+
+	t.Run("rejects expired `Last-Event-ID`", func(tt *testing.T) {
+		as := assert.New(tt)
+		r, _ := http.NewRequest(http.MethodGet, srv.URL+"/employees/events", nil)
+		r.Header.Set("Last-Event-ID", "99")
+		resp, err := http.DefaultClient.Do(r)
+		if as.NoError(err) {
+			as.Equal(http.StatusGone, resp.StatusCode)
+			resp.Body.Close()
+		}
+	})
+}
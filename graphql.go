@@ -0,0 +1,395 @@
+package ecrud
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/rs/zerolog"
+)
+
+// GraphQLPath is where NewHTTPServer serves GraphQL queries
+const GraphQLPath = "/graphql"
+
+// graphqlSchema mirrors the REST resources. Fields and arguments keep
+// their JSON names so that the error extensions name the same fields.
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	employee(id: ID!): Employee
+	"Lists employees like GET /employees; first defaults to 100, at most 1000."
+	employees(first: Int, offset: Int, after: String, sort: String, desc: Boolean, filter: EmployeeFilter): EmployeeConnection!
+}
+
+type Mutation {
+	createEmployee(input: EmployeeInput!): Employee!
+	"Changes only the fields present in input."
+	updateEmployee(id: ID!, input: EmployeeInput!): Employee!
+	deleteEmployee(id: ID!): ID!
+}
+
+type Employee {
+	id: ID!
+	firstName: String!
+	lastName: String!
+	dateOfBirth: String!
+	email: String!
+	isActive: Boolean
+	department: String
+	role: String
+	"The employee this one reports to."
+	managerId: ID
+	version: Int!
+}
+
+type EmployeeConnection {
+	nodes: [Employee!]!
+	"Number of records matching the filter across all pages."
+	totalCount: Int!
+	"Pass as after to fetch the next page, null on the last page."
+	nextCursor: String
+}
+
+input EmployeeFilter {
+	department: String
+	role: String
+	isActive: Boolean
+	dateOfBirthFrom: String
+	dateOfBirthTo: String
+	"Only the direct reports of that employee."
+	managerId: ID
+}
+
+input EmployeeInput {
+	firstName: String
+	lastName: String
+	dateOfBirth: String
+	email: String
+	isActive: Boolean
+	department: String
+	role: String
+	managerId: ID
+	"The version an update is based on, ignored on create."
+	version: Int
+	"Optional fields to reset to null on update."
+	clear: [String!]
+}
+`
+
+// NewGraphQLServer returns an http.Handler that executes GraphQL
+// requests, POSTed as JSON, against svc
+func NewGraphQLServer(svc Service, log *zerolog.Logger) http.Handler {
+	resolver := &graphqlResolver{
+		svc: svc,
+		log: log,
+	}
+	return &graphqlHandler{
+		schema: graphql.MustParseSchema(graphqlSchema, resolver),
+		log:    log,
+	}
+}
+
+type graphqlHandler struct {
+	schema *graphql.Schema
+	log    *zerolog.Logger
+}
+
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+func (hndlr *graphqlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p := NewProblem(err)
+		p.Instance = r.URL.Path
+		writeProblem(w, hndlr.log, p)
+		return
+	}
+
+	// errors, including the Service's, are reported in the response
+	// body with a 200 as is customary for GraphQL
+	resp := hndlr.schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		hndlr.log.Error().
+			Err(err).
+			Msg("response encoding failed")
+	}
+}
+
+// graphqlError carries the Problem a Service error maps onto, so that
+// GraphQL clients can branch on the same codes as REST clients
+type graphqlError struct {
+	p Problem
+}
+
+func (e graphqlError) Error() string {
+	return e.p.Detail
+}
+
+// Extensions is picked up by graphql-go and included in the error
+func (e graphqlError) Extensions() map[string]any {
+	ext := map[string]any{"code": e.p.Code}
+	if len(e.p.Fields) > 0 {
+		ext["fields"] = e.p.Fields
+		ext["invalidParams"] = e.p.InvalidParams
+	}
+	if e.p.ID != nil {
+		ext["id"] = *e.p.ID
+	}
+	if e.p.Version != nil {
+		ext["version"] = *e.p.Version
+	}
+
+	return ext
+}
+
+type graphqlResolver struct {
+	svc Service
+	log *zerolog.Logger
+}
+
+func (r *graphqlResolver) error(ctx context.Context, err error) error {
+	p := NewProblem(err)
+	if p.Status == http.StatusInternalServerError {
+		ctxLogger(ctx, r.log).Error().
+			Err(err).
+			Msg("request failed")
+	}
+
+	return graphqlError{p: p}
+}
+
+func (r *graphqlResolver) id(ctx context.Context, id graphql.ID) (int, error) {
+	n, err := strconv.Atoi(string(id))
+	if err != nil {
+		return 0, r.error(ctx, badRequest("id", ReasonMalformed))
+	}
+
+	return n, nil
+}
+
+// optionalID parses an optional ID argument named field
+func (r *graphqlResolver) optionalID(ctx context.Context, field string, id *graphql.ID) (*int, error) {
+	if id == nil {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(string(*id))
+	if err != nil {
+		return nil, r.error(ctx, badRequest(field, ReasonMalformed))
+	}
+
+	return &n, nil
+}
+
+func (r *graphqlResolver) Employee(ctx context.Context, args struct{ ID graphql.ID }) (*employeeResolver, error) {
+	id, err := r.id(ctx, args.ID)
+	if err != nil {
+		return nil, err
+	}
+	e, err := r.svc.Get(ctx, id)
+	if err != nil {
+		return nil, r.error(ctx, err)
+	}
+
+	return &employeeResolver{e}, nil
+}
+
+type graphqlEmployeeFilter struct {
+	Department      *string
+	Role            *string
+	IsActive        *bool
+	DateOfBirthFrom *string
+	DateOfBirthTo   *string
+	ManagerID       *graphql.ID
+}
+
+func (r *graphqlResolver) Employees(ctx context.Context, args struct {
+	First  *int32
+	Offset *int32
+	After  *string
+	Sort   *string
+	Desc   *bool
+	Filter *graphqlEmployeeFilter
+}) (*employeeConnectionResolver, error) {
+	opts := ListOptions{Limit: DefaultListLimit}
+	if args.First != nil {
+		opts.Limit = int(*args.First)
+	}
+	if args.Offset != nil {
+		opts.Offset = int(*args.Offset)
+	}
+	if args.After != nil {
+		opts.Cursor = *args.After
+	}
+	if args.Sort != nil {
+		opts.Sort = *args.Sort
+	}
+	if args.Desc != nil {
+		opts.Desc = *args.Desc
+	}
+	if f := args.Filter; f != nil {
+		opts.Department = f.Department
+		opts.Role = f.Role
+		opts.IsActive = f.IsActive
+		opts.DateOfBirthFrom = f.DateOfBirthFrom
+		opts.DateOfBirthTo = f.DateOfBirthTo
+		managerID, err := r.optionalID(ctx, "managerId", f.ManagerID)
+		if err != nil {
+			return nil, err
+		}
+		opts.ManagerID = managerID
+	}
+
+	page, err := r.svc.List(ctx, opts)
+	if err != nil {
+		return nil, r.error(ctx, err)
+	}
+
+	return &employeeConnectionResolver{page}, nil
+}
+
+type graphqlEmployeeInput struct {
+	FirstName   *string
+	LastName    *string
+	DateOfBirth *string
+	Email       *string
+	IsActive    *bool
+	Department  *string
+	Role        *string
+	ManagerID   *graphql.ID
+	Version     *int32
+	Clear       *[]string
+}
+
+func (r *graphqlResolver) attrs(ctx context.Context, in graphqlEmployeeInput) (EmployeeAttrs, error) {
+	managerID, err := r.optionalID(ctx, "managerId", in.ManagerID)
+	if err != nil {
+		return EmployeeAttrs{}, err
+	}
+	attrs := EmployeeAttrs{
+		FirstName:   in.FirstName,
+		LastName:    in.LastName,
+		DateOfBirth: in.DateOfBirth,
+		Email:       in.Email,
+		IsActive:    in.IsActive,
+		Department:  in.Department,
+		Role:        in.Role,
+		ManagerID:   managerID,
+	}
+	if in.Version != nil {
+		v := int(*in.Version)
+		attrs.Version = &v
+	}
+	if in.Clear != nil {
+		attrs.Clear = *in.Clear
+	}
+
+	return attrs, nil
+}
+
+func (r *graphqlResolver) CreateEmployee(ctx context.Context, args struct{ Input graphqlEmployeeInput }) (*employeeResolver, error) {
+	attrs, err := r.attrs(ctx, args.Input)
+	if err != nil {
+		return nil, err
+	}
+	id, err := r.svc.Create(ctx, attrs)
+	if err != nil {
+		return nil, r.error(ctx, err)
+	}
+	e, err := r.svc.Get(ctx, id)
+	if err != nil {
+		return nil, r.error(ctx, err)
+	}
+
+	return &employeeResolver{e}, nil
+}
+
+func (r *graphqlResolver) UpdateEmployee(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input graphqlEmployeeInput
+}) (*employeeResolver, error) {
+	id, err := r.id(ctx, args.ID)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := r.attrs(ctx, args.Input)
+	if err != nil {
+		return nil, err
+	}
+	e, err := r.svc.Update(ctx, id, attrs)
+	if err != nil {
+		return nil, r.error(ctx, err)
+	}
+
+	return &employeeResolver{e}, nil
+}
+
+func (r *graphqlResolver) DeleteEmployee(ctx context.Context, args struct{ ID graphql.ID }) (graphql.ID, error) {
+	id, err := r.id(ctx, args.ID)
+	if err != nil {
+		return "", err
+	}
+	if err = r.svc.Delete(ctx, id); err != nil {
+		return "", r.error(ctx, err)
+	}
+
+	return args.ID, nil
+}
+
+type employeeResolver struct {
+	e Employee
+}
+
+func (r *employeeResolver) ID() graphql.ID      { return graphql.ID(strconv.Itoa(r.e.ID)) }
+func (r *employeeResolver) FirstName() string   { return r.e.FirstName }
+func (r *employeeResolver) LastName() string    { return r.e.LastName }
+func (r *employeeResolver) DateOfBirth() string { return r.e.DateOfBirth }
+func (r *employeeResolver) Email() string       { return r.e.Email }
+func (r *employeeResolver) IsActive() *bool     { return r.e.IsActive }
+func (r *employeeResolver) Department() *string { return r.e.Department }
+func (r *employeeResolver) Role() *string       { return r.e.Role }
+func (r *employeeResolver) Version() int32      { return int32(r.e.Version) }
+
+func (r *employeeResolver) ManagerID() *graphql.ID {
+	if r.e.ManagerID == nil {
+		return nil
+	}
+	id := graphql.ID(strconv.Itoa(*r.e.ManagerID))
+
+	return &id
+}
+
+type employeeConnectionResolver struct {
+	page EmployeePage
+}
+
+func (r *employeeConnectionResolver) Nodes() []*employeeResolver {
+	nodes := make([]*employeeResolver, len(r.page.Employees))
+	for i, e := range r.page.Employees {
+		nodes[i] = &employeeResolver{e}
+	}
+
+	return nodes
+}
+
+func (r *employeeConnectionResolver) TotalCount() int32 {
+	return int32(r.page.Total)
+}
+
+func (r *employeeConnectionResolver) NextCursor() *string {
+	if r.page.NextCursor == "" {
+		return nil
+	}
+
+	return &r.page.NextCursor
+}
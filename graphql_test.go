@@ -0,0 +1,190 @@
+package ecrud_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+)
+
+func TestGraphQL(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	dept := "Engineering"
+	stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+		1: {
+			FirstName:   "David",
+			LastName:    "Ebreo",
+			DateOfBirth: "2001-04-15",
+			Email:       "hire@me.com",
+			Department:  &dept,
+		},
+	}, &log)
+	svc := ecrud.NewServiceValidationMiddleware(stub, &log)
+	hndlr := ecrud.NewHTTPServer(svc, &log)
+
+	type gqlError struct {
+		Message    string         `json:"message"`
+		Path       []any          `json:"path"`
+		Extensions map[string]any `json:"extensions"`
+	}
+	do := func(query string, variables map[string]any, data any) []gqlError {
+		body, _ := json.Marshal(map[string]any{"query": query, "variables": variables})
+		r := httptest.NewRequest(http.MethodPost, ecrud.GraphQLPath, bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		hndlr.ServeHTTP(w, r)
+		resp := struct {
+			Data   json.RawMessage `json:"data"`
+			Errors []gqlError      `json:"errors"`
+		}{}
+		if err := json.NewDecoder(w.Result().Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if data != nil && len(resp.Data) > 0 {
+			if err := json.Unmarshal(resp.Data, data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.Errors
+	}
+
+	t.Run("queries select fields", func(tt *testing.T) {
+		as := assert.New(tt)
+		data := struct {
+			Employee map[string]any `json:"employee"`
+		}{}
+		errs := do(`query($id: ID!) { employee(id: $id) { email department } }`, map[string]any{"id": "1"}, &data)
+		as.Empty(errs)
+		as.Equal(map[string]any{"email": "hire@me.com", "department": dept}, data.Employee)
+
+		errs = do(`{ employee(id: 99) { id } }`, nil, &data)
+		as.Nil(data.Employee)
+		if as.Len(errs, 1) {
+			as.Equal(ecrud.CodeNotFound, errs[0].Extensions["code"])
+		}
+	})
+
+	t.Run("mutations resolve through Service", func(tt *testing.T) {
+		as := assert.New(tt)
+		data := struct {
+			CreateEmployee struct {
+				ID      string `json:"id"`
+				Version int    `json:"version"`
+			} `json:"createEmployee"`
+		}{}
+		errs := do(`mutation($in: EmployeeInput!) { createEmployee(input: $in) { id version } }`, map[string]any{
+			"in": map[string]any{
+				"firstName":   "Tim",
+				"lastName":    "Cook",
+				"dateOfBirth": "1960-11-01",
+				"email":       "tim@apple.com",
+				"department":  dept,
+			},
+		}, &data)
+		as.Empty(errs)
+		as.Equal(1, data.CreateEmployee.Version)
+
+		errs = do(`mutation($id: ID!) { updateEmployee(id: $id, input: {role: "CEO", version: 1, clear: ["department"]}) { role } }`,
+			map[string]any{"id": data.CreateEmployee.ID}, nil)
+		as.Empty(errs)
+		e, err := svc.Get(ctx, 2)
+		as.NoError(err)
+		as.Equal("CEO", *e.Role)
+		as.Nil(e.Department)
+
+		errs = do(`mutation { deleteEmployee(id: 2) }`, nil, nil)
+		as.Empty(errs)
+		_, err = svc.Get(ctx, 2)
+		as.ErrorAs(err, &ecrud.ErrNotFound{})
+	})
+
+	t.Run("lists filter and page", func(tt *testing.T) {
+		as := assert.New(tt)
+		fn, ln, dob, em := "Phil", "Schiller", "1960-07-08", "phil@apple.com"
+		_, err := svc.Create(ctx, ecrud.EmployeeAttrs{
+			FirstName:   &fn,
+			LastName:    &ln,
+			DateOfBirth: &dob,
+			Email:       &em,
+			Department:  &dept,
+		})
+		as.NoError(err)
+
+		type page struct {
+			Employees struct {
+				Nodes []struct {
+					Email string `json:"email"`
+				} `json:"nodes"`
+				TotalCount int     `json:"totalCount"`
+				NextCursor *string `json:"nextCursor"`
+			} `json:"employees"`
+		}
+		query := `query($after: String) {
+			employees(first: 1, after: $after, sort: "email", filter: {department: "Engineering"}) {
+				nodes { email } totalCount nextCursor
+			}
+		}`
+		first := page{}
+		as.Empty(do(query, nil, &first))
+		as.Equal(2, first.Employees.TotalCount)
+		if as.Len(first.Employees.Nodes, 1) && as.NotNil(first.Employees.NextCursor) {
+			as.Equal("hire@me.com", first.Employees.Nodes[0].Email)
+
+			second := page{}
+			as.Empty(do(query, map[string]any{"after": *first.Employees.NextCursor}, &second))
+			if as.Len(second.Employees.Nodes, 1) {
+				as.Equal("phil@apple.com", second.Employees.Nodes[0].Email)
+			}
+			as.Nil(second.Employees.NextCursor)
+		}
+	})
+
+	t.Run("sets, reads and filters by manager", func(tt *testing.T) {
+		as := assert.New(tt)
+		errs := do(`mutation { createEmployee(input: {firstName: "Craig", lastName: "Federighi", dateOfBirth: "1969-05-27", email: "craig@apple.com", managerId: "1"}) { id } }`, nil, nil)
+		as.Empty(errs)
+
+		data := struct {
+			Employees struct {
+				Nodes []struct {
+					Email     string `json:"email"`
+					ManagerID string `json:"managerId"`
+				} `json:"nodes"`
+			} `json:"employees"`
+		}{}
+		as.Empty(do(`{ employees(filter: {managerId: "1"}) { nodes { email managerId } } }`, nil, &data))
+		if as.Len(data.Employees.Nodes, 1) {
+			as.Equal("craig@apple.com", data.Employees.Nodes[0].Email)
+			as.Equal("1", data.Employees.Nodes[0].ManagerID)
+		}
+
+		errs = do(`{ employees(filter: {managerId: "one"}) { totalCount } }`, nil, nil)
+		if as.Len(errs, 1) {
+			as.Equal([]any{"managerId"}, errs[0].Extensions["fields"])
+		}
+	})
+
+	t.Run("returns rejected fields as error extensions", func(tt *testing.T) {
+		as := assert.New(tt)
+		errs := do(`mutation { createEmployee(input: {firstName: "Tim", email: "hire.me.com"}) { id } }`, nil, nil)
+		if as.Len(errs, 1) {
+			as.Equal([]any{"createEmployee"}, errs[0].Path)
+			as.Equal(ecrud.CodeInvalidParams, errs[0].Extensions["code"])
+			as.ElementsMatch([]any{"lastName", "dateOfBirth", "email"}, errs[0].Extensions["fields"])
+			as.Contains(errs[0].Extensions["invalidParams"], map[string]any{"name": "email", "reason": ecrud.ReasonMalformed})
+		}
+
+		errs = do(`{ employees(first: 5000) { totalCount } }`, nil, nil)
+		if as.Len(errs, 1) {
+			as.Equal([]any{"limit"}, errs[0].Extensions["fields"])
+		}
+	})
+}
@@ -0,0 +1,304 @@
+package ecrud
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ecrudpb/employee.proto
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+
+	"github.com/arhyth/ecrud/ecrudpb"
+)
+
+// NewGRPCServer returns a grpc.Server that serves the EmployeeService
+// defined in ecrudpb/employee.proto. Pass it the same Service chain as
+// NewHTTPServer so that both transports validate alike.
+func NewGRPCServer(svc Service, log *zerolog.Logger, opts ...grpc.ServerOption) *grpc.Server {
+	srv := &grpcServer{
+		svc: svc,
+		log: log,
+	}
+	opts = append([]grpc.ServerOption{grpc.ChainUnaryInterceptor(srv.requestLogger)}, opts...)
+	gs := grpc.NewServer(opts...)
+	ecrudpb.RegisterEmployeeServiceServer(gs, srv)
+
+	return gs
+}
+
+// grpcServer implements ecrudpb.EmployeeServiceServer for each of the
+// inner Service methods
+type grpcServer struct {
+	ecrudpb.UnimplementedEmployeeServiceServer
+	svc Service
+	log *zerolog.Logger
+}
+
+// requestLogger attaches a logger tagged with the request ID, taken from
+// the x-request-id metadata if the caller sent one, like the HTTP
+// server does.
+func (srv *grpcServer) requestLogger(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	reqID := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get("x-request-id"); len(ids) > 0 {
+			reqID = ids[0]
+		}
+	}
+	if reqID == "" {
+		reqID = strconv.FormatUint(middleware.NextRequestID(), 10)
+	}
+	logr := srv.log.With().
+		Str("requestID", reqID).
+		Str("rpc", info.FullMethod).
+		Logger()
+	// under the same key as HTTP requests, for the audit log
+	ctx = context.WithValue(ctx, middleware.RequestIDKey, reqID)
+
+	return handler(logr.WithContext(ctx), req)
+}
+
+// GRPCAuthentication requires every call to be authenticated by one of
+// auths, tried in order, and attaches the principal to the call
+// context. Credentials are read from the metadata under the same names
+// as the HTTP headers, ie. x-api-key or authorization. Calls are
+// rejected with Unauthenticated when none of auths finds credentials.
+func GRPCAuthentication(auths ...Authenticator) grpc.ServerOption {
+	return grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		// the authenticators read credentials off an HTTP request
+		r := &http.Request{Header: http.Header{}}
+		md, _ := metadata.FromIncomingContext(ctx)
+		for key, values := range md {
+			for _, v := range values {
+				r.Header.Add(key, v)
+			}
+		}
+		p, err := authenticate(r, auths)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		ctx = ContextWithPrincipal(ctx, p)
+		logr := zerolog.Ctx(ctx).With().
+			Str("principal", p.Subject).
+			Logger()
+
+		return handler(logr.WithContext(ctx), req)
+	})
+}
+
+func (srv *grpcServer) ListEmployees(ctx context.Context, req *ecrudpb.ListEmployeesRequest) (*ecrudpb.ListEmployeesResponse, error) {
+	opts := ListOptions{
+		Limit:           int(req.GetLimit()),
+		Offset:          int(req.GetOffset()),
+		Cursor:          req.GetCursor(),
+		Sort:            req.GetSort(),
+		Desc:            req.GetDesc(),
+		Department:      req.Department,
+		Role:            req.Role,
+		IsActive:        req.IsActive,
+		DateOfBirthFrom: req.DateOfBirthFrom,
+		DateOfBirthTo:   req.DateOfBirthTo,
+		ManagerID:       intPtrFromProto(req.ManagerId),
+	}
+	// like a missing query parameter, 0 asks for the default page size
+	if opts.Limit == 0 {
+		opts.Limit = DefaultListLimit
+	}
+	page, err := srv.svc.List(ctx, opts)
+	if err != nil {
+		return nil, srv.status(ctx, err, "")
+	}
+
+	resp := &ecrudpb.ListEmployeesResponse{
+		Employees:  make([]*ecrudpb.Employee, len(page.Employees)),
+		Total:      int32(page.Total),
+		NextCursor: page.NextCursor,
+	}
+	for i, e := range page.Employees {
+		resp.Employees[i] = employeeProto(e)
+	}
+
+	return resp, nil
+}
+
+func (srv *grpcServer) GetEmployee(ctx context.Context, req *ecrudpb.GetEmployeeRequest) (*ecrudpb.Employee, error) {
+	e, err := srv.svc.Get(ctx, int(req.GetId()))
+	if err != nil {
+		return nil, srv.status(ctx, err, "")
+	}
+
+	return employeeProto(e), nil
+}
+
+func (srv *grpcServer) CreateEmployee(ctx context.Context, req *ecrudpb.CreateEmployeeRequest) (*ecrudpb.CreateEmployeeResponse, error) {
+	id, err := srv.svc.Create(ctx, employeeAttrsFromProto(req.GetEmployee()))
+	if err != nil {
+		return nil, srv.status(ctx, err, "employee")
+	}
+
+	return &ecrudpb.CreateEmployeeResponse{Id: int64(id)}, nil
+}
+
+func (srv *grpcServer) UpdateEmployee(ctx context.Context, req *ecrudpb.UpdateEmployeeRequest) (*ecrudpb.Employee, error) {
+	e, err := srv.svc.Update(ctx, int(req.GetId()), employeeAttrsFromProto(req.GetEmployee()))
+	if err != nil {
+		return nil, srv.status(ctx, err, "employee")
+	}
+
+	return employeeProto(e), nil
+}
+
+func (srv *grpcServer) DeleteEmployee(ctx context.Context, req *ecrudpb.DeleteEmployeeRequest) (*ecrudpb.DeleteEmployeeResponse, error) {
+	if err := srv.svc.Delete(ctx, int(req.GetId())); err != nil {
+		return nil, srv.status(ctx, err, "")
+	}
+
+	return &ecrudpb.DeleteEmployeeResponse{}, nil
+}
+
+func employeeProto(e Employee) *ecrudpb.Employee {
+	return &ecrudpb.Employee{
+		Id:          int64(e.ID),
+		FirstName:   e.FirstName,
+		LastName:    e.LastName,
+		DateOfBirth: e.DateOfBirth,
+		Email:       e.Email,
+		IsActive:    e.IsActive,
+		Department:  e.Department,
+		Role:        e.Role,
+		Version:     int64(e.Version),
+		ManagerId:   int64PtrToProto(e.ManagerID),
+	}
+}
+
+func employeeAttrsFromProto(pb *ecrudpb.EmployeeAttrs) EmployeeAttrs {
+	if pb == nil {
+		// validation reports the missing fields
+		return EmployeeAttrs{}
+	}
+	attrs := EmployeeAttrs{
+		FirstName:   pb.FirstName,
+		LastName:    pb.LastName,
+		DateOfBirth: pb.DateOfBirth,
+		Email:       pb.Email,
+		IsActive:    pb.IsActive,
+		Department:  pb.Department,
+		Role:        pb.Role,
+		ManagerID:   intPtrFromProto(pb.ManagerId),
+		Clear:       pb.GetClear(),
+	}
+	attrs.Version = intPtrFromProto(pb.Version)
+
+	return attrs
+}
+
+func intPtrFromProto(v *int64) *int {
+	if v == nil {
+		return nil
+	}
+	i := int(*v)
+
+	return &i
+}
+
+func int64PtrToProto(v *int) *int64 {
+	if v == nil {
+		return nil
+	}
+	i := int64(*v)
+
+	return &i
+}
+
+// status maps err onto a gRPC status. Rejected fields are reported as
+// field violations named after the proto fields, relative to parent
+// when the fields are nested in a message.
+func (srv *grpcServer) status(ctx context.Context, err error, parent string) error {
+	var (
+		errnf ErrNotFound
+		errbr ErrBadRequest
+		errcf ErrConflict
+		errhr ErrHasReports
+		errfb ErrForbidden
+		errua ErrUnauthenticated
+	)
+	switch {
+	case errors.As(err, &errnf):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.As(err, &errbr):
+		br := &errdetails.BadRequest{}
+		for _, fe := range errbr.Errors {
+			field := protoFieldName(fe.Field)
+			if parent != "" {
+				field = parent + "." + field
+			}
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       field,
+				Description: fe.Reason,
+			})
+		}
+		return statusWithDetails(codes.InvalidArgument, errbr.Detail(), br)
+	case errors.As(err, &errcf):
+		return statusWithDetails(codes.Aborted, err.Error(), &errdetails.ErrorInfo{
+			Reason: strings.ToUpper(CodeVersionConflict),
+			Domain: "ecrud",
+			Metadata: map[string]string{
+				"id":      strconv.Itoa(errcf.ID),
+				"version": strconv.Itoa(errcf.Version),
+			},
+		})
+	case errors.As(err, &errhr):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.As(err, &errfb):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.As(err, &errua):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "request timed out")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "request canceled")
+	default:
+		ctxLogger(ctx, srv.log).Error().
+			Err(err).
+			Msg("request failed")
+		return status.Error(codes.Internal, ErrServerError.Error())
+	}
+}
+
+// statusWithDetails falls back to a status without details in the
+// unlikely case that they cannot be encoded
+func statusWithDetails(code codes.Code, msg string, details ...protoadapt.MessageV1) error {
+	st := status.New(code, msg)
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		return withDetails.Err()
+	}
+
+	return st.Err()
+}
+
+// protoFieldName turns a JSON field name into its proto counterpart,
+// ie. "dateOfBirth" into "date_of_birth"
+func protoFieldName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
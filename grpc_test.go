@@ -0,0 +1,214 @@
+package ecrud_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/arhyth/ecrud"
+	"github.com/arhyth/ecrud/ecrudpb"
+)
+
+func TestGRPCServer(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+		1: {
+			FirstName:   "David",
+			LastName:    "Ebreo",
+			DateOfBirth: "2001-04-15",
+			Email:       "hire@me.com",
+		},
+	}, &log)
+	svc := ecrud.NewServiceValidationMiddleware(stub, &log)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := ecrud.NewGRPCServer(svc, &log)
+	go srv.Serve(lis)
+	defer srv.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := ecrudpb.NewEmployeeServiceClient(conn)
+
+	t.Run("serves CRUD and List", func(tt *testing.T) {
+		as := assert.New(tt)
+		created, err := client.CreateEmployee(ctx, &ecrudpb.CreateEmployeeRequest{
+			Employee: &ecrudpb.EmployeeAttrs{
+				FirstName:   proto.String("Tim"),
+				LastName:    proto.String("Cook"),
+				DateOfBirth: proto.String("1960-11-01"),
+				Email:       proto.String("tim@apple.com"),
+			},
+		})
+		as.NoError(err)
+
+		e, err := client.UpdateEmployee(ctx, &ecrudpb.UpdateEmployeeRequest{
+			Id:       created.GetId(),
+			Employee: &ecrudpb.EmployeeAttrs{Role: proto.String("CEO"), Version: proto.Int64(1)},
+		})
+		as.NoError(err)
+		as.Equal("CEO", e.GetRole())
+		as.Equal(int64(2), e.GetVersion())
+
+		e, err = client.GetEmployee(ctx, &ecrudpb.GetEmployeeRequest{Id: created.GetId()})
+		as.NoError(err)
+		as.Equal("Tim", e.GetFirstName())
+
+		page, err := client.ListEmployees(ctx, &ecrudpb.ListEmployeesRequest{Limit: 1})
+		as.NoError(err)
+		as.Equal(int32(2), page.GetTotal())
+		as.Len(page.GetEmployees(), 1)
+		as.NotEmpty(page.GetNextCursor())
+
+		_, err = client.DeleteEmployee(ctx, &ecrudpb.DeleteEmployeeRequest{Id: created.GetId()})
+		as.NoError(err)
+	})
+
+	t.Run("sets, reads and filters by manager", func(tt *testing.T) {
+		as := assert.New(tt)
+		created, err := client.CreateEmployee(ctx, &ecrudpb.CreateEmployeeRequest{
+			Employee: &ecrudpb.EmployeeAttrs{
+				FirstName:   proto.String("Craig"),
+				LastName:    proto.String("Federighi"),
+				DateOfBirth: proto.String("1969-05-27"),
+				Email:       proto.String("craig@apple.com"),
+				ManagerId:   proto.Int64(1),
+			},
+		})
+		if !as.NoError(err) {
+			return
+		}
+		e, err := client.GetEmployee(ctx, &ecrudpb.GetEmployeeRequest{Id: created.GetId()})
+		if as.NoError(err) {
+			as.Equal(int64(1), e.GetManagerId())
+		}
+		page, err := client.ListEmployees(ctx, &ecrudpb.ListEmployeesRequest{ManagerId: proto.Int64(1)})
+		if as.NoError(err) && as.Len(page.GetEmployees(), 1) {
+			as.Equal(created.GetId(), page.GetEmployees()[0].GetId())
+		}
+
+		_, err = client.UpdateEmployee(ctx, &ecrudpb.UpdateEmployeeRequest{
+			Id:       created.GetId(),
+			Employee: &ecrudpb.EmployeeAttrs{Clear: []string{"managerId"}},
+		})
+		as.NoError(err)
+		page, err = client.ListEmployees(ctx, &ecrudpb.ListEmployeesRequest{ManagerId: proto.Int64(1)})
+		if as.NoError(err) {
+			as.Empty(page.GetEmployees())
+		}
+	})
+
+	t.Run("maps errors onto status codes", func(tt *testing.T) {
+		as := assert.New(tt)
+		_, err := client.GetEmployee(ctx, &ecrudpb.GetEmployeeRequest{Id: 99})
+		as.Equal(codes.NotFound, status.Code(err))
+
+		_, err = client.UpdateEmployee(ctx, &ecrudpb.UpdateEmployeeRequest{
+			Id:       1,
+			Employee: &ecrudpb.EmployeeAttrs{Role: proto.String("CTO"), Version: proto.Int64(7)},
+		})
+		as.Equal(codes.Aborted, status.Code(err))
+	})
+
+	t.Run("reports rejected fields as field violations", func(tt *testing.T) {
+		as := assert.New(tt)
+		_, err := client.CreateEmployee(ctx, &ecrudpb.CreateEmployeeRequest{
+			Employee: &ecrudpb.EmployeeAttrs{
+				FirstName:   proto.String("Tim"),
+				LastName:    proto.String("Cook"),
+				DateOfBirth: proto.String("11/01/1960"),
+			},
+		})
+		st := status.Convert(err)
+		as.Equal(codes.InvalidArgument, st.Code())
+		violations := map[string]string{}
+		for _, d := range st.Details() {
+			if br, ok := d.(*errdetails.BadRequest); ok {
+				for _, v := range br.GetFieldViolations() {
+					violations[v.GetField()] = v.GetDescription()
+				}
+			}
+		}
+		as.Equal(map[string]string{
+			"employee.date_of_birth": ecrud.ReasonMalformed,
+			"employee.email":         ecrud.ReasonRequired,
+		}, violations)
+
+		_, err = client.ListEmployees(ctx, &ecrudpb.ListEmployeesRequest{Limit: 5000, Sort: "salary"})
+		st = status.Convert(err)
+		as.Equal(codes.InvalidArgument, st.Code())
+		as.Len(st.Details(), 1)
+	})
+}
+
+func TestGRPCAuthentication(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+		1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+	}, &log)
+	svc := ecrud.NewServiceAuthorizationMiddleware(ecrud.NewServiceValidationMiddleware(stub, &log), &log)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := ecrud.NewGRPCServer(svc, &log, ecrud.GRPCAuthentication(
+		ecrud.NewAPIKeyAuthenticator(map[string]ecrud.Principal{
+			"reader": {Subject: "reader"},
+			"admin":  {Subject: "admin", Roles: []string{ecrud.RoleAdmin}},
+		}),
+	))
+	go srv.Serve(lis)
+	defer srv.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := ecrudpb.NewEmployeeServiceClient(conn)
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(ctx, "x-api-key", key)
+	}
+
+	t.Run("rejects calls without valid credentials", func(tt *testing.T) {
+		as := assert.New(tt)
+		_, err := client.GetEmployee(ctx, &ecrudpb.GetEmployeeRequest{Id: 1})
+		as.Equal(codes.Unauthenticated, status.Code(err))
+		_, err = client.GetEmployee(withKey("guess"), &ecrudpb.GetEmployeeRequest{Id: 1})
+		as.Equal(codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("authorizes calls as the authenticated principal", func(tt *testing.T) {
+		as := assert.New(tt)
+		e, err := client.GetEmployee(withKey("reader"), &ecrudpb.GetEmployeeRequest{Id: 1})
+		if as.NoError(err) {
+			as.Equal("David", e.GetFirstName())
+		}
+		_, err = client.DeleteEmployee(withKey("reader"), &ecrudpb.DeleteEmployeeRequest{Id: 1})
+		as.Equal(codes.PermissionDenied, status.Code(err))
+		_, err = client.DeleteEmployee(withKey("admin"), &ecrudpb.DeleteEmployeeRequest{Id: 1})
+		as.NoError(err)
+	})
+}
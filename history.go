@@ -0,0 +1,27 @@
+package ecrud
+
+import (
+	"sort"
+	"time"
+)
+
+// employeeVersion is the state of a record from At until the next
+// version. Records that predate history have a single version with a
+// zero At, taken to have always been as they are.
+type employeeVersion struct {
+	At       time.Time `json:"at"`
+	Employee Employee  `json:"employee"`
+}
+
+// versionAt returns the version of versions, in order, that was current
+// at t. found is false when the record did not exist yet.
+func versionAt(versions []employeeVersion, t time.Time) (e Employee, found bool) {
+	i := sort.Search(len(versions), func(i int) bool {
+		return versions[i].At.After(t)
+	})
+	if i == 0 {
+		return Employee{}, false
+	}
+
+	return versions[i-1].Employee, true
+}
@@ -1,187 +1,1356 @@
 package ecrud
 
 import (
+	"encoding/csv"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rs/zerolog"
 )
 
+// StatusClientClosedRequest is the non-standard status, borrowed from
+// nginx, recorded when the client cancels a request before a response
+// could be written.
+const StatusClientClosedRequest = 499
+
+// EventStreamContentType is the media type of Server-Sent Events
+const EventStreamContentType = "text/event-stream"
+
+// sseKeepAlive is how often an idle event stream gets a comment line,
+// so that proxies do not time it out
+var sseKeepAlive = 15 * time.Second
+
+// HTTPOption configures optional NewHTTPServer behavior
+type HTTPOption func(*httpHandler)
+
+// WithEventStream serves the events published to feed at
+// GET /employees/events. The route is not registered without it.
+func WithEventStream(feed *ChangeFeed) HTTPOption {
+	return func(hndlr *httpHandler) {
+		hndlr.feed = feed
+	}
+}
+
+// WithWebhookAdmin serves the management of hooks' subscriptions and
+// dead letters under /webhooks. The routes are not registered without
+// it.
+func WithWebhookAdmin(hooks *Webhooks) HTTPOption {
+	return func(hndlr *httpHandler) {
+		hndlr.hooks = hooks
+	}
+}
+
+// WithAuditLog serves the records of sink at GET /audit and
+// GET /employees/{id}/history. The routes are not registered without
+// it.
+func WithAuditLog(sink AuditSink) HTTPOption {
+	return func(hndlr *httpHandler) {
+		hndlr.audit = sink
+	}
+}
+
+// WithScheduler serves the changes pending in sched at
+// GET /employees/{id}/pending, and their cancellation. The routes are
+// not registered without it.
+func WithScheduler(sched *ServiceSchedulerMiddleware) HTTPOption {
+	return func(hndlr *httpHandler) {
+		hndlr.sched = sched
+	}
+}
+
+// WithDepartments serves the CRUD of depts under /departments, and
+// the members of each. The routes are not registered without it.
+func WithDepartments(depts *Departments) HTTPOption {
+	return func(hndlr *httpHandler) {
+		hndlr.depts = depts
+	}
+}
+
+// WithVisibilityPolicy masks the records of the change events streamed
+// at GET /employees/events as policy says for the caller. Records
+// returned by the Service are masked by ServiceVisibilityMiddleware.
+func WithVisibilityPolicy(policy VisibilityPolicy) HTTPOption {
+	return func(hndlr *httpHandler) {
+		hndlr.visibility = &policy
+	}
+}
+
+// WithAuthentication requires every request but those for the OpenAPI
+// document to be authenticated by one of auths, tried in order, and
+// attaches the principal to the request context. Requests are
+// rejected with 401 when none of auths finds credentials.
+func WithAuthentication(auths ...Authenticator) HTTPOption {
+	return func(hndlr *httpHandler) {
+		hndlr.auths = append(hndlr.auths, auths...)
+	}
+}
+
 // NewHTTPServer returns an http.Handler
 // that serves all the eCRUD endpoints
-func NewHTTPServer(svc Service, log *zerolog.Logger) http.Handler {
+func NewHTTPServer(svc Service, log *zerolog.Logger, opts ...HTTPOption) http.Handler {
 	hndlr := &httpHandler{
 		svc: svc,
 		log: log,
 	}
+	for _, opt := range opts {
+		opt(hndlr)
+	}
 	mux := chi.NewRouter()
+	mux.Use(middleware.RequestID, hndlr.requestLogger)
+	if len(hndlr.auths) > 0 {
+		mux.Use(hndlr.authenticate)
+	}
 	mux.NotFound(HTTPNotFound)
+	mux.MethodNotAllowed(HTTPMethodNotAllowed)
+	mux.Mount(scimBasePath, NewSCIMServer(svc, log))
+	mux.Method(http.MethodPost, GraphQLPath, NewGraphQLServer(svc, log))
+	mux.Post("/employees:batch", hndlr.Batch)
+	mux.Get("/employees.csv", hndlr.ExportCSV)
+	if hndlr.hooks != nil {
+		mux.Route("/webhooks", func(r chi.Router) {
+			if len(hndlr.auths) > 0 {
+				// webhooks receive every change, so only admins may
+				// manage them
+				r.Use(hndlr.requireRole(RoleAdmin))
+			}
+			r.Get("/", hndlr.ListWebhooks)
+			r.Post("/", hndlr.CreateWebhook)
+			r.Get("/dead-letters", hndlr.ListDeadLetters)
+			r.Post("/dead-letters/{deliveryID:[0-9]+}/replay", hndlr.ReplayDeadLetter)
+			r.Route("/{webhookID:[0-9]+}", func(rr chi.Router) {
+				rr.Get("/", hndlr.GetWebhook)
+				rr.Put("/", hndlr.UpdateWebhook)
+				rr.Delete("/", hndlr.DeleteWebhook)
+			})
+		})
+	}
+	if hndlr.audit != nil {
+		mux.Group(func(r chi.Router) {
+			if len(hndlr.auths) > 0 {
+				// audit records hold the changes of masked fields in full
+				r.Use(hndlr.requireRole(RoleAdmin, RoleHR))
+			}
+			r.Get("/audit", hndlr.Audit)
+			r.Get("/employees/{employeeID:[0-9]+}/history", hndlr.History)
+		})
+	}
+	if hndlr.sched != nil {
+		mux.Group(func(r chi.Router) {
+			if len(hndlr.auths) > 0 {
+				// pending changes hold the new values of masked fields
+				r.Use(hndlr.requireRole(RoleAdmin, RoleHR))
+			}
+			r.Get("/employees/{employeeID:[0-9]+}/pending", hndlr.ListPending)
+			r.Delete("/employees/{employeeID:[0-9]+}/pending/{changeID:[0-9]+}", hndlr.CancelPending)
+		})
+	}
+	if hndlr.depts != nil {
+		mux.Route("/departments", func(r chi.Router) {
+			r.Get("/", hndlr.ListDepartments)
+			r.Get("/{departmentID:[0-9]+}", hndlr.GetDepartment)
+			r.Get("/{departmentID:[0-9]+}/employees", hndlr.DepartmentEmployees)
+			r.Group(func(rw chi.Router) {
+				if len(hndlr.auths) > 0 {
+					rw.Use(hndlr.requireRole(RoleAdmin, RoleHR))
+				}
+				rw.Post("/", hndlr.CreateDepartment)
+				rw.Put("/{departmentID:[0-9]+}", hndlr.UpdateDepartment)
+				rw.Delete("/{departmentID:[0-9]+}", hndlr.DeleteDepartment)
+			})
+		})
+	}
 	mux.Route("/employees", func(r chi.Router) {
 		r.Get("/", hndlr.List)
 		r.Post("/", hndlr.Create)
+		r.Post("/import", hndlr.ImportCSV)
+		if hndlr.feed != nil {
+			r.Get("/events", hndlr.Events)
+		}
+		r.Post("/{employeeID:[0-9]+}:restore", hndlr.Restore)
 		r.Route("/{employeeID:[0-9]+}", func(rr chi.Router) {
 			rr.Get("/", hndlr.Get)
 			rr.Put("/", hndlr.Update)
+			rr.Patch("/", hndlr.Patch)
 			rr.Delete("/", hndlr.Delete)
+			rr.Get("/reports", hndlr.Reports)
+			rr.Get("/chain", hndlr.Chain)
+			rr.Get("/org", hndlr.Org)
+			rr.Get("/org.dot", hndlr.OrgDOT)
 		})
 	})
 
+	// the document is generated once all routes are registered,
+	// including its own
+	var spec []byte
+	mux.Get(OpenAPIPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	})
+	doc, err := newOpenAPIDocument(mux, len(hndlr.auths) > 0)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("OpenAPI document is incomplete")
+	}
+	if spec, err = json.Marshal(doc); err != nil {
+		log.Error().
+			Err(err).
+			Msg("OpenAPI document encoding failed")
+	}
+
 	return mux
 }
 
 // httpHandler implements net/http.HandlerFunc interfaces
 // for each of the inner Service methods
 type httpHandler struct {
-	svc Service
-	log *zerolog.Logger
+	svc   Service
+	log   *zerolog.Logger
+	feed  *ChangeFeed
+	hooks *Webhooks
+	audit AuditSink
+	sched *ServiceSchedulerMiddleware
+	depts *Departments
+	auths []Authenticator
+	// visibility masks streamed events when set
+	visibility *VisibilityPolicy
+}
+
+// requestLogger attaches a logger tagged with the request ID to the
+// request context so that the Service layer logs under the same ID.
+func (hndlr *httpHandler) requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logr := hndlr.log.With().
+			Str("requestID", middleware.GetReqID(r.Context())).
+			Logger()
+		next.ServeHTTP(w, r.WithContext(logr.WithContext(r.Context())))
+	})
+}
+
+// authenticate rejects requests that none of hndlr.auths authenticates
+// and tags the request logger with the principal of the others
+func (hndlr *httpHandler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == OpenAPIPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p, err := authenticate(r, hndlr.auths)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ecrud"`)
+			hndlr.WriteHTTPError(w, r, err)
+			return
+		}
+		ctx := ContextWithPrincipal(r.Context(), p)
+		logr := ctxLogger(ctx, hndlr.log).With().
+			Str("principal", p.Subject).
+			Logger()
+		next.ServeHTTP(w, r.WithContext(logr.WithContext(ctx)))
+	})
+}
+
+// requireRole forbids requests whose principal holds none of roles
+func (hndlr *httpHandler) requireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, _ := PrincipalFromContext(r.Context())
+			if !slices.ContainsFunc(roles, p.HasRole) {
+				hndlr.WriteHTTPError(w, r, ErrForbidden{Reason: "requires the " + strings.Join(roles, " or ") + " role"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 func (hndlr *httpHandler) List(w http.ResponseWriter, r *http.Request) {
-	employees := hndlr.svc.List()
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	page, err := hndlr.svc.List(r.Context(), opts)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+
+	// paging metadata travels in headers so the body stays a plain array
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		next := r.URL.Query()
+		next.Del("offset")
+		next.Set("cursor", page.NextCursor)
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+		w.Header().Set("Link", `<`+r.URL.Path+`?`+next.Encode()+`>; rel="next"`)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	err := json.NewEncoder(w).Encode(employees)
+	err = json.NewEncoder(w).Encode(page.Employees)
 	if err != nil {
 		hndlr.log.Error().
 			Err(err).
 			Msg("response encoding failed")
-		hndlr.WriteHTTPError(w, err)
+		hndlr.WriteHTTPError(w, r, err)
+	}
+}
+
+// parseListOptions reads ListOptions from the `GET /employees` query
+// string. Only malformed values are rejected here; range and
+// consistency checks belong to ServiceValidationMiddleware.
+func parseListOptions(q url.Values) (ListOptions, error) {
+	opts := ListOptions{
+		Limit:  DefaultListLimit,
+		Cursor: q.Get("cursor"),
+		Sort:   q.Get("sort"),
+	}
+
+	var ebr ErrBadRequest
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			ebr.Add("limit", ReasonMalformed)
+		}
+		opts.Limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			ebr.Add("offset", ReasonMalformed)
+		}
+		opts.Offset = n
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		ebr.Add("order", ReasonMalformed)
+	}
+	if q.Has("department") {
+		v := q.Get("department")
+		opts.Department = &v
+	}
+	if q.Has("role") {
+		v := q.Get("role")
+		opts.Role = &v
+	}
+	if q.Has("isActive") {
+		v, err := strconv.ParseBool(q.Get("isActive"))
+		if err != nil {
+			ebr.Add("isActive", ReasonMalformed)
+		}
+		opts.IsActive = &v
+	}
+	if q.Has("managerId") {
+		v, err := strconv.Atoi(q.Get("managerId"))
+		if err != nil {
+			ebr.Add("managerId", ReasonMalformed)
+		}
+		opts.ManagerID = &v
+	}
+	if q.Has("dateOfBirthFrom") {
+		v := q.Get("dateOfBirthFrom")
+		opts.DateOfBirthFrom = &v
+	}
+	if q.Has("dateOfBirthTo") {
+		v := q.Get("dateOfBirthTo")
+		opts.DateOfBirthTo = &v
+	}
+	if q.Has("includeDeleted") {
+		v, err := strconv.ParseBool(q.Get("includeDeleted"))
+		if err != nil {
+			ebr.Add("includeDeleted", ReasonMalformed)
+		}
+		opts.IncludeDeleted = v
+	}
+	if q.Has("asOf") {
+		t, err := time.Parse(time.RFC3339, q.Get("asOf"))
+		if err != nil {
+			ebr.Add("asOf", ReasonMalformed)
+		}
+		opts.AsOf = &t
+	}
+
+	if !ebr.Empty() {
+		return opts, ebr
+	}
+
+	return opts, nil
+}
+
+// parseGetOptions reads the options of `GET /employees/{id}` from its
+// query string
+func parseGetOptions(q url.Values) ([]GetOption, error) {
+	var (
+		opts []GetOption
+		ebr  ErrBadRequest
+	)
+	if q.Has("includeDeleted") {
+		v, err := strconv.ParseBool(q.Get("includeDeleted"))
+		if err != nil {
+			ebr.Add("includeDeleted", ReasonMalformed)
+		} else if v {
+			opts = append(opts, WithDeleted())
+		}
+	}
+	if q.Has("asOf") {
+		t, err := time.Parse(time.RFC3339, q.Get("asOf"))
+		if err != nil {
+			ebr.Add("asOf", ReasonMalformed)
+		} else {
+			opts = append(opts, AsOf(t))
+		}
+	}
+
+	if !ebr.Empty() {
+		return nil, ebr
 	}
+
+	return opts, nil
 }
 
 func (hndlr *httpHandler) Get(w http.ResponseWriter, r *http.Request) {
-	idstr := chi.URLParam(r, "employeeID")
-	id, err := strconv.Atoi(idstr)
+	id, err := employeeID(r)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	opts, err := parseGetOptions(r.URL.Query())
 	if err != nil {
-		hndlr.WriteHTTPError(w, err)
+		hndlr.WriteHTTPError(w, r, err)
 		return
 	}
-	employee, err := hndlr.svc.Get(id)
+	employee, err := hndlr.svc.Get(r.Context(), id, opts...)
 	if err != nil {
-		hndlr.WriteHTTPError(w, err)
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(employee.Version))
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagListMatches(inm, employee.Version, false) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(employee)
 	if err != nil {
-		hndlr.WriteHTTPError(w, err)
+		hndlr.WriteHTTPError(w, r, err)
 	}
 }
 
 func (hndlr *httpHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var attrs EmployeeAttrs
-	err := json.NewDecoder(r.Body).Decode(&attrs)
+	err := decodeJSON(r, &attrs)
 	if err != nil {
-		hndlr.WriteHTTPError(w, err)
+		hndlr.WriteHTTPError(w, r, err)
 		return
 	}
-	id, err := hndlr.svc.Create(attrs)
+	id, err := hndlr.svc.Create(r.Context(), attrs)
 	if err != nil {
-		hndlr.WriteHTTPError(w, err)
+		hndlr.WriteHTTPError(w, r, err)
 		return
 	}
 
-	resp := map[string]int{
-		"id": id,
-	}
-	w.WriteHeader(http.StatusCreated)
+	resp := idResponse{ID: id}
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
 	err = json.NewEncoder(w).Encode(resp)
 	if err != nil {
 		hndlr.log.Error().
 			Err(err).
 			Msg("response encoding failed")
-		hndlr.WriteHTTPError(w, err)
+		hndlr.WriteHTTPError(w, r, err)
 	}
 }
 
 func (hndlr *httpHandler) Update(w http.ResponseWriter, r *http.Request) {
-	idstr := chi.URLParam(r, "employeeID")
-	id, err := strconv.Atoi(idstr)
+	id, err := employeeID(r)
 	if err != nil {
-		hndlr.WriteHTTPError(w, err)
+		hndlr.WriteHTTPError(w, r, err)
 		return
 	}
 	var attrs EmployeeAttrs
-	err = json.NewDecoder(r.Body).Decode(&attrs)
+	err = decodeJSON(r, &attrs)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	if im := r.Header.Get("If-Match"); im != "" {
+		attrs.Version, err = hndlr.ifMatchVersion(r, id, im)
+		if err != nil {
+			hndlr.WriteHTTPError(w, r, err)
+			return
+		}
+	}
+	employee, err := hndlr.svc.Update(r.Context(), id, attrs)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(employee.Version))
+	if attrs.EffectiveAt != nil && attrs.EffectiveAt.After(time.Now()) {
+		// the record is returned as it is until the change takes effect
+		w.Header().Set("Location", "/employees/"+strconv.Itoa(id)+"/pending")
+		hndlr.writeJSON(w, r, http.StatusAccepted, employee)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(employee)
 	if err != nil {
-		hndlr.WriteHTTPError(w, err)
+		hndlr.log.Error().
+			Err(err).
+			Msg("response encoding failed")
+		hndlr.WriteHTTPError(w, r, err)
+	}
+}
+
+// ifMatchVersion turns an If-Match header into the version an update
+// must be based on. A nil version means any current version will do.
+func (hndlr *httpHandler) ifMatchVersion(r *http.Request, id int, header string) (*int, error) {
+	if strings.TrimSpace(header) == "*" {
+		return nil, nil
+	}
+	versions := parseETags(header, true)
+	if len(versions) == 1 {
+		return &versions[0], nil
+	}
+
+	// with several candidates, pin whichever one is current so the
+	// service still rejects a change that races with this request
+	current, err := hndlr.svc.Get(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range versions {
+		if v == current.Version {
+			return &v, nil
+		}
+	}
+
+	return nil, ErrConflict{ID: id, Version: current.Version}
+}
+
+// etag renders a record version as a strong entity tag
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseETags extracts the versions from a comma separated list of entity
+// tags. Weak tags are skipped when strong comparison is required, as
+// for If-Match; unparseable tags never match anything.
+func parseETags(header string, strong bool) []int {
+	var versions []int
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			if strong {
+				continue
+			}
+			tag = tag[2:]
+		}
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		v, err := strconv.Atoi(tag[1 : len(tag)-1])
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+
+	return versions
+}
+
+func etagListMatches(header string, version int, strong bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, v := range parseETags(header, strong) {
+		if v == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (hndlr *httpHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	id, err := employeeID(r)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	ct := r.Header.Get("Content-Type")
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil || (mt != MergePatchContentType && mt != JSONPatchContentType) {
+		hndlr.WriteHTTPError(w, r, ErrUnsupportedMediaType{
+			ContentType: ct,
+			Supported:   patchContentTypes,
+		})
+		return
+	}
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, ErrMalformedBody{Reason: err.Error()})
+		return
+	}
+
+	current, err := hndlr.svc.Get(r.Context(), id)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	if im := r.Header.Get("If-Match"); im != "" && !etagListMatches(im, current.Version, true) {
+		hndlr.WriteHTTPError(w, r, ErrConflict{ID: id, Version: current.Version})
 		return
 	}
-	err = hndlr.svc.Update(id, attrs)
+	// the patch is turned into a regular update so it goes through the
+	// same validation; attrs are pinned to the version just read
+	attrs, changed, err := patchAttrs(current, mt, patch)
 	if err != nil {
-		hndlr.WriteHTTPError(w, err)
+		hndlr.WriteHTTPError(w, r, err)
 		return
 	}
+	employee := current
+	if changed {
+		employee, err = hndlr.svc.Update(r.Context(), id, attrs)
+		if err != nil {
+			hndlr.WriteHTTPError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("ETag", etag(employee.Version))
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(attrs)
+	err = json.NewEncoder(w).Encode(employee)
 	if err != nil {
 		hndlr.log.Error().
 			Err(err).
 			Msg("response encoding failed")
-		hndlr.WriteHTTPError(w, err)
+		hndlr.WriteHTTPError(w, r, err)
+	}
+}
+
+// Restore answers with the restored record, like Get
+func (hndlr *httpHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	id, err := employeeID(r)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
 	}
+	employee, err := hndlr.svc.Restore(r.Context(), id)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(employee.Version))
+	hndlr.writeJSON(w, r, http.StatusOK, employee)
 }
 
 func (hndlr *httpHandler) Delete(w http.ResponseWriter, r *http.Request) {
-	idstr := chi.URLParam(r, "employeeID")
-	id, err := strconv.Atoi(idstr)
+	id, err := employeeID(r)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	err = hndlr.svc.Delete(r.Context(), id)
 	if err != nil {
-		hndlr.WriteHTTPError(w, err)
+		hndlr.WriteHTTPError(w, r, err)
 		return
 	}
-	err = hndlr.svc.Delete(id)
+	resp := idResponse{ID: id}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(resp)
 	if err != nil {
-		hndlr.WriteHTTPError(w, err)
+		hndlr.log.Error().
+			Err(err).
+			Msg("response encoding failed")
+		hndlr.WriteHTTPError(w, r, err)
+	}
+}
+
+// Batch applies a list of creates, updates and deletes all-or-nothing
+func (hndlr *httpHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	err := decodeJSON(r, &req)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
 		return
 	}
-	resp := map[string]int{
-		"id": id,
+	results, err := hndlr.svc.Batch(r.Context(), req)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
 	}
+
+	resp := batchResponse{Results: results}
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(resp)
 	if err != nil {
 		hndlr.log.Error().
 			Err(err).
 			Msg("response encoding failed")
-		hndlr.WriteHTTPError(w, err)
+		hndlr.WriteHTTPError(w, r, err)
+	}
+}
+
+// ExportCSV writes every record matching the `GET /employees` filters
+// as CSV. Paging parameters are ignored.
+func (hndlr *httpHandler) ExportCSV(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	opts.Limit, opts.Offset, opts.Cursor = MaxListLimit, 0, ""
+	// the first page is fetched before anything is written so that
+	// invalid filters still get a problem document
+	page, err := hndlr.svc.List(r.Context(), opts)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", CSVContentType+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="employees.csv"`)
+	cw := csv.NewWriter(w)
+	cw.Write(csvColumns)
+	for {
+		for _, e := range page.Employees {
+			cw.Write(employeeCSVRecord(e))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+		if page, err = hndlr.svc.List(r.Context(), opts); err != nil {
+			// too late for a problem document, truncate the export
+			ctxLogger(r.Context(), hndlr.log).Error().
+				Err(err).
+				Msg("export failed")
+			return
+		}
+	}
+	cw.Flush()
+	if err = cw.Error(); err != nil {
+		hndlr.log.Error().
+			Err(err).
+			Msg("response encoding failed")
 	}
 }
 
-func (hndlr *httpHandler) WriteHTTPError(w http.ResponseWriter, err error) {
-	var ne error
-	defer func() {
-		if ne != nil {
-			hndlr.log.Error().
-				Err(ne).
-				Msg("error response encoding failed")
+// ImportCSV creates a record for every row of a CSV body, all-or-nothing.
+// Columns are mapped to fields by header; `map=<header>:<field>` query
+// parameters override that, mapping to "-" skips a column.
+func (hndlr *httpHandler) ImportCSV(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var ebr ErrBadRequest
+	dryRun := false
+	if q.Has("dryRun") {
+		v, err := strconv.ParseBool(q.Get("dryRun"))
+		if err != nil {
+			ebr.Add("dryRun", ReasonMalformed)
+		}
+		dryRun = v
+	}
+	mapping := map[string]string{}
+	for _, m := range q["map"] {
+		i := strings.LastIndex(m, ":")
+		if i < 0 {
+			ebr.Add("map", ReasonMalformed)
+			continue
+		}
+		mapping[m[:i]] = m[i+1:]
+	}
+	if !ebr.Empty() {
+		hndlr.WriteHTTPError(w, r, ebr)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil || mt != CSVContentType {
+			hndlr.WriteHTTPError(w, r, ErrUnsupportedMediaType{
+				ContentType: ct,
+				Supported:   []string{CSVContentType},
+			})
+			return
 		}
-	}()
+	}
+
+	imp, err := parseCSVImport(r.Body, mapping)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	results, err := importCSV(r.Context(), hndlr.svc, imp, dryRun)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
 
+	resp := importResponse{
+		DryRun:  dryRun,
+		Results: results,
+	}
 	w.Header().Set("Content-Type", "application/json")
-	errnf := &ErrNotFound{}
-	errbr := &ErrBadRequest{}
-	if errors.As(err, errnf) {
-		w.WriteHeader(http.StatusNotFound)
-		ne = json.NewEncoder(w).Encode(errnf)
-	} else if errors.As(err, errbr) {
-		w.WriteHeader(http.StatusBadRequest)
-		ne = json.NewEncoder(w).Encode(errbr)
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		hndlr.log.Error().
+			Err(err).
+			Msg("response encoding failed")
+		hndlr.WriteHTTPError(w, r, err)
+	}
+}
+
+// Events streams change events as Server-Sent Events, each with its
+// sequence number as ID. Clients resume after a disconnect by sending
+// the last ID they received as Last-Event-ID, or as the lastEventId
+// query parameter since browsers cannot set headers on the first
+// request.
+func (hndlr *httpHandler) Events(w http.ResponseWriter, r *http.Request) {
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventId")
+	}
+	var sub *ChangeSubscription
+	if lastID == "" {
+		sub = hndlr.feed.Subscribe()
 	} else {
-		w.WriteHeader(http.StatusInternalServerError)
-		resp := map[string]string{
-			"message": "server error",
+		after, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			hndlr.WriteHTTPError(w, r, badRequest("Last-Event-ID", ReasonMalformed))
+			return
+		}
+		if sub, err = hndlr.feed.Resume(after); err != nil {
+			hndlr.WriteHTTPError(w, r, err)
+			return
+		}
+	}
+	defer sub.Close()
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", EventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	mask := func(ev ChangeEvent) ChangeEvent {
+		if hndlr.visibility == nil {
+			return ev
+		}
+		return hndlr.visibility.maskEvent(r.Context(), ev)
+	}
+	for _, ev := range sub.Backlog {
+		if err := writeEvent(w, mask(ev)); err != nil {
+			return
+		}
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				// dropped for falling behind; the client resumes
+				// from the last event it got
+				return
+			}
+			err = writeEvent(w, mask(ev))
+		case <-keepAlive.C:
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+		}
+		if err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
 		}
-		ne = json.NewEncoder(w).Encode(resp)
 	}
 }
 
-func HTTPNotFound(w http.ResponseWriter, r *http.Request) {
+func writeEvent(w io.Writer, ev ChangeEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Type, data)
+
+	return err
+}
+
+func (hndlr *httpHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := hndlr.hooks.List(r.Context())
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, hooks)
+}
+
+func (hndlr *httpHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var attrs WebhookAttrs
+	if err := decodeJSON(r, &attrs); err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hook, err := hndlr.hooks.Create(r.Context(), attrs)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/webhooks/"+strconv.Itoa(hook.ID))
+	hndlr.writeJSON(w, r, http.StatusCreated, hook)
+}
+
+func (hndlr *httpHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "webhookID")
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hook, err := hndlr.hooks.Get(r.Context(), id)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, hook)
+}
+
+func (hndlr *httpHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "webhookID")
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	var attrs WebhookAttrs
+	if err = decodeJSON(r, &attrs); err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hook, err := hndlr.hooks.Update(r.Context(), id, attrs)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, hook)
+}
+
+func (hndlr *httpHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "webhookID")
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	if err = hndlr.hooks.Delete(r.Context(), id); err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, idResponse{ID: id})
+}
+
+func (hndlr *httpHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	letters, err := hndlr.hooks.DeadLetters(r.Context())
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, letters)
+}
+
+// ReplayDeadLetter queues a dead letter for delivery again; the outcome
+// is only known from the webhook or the dead letters later on
+func (hndlr *httpHandler) ReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "deliveryID")
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	if err = hndlr.hooks.Replay(r.Context(), id); err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusAccepted, idResponse{ID: id})
+}
+
+func (hndlr *httpHandler) Audit(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r.URL.Query())
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	records, err := hndlr.audit.Query(r.Context(), q)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, records)
+}
+
+// History lists the audit records of an employee, the most recent
+// first. Deleted employees keep their history.
+func (hndlr *httpHandler) History(w http.ResponseWriter, r *http.Request) {
+	id, err := employeeID(r)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	q, err := parseAuditQuery(r.URL.Query())
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	q.TargetID = id
+	records, err := hndlr.audit.Query(r.Context(), q)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, records)
+}
+
+// ListPending lists the changes scheduled for an employee, the soonest
+// first
+func (hndlr *httpHandler) ListPending(w http.ResponseWriter, r *http.Request) {
+	id, err := employeeID(r)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	changes, err := hndlr.sched.Pending(r.Context(), id)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, changes)
+}
+
+func (hndlr *httpHandler) CancelPending(w http.ResponseWriter, r *http.Request) {
+	id, err := employeeID(r)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	changeID, err := pathID(r, "changeID")
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	if err = hndlr.sched.Cancel(r.Context(), id, changeID); err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, idResponse{ID: changeID})
+}
+
+func (hndlr *httpHandler) ListDepartments(w http.ResponseWriter, r *http.Request) {
+	depts, err := hndlr.depts.List(r.Context())
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, depts)
+}
+
+func (hndlr *httpHandler) CreateDepartment(w http.ResponseWriter, r *http.Request) {
+	var attrs DepartmentAttrs
+	if err := decodeJSON(r, &attrs); err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	dept, err := hndlr.depts.Create(r.Context(), attrs)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/departments/"+strconv.Itoa(dept.ID))
+	hndlr.writeJSON(w, r, http.StatusCreated, dept)
+}
+
+func (hndlr *httpHandler) GetDepartment(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "departmentID")
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	dept, err := hndlr.depts.Get(r.Context(), id)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, dept)
+}
+
+func (hndlr *httpHandler) UpdateDepartment(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "departmentID")
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	var attrs DepartmentAttrs
+	if err = decodeJSON(r, &attrs); err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	dept, err := hndlr.depts.Update(r.Context(), id, attrs)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, dept)
+}
+
+func (hndlr *httpHandler) DeleteDepartment(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "departmentID")
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	if err = hndlr.depts.Delete(r.Context(), id); err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, idResponse{ID: id})
+}
+
+// DepartmentEmployees lists the members of a department as the caller
+// may see them
+func (hndlr *httpHandler) DepartmentEmployees(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "departmentID")
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	dept, err := hndlr.depts.Get(r.Context(), id)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	members, err := departmentMembers(r.Context(), hndlr.svc, dept.Name)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, members)
+}
+
+// Reports lists the direct reports of an employee
+func (hndlr *httpHandler) Reports(w http.ResponseWriter, r *http.Request) {
+	id, err := employeeID(r)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	reports, err := directReports(r.Context(), hndlr.svc, id)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, reports)
+}
+
+// Chain lists the managers of an employee up to the top of the
+// organization, the immediate one first
+func (hndlr *httpHandler) Chain(w http.ResponseWriter, r *http.Request) {
+	id, err := employeeID(r)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	chain, err := managementChain(r.Context(), hndlr.svc, id)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, chain)
+}
+
+// Org exports an employee and everybody reporting to them as a tree
+func (hndlr *httpHandler) Org(w http.ResponseWriter, r *http.Request) {
+	id, err := employeeID(r)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	tree, err := orgSubtree(r.Context(), hndlr.svc, id)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	hndlr.writeJSON(w, r, http.StatusOK, tree)
+}
+
+// OrgDOT exports the same tree as Org as a Graphviz digraph
+func (hndlr *httpHandler) OrgDOT(w http.ResponseWriter, r *http.Request) {
+	id, err := employeeID(r)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	tree, err := orgSubtree(r.Context(), hndlr.svc, id)
+	if err != nil {
+		hndlr.WriteHTTPError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", GraphvizContentType+"; charset=utf-8")
+	if err = tree.WriteDOT(w); err != nil {
+		ctxLogger(r.Context(), hndlr.log).Error().
+			Err(err).
+			Msg("response encoding failed")
+	}
+}
+
+// parseAuditQuery reads an AuditQuery from the `GET /audit` query string
+func parseAuditQuery(q url.Values) (AuditQuery, error) {
+	aq := AuditQuery{
+		Actor: q.Get("actor"),
+		Op:    q.Get("op"),
+		Field: q.Get("field"),
+		Limit: DefaultListLimit,
+	}
+
+	var ebr ErrBadRequest
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			ebr.Add("limit", ReasonMalformed)
+		} else if n < 1 || n > MaxListLimit {
+			ebr.Add("limit", ReasonOutOfRange)
+		}
+		aq.Limit = n
+	}
+	if v := q.Get("targetId"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			ebr.Add("targetId", ReasonMalformed)
+		}
+		aq.TargetID = n
+	}
+	switch aq.Op {
+	case "", AuditCreate, AuditUpdate, AuditDelete, AuditRestore:
+	default:
+		ebr.Add("op", ReasonUnknown)
+	}
+	if v := q.Get("since"); v != "" {
+		ts, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			ebr.Add("since", ReasonMalformed)
+		}
+		aq.Since = &ts
+	}
+	if v := q.Get("until"); v != "" {
+		ts, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			ebr.Add("until", ReasonMalformed)
+		}
+		aq.Until = &ts
+	}
+
+	if !ebr.Empty() {
+		return aq, ebr
+	}
+
+	return aq, nil
+}
+
+func (hndlr *httpHandler) writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
-	resp := map[string]string{
-		"path": r.URL.Path,
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		ctxLogger(r.Context(), hndlr.log).Error().
+			Err(err).
+			Msg("response encoding failed")
 	}
-	json.NewEncoder(w).Encode(resp)
+}
+
+// employeeID reads the record id from the URL path
+func employeeID(r *http.Request) (int, error) {
+	return pathID(r, "employeeID")
+}
+
+// pathID reads the numeric URL parameter name
+func pathID(r *http.Request, name string) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, name))
+	if err != nil {
+		return 0, badRequest(name, ReasonMalformed)
+	}
+
+	return id, nil
+}
+
+// decodeJSON decodes a JSON request body into v. A missing Content-Type
+// is tolerated for the benefit of simple clients such as curl.
+func decodeJSON(r *http.Request, v any) error {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil || mt != "application/json" {
+			return ErrUnsupportedMediaType{
+				ContentType: ct,
+				Supported:   []string{"application/json"},
+			}
+		}
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return ErrMalformedBody{Reason: err.Error()}
+	}
+
+	return nil
+}
+
+// WriteHTTPError writes err as an RFC 7807 problem document
+func (hndlr *httpHandler) WriteHTTPError(w http.ResponseWriter, r *http.Request, err error) {
+	p := NewProblem(err)
+	p.Instance = r.URL.Path
+	if p.Status == http.StatusInternalServerError {
+		ctxLogger(r.Context(), hndlr.log).Error().
+			Err(err).
+			Msg("request failed")
+	}
+	if p.Status == StatusClientClosedRequest {
+		// the client is gone, nobody will read the body
+		w.WriteHeader(p.Status)
+		return
+	}
+	if p.Version != nil {
+		w.Header().Set("ETag", etag(*p.Version))
+	}
+
+	writeProblem(w, hndlr.log, p)
+}
+
+func writeProblem(w http.ResponseWriter, log *zerolog.Logger, p Problem) {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		log.Error().
+			Err(err).
+			Msg("error response encoding failed")
+	}
+}
+
+func HTTPNotFound(w http.ResponseWriter, r *http.Request) {
+	p := newProblem(http.StatusNotFound, CodeRouteNotFound, "no such endpoint")
+	p.Instance = r.URL.Path
+	nop := zerolog.Nop()
+	writeProblem(w, &nop, p)
+}
+
+func HTTPMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	p := newProblem(http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not supported here")
+	p.Instance = r.URL.Path
+	nop := zerolog.Nop()
+	writeProblem(w, &nop, p)
 }
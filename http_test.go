@@ -2,9 +2,12 @@ package ecrud_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 
 	"github.com/rs/zerolog"
@@ -14,6 +17,7 @@ import (
 )
 
 func TestHandler(t *testing.T) {
+	ctx := context.Background()
 	log := zerolog.Nop()
 	seed := map[int]ecrud.Employee{
 		1: {
@@ -37,6 +41,54 @@ func TestHandler(t *testing.T) {
 		err := json.NewDecoder(w.Result().Body).Decode(&resp)
 		as.NoError(err)
 		as.NotEmpty(resp)
+		as.Equal("1", w.Result().Header.Get("X-Total-Count"))
+	})
+
+	t.Run("`List` pages through employee records", func(tt *testing.T) {
+		as := assert.New(tt)
+		fn, ln, dob, em := "Ada", "Lovelace", "1815-12-10", "ada@engine.org"
+		id, err := svc.Create(ctx, ecrud.EmployeeAttrs{
+			FirstName:   &fn,
+			LastName:    &ln,
+			DateOfBirth: &dob,
+			Email:       &em,
+		})
+		as.NoError(err)
+		defer svc.Delete(ctx, id)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/employees?sort=lastName&order=desc&limit=1", nil)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+		as.Equal("2", w.Result().Header.Get("X-Total-Count"))
+		cursor := w.Result().Header.Get("X-Next-Cursor")
+		as.NotEmpty(cursor)
+		as.Contains(w.Result().Header.Get("Link"), `rel="next"`)
+		resp := []ecrud.Employee{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&resp))
+		as.Len(resp, 1)
+		as.Equal("Lovelace", resp[0].LastName)
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/employees?sort=lastName&order=desc&limit=1&cursor="+cursor, nil)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+		as.Empty(w.Result().Header.Get("X-Next-Cursor"))
+		resp = []ecrud.Employee{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&resp))
+		as.Len(resp, 1)
+		as.Equal("Ebreo", resp[0].LastName)
+	})
+
+	t.Run("`List` rejects invalid query parameters", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/employees?isActive=maybe&order=up", nil)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusBadRequest, w.Result().StatusCode)
+		resp := ecrud.ErrBadRequest{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&resp))
+		as.ElementsMatch([]string{"isActive", "order"}, resp.Fields)
 	})
 
 	t.Run("`Get` returns an employee record", func(tt *testing.T) {
@@ -66,6 +118,16 @@ func TestHandler(t *testing.T) {
 		as.Equal(resp.ID, 999)
 	})
 
+	t.Run("`Get` gives up when the request context is done", func(tt *testing.T) {
+		as := assert.New(tt)
+		rctx, cancel := context.WithTimeout(ctx, 0)
+		defer cancel()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/employees/1", nil).WithContext(rctx)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusGatewayTimeout, w.Result().StatusCode)
+	})
+
 	t.Run("`Create` creates an employee record", func(tt *testing.T) {
 		as := assert.New(tt)
 		w := httptest.NewRecorder()
@@ -102,6 +164,268 @@ func TestHandler(t *testing.T) {
 		as.Contains(resp.Fields, "email")
 	})
 
+	t.Run("errors are problem documents with per-field reasons", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := httptest.NewRecorder()
+		body := bytes.NewBufferString(`{
+			"firstName": "Steve",
+			"lastName": "J",
+			"dateOfBirth": "1955-02-24",
+			"email": "not-an-email"
+		}`)
+		r := httptest.NewRequest(http.MethodPost, "/employees", body)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusBadRequest, w.Result().StatusCode)
+		as.Equal(ecrud.ProblemContentType, w.Result().Header.Get("Content-Type"))
+		p := ecrud.Problem{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&p))
+		as.Equal(ecrud.CodeInvalidParams, p.Code)
+		as.Equal(http.StatusBadRequest, p.Status)
+		as.Equal("/employees", p.Instance)
+		as.NotEmpty(p.Type)
+		as.NotEmpty(p.Title)
+		as.ElementsMatch([]ecrud.FieldError{
+			{Field: "lastName", Reason: ecrud.ReasonTooShort},
+			{Field: "email", Reason: ecrud.ReasonMalformed},
+		}, p.InvalidParams)
+
+		w = httptest.NewRecorder()
+		body = bytes.NewBufferString(`{
+			"firstName": "Steve",
+			"lastName": "Jobs",
+			"dateOfBirth": "1955-02-24",
+			"email": "hire@me.com"
+		}`)
+		r = httptest.NewRequest(http.MethodPost, "/employees", body)
+		hndlr.ServeHTTP(w, r)
+		p = ecrud.Problem{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&p))
+		as.Equal([]ecrud.FieldError{{Field: "email", Reason: ecrud.ReasonTaken}}, p.InvalidParams)
+		as.Equal("email: already taken", p.Detail)
+	})
+
+	t.Run("`Batch` applies operations all-or-nothing", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := httptest.NewRecorder()
+		body := bytes.NewBufferString(`{"ops": [
+			{"op": "create", "attrs": {
+				"firstName": "Tim",
+				"lastName": "Cook",
+				"dateOfBirth": "1960-11-01",
+				"email": "tim@apple.com"
+			}},
+			{"op": "update", "id": 1, "attrs": {"email": "not-an-email"}},
+			{"op": "delete", "id": 99}
+		]}`)
+		r := httptest.NewRequest(http.MethodPost, "/employees:batch", body)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusUnprocessableEntity, w.Result().StatusCode)
+		p := ecrud.Problem{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&p))
+		as.Equal(ecrud.CodeBatchFailed, p.Code)
+		as.Len(p.Results, 3)
+		as.Nil(p.Results[0].Error)
+		if as.NotNil(p.Results[1].Error) {
+			as.Equal(ecrud.CodeInvalidParams, p.Results[1].Error.Code)
+		}
+
+		w = httptest.NewRecorder()
+		body = bytes.NewBufferString(`{"ops": [
+			{"op": "create", "attrs": {
+				"firstName": "Tim",
+				"lastName": "Cook",
+				"dateOfBirth": "1960-11-01",
+				"email": "tim@apple.com"
+			}}
+		]}`)
+		r = httptest.NewRequest(http.MethodPost, "/employees:batch", body)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+		resp := struct {
+			Results []ecrud.BatchResult `json:"results"`
+		}{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&resp))
+		if as.Len(resp.Results, 1) {
+			defer svc.Delete(ctx, resp.Results[0].ID)
+			_, err := svc.Get(ctx, resp.Results[0].ID)
+			as.NoError(err)
+		}
+	})
+
+	t.Run("`ExportCSV` writes filtered records", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/employees.csv?sort=email&limit=1", nil)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+		as.Contains(w.Result().Header.Get("Content-Type"), ecrud.CSVContentType)
+		records, err := csv.NewReader(w.Result().Body).ReadAll()
+		as.NoError(err)
+		as.Equal([]string{
+			"id", "firstName", "lastName", "dateOfBirth", "email",
+			"isActive", "department", "role", "managerId", "version",
+		}, records[0])
+		// paging parameters do not truncate the export
+		page, err := svc.List(ctx, ecrud.ListOptions{})
+		as.NoError(err)
+		as.Len(records, page.Total+1)
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/employees.csv?sort=salary", nil)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusBadRequest, w.Result().StatusCode)
+	})
+
+	t.Run("`ImportCSV` reports rejected rows", func(tt *testing.T) {
+		as := assert.New(tt)
+		before, err := svc.List(ctx, ecrud.ListOptions{})
+		as.NoError(err)
+
+		w := httptest.NewRecorder()
+		body := bytes.NewBufferString("First Name,Last Name,DOB,E-mail,Active\n" +
+			"Tim,Cook,1960-11-01,tim@apple.com,true\n" +
+			"Phil,S,1957-01-01,hire@me.com,maybe\n")
+		r := httptest.NewRequest(http.MethodPost, "/employees/import?map=DOB:dateOfBirth&map=Active:isActive", body)
+		r.Header.Set("Content-Type", "text/csv")
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusUnprocessableEntity, w.Result().StatusCode)
+		p := ecrud.Problem{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&p))
+		if as.Len(p.Results, 2) {
+			as.Nil(p.Results[0].Error)
+			as.Equal(2, p.Results[0].Line)
+			as.Equal(3, p.Results[1].Line)
+			if as.NotNil(p.Results[1].Error) {
+				as.ElementsMatch([]ecrud.FieldError{
+					{Field: "isActive", Reason: ecrud.ReasonMalformed},
+					{Field: "lastName", Reason: ecrud.ReasonTooShort},
+				}, p.Results[1].Error.InvalidParams)
+			}
+		}
+
+		after, err := svc.List(ctx, ecrud.ListOptions{})
+		as.NoError(err)
+		as.Equal(before.Total, after.Total)
+	})
+
+	t.Run("`ImportCSV` supports dry runs and header mapping", func(tt *testing.T) {
+		as := assert.New(tt)
+		csvBody := "Given,Surname,dateOfBirth,email,Notes\n" +
+			"Tim,Cook,1960-11-01,tim.cook@apple.com,hired 1998\n"
+		resp := struct {
+			DryRun  bool                `json:"dryRun"`
+			Results []ecrud.BatchResult `json:"results"`
+		}{}
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/employees/import?dryRun=true", bytes.NewBufferString(csvBody))
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusBadRequest, w.Result().StatusCode)
+		p := ecrud.Problem{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&p))
+		as.ElementsMatch([]string{"Given", "Surname", "Notes", "firstName", "lastName"}, p.Fields)
+
+		mapped := "&map=Given:firstName&map=Surname:lastName&map=Notes:-"
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPost, "/employees/import?dryRun=true"+mapped, bytes.NewBufferString(csvBody))
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&resp))
+		as.True(resp.DryRun)
+		if as.Len(resp.Results, 1) {
+			_, err := svc.Get(ctx, resp.Results[0].ID)
+			var enf ecrud.ErrNotFound
+			as.ErrorAs(err, &enf)
+		}
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPost, "/employees/import?dryRun=false"+mapped, bytes.NewBufferString(csvBody))
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&resp))
+		as.False(resp.DryRun)
+		if as.Len(resp.Results, 1) {
+			defer svc.Delete(ctx, resp.Results[0].ID)
+			e, err := svc.Get(ctx, resp.Results[0].ID)
+			as.NoError(err)
+			as.Equal("Cook", e.LastName)
+		}
+	})
+
+	t.Run("`ImportCSV` and `ExportCSV` round-trip managers", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/employees/import", bytes.NewBufferString(
+			"firstName,lastName,dateOfBirth,email,managerId\n"+
+				"Tim,Cook,1960-11-01,tim.cook@apple.com,one\n"))
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusUnprocessableEntity, w.Result().StatusCode)
+		p := ecrud.Problem{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&p))
+		if as.Len(p.Results, 1) && as.NotNil(p.Results[0].Error) {
+			as.Equal([]ecrud.FieldError{{Field: "managerId", Reason: ecrud.ReasonMalformed}}, p.Results[0].Error.InvalidParams)
+		}
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPost, "/employees/import", bytes.NewBufferString(
+			"firstName,lastName,dateOfBirth,email,managerId\n"+
+				"Tim,Cook,1960-11-01,tim.cook@apple.com,1\n"))
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+		resp := struct {
+			Results []ecrud.BatchResult `json:"results"`
+		}{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&resp))
+		if !as.Len(resp.Results, 1) {
+			return
+		}
+		defer svc.Delete(ctx, resp.Results[0].ID)
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/employees.csv?managerId=1", nil)
+		hndlr.ServeHTTP(w, r)
+		records, err := csv.NewReader(w.Result().Body).ReadAll()
+		as.NoError(err)
+		if as.Len(records, 2) {
+			as.Equal(strconv.Itoa(resp.Results[0].ID), records[1][0])
+			as.Equal("1", records[1][8])
+		}
+	})
+
+	t.Run("rejects unsupported and malformed bodies", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/employees", bytes.NewBufferString(`firstName=Steve`))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusUnsupportedMediaType, w.Result().StatusCode)
+		p := ecrud.Problem{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&p))
+		as.Equal(ecrud.CodeUnsupportedMediaType, p.Code)
+		as.Contains(p.Supported, "application/json")
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPut, "/employees/1", bytes.NewBufferString(`{"role":`))
+		r.Header.Set("Content-Type", "application/json; charset=utf-8")
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusBadRequest, w.Result().StatusCode)
+		p = ecrud.Problem{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&p))
+		as.Equal(ecrud.CodeMalformedBody, p.Code)
+	})
+
+	t.Run("unknown routes return a problem document", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/payroll", nil)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusNotFound, w.Result().StatusCode)
+		p := ecrud.Problem{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&p))
+		as.Equal(ecrud.CodeRouteNotFound, p.Code)
+		as.Equal("/payroll", p.Instance)
+	})
+
 	t.Run("`Update` updates an employee record", func(tt *testing.T) {
 		as := assert.New(tt)
 		fn, ln, dob, em, ro := "Saul", "Goodman", "1960-10-15", "saul@good.man", "CEO"
@@ -149,6 +473,151 @@ func TestHandler(t *testing.T) {
 		as.Equal(ro, *resp.Role)
 	})
 
+	t.Run("`Get` and `Update` honor entity tags", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/employees/1", nil)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+		tag := w.Result().Header.Get("ETag")
+		as.NotEmpty(tag)
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/employees/1", nil)
+		r.Header.Set("If-None-Match", tag)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusNotModified, w.Result().StatusCode)
+		as.Zero(w.Body.Len())
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPut, "/employees/1", bytes.NewBufferString(`{"role": "CTO"}`))
+		r.Header.Set("If-Match", tag)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+		fresh := w.Result().Header.Get("ETag")
+		as.NotEqual(tag, fresh)
+		resp := ecrud.Employee{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&resp))
+		as.Equal("CTO", *resp.Role)
+		as.Equal(fresh, `"`+strconv.Itoa(resp.Version)+`"`)
+
+		// a second writer still holding the old tag loses
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPut, "/employees/1", bytes.NewBufferString(`{"role": "CFO"}`))
+		r.Header.Set("If-Match", tag)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusPreconditionFailed, w.Result().StatusCode)
+		as.Equal(fresh, w.Result().Header.Get("ETag"))
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/employees/1", nil)
+		r.Header.Set("If-None-Match", tag)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+		resp = ecrud.Employee{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&resp))
+		as.Equal("CTO", *resp.Role)
+	})
+
+	t.Run("`Patch` applies merge patches", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := httptest.NewRecorder()
+		body := bytes.NewBufferString(`{"department": "Legal", "role": "Counsel"}`)
+		r := httptest.NewRequest(http.MethodPatch, "/employees/1", body)
+		r.Header.Set("Content-Type", ecrud.MergePatchContentType)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+		resp := ecrud.Employee{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&resp))
+		as.Equal("Legal", *resp.Department)
+		tag := w.Result().Header.Get("ETag")
+
+		// null clears an optional field, which PUT cannot express
+		w = httptest.NewRecorder()
+		body = bytes.NewBufferString(`{"department": null}`)
+		r = httptest.NewRequest(http.MethodPatch, "/employees/1", body)
+		r.Header.Set("Content-Type", ecrud.MergePatchContentType)
+		r.Header.Set("If-Match", tag)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+		resp = ecrud.Employee{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&resp))
+		as.Nil(resp.Department)
+		as.Equal("Counsel", *resp.Role)
+
+		w = httptest.NewRecorder()
+		body = bytes.NewBufferString(`{"role": null}`)
+		r = httptest.NewRequest(http.MethodPatch, "/employees/1", body)
+		r.Header.Set("Content-Type", ecrud.MergePatchContentType)
+		r.Header.Set("If-Match", tag)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusPreconditionFailed, w.Result().StatusCode)
+	})
+
+	t.Run("`Patch` applies JSON patches", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := httptest.NewRecorder()
+		body := bytes.NewBufferString(`[
+			{"op": "test", "path": "/role", "value": "Counsel"},
+			{"op": "replace", "path": "/role", "value": "General Counsel"},
+			{"op": "add", "path": "/isActive", "value": false}
+		]`)
+		r := httptest.NewRequest(http.MethodPatch, "/employees/1", body)
+		r.Header.Set("Content-Type", ecrud.JSONPatchContentType)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+		resp := ecrud.Employee{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&resp))
+		as.Equal("General Counsel", *resp.Role)
+		as.False(*resp.IsActive)
+
+		w = httptest.NewRecorder()
+		body = bytes.NewBufferString(`[{"op": "test", "path": "/role", "value": "Counsel"}]`)
+		r = httptest.NewRequest(http.MethodPatch, "/employees/1", body)
+		r.Header.Set("Content-Type", ecrud.JSONPatchContentType)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusUnprocessableEntity, w.Result().StatusCode)
+	})
+
+	t.Run("`Patch` results are validated", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := httptest.NewRecorder()
+		body := bytes.NewBufferString(`[
+			{"op": "replace", "path": "/firstName", "value": "J"},
+			{"op": "remove", "path": "/email"},
+			{"op": "add", "path": "/salary", "value": 1},
+			{"op": "replace", "path": "/id", "value": 2}
+		]`)
+		r := httptest.NewRequest(http.MethodPatch, "/employees/1", body)
+		r.Header.Set("Content-Type", ecrud.JSONPatchContentType)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusBadRequest, w.Result().StatusCode)
+		p := ecrud.Problem{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&p))
+		as.ElementsMatch([]ecrud.FieldError{
+			{Field: "email", Reason: ecrud.ReasonRequired},
+			{Field: "salary", Reason: ecrud.ReasonUnknown},
+			{Field: "id", Reason: ecrud.ReasonReadOnly},
+		}, p.InvalidParams)
+
+		// well formed patches still go through ServiceValidationMiddleware
+		w = httptest.NewRecorder()
+		body = bytes.NewBufferString(`{"firstName": "J"}`)
+		r = httptest.NewRequest(http.MethodPatch, "/employees/1", body)
+		r.Header.Set("Content-Type", ecrud.MergePatchContentType)
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusBadRequest, w.Result().StatusCode)
+		p = ecrud.Problem{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&p))
+		as.Equal([]string{"firstName"}, p.Fields)
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPatch, "/employees/1", bytes.NewBufferString(`{}`))
+		r.Header.Set("Content-Type", "application/json")
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusUnsupportedMediaType, w.Result().StatusCode)
+	})
+
 	t.Run("`Update` returns 404 on non-existent employee record", func(tt *testing.T) {
 		as := assert.New(tt)
 		w := httptest.NewRecorder()
@@ -195,6 +664,33 @@ func TestHandler(t *testing.T) {
 		as.Equal(1, notfound.ID)
 	})
 
+	t.Run("`Restore` brings deleted records back", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := httptest.NewRecorder()
+		hndlr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/employees/1?includeDeleted=true", nil))
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+		w = httptest.NewRecorder()
+		hndlr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/employees?includeDeleted=true", nil))
+		listed := []ecrud.Employee{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&listed))
+		if as.NotEmpty(listed) {
+			as.Equal(1, listed[0].ID)
+			as.NotNil(listed[0].DeletedAt)
+		}
+
+		w = httptest.NewRecorder()
+		hndlr.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/employees/1:restore", nil))
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+		resp := ecrud.Employee{}
+		as.NoError(json.NewDecoder(w.Result().Body).Decode(&resp))
+		as.Equal(1, resp.ID)
+		as.Nil(resp.DeletedAt)
+
+		w = httptest.NewRecorder()
+		hndlr.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/employees/1", nil))
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+	})
+
 	t.Run("`Delete` returns 404 on non-existent employee record", func(tt *testing.T) {
 		as := assert.New(tt)
 		w := httptest.NewRecorder()
@@ -0,0 +1,349 @@
+package ecrud
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	journalFile  = "journal.log"
+	snapshotFile = "snapshot.json"
+
+	// DefaultSnapshotEvery is the number of journal entries after which
+	// the journal is compacted into a snapshot.
+	DefaultSnapshotEvery = 1000
+)
+
+// Journal is a durable, append-only log of ServiceStub mutations with
+// periodic compacted snapshots. Each entry holds the full post-mutation
+// state of a single record, so replaying entries over a snapshot is
+// idempotent and a crash between writing a snapshot and truncating the
+// log loses nothing.
+type Journal struct {
+	mtx           sync.Mutex
+	dir           string
+	f             *os.File
+	entries       int
+	snapshotEvery int
+
+	// state recovered from disk by OpenJournal
+	records   map[int]Employee
+	history   map[int][]employeeVersion
+	seq       int
+	recovered bool
+}
+
+type journalEntry struct {
+	Op       string    `json:"op"`
+	ID       int       `json:"id,omitempty"`
+	Employee *Employee `json:"employee,omitempty"`
+	// At is when a put was applied, missing from entries that predate
+	// record history
+	At *time.Time `json:"at,omitempty"`
+	// Entries of a batch are written as one line so that a batch is
+	// replayed either completely or not at all.
+	Entries []journalEntry `json:"entries,omitempty"`
+}
+
+const (
+	journalOpPut    = "put"
+	journalOpDelete = "delete"
+	journalOpBatch  = "batch"
+)
+
+func putEntry(e Employee, at time.Time) journalEntry {
+	return journalEntry{Op: journalOpPut, ID: e.ID, Employee: &e, At: &at}
+}
+
+func deleteEntry(id int) journalEntry {
+	return journalEntry{Op: journalOpDelete, ID: id}
+}
+
+type journalSnapshot struct {
+	Seq     int        `json:"seq"`
+	Records []Employee `json:"records"`
+	// History holds every version of the records, current ones
+	// included, ordered by id and version
+	History []employeeVersion `json:"history,omitempty"`
+}
+
+// OpenJournal opens the journal in dir, creating the directory if needed,
+// and recovers the state left by a previous process from the latest
+// snapshot and the entries appended after it. snapshotEvery <= 0 uses
+// DefaultSnapshotEvery.
+func OpenJournal(dir string, snapshotEvery int) (*Journal, error) {
+	if snapshotEvery <= 0 {
+		snapshotEvery = DefaultSnapshotEvery
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	j := &Journal{
+		dir:           dir,
+		snapshotEvery: snapshotEvery,
+		records:       map[int]Employee{},
+		history:       map[int][]employeeVersion{},
+	}
+	if err := j.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := j.replay(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	j.f = f
+
+	return j, nil
+}
+
+func (j *Journal) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(j.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var snap journalSnapshot
+	if err = json.NewDecoder(f).Decode(&snap); err != nil {
+		return err
+	}
+	for _, e := range snap.Records {
+		j.records[e.ID] = e
+	}
+	for _, v := range snap.History {
+		j.history[v.Employee.ID] = append(j.history[v.Employee.ID], v)
+	}
+	j.seq = snap.Seq
+	j.recovered = true
+
+	return nil
+}
+
+func (j *Journal) replay() error {
+	f, err := os.OpenFile(filepath.Join(j.dir, journalFile), os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var (
+		valid int64
+		rd    = bufio.NewReader(f)
+	)
+	for {
+		line, err := rd.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// anything after the last newline is a torn write
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var entry journalEntry
+		if err = json.Unmarshal(line, &entry); err != nil {
+			break
+		}
+		j.apply(entry)
+		j.entries++
+		j.recovered = true
+		valid += int64(len(line))
+	}
+
+	// drop a partially written tail so new entries start on a clean line
+	return f.Truncate(valid)
+}
+
+func (j *Journal) apply(entry journalEntry) {
+	switch entry.Op {
+	case journalOpPut:
+		if entry.Employee != nil {
+			versions := j.history[entry.ID]
+			if prev, found := j.records[entry.ID]; found && len(versions) == 0 {
+				// the record predates history
+				versions = []employeeVersion{{Employee: prev}}
+			}
+			// entries already in the snapshot are replayed again after
+			// a crash before the journal was truncated
+			if n := len(versions); n == 0 || versions[n-1].Employee.Version < entry.Employee.Version {
+				v := employeeVersion{Employee: *entry.Employee}
+				if entry.At != nil {
+					v.At = *entry.At
+				}
+				versions = append(versions, v)
+			}
+			j.records[entry.ID] = *entry.Employee
+			j.history[entry.ID] = versions
+		}
+	case journalOpDelete:
+		delete(j.records, entry.ID)
+		delete(j.history, entry.ID)
+	case journalOpBatch:
+		for _, e := range entry.Entries {
+			j.apply(e)
+		}
+	}
+	if entry.ID > j.seq {
+		j.seq = entry.ID
+	}
+}
+
+func (j *Journal) append(entry journalEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if _, err = j.f.Write(b); err != nil {
+		return err
+	}
+	if err = j.f.Sync(); err != nil {
+		return err
+	}
+	j.entries++
+
+	return nil
+}
+
+// NeedsSnapshot reports whether enough entries have accumulated since
+// the last snapshot that the journal should be compacted.
+func (j *Journal) NeedsSnapshot() bool {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	return j.entries >= j.snapshotEvery
+}
+
+// snapshot atomically replaces the snapshot with the given records and
+// their past versions, and truncates the journal. The caller must
+// ensure no mutations happen concurrently, ie. by holding its write
+// lock.
+func (j *Journal) snapshot(records map[int]Employee, history map[int][]employeeVersion, seq int) error {
+	snap := journalSnapshot{
+		Seq:     seq,
+		Records: make([]Employee, 0, len(records)),
+	}
+	for _, e := range records {
+		snap.Records = append(snap.Records, e)
+	}
+	sort.Slice(snap.Records, func(a, b int) bool {
+		return snap.Records[a].ID < snap.Records[b].ID
+	})
+	for _, e := range snap.Records {
+		snap.History = append(snap.History, history[e.ID]...)
+	}
+
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	tmp, err := os.CreateTemp(j.dir, snapshotFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = json.NewEncoder(tmp).Encode(snap); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(j.dir, snapshotFile)); err != nil {
+		return err
+	}
+	if err = syncDir(j.dir); err != nil {
+		return err
+	}
+
+	if err = j.f.Truncate(0); err != nil {
+		return err
+	}
+	j.entries = 0
+
+	return j.f.Sync()
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	return j.f.Close()
+}
+
+// recoveredState hands over the state read by OpenJournal. ok is false
+// when the journal directory held no prior state.
+func (j *Journal) recoveredState() (records map[int]Employee, history map[int][]employeeVersion, seq int, ok bool) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	records, history, seq, ok = j.records, j.history, j.seq, j.recovered
+	j.records, j.history = nil, nil
+
+	return records, history, seq, ok
+}
+
+// replaceJSONFile replaces the file at path with v encoded as JSON, so
+// that a crash never leaves it half written
+func replaceJSONFile(path string, v any) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = json.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
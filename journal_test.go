@@ -0,0 +1,227 @@
+package ecrud_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+)
+
+func TestJournal(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	seed := func() map[int]ecrud.Employee {
+		return map[int]ecrud.Employee{
+			1: {
+				ID:          1,
+				FirstName:   "David",
+				LastName:    "Ebreo",
+				DateOfBirth: "2001-08-15",
+				Email:       "hire@me.com",
+			},
+		}
+	}
+	create := func(svc ecrud.Service, em string) (int, error) {
+		fn, ln, dob := "Steve", "Jobs", "1955-02-24"
+		return svc.Create(ctx, ecrud.EmployeeAttrs{
+			FirstName:   &fn,
+			LastName:    &ln,
+			DateOfBirth: &dob,
+			Email:       &em,
+		})
+	}
+
+	t.Run("mutations survive a restart", func(tt *testing.T) {
+		as := assert.New(tt)
+		dir := tt.TempDir()
+		j, err := ecrud.OpenJournal(dir, 0)
+		as.NoError(err)
+		svc := ecrud.NewServiceStub(seed(), &log, ecrud.WithJournal(j))
+
+		id, err := create(svc, "steve@apple.com")
+		as.NoError(err)
+		ro := "CEO"
+		_, err = svc.Update(ctx, id, ecrud.EmployeeAttrs{Role: &ro})
+		as.NoError(err)
+		as.NoError(svc.Delete(ctx, 1))
+		as.NoError(j.Close())
+
+		j, err = ecrud.OpenJournal(dir, 0)
+		as.NoError(err)
+		defer j.Close()
+		// seed passed on restart must not resurrect the deleted record
+		svc = ecrud.NewServiceStub(seed(), &log, ecrud.WithJournal(j))
+
+		_, err = svc.Get(ctx, 1)
+		var enf ecrud.ErrNotFound
+		as.ErrorAs(err, &enf)
+		e, err := svc.Get(ctx, id)
+		as.NoError(err)
+		as.Equal("CEO", *e.Role)
+		as.Equal(2, e.Version)
+
+		// ids are never reused, even after deleting the newest record
+		as.NoError(svc.Delete(ctx, id))
+		next, err := create(svc, "woz@apple.com")
+		as.NoError(err)
+		as.Greater(next, id)
+	})
+
+	t.Run("batches survive a restart", func(tt *testing.T) {
+		as := assert.New(tt)
+		dir := tt.TempDir()
+		j, err := ecrud.OpenJournal(dir, 0)
+		as.NoError(err)
+		svc := ecrud.NewServiceStub(seed(), &log, ecrud.WithJournal(j))
+
+		fn, ln, dob, em := "Steve", "Jobs", "1955-02-24", "steve@apple.com"
+		results, err := svc.Batch(ctx, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			{Op: ecrud.BatchCreate, Attrs: ecrud.EmployeeAttrs{
+				FirstName:   &fn,
+				LastName:    &ln,
+				DateOfBirth: &dob,
+				Email:       &em,
+			}},
+			{Op: ecrud.BatchDelete, ID: 1},
+		}})
+		as.NoError(err)
+		as.NoError(j.Close())
+
+		j, err = ecrud.OpenJournal(dir, 0)
+		as.NoError(err)
+		defer j.Close()
+		svc = ecrud.NewServiceStub(seed(), &log, ecrud.WithJournal(j))
+
+		_, err = svc.Get(ctx, 1)
+		var enf ecrud.ErrNotFound
+		as.ErrorAs(err, &enf)
+		e, err := svc.Get(ctx, results[0].ID)
+		as.NoError(err)
+		as.Equal(em, e.Email)
+	})
+
+	t.Run("persists seeds as they are served", func(tt *testing.T) {
+		as := assert.New(tt)
+		dir := tt.TempDir()
+		j, err := ecrud.OpenJournal(dir, 0)
+		as.NoError(err)
+		// seed records may leave the id to the map key
+		ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-08-15", Email: "hire@me.com"},
+			2: {FirstName: "Tim", LastName: "Cook", DateOfBirth: "1960-11-01", Email: "tim@apple.com"},
+		}, &log, ecrud.WithJournal(j))
+		as.NoError(j.Close())
+
+		j, err = ecrud.OpenJournal(dir, 0)
+		as.NoError(err)
+		defer j.Close()
+		svc := ecrud.NewServiceStub(nil, &log, ecrud.WithJournal(j))
+		for id, email := range map[int]string{1: "hire@me.com", 2: "tim@apple.com"} {
+			e, err := svc.Get(ctx, id)
+			if as.NoError(err) {
+				as.Equal(email, e.Email)
+				as.Equal(1, e.Version)
+			}
+		}
+		id, err := create(svc, "steve@apple.com")
+		as.NoError(err)
+		as.Equal(3, id)
+	})
+
+	t.Run("compacts into snapshots", func(tt *testing.T) {
+		as := assert.New(tt)
+		dir := tt.TempDir()
+		j, err := ecrud.OpenJournal(dir, 2)
+		as.NoError(err)
+		svc := ecrud.NewServiceStub(seed(), &log, ecrud.WithJournal(j))
+
+		_, err = create(svc, "a@apple.com")
+		as.NoError(err)
+		_, err = create(svc, "b@apple.com")
+		as.NoError(err)
+		last, err := create(svc, "c@apple.com")
+		as.NoError(err)
+		as.NoError(j.Close())
+
+		info, err := os.Stat(filepath.Join(dir, "journal.log"))
+		as.NoError(err)
+		as.NotZero(info.Size())
+		_, err = os.Stat(filepath.Join(dir, "snapshot.json"))
+		as.NoError(err)
+
+		j, err = ecrud.OpenJournal(dir, 2)
+		as.NoError(err)
+		defer j.Close()
+		svc = ecrud.NewServiceStub(nil, &log, ecrud.WithJournal(j))
+		page, err := svc.List(ctx, ecrud.ListOptions{})
+		as.NoError(err)
+		as.Equal(4, page.Total)
+		_, err = svc.Get(ctx, last)
+		as.NoError(err)
+	})
+
+	t.Run("history survives compaction and restarts", func(tt *testing.T) {
+		as := assert.New(tt)
+		dir := tt.TempDir()
+		j, err := ecrud.OpenJournal(dir, 2)
+		as.NoError(err)
+		svc := ecrud.NewServiceStub(seed(), &log, ecrud.WithJournal(j))
+
+		seeded := time.Now()
+		for _, ro := range []string{"CTO", "CEO", "Chairman"} {
+			ro := ro
+			_, err = svc.Update(ctx, 1, ecrud.EmployeeAttrs{Role: &ro})
+			as.NoError(err)
+		}
+		as.NoError(j.Close())
+
+		j, err = ecrud.OpenJournal(dir, 2)
+		as.NoError(err)
+		defer j.Close()
+		svc = ecrud.NewServiceStub(nil, &log, ecrud.WithJournal(j))
+		e, err := svc.Get(ctx, 1, ecrud.AsOf(seeded))
+		as.NoError(err)
+		as.Nil(e.Role)
+		as.Equal(1, e.Version)
+		e, err = svc.Get(ctx, 1)
+		as.NoError(err)
+		as.Equal("Chairman", *e.Role)
+	})
+
+	t.Run("ignores a torn trailing entry", func(tt *testing.T) {
+		as := assert.New(tt)
+		dir := tt.TempDir()
+		j, err := ecrud.OpenJournal(dir, 0)
+		as.NoError(err)
+		svc := ecrud.NewServiceStub(seed(), &log, ecrud.WithJournal(j))
+		id, err := create(svc, "steve@apple.com")
+		as.NoError(err)
+		as.NoError(j.Close())
+
+		f, err := os.OpenFile(filepath.Join(dir, "journal.log"), os.O_WRONLY|os.O_APPEND, 0)
+		as.NoError(err)
+		_, err = f.WriteString(`{"op":"put","id":9,"empl`)
+		as.NoError(err)
+		as.NoError(f.Close())
+
+		j, err = ecrud.OpenJournal(dir, 0)
+		as.NoError(err)
+		defer j.Close()
+		svc = ecrud.NewServiceStub(nil, &log, ecrud.WithJournal(j))
+		page, err := svc.List(ctx, ecrud.ListOptions{})
+		as.NoError(err)
+		as.Equal(2, page.Total)
+		_, err = svc.Get(ctx, id)
+		as.NoError(err)
+
+		next, err := create(svc, "woz@apple.com")
+		as.NoError(err)
+		as.Equal(id+1, next)
+	})
+}
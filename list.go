@@ -0,0 +1,234 @@
+package ecrud
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultListLimit is the page size used by the HTTP API when the
+	// caller does not specify one.
+	DefaultListLimit = 100
+	// MaxListLimit is the largest page size a caller may request
+	MaxListLimit = 1000
+)
+
+// sortFields lists the Employee fields List results can be ordered by
+var sortFields = map[string]struct{}{
+	"id":          {},
+	"firstName":   {},
+	"lastName":    {},
+	"dateOfBirth": {},
+	"email":       {},
+	"department":  {},
+	"role":        {},
+}
+
+// ListOptions narrows, orders and pages the records returned by
+// Service.List. The zero value lists every record ordered by id.
+type ListOptions struct {
+	// Limit caps the number of records returned; 0 means no limit.
+	Limit int
+	// Offset skips that many records of the filtered, sorted result.
+	// It cannot be combined with Cursor.
+	Offset int
+	// Cursor resumes listing where a previous page's NextCursor left
+	// off. The other options must be the same as for that page.
+	Cursor string
+	// Sort is the JSON name of the field to order by, defaults to "id".
+	// Ties are always broken by id.
+	Sort string
+	// Desc reverses the sort order
+	Desc bool
+
+	Department *string
+	Role       *string
+	IsActive   *bool
+	// ManagerID lists the direct reports of that employee
+	ManagerID *int
+	// DateOfBirthFrom and DateOfBirthTo are an inclusive range
+	// formatted as time.DateOnly.
+	DateOfBirthFrom *string
+	DateOfBirthTo   *string
+
+	// IncludeDeleted lists tombstoned records too
+	IncludeDeleted bool
+	// AsOf lists the records as they were at that instant
+	AsOf *time.Time
+}
+
+// EmployeePage is a single page of List results
+type EmployeePage struct {
+	Employees []Employee `json:"employees"`
+	// Total is the number of records matching the filters across
+	// all pages.
+	Total int `json:"total"`
+	// NextCursor is empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type listCursor struct {
+	Offset int `json:"o"`
+}
+
+func encodeCursor(offset int) string {
+	b, _ := json.Marshal(listCursor{Offset: offset})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (int, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, false
+	}
+	var c listCursor
+	if err = json.Unmarshal(b, &c); err != nil || c.Offset < 0 {
+		return 0, false
+	}
+
+	return c.Offset, true
+}
+
+// start resolves the position of the first record of the page
+func (opts ListOptions) start() (int, error) {
+	if opts.Cursor == "" {
+		return opts.Offset, nil
+	}
+	offset, ok := decodeCursor(opts.Cursor)
+	if !ok {
+		return 0, badRequest("cursor", ReasonMalformed)
+	}
+
+	return offset, nil
+}
+
+// nextCursor returns the cursor for the page following one that
+// started at offset and held n of total records
+func (opts ListOptions) nextCursor(offset, n, total int) string {
+	if opts.Limit == 0 || offset+n >= total {
+		return ""
+	}
+
+	return encodeCursor(offset + n)
+}
+
+func (opts ListOptions) matches(e Employee) bool {
+	if opts.Department != nil && (e.Department == nil || *e.Department != *opts.Department) {
+		return false
+	}
+	if opts.Role != nil && (e.Role == nil || *e.Role != *opts.Role) {
+		return false
+	}
+	if opts.IsActive != nil && (e.IsActive == nil || *e.IsActive != *opts.IsActive) {
+		return false
+	}
+	if opts.ManagerID != nil && (e.ManagerID == nil || *e.ManagerID != *opts.ManagerID) {
+		return false
+	}
+	// dates are zero padded so lexical order is chronological
+	if opts.DateOfBirthFrom != nil && e.DateOfBirth < *opts.DateOfBirthFrom {
+		return false
+	}
+	if opts.DateOfBirthTo != nil && e.DateOfBirth > *opts.DateOfBirthTo {
+		return false
+	}
+
+	return true
+}
+
+// listAll lists every record matching opts, a page of MaxListLimit at
+// a time. Paging options of opts are ignored.
+func listAll(ctx context.Context, svc Service, opts ListOptions) ([]Employee, error) {
+	opts.Limit, opts.Offset, opts.Cursor = MaxListLimit, 0, ""
+	employees := []Employee{}
+	for {
+		page, err := svc.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		employees = append(employees, page.Employees...)
+		if page.NextCursor == "" {
+			return employees, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// paginate filters, sorts and slices employees in memory according to opts
+func paginate(employees []Employee, opts ListOptions) (EmployeePage, error) {
+	offset, err := opts.start()
+	if err != nil {
+		return EmployeePage{}, err
+	}
+
+	matched := make([]Employee, 0, len(employees))
+	for _, e := range employees {
+		if opts.matches(e) {
+			matched = append(matched, e)
+		}
+	}
+
+	sort.Slice(matched, func(a, b int) bool {
+		c := compareEmployees(matched[a], matched[b], opts.Sort)
+		if c == 0 {
+			c = matched[a].ID - matched[b].ID
+		}
+		if opts.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	total := len(matched)
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if opts.Limit > 0 && offset+opts.Limit < total {
+		end = offset + opts.Limit
+	}
+	page := matched[offset:end]
+
+	return EmployeePage{
+		Employees:  page,
+		Total:      total,
+		NextCursor: opts.nextCursor(offset, len(page), total),
+	}, nil
+}
+
+func compareEmployees(a, b Employee, field string) int {
+	switch field {
+	case "firstName":
+		return strings.Compare(a.FirstName, b.FirstName)
+	case "lastName":
+		return strings.Compare(a.LastName, b.LastName)
+	case "dateOfBirth":
+		return strings.Compare(a.DateOfBirth, b.DateOfBirth)
+	case "email":
+		return strings.Compare(a.Email, b.Email)
+	case "department":
+		return compareOptional(a.Department, b.Department)
+	case "role":
+		return compareOptional(a.Role, b.Role)
+	default:
+		return a.ID - b.ID
+	}
+}
+
+// compareOptional orders unset values first, like SQL NULLs
+func compareOptional(a, b *string) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	default:
+		return strings.Compare(*a, *b)
+	}
+}
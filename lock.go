@@ -0,0 +1,47 @@
+package ecrud
+
+import (
+	"context"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// rwlockReaders bounds the number of concurrent readers; a writer
+// acquires all of them at once.
+const rwlockReaders = 1 << 30
+
+// rwlock is a readers-writer lock whose acquisition is abandoned when
+// the caller's context is done. Waiters are served in FIFO order, so a
+// pending writer is not starved by a stream of readers.
+type rwlock struct {
+	sem *semaphore.Weighted
+}
+
+func newRWLock() *rwlock {
+	return &rwlock{
+		sem: semaphore.NewWeighted(rwlockReaders),
+	}
+}
+
+func (l *rwlock) RLock(ctx context.Context) error {
+	// fail fast even when the lock happens to be free
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.sem.Acquire(ctx, 1)
+}
+
+func (l *rwlock) RUnlock() {
+	l.sem.Release(1)
+}
+
+func (l *rwlock) Lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.sem.Acquire(ctx, rwlockReaders)
+}
+
+func (l *rwlock) Unlock() {
+	l.sem.Release(rwlockReaders)
+}
@@ -0,0 +1,748 @@
+package ecrud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// OpenAPIPath is where NewHTTPServer serves its OpenAPI document
+const OpenAPIPath = "/openapi.json"
+
+// Response bodies that are not domain types. They are named so that the
+// handlers and the OpenAPI document share a single definition.
+type (
+	idResponse struct {
+		ID int `json:"id"`
+	}
+	batchResponse struct {
+		Results []BatchResult `json:"results"`
+	}
+	importResponse struct {
+		DryRun  bool          `json:"dryRun"`
+		Results []BatchResult `json:"results"`
+	}
+)
+
+// apiRoute documents a route registered in NewHTTPServer. Bodies are
+// given as Go values whose types the schemas are generated from.
+type apiRoute struct {
+	summary   string
+	query     []apiParam
+	headers   []apiParam
+	body      map[string]any
+	responses map[int]apiResponse
+}
+
+type apiParam struct {
+	name        string
+	typ         string
+	description string
+}
+
+type apiResponse struct {
+	description string
+	contentType string
+	body        any
+	headers     []string
+}
+
+var (
+	apiProblem = func(description string) apiResponse {
+		return apiResponse{description: description, contentType: ProblemContentType, body: Problem{}}
+	}
+	apiEmployee = apiResponse{
+		description: "the record, its version is also sent as ETag",
+		contentType: "application/json",
+		body:        Employee{},
+		headers:     []string{"ETag"},
+	}
+	apiIfMatch = apiParam{
+		name:        "If-Match",
+		typ:         "string",
+		description: "ETag the change is based on",
+	}
+	apiAuditQuery = []apiParam{
+		{"limit", "integer", "maximum number of records"},
+		{"actor", "string", "subject of the principal that made the change"},
+		{"op", "string", "create, update, delete or restore"},
+		{"field", "string", "only changes of this field"},
+		{"since", "string", "inclusive lower bound, RFC 3339"},
+		{"until", "string", "inclusive upper bound, RFC 3339"},
+	}
+	apiListQuery = []apiParam{
+		{"limit", "integer", "page size"},
+		{"offset", "integer", "number of records to skip"},
+		{"cursor", "string", "X-Next-Cursor of the previous page"},
+		{"sort", "string", "field to order by"},
+		{"order", "string", "asc or desc"},
+		{"department", "string", "exact match"},
+		{"role", "string", "exact match"},
+		{"isActive", "boolean", "exact match"},
+		{"managerId", "integer", "direct reports of that employee"},
+		{"dateOfBirthFrom", "string", "inclusive lower bound, YYYY-MM-DD"},
+		{"dateOfBirthTo", "string", "inclusive upper bound, YYYY-MM-DD"},
+		{"includeDeleted", "boolean", "also list deleted records"},
+		{"asOf", "string", "list the records as they were at that RFC 3339 instant"},
+	}
+)
+
+// apiRoutes is keyed by method and chi route pattern. Every route of
+// NewHTTPServer outside of the self-describing SCIM endpoints must be
+// listed here.
+var apiRoutes = map[string]apiRoute{
+	"GET " + OpenAPIPath: {
+		summary: "This document",
+		responses: map[int]apiResponse{
+			http.StatusOK: {description: "OpenAPI 3.1 document", contentType: "application/json", body: map[string]any{}},
+		},
+	},
+	"GET /employees": {
+		summary: "List employees",
+		query:   apiListQuery,
+		responses: map[int]apiResponse{
+			http.StatusOK: {
+				description: "a page of records",
+				contentType: "application/json",
+				body:        []Employee{},
+				headers:     []string{"X-Total-Count", "X-Next-Cursor", "Link"},
+			},
+			http.StatusBadRequest: apiProblem("invalid query parameters"),
+		},
+	},
+	"POST /employees": {
+		summary: "Create an employee",
+		body:    map[string]any{"application/json": EmployeeAttrs{}},
+		responses: map[int]apiResponse{
+			http.StatusCreated:              {description: "id of the new record", contentType: "application/json", body: idResponse{}},
+			http.StatusBadRequest:           apiProblem("invalid or taken fields"),
+			http.StatusUnsupportedMediaType: apiProblem("body is not JSON"),
+		},
+	},
+	"POST /employees:batch": {
+		summary: "Apply creates, updates and deletes all-or-nothing",
+		body:    map[string]any{"application/json": BatchRequest{}},
+		responses: map[int]apiResponse{
+			http.StatusOK:                   {description: "every operation was applied", contentType: "application/json", body: batchResponse{}},
+			http.StatusBadRequest:           apiProblem("malformed or empty batch"),
+			http.StatusUnsupportedMediaType: apiProblem("body is not JSON"),
+			http.StatusUnprocessableEntity:  apiProblem("an operation failed, none was applied"),
+		},
+	},
+	"GET /employees.csv": {
+		summary: "Export employees as CSV",
+		query:   apiListQuery,
+		responses: map[int]apiResponse{
+			http.StatusOK:         {description: "every matching record", contentType: CSVContentType, body: ""},
+			http.StatusBadRequest: apiProblem("invalid query parameters"),
+		},
+	},
+	"POST /employees/import": {
+		summary: "Import employees from CSV, all-or-nothing",
+		query: []apiParam{
+			{"map", "string", "<header>:<field>, repeatable"},
+			{"dryRun", "boolean", "only check the rows"},
+		},
+		body: map[string]any{CSVContentType: ""},
+		responses: map[int]apiResponse{
+			http.StatusOK:                   {description: "every row was imported", contentType: "application/json", body: importResponse{}},
+			http.StatusBadRequest:           apiProblem("unmapped or missing columns"),
+			http.StatusUnsupportedMediaType: apiProblem("body is not CSV"),
+			http.StatusUnprocessableEntity:  apiProblem("a row was rejected, none was imported"),
+		},
+	},
+	"GET /employees/events": {
+		summary: "Stream change events as Server-Sent Events",
+		query:   []apiParam{{"lastEventId", "string", "resume after this event, for clients that cannot send Last-Event-ID"}},
+		headers: []apiParam{{"Last-Event-ID", "string", "resume after this event"}},
+		responses: map[int]apiResponse{
+			http.StatusOK:         {description: "an endless stream of ChangeEvent JSON payloads", contentType: EventStreamContentType, body: ""},
+			http.StatusBadRequest: apiProblem("malformed Last-Event-ID"),
+			http.StatusGone:       apiProblem("the events to resume from are no longer kept"),
+		},
+	},
+	"GET /employees/{employeeID:[0-9]+}": {
+		summary: "Get an employee",
+		query: []apiParam{
+			{"includeDeleted", "boolean", "also get the record if it is deleted"},
+			{"asOf", "string", "get the record as it was at that RFC 3339 instant"},
+		},
+		headers: []apiParam{{"If-None-Match", "string", "ETag of a cached copy"}},
+		responses: map[int]apiResponse{
+			http.StatusOK:          apiEmployee,
+			http.StatusNotModified: {description: "the cached copy is current"},
+			http.StatusBadRequest:  apiProblem("malformed query parameters"),
+			http.StatusNotFound:    apiProblem("no such record"),
+		},
+	},
+	"POST /employees/{employeeID:[0-9]+}:restore": {
+		summary: "Restore a deleted employee",
+		responses: map[int]apiResponse{
+			http.StatusOK:         apiEmployee,
+			http.StatusBadRequest: apiProblem("the email was taken, or the department removed, since the record was deleted"),
+			http.StatusNotFound:   apiProblem("no such record, or it was purged"),
+		},
+	},
+	"PUT /employees/{employeeID:[0-9]+}": {
+		summary: "Update the given fields of an employee",
+		headers: []apiParam{apiIfMatch},
+		body:    map[string]any{"application/json": EmployeeAttrs{}},
+		responses: map[int]apiResponse{
+			http.StatusOK:                   apiEmployee,
+			http.StatusAccepted:             {description: "the record as it is until the change takes effect at effectiveAt", contentType: "application/json", body: Employee{}},
+			http.StatusBadRequest:           apiProblem("invalid or taken fields"),
+			http.StatusNotFound:             apiProblem("no such record"),
+			http.StatusPreconditionFailed:   apiProblem("the record changed since it was read"),
+			http.StatusUnsupportedMediaType: apiProblem("body is not JSON"),
+		},
+	},
+	"PATCH /employees/{employeeID:[0-9]+}": {
+		summary: "Patch an employee",
+		headers: []apiParam{apiIfMatch},
+		body: map[string]any{
+			MergePatchContentType: map[string]any{},
+			JSONPatchContentType:  []map[string]any{},
+		},
+		responses: map[int]apiResponse{
+			http.StatusOK:                   apiEmployee,
+			http.StatusBadRequest:           apiProblem("malformed patch or invalid result"),
+			http.StatusNotFound:             apiProblem("no such record"),
+			http.StatusPreconditionFailed:   apiProblem("the record changed since it was read"),
+			http.StatusUnsupportedMediaType: apiProblem("unsupported patch format"),
+			http.StatusUnprocessableEntity:  apiProblem("the patch cannot be applied"),
+		},
+	},
+	"DELETE /employees/{employeeID:[0-9]+}": {
+		summary: "Delete an employee",
+		responses: map[int]apiResponse{
+			http.StatusOK:       {description: "id of the deleted record", contentType: "application/json", body: idResponse{}},
+			http.StatusNotFound: apiProblem("no such record"),
+			http.StatusConflict: apiProblem("employees still report to the record, reassign them first"),
+		},
+	},
+	"GET /employees/{employeeID:[0-9]+}/reports": {
+		summary: "List the direct reports of an employee",
+		responses: map[int]apiResponse{
+			http.StatusOK:       {description: "the reports, ordered by id", contentType: "application/json", body: []Employee{}},
+			http.StatusNotFound: apiProblem("no such record"),
+		},
+	},
+	"GET /employees/{employeeID:[0-9]+}/chain": {
+		summary: "List the managers of an employee",
+		responses: map[int]apiResponse{
+			http.StatusOK:       {description: "the managers, the immediate one first", contentType: "application/json", body: []Employee{}},
+			http.StatusNotFound: apiProblem("no such record"),
+		},
+	},
+	"GET /employees/{employeeID:[0-9]+}/org": {
+		summary: "Export the organization under an employee",
+		responses: map[int]apiResponse{
+			http.StatusOK:       {description: "the employee and their reports, recursively", contentType: "application/json", body: OrgNode{}},
+			http.StatusNotFound: apiProblem("no such record"),
+		},
+	},
+	"GET /employees/{employeeID:[0-9]+}/org.dot": {
+		summary: "Export the organization under an employee as Graphviz DOT",
+		responses: map[int]apiResponse{
+			http.StatusOK:       {description: "a digraph of the reporting lines", contentType: GraphvizContentType, body: ""},
+			http.StatusNotFound: apiProblem("no such record"),
+		},
+	},
+	"GET /employees/{employeeID:[0-9]+}/history": {
+		summary: "List the audit records of an employee",
+		query:   apiAuditQuery,
+		responses: map[int]apiResponse{
+			http.StatusOK:         {description: "the changes made to the record, most recent first", contentType: "application/json", body: []AuditRecord{}},
+			http.StatusBadRequest: apiProblem("malformed query parameters"),
+		},
+	},
+	"GET /employees/{employeeID:[0-9]+}/pending": {
+		summary: "List the changes scheduled for an employee",
+		responses: map[int]apiResponse{
+			http.StatusOK:       {description: "pending changes, the soonest first", contentType: "application/json", body: []PendingChange{}},
+			http.StatusNotFound: apiProblem("no such record"),
+		},
+	},
+	"DELETE /employees/{employeeID:[0-9]+}/pending/{changeID:[0-9]+}": {
+		summary: "Cancel a scheduled change",
+		responses: map[int]apiResponse{
+			http.StatusOK:       {description: "id of the cancelled change", contentType: "application/json", body: idResponse{}},
+			http.StatusNotFound: apiProblem("no such pending change"),
+		},
+	},
+	"GET /departments": {
+		summary: "List departments",
+		responses: map[int]apiResponse{
+			http.StatusOK: {description: "every department, ordered by id", contentType: "application/json", body: []Department{}},
+		},
+	},
+	"POST /departments": {
+		summary: "Create a department",
+		body:    map[string]any{"application/json": DepartmentAttrs{}},
+		responses: map[int]apiResponse{
+			http.StatusCreated:              {description: "the new department", contentType: "application/json", body: Department{}, headers: []string{"Location"}},
+			http.StatusBadRequest:           apiProblem("invalid or taken fields"),
+			http.StatusUnsupportedMediaType: apiProblem("body is not JSON"),
+		},
+	},
+	"GET /departments/{departmentID:[0-9]+}": {
+		summary: "Get a department",
+		responses: map[int]apiResponse{
+			http.StatusOK:       {description: "the department", contentType: "application/json", body: Department{}},
+			http.StatusNotFound: apiProblem("no such department"),
+		},
+	},
+	"PUT /departments/{departmentID:[0-9]+}": {
+		summary: "Update the given fields of a department, a new name is given to its employees too",
+		body:    map[string]any{"application/json": DepartmentAttrs{}},
+		responses: map[int]apiResponse{
+			http.StatusOK:                   {description: "the updated department", contentType: "application/json", body: Department{}},
+			http.StatusBadRequest:           apiProblem("invalid or taken fields"),
+			http.StatusNotFound:             apiProblem("no such department"),
+			http.StatusConflict:             apiProblem("deleted employees or scheduled changes still use the name"),
+			http.StatusUnsupportedMediaType: apiProblem("body is not JSON"),
+		},
+	},
+	"DELETE /departments/{departmentID:[0-9]+}": {
+		summary: "Delete a department",
+		responses: map[int]apiResponse{
+			http.StatusOK:       {description: "id of the deleted department", contentType: "application/json", body: idResponse{}},
+			http.StatusNotFound: apiProblem("no such department"),
+			http.StatusConflict: apiProblem("employees, deleted ones or scheduled changes still belong to the department, move them first"),
+		},
+	},
+	"GET /departments/{departmentID:[0-9]+}/employees": {
+		summary: "List the employees of a department",
+		responses: map[int]apiResponse{
+			http.StatusOK:       {description: "the headcount and members, ordered by id", contentType: "application/json", body: DepartmentMembers{}},
+			http.StatusNotFound: apiProblem("no such department"),
+		},
+	},
+	"GET /audit": {
+		summary: "Search the audit log",
+		query:   append([]apiParam{{"targetId", "integer", "id of the changed employee"}}, apiAuditQuery...),
+		responses: map[int]apiResponse{
+			http.StatusOK:         {description: "matching records, most recent first", contentType: "application/json", body: []AuditRecord{}},
+			http.StatusBadRequest: apiProblem("malformed query parameters"),
+		},
+	},
+	"GET /webhooks": {
+		summary: "List webhooks",
+		responses: map[int]apiResponse{
+			http.StatusOK: {description: "every webhook, without secrets", contentType: "application/json", body: []Webhook{}},
+		},
+	},
+	"POST /webhooks": {
+		summary: "Subscribe a webhook to employee lifecycle events",
+		body:    map[string]any{"application/json": WebhookAttrs{}},
+		responses: map[int]apiResponse{
+			http.StatusCreated:              {description: "the webhook, including its signing secret", contentType: "application/json", body: Webhook{}, headers: []string{"Location"}},
+			http.StatusBadRequest:           apiProblem("invalid or missing fields"),
+			http.StatusUnsupportedMediaType: apiProblem("body is not JSON"),
+		},
+	},
+	"GET /webhooks/{webhookID:[0-9]+}": {
+		summary: "Get a webhook",
+		responses: map[int]apiResponse{
+			http.StatusOK:       {description: "the webhook, without its secret", contentType: "application/json", body: Webhook{}},
+			http.StatusNotFound: apiProblem("no such webhook"),
+		},
+	},
+	"PUT /webhooks/{webhookID:[0-9]+}": {
+		summary: "Update a webhook",
+		body:    map[string]any{"application/json": WebhookAttrs{}},
+		responses: map[int]apiResponse{
+			http.StatusOK:                   {description: "the updated webhook, without its secret", contentType: "application/json", body: Webhook{}},
+			http.StatusBadRequest:           apiProblem("invalid fields"),
+			http.StatusNotFound:             apiProblem("no such webhook"),
+			http.StatusUnsupportedMediaType: apiProblem("body is not JSON"),
+		},
+	},
+	"DELETE /webhooks/{webhookID:[0-9]+}": {
+		summary: "Delete a webhook",
+		responses: map[int]apiResponse{
+			http.StatusOK:       {description: "id of the deleted webhook", contentType: "application/json", body: idResponse{}},
+			http.StatusNotFound: apiProblem("no such webhook"),
+		},
+	},
+	"GET /webhooks/dead-letters": {
+		summary: "List deliveries that failed every attempt",
+		responses: map[int]apiResponse{
+			http.StatusOK: {description: "every dead letter", contentType: "application/json", body: []WebhookDelivery{}},
+		},
+	},
+	"POST /webhooks/dead-letters/{deliveryID:[0-9]+}/replay": {
+		summary: "Deliver a dead letter again",
+		responses: map[int]apiResponse{
+			http.StatusAccepted: {description: "id of the delivery queued again", contentType: "application/json", body: idResponse{}},
+			http.StatusNotFound: apiProblem("no such dead letter, or its webhook was deleted"),
+		},
+	},
+}
+
+// openAPIDocument is the subset of OpenAPI 3.1 this API needs
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+	Security   []map[string][]string                   `json:"security,omitempty"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*jsonSchema           `json:"schemas"`
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type openAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+type openAPIOperation struct {
+	Summary     string                      `json:"summary"`
+	OperationID string                      `json:"operationId"`
+	Parameters  []openAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+	// Security overrides the document's, an empty list makes the
+	// operation public
+	Security *[]map[string][]string `json:"security,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string      `json:"name"`
+	In          string      `json:"in"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Schema      *jsonSchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Headers     map[string]openAPIHeader    `json:"headers,omitempty"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIHeader struct {
+	Schema *jsonSchema `json:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema *jsonSchema `json:"schema"`
+}
+
+// jsonSchema is the subset of JSON Schema 2020-12 generated from Go types
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 any                    `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties,omitempty"`
+	AnyOf                []*jsonSchema          `json:"anyOf,omitempty"`
+}
+
+// newOpenAPIDocument documents every route of router from apiRoutes.
+// Routes under scimBasePath and GraphQLPath are left out as SCIM and
+// GraphQL describe themselves, at /scim/v2/Schemas and through
+// introspection respectively. Undocumented routes are reported in the error but
+// do not prevent documenting the others. When authenticated, every
+// operation but the document itself requires an API key or bearer token
+// and may be forbidden to the principal.
+func newOpenAPIDocument(router chi.Routes, authenticated bool) (openAPIDocument, error) {
+	doc := openAPIDocument{
+		OpenAPI: "3.1.0",
+		Info:    openAPIInfo{Title: "eCRUD", Version: "1"},
+		Paths:   map[string]map[string]*openAPIOperation{},
+		Components: openAPIComponents{
+			Schemas: map[string]*jsonSchema{},
+		},
+	}
+	gen := schemaGenerator{schemas: doc.Components.Schemas}
+	if authenticated {
+		doc.Components.SecuritySchemes = map[string]openAPISecurityScheme{
+			"apiKey": {Type: "apiKey", Name: APIKeyHeader, In: "header"},
+			"bearer": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+		}
+		doc.Security = []map[string][]string{{"apiKey": {}}, {"bearer": {}}}
+	}
+
+	var undocumented []error
+	err := chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route = apiRoutePattern(route)
+		if strings.HasPrefix(route, scimBasePath+"/") || route == GraphQLPath {
+			return nil
+		}
+		spec, ok := apiRoutes[method+" "+route]
+		if !ok {
+			undocumented = append(undocumented, fmt.Errorf("route %s %s is not documented", method, route))
+			return nil
+		}
+
+		path, params := openAPIPath(route)
+		op := &openAPIOperation{
+			Summary:     spec.summary,
+			OperationID: strings.ToLower(method) + apiOperationName(path),
+			Parameters:  params,
+			Responses:   map[string]*openAPIResponse{},
+		}
+		for _, p := range spec.query {
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name:        p.name,
+				In:          "query",
+				Description: p.description,
+				Schema:      &jsonSchema{Type: p.typ},
+			})
+		}
+		for _, p := range spec.headers {
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name:        p.name,
+				In:          "header",
+				Description: p.description,
+				Schema:      &jsonSchema{Type: p.typ},
+			})
+		}
+		if spec.body != nil {
+			op.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{}}
+			for ct, body := range spec.body {
+				op.RequestBody.Content[ct] = openAPIMediaType{Schema: gen.schema(reflect.TypeOf(body))}
+			}
+		}
+		for status, resp := range spec.responses {
+			r := &openAPIResponse{Description: resp.description}
+			if resp.contentType != "" {
+				r.Content = map[string]openAPIMediaType{
+					resp.contentType: {Schema: gen.schema(reflect.TypeOf(resp.body))},
+				}
+			}
+			for _, h := range resp.headers {
+				if r.Headers == nil {
+					r.Headers = map[string]openAPIHeader{}
+				}
+				r.Headers[h] = openAPIHeader{Schema: &jsonSchema{Type: "string"}}
+			}
+			op.Responses[strconv.Itoa(status)] = r
+		}
+		if authenticated {
+			if route == OpenAPIPath {
+				op.Security = &[]map[string][]string{}
+			} else {
+				problem := map[string]openAPIMediaType{
+					ProblemContentType: {Schema: gen.schema(reflect.TypeOf(Problem{}))},
+				}
+				op.Responses[strconv.Itoa(http.StatusUnauthorized)] = &openAPIResponse{
+					Description: "missing or invalid credentials",
+					Headers:     map[string]openAPIHeader{"WWW-Authenticate": {Schema: &jsonSchema{Type: "string"}}},
+					Content:     problem,
+				}
+				op.Responses[strconv.Itoa(http.StatusForbidden)] = &openAPIResponse{
+					Description: "the principal may not perform the request",
+					Content:     problem,
+				}
+			}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*openAPIOperation{}
+		}
+		doc.Paths[path][strings.ToLower(method)] = op
+		return nil
+	})
+
+	if err != nil {
+		return doc, err
+	}
+	// error bodies are Problem documents, which carry the members of
+	// these too; listed for clients that decode errors into them
+	gen.schema(reflect.TypeOf(ErrBadRequest{}))
+	gen.schema(reflect.TypeOf(ErrNotFound{}))
+
+	return doc, errors.Join(undocumented...)
+}
+
+// apiRoutePattern drops the trailing slash chi reports for routes
+// registered as "/" within a sub-router
+func apiRoutePattern(route string) string {
+	if len(route) > 1 {
+		route = strings.TrimSuffix(route, "/")
+	}
+
+	return route
+}
+
+// openAPIPath turns chi's `{name:regexp}` placeholders into OpenAPI path
+// parameters. A placeholder may be followed by a custom method, ie.
+// `{id}:restore`.
+func openAPIPath(route string) (string, []openAPIParameter) {
+	var params []openAPIParameter
+	segments := strings.Split(route, "/")
+	for i, seg := range segments {
+		end := strings.LastIndex(seg, "}")
+		if !strings.HasPrefix(seg, "{") || end < 0 {
+			continue
+		}
+		name, pattern, _ := strings.Cut(seg[1:end], ":")
+		schema := &jsonSchema{Type: "string", Pattern: pattern}
+		if pattern == "[0-9]+" {
+			schema = &jsonSchema{Type: "integer"}
+		}
+		params = append(params, openAPIParameter{Name: name, In: "path", Required: true, Schema: schema})
+		segments[i] = "{" + name + "}" + seg[end+1:]
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+// apiOperationName derives a camel cased name from a path, ie.
+// "/employees/{employeeID}" becomes "EmployeesByEmployeeID"
+func apiOperationName(path string) string {
+	var b strings.Builder
+	for _, seg := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '.' || r == ':'
+	}) {
+		if strings.HasPrefix(seg, "{") {
+			b.WriteString("By")
+			seg = strings.Trim(seg, "{}")
+		}
+		b.WriteString(strings.ToUpper(seg[:1]) + seg[1:])
+	}
+
+	return b.String()
+}
+
+// schemaGenerator derives JSON schemas from Go types the way
+// encoding/json marshals them. Named struct types are added to schemas
+// and referenced.
+type schemaGenerator struct {
+	schemas map[string]*jsonSchema
+}
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	timeType       = reflect.TypeOf(time.Time{})
+)
+
+func (gen schemaGenerator) schema(t reflect.Type) *jsonSchema {
+	switch {
+	case t == rawMessageType:
+		return &jsonSchema{}
+	case t == timeType:
+		return &jsonSchema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Pointer:
+		return gen.schema(t.Elem())
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &jsonSchema{Type: "array", Items: gen.schema(t.Elem())}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: gen.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return gen.object(t)
+		}
+		ref := &jsonSchema{Ref: "#/components/schemas/" + t.Name()}
+		if _, done := gen.schemas[t.Name()]; !done {
+			// registered before recursing so self references terminate
+			gen.schemas[t.Name()] = &jsonSchema{}
+			*gen.schemas[t.Name()] = *gen.object(t)
+		}
+		return ref
+	default:
+		// interfaces hold arbitrary JSON
+		return &jsonSchema{}
+	}
+}
+
+// object describes a struct. Fields that are marshalled even when unset
+// are required; pointers without omitempty may be null.
+func (gen schemaGenerator) object(t reflect.Type) *jsonSchema {
+	s := &jsonSchema{Type: "object", Properties: map[string]*jsonSchema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			// embedded fields are marshalled inline
+			embedded := gen.object(f.Type)
+			for field, prop := range embedded.Properties {
+				s.Properties[field] = prop
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		omitempty := strings.Contains(opts, "omitempty")
+
+		prop := gen.schema(f.Type)
+		nullable := f.Type.Kind() == reflect.Pointer || f.Type.Kind() == reflect.Slice || f.Type.Kind() == reflect.Map
+		if nullable && !omitempty {
+			prop = nullableSchema(prop)
+		}
+		if strings.Contains(opts, "string") {
+			prop = &jsonSchema{Type: "string"}
+		}
+		s.Properties[name] = prop
+		if !omitempty {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+
+	return s
+}
+
+// nullableSchema additionally allows null
+func nullableSchema(s *jsonSchema) *jsonSchema {
+	typ, ok := s.Type.(string)
+	switch {
+	case ok:
+		nullable := *s
+		nullable.Type = []string{typ, "null"}
+		return &nullable
+	case s.Ref != "":
+		return &jsonSchema{AnyOf: []*jsonSchema{s, {Type: "null"}}}
+	default:
+		// any JSON value, null included
+		return s
+	}
+}
@@ -0,0 +1,448 @@
+package ecrud_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+)
+
+// TestOpenAPI fails whenever /openapi.json and the handlers disagree:
+// on the set of routes, or on the statuses, media types and shapes of
+// the responses to a sample request for every documented operation.
+func TestOpenAPI(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	feed := ecrud.NewChangeFeed(ecrud.DefaultChangeFeedSize)
+	hooks := ecrud.NewWebhooks(&log, ecrud.WithWebhookRetries(1, 0))
+	defer hooks.Close()
+	stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+		1: {
+			FirstName:   "David",
+			LastName:    "Ebreo",
+			DateOfBirth: "2001-04-15",
+			Email:       "hire@me.com",
+		},
+		2: {
+			FirstName:   "Tim",
+			LastName:    "Cook",
+			DateOfBirth: "1960-11-01",
+			Email:       "tim@apple.com",
+		},
+	}, &log, ecrud.WithChangeFeed(feed))
+	audit := ecrud.NewAuditRing(0)
+	core := ecrud.NewServiceAuditMiddleware(ecrud.NewServiceWebhookMiddleware(stub, hooks), audit, &log)
+	sched := ecrud.NewServiceSchedulerMiddleware(core, ecrud.NewPendingMemory(), &log)
+	defer sched.Close()
+	depts := ecrud.NewDepartments(core, &log)
+	svc := ecrud.NewServiceValidationMiddleware(ecrud.NewServiceDepartmentMiddleware(sched, depts, &log), &log)
+	hndlr := ecrud.NewHTTPServer(svc, &log,
+		ecrud.WithEventStream(feed),
+		ecrud.WithWebhookAdmin(hooks),
+		ecrud.WithAuditLog(audit),
+		ecrud.WithScheduler(sched),
+		ecrud.WithDepartments(depts),
+	)
+	code, name := "RET", "Retail"
+	if _, err := depts.Create(ctx, ecrud.DepartmentAttrs{Code: &code, Name: &name}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a webhook whose deliveries fail, to have a dead letter to replay
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+	if _, err := hooks.Create(ctx, ecrud.WebhookAttrs{URL: &receiver.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Delete(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	for letters, _ := hooks.DeadLetters(ctx); len(letters) == 0; letters, _ = hooks.DeadLetters(ctx) {
+		time.Sleep(time.Millisecond)
+	}
+
+	w := httptest.NewRecorder()
+	hndlr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ecrud.OpenAPIPath, nil))
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %d", ecrud.OpenAPIPath, w.Result().StatusCode)
+	}
+	var doc struct {
+		OpenAPI    string                                 `json:"openapi"`
+		Paths      map[string]map[string]openAPIOperation `json:"paths"`
+		Components struct {
+			Schemas map[string]*schema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(w.Result().Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("documents every route", func(tt *testing.T) {
+		as := assert.New(tt)
+		as.Equal("3.1.0", doc.OpenAPI)
+		placeholder := regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+		var routed, documented []string
+		err := chi.Walk(hndlr.(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+			if strings.HasPrefix(route, "/scim/v2/") || route == ecrud.GraphQLPath {
+				return nil
+			}
+			if len(route) > 1 {
+				route = strings.TrimSuffix(route, "/")
+			}
+			routed = append(routed, method+" "+placeholder.ReplaceAllString(route, "{$1}"))
+			return nil
+		})
+		as.NoError(err)
+		for path, ops := range doc.Paths {
+			for method := range ops {
+				documented = append(documented, strings.ToUpper(method)+" "+path)
+			}
+		}
+		as.ElementsMatch(routed, documented)
+		as.Contains(doc.Components.Schemas, "ErrBadRequest")
+		as.Contains(doc.Components.Schemas, "ErrNotFound")
+	})
+
+	t.Run("responses match their documentation", func(tt *testing.T) {
+		as := assert.New(tt)
+		samples := []struct {
+			op          string
+			target      string
+			contentType string
+			header      http.Header
+			body        string
+			// stream marks endless responses, which are cut off right
+			// after the headers
+			stream bool
+			status int
+		}{
+			{op: "GET /openapi.json", target: "/openapi.json", status: 200},
+			{op: "GET /employees", target: "/employees?limit=1", status: 200},
+			{op: "GET /employees", target: "/employees?sort=salary", status: 400},
+			{op: "GET /employees.csv", target: "/employees.csv", status: 200},
+			{op: "GET /employees.csv", target: "/employees.csv?limit=x", status: 400},
+			{op: "GET /employees/events", target: "/employees/events", stream: true, status: 200},
+			{op: "GET /employees/events", target: "/employees/events?lastEventId=x", status: 400},
+			{op: "GET /employees/events", target: "/employees/events", header: http.Header{"Last-Event-Id": {"99"}}, status: 410},
+			{op: "GET /employees/{employeeID}", target: "/employees/1", status: 200},
+			{op: "GET /employees/{employeeID}", target: "/employees/1", header: http.Header{"If-None-Match": {`"1"`}}, status: 304},
+			{op: "GET /employees/{employeeID}", target: "/employees/99", status: 404},
+			{op: "GET /employees/{employeeID}", target: "/employees/2?includeDeleted=true", status: 200},
+			{op: "GET /employees/{employeeID}", target: "/employees/2?includeDeleted=x", status: 400},
+			{op: "GET /employees/{employeeID}", target: "/employees/1?asOf=2000-01-01", status: 400},
+			{
+				op:          "POST /employees",
+				target:      "/employees",
+				contentType: "application/json",
+				body:        `{"firstName": "Tim", "lastName": "Cook", "dateOfBirth": "1960-11-01", "email": "tim@apple.com"}`,
+				status:      201,
+			},
+			{op: "POST /employees", target: "/employees", contentType: "application/json", body: `{}`, status: 400},
+			{op: "POST /employees", target: "/employees", contentType: "text/plain", body: `x`, status: 415},
+			{
+				op:          "POST /employees:batch",
+				target:      "/employees:batch",
+				contentType: "application/json",
+				body:        `{"ops": [{"op": "update", "id": 1, "attrs": {"role": "CEO"}}]}`,
+				status:      200,
+			},
+			{op: "POST /employees:batch", target: "/employees:batch", contentType: "application/json", body: `{"ops": []}`, status: 400},
+			{op: "POST /employees:batch", target: "/employees:batch", contentType: "text/plain", body: `x`, status: 415},
+			{op: "POST /employees:batch", target: "/employees:batch", contentType: "application/json", body: `{"ops": [{"op": "delete", "id": 99}]}`, status: 422},
+			{
+				op:          "POST /employees/import",
+				target:      "/employees/import?dryRun=true",
+				contentType: "text/csv",
+				body:        "firstName,lastName,dateOfBirth,email\nPhil,Schiller,1960-07-08,phil@apple.com\n",
+				status:      200,
+			},
+			{op: "POST /employees/import", target: "/employees/import", contentType: "text/csv", body: "salary\n1\n", status: 400},
+			{op: "POST /employees/import", target: "/employees/import", contentType: "application/json", body: `{}`, status: 415},
+			{
+				op:          "POST /employees/import",
+				target:      "/employees/import",
+				contentType: "text/csv",
+				body:        "firstName,lastName,dateOfBirth,email\nP,S,1960-07-08,phil@apple.com\n",
+				status:      422,
+			},
+			{op: "PUT /employees/{employeeID}", target: "/employees/1", contentType: "application/json", body: `{"role": "CTO"}`, status: 200},
+			{op: "PUT /employees/{employeeID}", target: "/employees/1", contentType: "application/json", body: `{"email": "x"}`, status: 400},
+			{op: "PUT /employees/{employeeID}", target: "/employees/99", contentType: "application/json", body: `{}`, status: 404},
+			{op: "PUT /employees/{employeeID}", target: "/employees/1", contentType: "application/json", header: http.Header{"If-Match": {`"1"`}}, body: `{}`, status: 412},
+			{op: "PUT /employees/{employeeID}", target: "/employees/1", contentType: "text/plain", body: `x`, status: 415},
+			{op: "PATCH /employees/{employeeID}", target: "/employees/1", contentType: ecrud.MergePatchContentType, body: `{"role": null}`, status: 200},
+			{op: "PATCH /employees/{employeeID}", target: "/employees/1", contentType: ecrud.MergePatchContentType, body: `{"id": 2}`, status: 400},
+			{op: "PATCH /employees/{employeeID}", target: "/employees/99", contentType: ecrud.MergePatchContentType, body: `{}`, status: 404},
+			{op: "PATCH /employees/{employeeID}", target: "/employees/1", contentType: ecrud.MergePatchContentType, header: http.Header{"If-Match": {`"1"`}}, body: `{}`, status: 412},
+			{op: "PATCH /employees/{employeeID}", target: "/employees/1", contentType: "application/json", body: `{}`, status: 415},
+			{
+				op:          "PATCH /employees/{employeeID}",
+				target:      "/employees/1",
+				contentType: ecrud.JSONPatchContentType,
+				body:        `[{"op": "test", "path": "/role", "value": "CFO"}]`,
+				status:      422,
+			},
+			{
+				op:          "PUT /employees/{employeeID}",
+				target:      "/employees/1",
+				contentType: "application/json",
+				body:        `{"department": "Retail", "effectiveAt": "2100-01-01T00:00:00Z"}`,
+				status:      202,
+			},
+			{op: "GET /employees/{employeeID}/pending", target: "/employees/1/pending", status: 200},
+			{op: "GET /employees/{employeeID}/pending", target: "/employees/99/pending", status: 404},
+			{op: "DELETE /employees/{employeeID}/pending/{changeID}", target: "/employees/1/pending/1", status: 200},
+			{op: "DELETE /employees/{employeeID}/pending/{changeID}", target: "/employees/1/pending/1", status: 404},
+			{op: "GET /employees/{employeeID}/history", target: "/employees/2/history", status: 200},
+			{op: "GET /employees/{employeeID}/history", target: "/employees/2/history?since=yesterday", status: 400},
+			{op: "GET /departments", target: "/departments", status: 200},
+			{op: "POST /departments", target: "/departments", contentType: "application/json", body: `{"code": "ENG", "name": "Engineering"}`, status: 201},
+			{op: "POST /departments", target: "/departments", contentType: "application/json", body: `{}`, status: 400},
+			{op: "POST /departments", target: "/departments", contentType: "text/plain", body: `x`, status: 415},
+			{op: "GET /departments/{departmentID}", target: "/departments/2", status: 200},
+			{op: "GET /departments/{departmentID}", target: "/departments/99", status: 404},
+			{op: "PUT /departments/{departmentID}", target: "/departments/2", contentType: "application/json", body: `{"name": "Software"}`, status: 200},
+			{op: "PUT /departments/{departmentID}", target: "/departments/2", contentType: "application/json", body: `{"code": "ret"}`, status: 400},
+			{op: "PUT /departments/{departmentID}", target: "/departments/99", contentType: "application/json", body: `{}`, status: 404},
+			{op: "PUT /departments/{departmentID}", target: "/departments/2", contentType: "text/plain", body: `x`, status: 415},
+			{op: "PUT /employees/{employeeID}", target: "/employees/1", contentType: "application/json", body: `{"department": "ret"}`, status: 200},
+			{op: "PUT /employees/{employeeID}", target: "/employees/1", contentType: "application/json", body: `{"department": "Sales"}`, status: 400},
+			{op: "GET /departments/{departmentID}/employees", target: "/departments/1/employees", status: 200},
+			{op: "GET /departments/{departmentID}/employees", target: "/departments/99/employees", status: 404},
+			{op: "DELETE /departments/{departmentID}", target: "/departments/1", status: 409},
+			{op: "DELETE /departments/{departmentID}", target: "/departments/2", status: 200},
+			{op: "DELETE /departments/{departmentID}", target: "/departments/2", status: 404},
+			{op: "GET /audit", target: "/audit?op=delete&limit=10", status: 200},
+			{op: "GET /audit", target: "/audit?op=rename", status: 400},
+			{op: "GET /webhooks", target: "/webhooks", status: 200},
+			{op: "POST /webhooks", target: "/webhooks", contentType: "application/json", body: `{"url": "https://example.com/hook"}`, status: 201},
+			{op: "POST /webhooks", target: "/webhooks", contentType: "application/json", body: `{"url": "ftp://x"}`, status: 400},
+			{op: "POST /webhooks", target: "/webhooks", contentType: "text/plain", body: `x`, status: 415},
+			{op: "GET /webhooks/{webhookID}", target: "/webhooks/1", status: 200},
+			{op: "GET /webhooks/{webhookID}", target: "/webhooks/99", status: 404},
+			{op: "PUT /webhooks/{webhookID}", target: "/webhooks/2", contentType: "application/json", body: `{"active": false}`, status: 200},
+			{op: "PUT /webhooks/{webhookID}", target: "/webhooks/2", contentType: "application/json", body: `{"events": ["x"]}`, status: 400},
+			{op: "PUT /webhooks/{webhookID}", target: "/webhooks/99", contentType: "application/json", body: `{}`, status: 404},
+			{op: "PUT /webhooks/{webhookID}", target: "/webhooks/2", contentType: "text/plain", body: `x`, status: 415},
+			{op: "DELETE /webhooks/{webhookID}", target: "/webhooks/2", status: 200},
+			{op: "DELETE /webhooks/{webhookID}", target: "/webhooks/2", status: 404},
+			{op: "GET /webhooks/dead-letters", target: "/webhooks/dead-letters", status: 200},
+			{op: "POST /webhooks/dead-letters/{deliveryID}/replay", target: "/webhooks/dead-letters/1/replay", status: 202},
+			{op: "POST /webhooks/dead-letters/{deliveryID}/replay", target: "/webhooks/dead-letters/99/replay", status: 404},
+			{op: "PUT /employees/{employeeID}", target: "/employees/3", contentType: "application/json", body: `{"managerId": 1}`, status: 200},
+			{op: "GET /employees/{employeeID}/reports", target: "/employees/1/reports", status: 200},
+			{op: "GET /employees/{employeeID}/reports", target: "/employees/99/reports", status: 404},
+			{op: "GET /employees/{employeeID}/chain", target: "/employees/3/chain", status: 200},
+			{op: "GET /employees/{employeeID}/chain", target: "/employees/99/chain", status: 404},
+			{op: "GET /employees/{employeeID}/org", target: "/employees/1/org", status: 200},
+			{op: "GET /employees/{employeeID}/org", target: "/employees/99/org", status: 404},
+			{op: "GET /employees/{employeeID}/org.dot", target: "/employees/1/org.dot", status: 200},
+			{op: "GET /employees/{employeeID}/org.dot", target: "/employees/99/org.dot", status: 404},
+			{op: "DELETE /employees/{employeeID}", target: "/employees/1", status: 409},
+			{op: "PATCH /employees/{employeeID}", target: "/employees/3", contentType: ecrud.MergePatchContentType, body: `{"managerId": null}`, status: 200},
+			{op: "DELETE /employees/{employeeID}", target: "/employees/99", status: 404},
+			{op: "DELETE /employees/{employeeID}", target: "/employees/1", status: 200},
+			{op: "POST /employees/{employeeID}:restore", target: "/employees/1:restore", status: 200},
+			// tim@apple.com was taken again since employee 2 was deleted
+			{op: "POST /employees/{employeeID}:restore", target: "/employees/2:restore", status: 400},
+			{op: "POST /employees/{employeeID}:restore", target: "/employees/99:restore", status: 404},
+		}
+
+		exercised := map[string]bool{}
+		for _, s := range samples {
+			method, path, _ := strings.Cut(s.op, " ")
+			op, ok := doc.Paths[path][strings.ToLower(method)]
+			if !as.True(ok, "%s is not documented", s.op) {
+				continue
+			}
+			exercised[s.op] = true
+
+			var body io.Reader
+			if s.body != "" {
+				body = bytes.NewBufferString(s.body)
+			}
+			r := httptest.NewRequest(method, s.target, body)
+			if s.stream {
+				ctx, cancel := context.WithCancel(r.Context())
+				cancel()
+				r = r.WithContext(ctx)
+			}
+			if s.contentType != "" {
+				r.Header.Set("Content-Type", s.contentType)
+			}
+			for k, v := range s.header {
+				r.Header[k] = v
+			}
+			w := httptest.NewRecorder()
+			hndlr.ServeHTTP(w, r)
+			resp := w.Result()
+			if !as.Equal(s.status, resp.StatusCode, "%s %s", method, s.target) {
+				continue
+			}
+
+			documented, ok := op.Responses[strconv.Itoa(resp.StatusCode)]
+			if !as.True(ok, "%s does not document status %d", s.op, resp.StatusCode) {
+				continue
+			}
+			if len(documented.Content) == 0 {
+				continue
+			}
+			mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+			media, ok := documented.Content[mt]
+			if !as.True(ok, "%s %d does not document %s", s.op, resp.StatusCode, mt) {
+				continue
+			}
+			for name := range documented.Headers {
+				if name == "X-Next-Cursor" || name == "Link" {
+					continue // only sent when there is a next page
+				}
+				as.NotEmpty(resp.Header.Get(name), "%s %d header %s", s.op, resp.StatusCode, name)
+			}
+			if !strings.HasSuffix(mt, "json") {
+				continue
+			}
+			var v any
+			if as.NoError(json.NewDecoder(resp.Body).Decode(&v)) {
+				for _, problem := range media.Schema.validate(v, "", doc.Components.Schemas) {
+					as.Fail(problem, "%s %s", method, s.target)
+				}
+			}
+		}
+
+		for path, ops := range doc.Paths {
+			for method := range ops {
+				op := strings.ToUpper(method) + " " + path
+				as.True(exercised[op], "no sample request for %s", op)
+			}
+		}
+	})
+}
+
+type openAPIOperation struct {
+	Responses map[string]struct {
+		Headers map[string]any `json:"headers"`
+		Content map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+// schema is the part of JSON Schema the generated document uses
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 any                `json:"type"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	Items                *schema            `json:"items"`
+	AdditionalProperties *schema            `json:"additionalProperties"`
+	AnyOf                []*schema          `json:"anyOf"`
+}
+
+// validate reports every way v deviates from s. Objects may not have
+// members the schema does not declare, so that fields added to a
+// handler's response without documenting them are caught too.
+func (s *schema) validate(v any, at string, defs map[string]*schema) []string {
+	if s.Ref != "" {
+		return defs[strings.TrimPrefix(s.Ref, "#/components/schemas/")].validate(v, at, defs)
+	}
+	if s.AnyOf != nil {
+		for _, alt := range s.AnyOf {
+			if alt.validate(v, at, defs) == nil {
+				return nil
+			}
+		}
+		return []string{at + ": matches no alternative"}
+	}
+
+	var types []string
+	switch t := s.Type.(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		for _, tt := range t {
+			types = append(types, tt.(string))
+		}
+	default:
+		return nil
+	}
+	var actual string
+	switch v.(type) {
+	case nil:
+		actual = "null"
+	case bool:
+		actual = "boolean"
+	case float64:
+		actual = "number"
+		if f := v.(float64); f == float64(int64(f)) {
+			actual = "integer"
+		}
+	case string:
+		actual = "string"
+	case []any:
+		actual = "array"
+	case map[string]any:
+		actual = "object"
+	}
+	sort.Strings(types)
+	if i := sort.SearchStrings(types, actual); i == len(types) || types[i] != actual {
+		if !(actual == "integer" && contains(types, "number")) {
+			return []string{at + ": is " + actual + ", documented as " + strings.Join(types, "|")}
+		}
+	}
+
+	var problems []string
+	switch v := v.(type) {
+	case []any:
+		for i, item := range v {
+			problems = append(problems, s.Items.validate(item, at+"/"+strconv.Itoa(i), defs)...)
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				problems = append(problems, at+"/"+name+": required but missing")
+			}
+		}
+		for name, member := range v {
+			prop, ok := s.Properties[name]
+			if !ok && s.AdditionalProperties != nil {
+				prop, ok = s.AdditionalProperties, true
+			}
+			if !ok {
+				if s.Properties != nil {
+					problems = append(problems, at+"/"+name+": not documented")
+				}
+				continue
+			}
+			problems = append(problems, prop.validate(member, at+"/"+name, defs)...)
+		}
+	}
+
+	return problems
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,120 @@
+package ecrud
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// GraphvizContentType is the media type of DOT exports
+const GraphvizContentType = "text/vnd.graphviz"
+
+// OrgNode is an employee and, recursively, those reporting to them
+type OrgNode struct {
+	Employee
+	Reports []OrgNode `json:"reports"`
+}
+
+// directReports lists the live employees reporting to id, in id order.
+// A missing manager is ErrNotFound rather than an empty list.
+func directReports(ctx context.Context, svc Service, id int) ([]Employee, error) {
+	if _, err := svc.Get(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return listReports(ctx, svc, id)
+}
+
+func listReports(ctx context.Context, svc Service, id int) ([]Employee, error) {
+	return listAll(ctx, svc, ListOptions{ManagerID: &id})
+}
+
+// managementChain lists the managers of id, the immediate one first
+func managementChain(ctx context.Context, svc Service, id int) ([]Employee, error) {
+	e, err := svc.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := []Employee{}
+	// validation keeps cycles out, the guard keeps a corrupted store
+	// from looping forever
+	seen := map[int]struct{}{id: {}}
+	for e.ManagerID != nil {
+		if _, loop := seen[*e.ManagerID]; loop {
+			break
+		}
+		seen[*e.ManagerID] = struct{}{}
+		e, err = svc.Get(ctx, *e.ManagerID)
+		// a purged manager ends the chain like a missing one
+		if errors.As(err, &ErrNotFound{}) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, e)
+	}
+
+	return chain, nil
+}
+
+// orgSubtree returns id and everybody reporting to them, directly or not
+func orgSubtree(ctx context.Context, svc Service, id int) (OrgNode, error) {
+	e, err := svc.Get(ctx, id)
+	if err != nil {
+		return OrgNode{}, err
+	}
+
+	seen := map[int]struct{}{}
+	var build func(e Employee) (OrgNode, error)
+	build = func(e Employee) (OrgNode, error) {
+		seen[e.ID] = struct{}{}
+		node := OrgNode{Employee: e, Reports: []OrgNode{}}
+		reports, err := listReports(ctx, svc, e.ID)
+		if err != nil {
+			return node, err
+		}
+		for _, report := range reports {
+			if _, loop := seen[report.ID]; loop {
+				continue
+			}
+			child, err := build(report)
+			if err != nil {
+				return node, err
+			}
+			node.Reports = append(node.Reports, child)
+		}
+		return node, nil
+	}
+
+	return build(e)
+}
+
+// WriteDOT writes the subtree rooted at node as a Graphviz digraph,
+// one box per employee labelled with their name and role
+func (node OrgNode) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph org {")
+	fmt.Fprintln(bw, "\tnode [shape=box];")
+
+	var write func(n OrgNode)
+	write = func(n OrgNode) {
+		label := n.FirstName + " " + n.LastName
+		if n.Role != nil {
+			label += "\n" + *n.Role
+		}
+		// %q escapes quotes and newlines the way DOT strings expect
+		fmt.Fprintf(bw, "\t%d [label=%q];\n", n.ID, label)
+		for _, r := range n.Reports {
+			fmt.Fprintf(bw, "\t%d -> %d;\n", n.ID, r.ID)
+			write(r)
+		}
+	}
+	write(node)
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
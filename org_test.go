@@ -0,0 +1,107 @@
+package ecrud_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+)
+
+func TestOrg(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	ceo, cto := 1, 2
+	role := "CTO"
+	stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+		1: {FirstName: "Tim", LastName: "Cook", DateOfBirth: "1960-11-01", Email: "tim@apple.com"},
+		2: {FirstName: "Kevin", LastName: "Lynch", DateOfBirth: "1967-01-01", Email: "kevin@apple.com", Role: &role, ManagerID: &ceo},
+		3: {FirstName: "Craig", LastName: "Federighi", DateOfBirth: "1969-05-27", Email: "craig@apple.com", ManagerID: &cto},
+		4: {FirstName: "Phil", LastName: "Schiller", DateOfBirth: "1960-07-08", Email: "phil@apple.com", ManagerID: &ceo},
+	}, &log)
+	hndlr := ecrud.NewHTTPServer(ecrud.NewServiceValidationMiddleware(stub, &log), &log)
+	get := func(target string, v any) *http.Response {
+		w := httptest.NewRecorder()
+		hndlr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx))
+		if v != nil && w.Code == http.StatusOK {
+			json.NewDecoder(w.Body).Decode(v)
+		}
+		return w.Result()
+	}
+	ids := func(employees []ecrud.Employee) []int {
+		var ids []int
+		for _, e := range employees {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	t.Run("lists direct reports", func(tt *testing.T) {
+		as := assert.New(tt)
+		var reports []ecrud.Employee
+		as.Equal(http.StatusOK, get("/employees/1/reports", &reports).StatusCode)
+		as.Equal([]int{2, 4}, ids(reports))
+		reports = nil
+		as.Equal(http.StatusOK, get("/employees/3/reports", &reports).StatusCode)
+		as.Empty(reports)
+		as.Equal(http.StatusNotFound, get("/employees/99/reports", nil).StatusCode)
+	})
+
+	t.Run("lists the management chain", func(tt *testing.T) {
+		as := assert.New(tt)
+		var chain []ecrud.Employee
+		as.Equal(http.StatusOK, get("/employees/3/chain", &chain).StatusCode)
+		as.Equal([]int{2, 1}, ids(chain))
+
+		// the chain ends at a manager that is gone
+		purged := 99
+		dangling := ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "Tim", LastName: "Cook", DateOfBirth: "1960-11-01", Email: "tim@apple.com", ManagerID: &purged},
+			2: {FirstName: "Kevin", LastName: "Lynch", DateOfBirth: "1967-01-01", Email: "kevin@apple.com", ManagerID: &ceo},
+		}, &log)
+		w := httptest.NewRecorder()
+		ecrud.NewHTTPServer(dangling, &log).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/employees/2/chain", nil))
+		as.Equal(http.StatusOK, w.Code)
+		chain = nil
+		as.NoError(json.NewDecoder(w.Body).Decode(&chain))
+		as.Equal([]int{1}, ids(chain))
+	})
+
+	t.Run("exports subtrees", func(tt *testing.T) {
+		as := assert.New(tt)
+		var tree ecrud.OrgNode
+		as.Equal(http.StatusOK, get("/employees/1/org", &tree).StatusCode)
+		as.Equal(1, tree.ID)
+		if as.Len(tree.Reports, 2) {
+			as.Equal("Kevin", tree.Reports[0].FirstName)
+			if as.Len(tree.Reports[0].Reports, 1) {
+				as.Equal(3, tree.Reports[0].Reports[0].ID)
+			}
+		}
+
+		resp := get("/employees/2/org.dot", nil)
+		as.Equal(http.StatusOK, resp.StatusCode)
+		as.True(strings.HasPrefix(resp.Header.Get("Content-Type"), ecrud.GraphvizContentType))
+		dot, _ := io.ReadAll(resp.Body)
+		as.Contains(string(dot), `2 [label="Kevin Lynch\nCTO"];`)
+		as.Contains(string(dot), "2 -> 3;")
+		as.NotContains(string(dot), "1 -> 2;")
+	})
+
+	t.Run("blocks deleting managers with reports", func(tt *testing.T) {
+		as := assert.New(tt)
+		w := httptest.NewRecorder()
+		hndlr.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/employees/2", nil))
+		as.Equal(http.StatusConflict, w.Code)
+		var problem ecrud.Problem
+		as.NoError(json.NewDecoder(w.Body).Decode(&problem))
+		as.Equal([]int{3}, problem.Reports)
+	})
+}
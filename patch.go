@@ -0,0 +1,163 @@
+package ecrud
+
+import (
+	"encoding/json"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+// Media types accepted by `PATCH /employees/{id}`
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+var patchContentTypes = []string{MergePatchContentType, JSONPatchContentType}
+
+// patchAttrs applies an RFC 7396 merge patch or an RFC 6902 JSON Patch,
+// depending on mediatype, to the JSON form of e. It returns the attrs
+// that turn e into the patched record, pinned to e's version so that a
+// concurrent change between the read and the write is detected, and
+// reports whether the patch changes anything at all. Optional fields
+// the patch removed or nulled are listed in Clear.
+func patchAttrs(e Employee, mediatype string, patch []byte) (EmployeeAttrs, bool, error) {
+	doc, err := json.Marshal(e)
+	if err != nil {
+		return EmployeeAttrs{}, false, err
+	}
+
+	var patched []byte
+	switch mediatype {
+	case MergePatchContentType:
+		if !json.Valid(patch) {
+			return EmployeeAttrs{}, false, ErrMalformedBody{Reason: "invalid merge patch document"}
+		}
+		patched, err = jsonpatch.MergePatch(doc, patch)
+		if err != nil {
+			return EmployeeAttrs{}, false, ErrPatchFailed{Reason: err.Error()}
+		}
+	case JSONPatchContentType:
+		ops, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return EmployeeAttrs{}, false, ErrMalformedBody{Reason: err.Error()}
+		}
+		patched, err = ops.Apply(doc)
+		if err != nil {
+			return EmployeeAttrs{}, false, ErrPatchFailed{Reason: err.Error()}
+		}
+	default:
+		return EmployeeAttrs{}, false, ErrUnsupportedMediaType{
+			ContentType: mediatype,
+			Supported:   patchContentTypes,
+		}
+	}
+
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(patched, &fields); err != nil {
+		return EmployeeAttrs{}, false, ErrPatchFailed{Reason: "patched document is not an object"}
+	}
+
+	d := patchDiff{fields: fields}
+	d.readOnly("id", e.ID)
+	d.readOnly("version", e.Version)
+	attrs := EmployeeAttrs{
+		FirstName:   d.required("firstName", e.FirstName),
+		LastName:    d.required("lastName", e.LastName),
+		DateOfBirth: d.required("dateOfBirth", e.DateOfBirth),
+		Email:       d.required("email", e.Email),
+		IsActive:    patchOptional(&d, "isActive", e.IsActive),
+		Department:  patchOptional(&d, "department", e.Department),
+		Role:        patchOptional(&d, "role", e.Role),
+		ManagerID:   patchOptional(&d, "managerId", e.ManagerID),
+		Version:     &e.Version,
+		Clear:       d.clear,
+	}
+	for name := range fields {
+		if _, known := d.seen[name]; !known {
+			d.ebr.Add(name, ReasonUnknown)
+		}
+	}
+	if !d.ebr.Empty() {
+		return EmployeeAttrs{}, false, d.ebr
+	}
+
+	return attrs, d.changed, nil
+}
+
+// patchDiff compares a patched JSON object field by field against the
+// record it was derived from
+type patchDiff struct {
+	fields  map[string]json.RawMessage
+	seen    map[string]struct{}
+	ebr     ErrBadRequest
+	clear   []string
+	changed bool
+}
+
+// lookup returns the raw patched value of name, or nil if it was
+// removed or set to null
+func (d *patchDiff) lookup(name string) json.RawMessage {
+	if d.seen == nil {
+		d.seen = map[string]struct{}{}
+	}
+	d.seen[name] = struct{}{}
+
+	raw := d.fields[name]
+	if string(raw) == "null" {
+		return nil
+	}
+
+	return raw
+}
+
+func (d *patchDiff) readOnly(name string, current int) {
+	raw := d.lookup(name)
+	if raw == nil {
+		return
+	}
+	var v int
+	if err := json.Unmarshal(raw, &v); err != nil || v != current {
+		d.ebr.Add(name, ReasonReadOnly)
+	}
+}
+
+func (d *patchDiff) required(name, current string) *string {
+	raw := d.lookup(name)
+	if raw == nil {
+		d.ebr.Add(name, ReasonRequired)
+		return nil
+	}
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		d.ebr.Add(name, ReasonMalformed)
+		return nil
+	}
+	if v == current {
+		return nil
+	}
+	d.changed = true
+
+	return &v
+}
+
+func patchOptional[T comparable](d *patchDiff, name string, current *T) *T {
+	raw := d.lookup(name)
+	if raw == nil {
+		if current != nil {
+			d.clear = append(d.clear, name)
+			d.changed = true
+		}
+		return nil
+	}
+	var v T
+	if err := json.Unmarshal(raw, &v); err != nil {
+		d.ebr.Add(name, ReasonMalformed)
+		return nil
+	}
+	if current != nil && v == *current {
+		return nil
+	}
+	d.changed = true
+
+	return &v
+}
@@ -0,0 +1,226 @@
+package ecrud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ProblemContentType is the media type of every error response
+const ProblemContentType = "application/problem+json"
+
+// Stable, machine readable error codes carried by Problem.Code
+const (
+	CodeInvalidParams        = "invalid_params"
+	CodeMalformedBody        = "malformed_body"
+	CodeNotFound             = "not_found"
+	CodeRouteNotFound        = "route_not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeVersionConflict      = "version_conflict"
+	CodeHasReports           = "has_reports"
+	CodeDepartmentNotEmpty   = "department_not_empty"
+	CodeDepartmentInUse      = "department_in_use"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodePatchFailed          = "patch_failed"
+	CodeBatchFailed          = "batch_failed"
+	CodeEventsExpired        = "events_expired"
+	CodeUnauthenticated      = "unauthenticated"
+	CodeForbidden            = "forbidden"
+	CodeTimeout              = "timeout"
+	CodeClientClosedRequest  = "client_closed_request"
+	CodeServerError          = "server_error"
+)
+
+// problemTypeBase prefixes Code to form Problem.Type
+const problemTypeBase = "urn:ecrud:problem:"
+
+// Problem is an RFC 7807 problem details document. Next to the standard
+// members it carries a stable Code to branch on and, as extension
+// members, the fields of the domain error it was built from. Clients
+// that decode error bodies straight into ErrNotFound or ErrBadRequest
+// therefore keep working.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+
+	ID            *int         `json:"id,omitempty"`
+	Version       *int         `json:"version,omitempty"`
+	Reports       []int        `json:"reports,omitempty"`
+	Headcount     *int         `json:"headcount,omitempty"`
+	Employees     []int        `json:"employees,omitempty"`
+	Changes       []int        `json:"changes,omitempty"`
+	Fields        []string     `json:"fields,omitempty"`
+	InvalidParams []FieldError `json:"invalidParams,omitempty"`
+	ContentType   string       `json:"contentType,omitempty"`
+	Supported     []string     `json:"supported,omitempty"`
+	Results       []BatchItem  `json:"results,omitempty"`
+}
+
+// BatchItem is the outcome of a single batch operation as reported over
+// the wire. Error is set only on the operations that failed.
+type BatchItem struct {
+	Index int      `json:"index"`
+	Op    string   `json:"op"`
+	ID    int      `json:"id,omitempty"`
+	Line  int      `json:"line,omitempty"`
+	Error *Problem `json:"error,omitempty"`
+}
+
+func newProblem(status int, code, detail string) Problem {
+	return Problem{
+		Type:   problemTypeBase + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// NewProblem describes err as a Problem. Errors that are not part of
+// the domain are reported as an opaque server error.
+func NewProblem(err error) Problem {
+	var (
+		errnf ErrNotFound
+		errbr ErrBadRequest
+		errcf ErrConflict
+		errhr ErrHasReports
+		errdn ErrDepartmentNotEmpty
+		errdu ErrDepartmentInUse
+		errmt ErrUnsupportedMediaType
+		errmb ErrMalformedBody
+		errpf ErrPatchFailed
+		errbf ErrBatchFailed
+		errex ErrEventsExpired
+		errua ErrUnauthenticated
+		errfb ErrForbidden
+	)
+	switch {
+	case errors.As(err, &errbf):
+		p := newProblem(http.StatusUnprocessableEntity, CodeBatchFailed, errbf.Error())
+		p.Results = make([]BatchItem, len(errbf.Results))
+		for i, res := range errbf.Results {
+			p.Results[i] = BatchItem{Index: res.Index, Op: res.Op, ID: res.ID, Line: res.Line}
+			if res.Err != nil {
+				item := NewProblem(res.Err)
+				p.Results[i].Error = &item
+			}
+		}
+		return p
+	case errors.As(err, &errnf):
+		p := newProblem(http.StatusNotFound, CodeNotFound, errnf.Error())
+		p.ID = &errnf.ID
+		return p
+	case errors.As(err, &errbr):
+		p := newProblem(http.StatusBadRequest, CodeInvalidParams, errbr.Detail())
+		p.Fields = errbr.Fields
+		p.InvalidParams = errbr.Errors
+		return p
+	case errors.As(err, &errcf):
+		p := newProblem(http.StatusPreconditionFailed, CodeVersionConflict, errcf.Error())
+		p.ID = &errcf.ID
+		p.Version = &errcf.Version
+		return p
+	case errors.As(err, &errhr):
+		p := newProblem(http.StatusConflict, CodeHasReports, errhr.Error())
+		p.ID = &errhr.ID
+		p.Reports = errhr.Reports
+		return p
+	case errors.As(err, &errdn):
+		p := newProblem(http.StatusConflict, CodeDepartmentNotEmpty, errdn.Error())
+		p.ID = &errdn.ID
+		p.Headcount = &errdn.Headcount
+		return p
+	case errors.As(err, &errdu):
+		p := newProblem(http.StatusConflict, CodeDepartmentInUse, errdu.Error())
+		p.ID = &errdu.ID
+		p.Employees = errdu.Employees
+		p.Changes = errdu.Changes
+		return p
+	case errors.As(err, &errmt):
+		p := newProblem(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, errmt.Error())
+		p.ContentType = errmt.ContentType
+		p.Supported = errmt.Supported
+		return p
+	case errors.As(err, &errmb):
+		return newProblem(http.StatusBadRequest, CodeMalformedBody, errmb.Error())
+	case errors.As(err, &errpf):
+		return newProblem(http.StatusUnprocessableEntity, CodePatchFailed, errpf.Error())
+	case errors.As(err, &errex):
+		return newProblem(http.StatusGone, CodeEventsExpired, errex.Error())
+	case errors.As(err, &errua):
+		return newProblem(http.StatusUnauthorized, CodeUnauthenticated, errua.Error())
+	case errors.As(err, &errfb):
+		return newProblem(http.StatusForbidden, CodeForbidden, errfb.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return newProblem(http.StatusGatewayTimeout, CodeTimeout, "request timed out")
+	case errors.Is(err, context.Canceled):
+		p := newProblem(StatusClientClosedRequest, CodeClientClosedRequest, "request cancelled by client")
+		p.Title = "Client Closed Request"
+		return p
+	default:
+		return newProblem(http.StatusInternalServerError, CodeServerError, ErrServerError.Error())
+	}
+}
+
+// Err turns p back into the domain error it describes, so that callers
+// of a remote Service can branch on the same error types as local ones.
+// Problems without a domain counterpart wrap ErrServerError.
+func (p Problem) Err() error {
+	var id, version int
+	if p.ID != nil {
+		id = *p.ID
+	}
+	if p.Version != nil {
+		version = *p.Version
+	}
+
+	switch p.Code {
+	case CodeNotFound:
+		return ErrNotFound{ID: id}
+	case CodeInvalidParams:
+		return ErrBadRequest{Fields: p.Fields, Errors: p.InvalidParams}
+	case CodeVersionConflict:
+		return ErrConflict{ID: id, Version: version}
+	case CodeHasReports:
+		return ErrHasReports{ID: id, Reports: p.Reports}
+	case CodeDepartmentNotEmpty:
+		var headcount int
+		if p.Headcount != nil {
+			headcount = *p.Headcount
+		}
+		return ErrDepartmentNotEmpty{ID: id, Headcount: headcount}
+	case CodeDepartmentInUse:
+		return ErrDepartmentInUse{ID: id, Employees: p.Employees, Changes: p.Changes}
+	case CodeUnsupportedMediaType:
+		return ErrUnsupportedMediaType{ContentType: p.ContentType, Supported: p.Supported}
+	case CodeMalformedBody:
+		return ErrMalformedBody{Reason: strings.TrimPrefix(p.Detail, ErrMalformedBody{}.Error())}
+	case CodePatchFailed:
+		return ErrPatchFailed{Reason: strings.TrimPrefix(p.Detail, ErrPatchFailed{}.Error())}
+	case CodeBatchFailed:
+		results := make([]BatchResult, len(p.Results))
+		for i, item := range p.Results {
+			results[i] = BatchResult{Index: item.Index, Op: item.Op, ID: item.ID, Line: item.Line}
+			if item.Error != nil {
+				results[i].Err = item.Error.Err()
+			}
+		}
+		return ErrBatchFailed{Results: results}
+	case CodeEventsExpired:
+		return ErrEventsExpired{}
+	case CodeUnauthenticated:
+		return ErrUnauthenticated{Reason: strings.TrimPrefix(p.Detail, ErrUnauthenticated{}.Error())}
+	case CodeForbidden:
+		return ErrForbidden{Reason: strings.TrimPrefix(p.Detail, ErrForbidden{}.Error())}
+	case CodeTimeout:
+		return context.DeadlineExceeded
+	default:
+		return fmt.Errorf("%w: %s", ErrServerError, p.Detail)
+	}
+}
@@ -0,0 +1,85 @@
+package ecrud
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultRetention is how long deleted records are kept before they are
+// purged
+const DefaultRetention = 30 * 24 * time.Hour
+
+// purgeInterval caps the time between two purges
+var purgeInterval = time.Hour
+
+// Purger is implemented by the stores that tombstone deleted records
+type Purger interface {
+	// Purge hard deletes the records tombstoned before t and returns
+	// how many there were
+	Purge(ctx context.Context, t time.Time) (int, error)
+}
+
+var (
+	_ Purger = (*ServiceStub)(nil)
+	_ Purger = (*ServiceSQLite)(nil)
+)
+
+// RetentionPurger purges the records of a store in the background once
+// they have been deleted for longer than the retention period. Deleted
+// records may outlive it by up to an hour, or the retention period if
+// shorter.
+type RetentionPurger struct {
+	store     Purger
+	retention time.Duration
+	log       *zerolog.Logger
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewRetentionPurger starts purging store of the records deleted more
+// than retention ago, which must be positive. Close stops it.
+func NewRetentionPurger(store Purger, retention time.Duration, log *zerolog.Logger) *RetentionPurger {
+	rp := &RetentionPurger{
+		store:     store,
+		retention: retention,
+		log:       log,
+		stop:      make(chan struct{}),
+	}
+	rp.wg.Add(1)
+	go rp.run(min(retention, purgeInterval))
+
+	return rp
+}
+
+// Close stops purging, waiting for a purge in progress to finish
+func (rp *RetentionPurger) Close() {
+	close(rp.stop)
+	rp.wg.Wait()
+}
+
+func (rp *RetentionPurger) run(interval time.Duration) {
+	defer rp.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rp.stop:
+			return
+		case now := <-ticker.C:
+			n, err := rp.store.Purge(context.Background(), now.Add(-rp.retention))
+			if err != nil {
+				rp.log.Error().
+					Err(err).
+					Msg("purging deleted records failed")
+			} else if n > 0 {
+				rp.log.Info().
+					Int("purged", n).
+					Msg("deleted records purged")
+			}
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package ecrud_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+)
+
+func TestRetentionPurger(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+
+	t.Run("purges records deleted longer than the retention period", func(tt *testing.T) {
+		as := assert.New(tt)
+		stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+		}, &log)
+		as.NoError(stub.Delete(ctx, 1))
+
+		rp := ecrud.NewRetentionPurger(stub, 10*time.Millisecond, &log)
+		defer rp.Close()
+		as.Eventually(func() bool {
+			_, err := stub.Get(ctx, 1, ecrud.WithDeleted())
+			return err != nil
+		}, time.Second, 5*time.Millisecond)
+	})
+}
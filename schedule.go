@@ -0,0 +1,530 @@
+package ecrud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// maxScheduleWait caps the time between two looks at the pending
+	// changes, so that a change is applied on time even if the clock
+	// jumped
+	maxScheduleWait = time.Hour
+	// scheduleRetryDelay is how long a change that failed for reasons
+	// of the store waits before it is tried again
+	scheduleRetryDelay = time.Minute
+)
+
+// PendingChange is an update scheduled to be applied at EffectiveAt.
+// Actor is the subject of the principal that scheduled it.
+type PendingChange struct {
+	ID          int           `json:"id"`
+	EmployeeID  int           `json:"employeeId"`
+	EffectiveAt time.Time     `json:"effectiveAt"`
+	Attrs       EmployeeAttrs `json:"attrs"`
+	Actor       string        `json:"actor,omitempty"`
+	CreatedAt   time.Time     `json:"createdAt"`
+}
+
+// PendingStore keeps the changes scheduled by ServiceSchedulerMiddleware
+type PendingStore interface {
+	// Add stores change, assigning its ID
+	Add(ctx context.Context, change PendingChange) (PendingChange, error)
+	// List returns the pending changes of an employee, or of everybody
+	// when employeeID is 0, the soonest first
+	List(ctx context.Context, employeeID int) ([]PendingChange, error)
+	// Remove drops a pending change, ErrNotFound if there is none
+	Remove(ctx context.Context, id int) error
+	// Put stores change under the ID it already has, ie. to give back
+	// one that was removed
+	Put(ctx context.Context, change PendingChange) error
+}
+
+// PendingMemory is a PendingStore keeping changes in memory only
+type PendingMemory struct {
+	mtx     sync.Mutex
+	changes map[int]PendingChange
+	seq     int
+}
+
+var _ PendingStore = (*PendingMemory)(nil)
+
+func NewPendingMemory() *PendingMemory {
+	return &PendingMemory{changes: map[int]PendingChange{}}
+}
+
+func (pm *PendingMemory) Add(ctx context.Context, change PendingChange) (PendingChange, error) {
+	pm.mtx.Lock()
+	defer pm.mtx.Unlock()
+
+	pm.seq++
+	change.ID = pm.seq
+	pm.changes[change.ID] = change
+
+	return change, nil
+}
+
+func (pm *PendingMemory) List(ctx context.Context, employeeID int) ([]PendingChange, error) {
+	pm.mtx.Lock()
+	defer pm.mtx.Unlock()
+
+	changes := []PendingChange{}
+	for _, c := range pm.changes {
+		if employeeID == 0 || c.EmployeeID == employeeID {
+			changes = append(changes, c)
+		}
+	}
+	sort.Slice(changes, func(a, b int) bool {
+		if !changes[a].EffectiveAt.Equal(changes[b].EffectiveAt) {
+			return changes[a].EffectiveAt.Before(changes[b].EffectiveAt)
+		}
+		return changes[a].ID < changes[b].ID
+	})
+
+	return changes, nil
+}
+
+func (pm *PendingMemory) Remove(ctx context.Context, id int) error {
+	if _, found := pm.take(id); !found {
+		return ErrNotFound{ID: id}
+	}
+
+	return nil
+}
+
+func (pm *PendingMemory) Put(ctx context.Context, change PendingChange) error {
+	pm.put(change)
+
+	return nil
+}
+
+// take removes and returns the change id
+func (pm *PendingMemory) take(id int) (PendingChange, bool) {
+	pm.mtx.Lock()
+	defer pm.mtx.Unlock()
+
+	change, found := pm.changes[id]
+	delete(pm.changes, id)
+
+	return change, found
+}
+
+// put stores change under the ID it already has
+func (pm *PendingMemory) put(change PendingChange) {
+	pm.mtx.Lock()
+	defer pm.mtx.Unlock()
+
+	pm.changes[change.ID] = change
+	pm.seq = max(pm.seq, change.ID)
+}
+
+func (pm *PendingMemory) snapshot() pendingSnapshot {
+	changes, _ := pm.List(context.Background(), 0)
+
+	pm.mtx.Lock()
+	defer pm.mtx.Unlock()
+
+	return pendingSnapshot{Seq: pm.seq, Changes: changes}
+}
+
+// PendingFile is a PendingStore that keeps changes in memory and
+// rewrites them all to a JSON file, synced to disk, on every change
+type PendingFile struct {
+	mtx  sync.Mutex
+	path string
+	mem  *PendingMemory
+}
+
+var _ PendingStore = (*PendingFile)(nil)
+
+type pendingSnapshot struct {
+	Seq     int             `json:"seq"`
+	Changes []PendingChange `json:"changes"`
+}
+
+// OpenPendingFile loads the pending changes saved at path, if any
+func OpenPendingFile(path string) (*PendingFile, error) {
+	pf := &PendingFile{path: path, mem: NewPendingMemory()}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return pf, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snap pendingSnapshot
+	if err = json.Unmarshal(b, &snap); err != nil {
+		return nil, err
+	}
+	for _, c := range snap.Changes {
+		pf.mem.put(c)
+	}
+	// ids of applied or cancelled changes are not reused either
+	pf.mem.seq = max(pf.mem.seq, snap.Seq)
+
+	return pf, nil
+}
+
+func (pf *PendingFile) Add(ctx context.Context, change PendingChange) (PendingChange, error) {
+	pf.mtx.Lock()
+	defer pf.mtx.Unlock()
+
+	change, _ = pf.mem.Add(ctx, change)
+	if err := pf.save(); err != nil {
+		pf.mem.take(change.ID)
+		return PendingChange{}, err
+	}
+
+	return change, nil
+}
+
+func (pf *PendingFile) List(ctx context.Context, employeeID int) ([]PendingChange, error) {
+	return pf.mem.List(ctx, employeeID)
+}
+
+func (pf *PendingFile) Remove(ctx context.Context, id int) error {
+	pf.mtx.Lock()
+	defer pf.mtx.Unlock()
+
+	change, found := pf.mem.take(id)
+	if !found {
+		return ErrNotFound{ID: id}
+	}
+	if err := pf.save(); err != nil {
+		pf.mem.put(change)
+		return err
+	}
+
+	return nil
+}
+
+func (pf *PendingFile) Put(ctx context.Context, change PendingChange) error {
+	pf.mtx.Lock()
+	defer pf.mtx.Unlock()
+
+	prev, found := pf.mem.take(change.ID)
+	pf.mem.put(change)
+	if err := pf.save(); err != nil {
+		pf.mem.take(change.ID)
+		if found {
+			pf.mem.put(prev)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// save rewrites the file. Callers must hold mtx.
+func (pf *PendingFile) save() error {
+	return replaceJSONFile(pf.path, pf.mem.snapshot())
+}
+
+// ServiceSchedulerMiddleware is a middleware that holds back updates
+// whose EffectiveAt is in the future as pending changes, and applies
+// them through the inner Service once they take effect, so that they
+// emit the same events and audit records as any other update. Changes
+// rejected when applied, ie. because the employee was deleted in the
+// meantime, are logged and dropped.
+//
+// It sits below ServiceValidationMiddleware so that changes are
+// validated when they are scheduled, and above the middlewares that
+// record or publish updates. Updates without EffectiveAt, or with one
+// that has passed, are applied right away.
+type ServiceSchedulerMiddleware struct {
+	inner Service
+	store PendingStore
+	log   *zerolog.Logger
+	// mtx serializes Cancel with applying changes, so that a change is
+	// either cancelled or applied, never both
+	mtx  sync.Mutex
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+var _ Service = (*ServiceSchedulerMiddleware)(nil)
+
+// NewServiceSchedulerMiddleware starts applying the changes pending in
+// store. Close stops it.
+func NewServiceSchedulerMiddleware(svc Service, store PendingStore, log *zerolog.Logger) *ServiceSchedulerMiddleware {
+	mw := &ServiceSchedulerMiddleware{
+		inner: svc,
+		store: store,
+		log:   log,
+		wake:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+	}
+	mw.wg.Add(1)
+	go mw.run()
+
+	return mw
+}
+
+// Close stops applying changes, waiting for one in progress to finish
+func (mw *ServiceSchedulerMiddleware) Close() {
+	close(mw.stop)
+	mw.wg.Wait()
+}
+
+func (mw *ServiceSchedulerMiddleware) List(ctx context.Context, opts ListOptions) (EmployeePage, error) {
+	return mw.inner.List(ctx, opts)
+}
+
+func (mw *ServiceSchedulerMiddleware) Get(ctx context.Context, id int, opts ...GetOption) (Employee, error) {
+	return mw.inner.Get(ctx, id, opts...)
+}
+
+func (mw *ServiceSchedulerMiddleware) Create(ctx context.Context, attrs EmployeeAttrs) (int, error) {
+	return mw.inner.Create(ctx, attrs)
+}
+
+// Update schedules attrs if they take effect in the future, returning
+// the record as it currently is
+func (mw *ServiceSchedulerMiddleware) Update(ctx context.Context, id int, attrs EmployeeAttrs) (Employee, error) {
+	at := attrs.EffectiveAt
+	attrs.EffectiveAt = nil
+	if at == nil || !at.After(time.Now()) {
+		return mw.inner.Update(ctx, id, attrs)
+	}
+
+	current, err := mw.inner.Get(ctx, id)
+	if err != nil {
+		return current, err
+	}
+	change := PendingChange{
+		EmployeeID:  id,
+		EffectiveAt: at.UTC(),
+		Attrs:       attrs,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if p, ok := PrincipalFromContext(ctx); ok {
+		change.Actor = p.Subject
+	}
+	if change, err = mw.store.Add(ctx, change); err != nil {
+		ctxLogger(ctx, mw.log).Error().
+			Err(err).
+			Int("id", id).
+			Msg("`Update` scheduling failed")
+		return Employee{}, ErrServerError
+	}
+
+	ctxLogger(ctx, mw.log).Info().
+		Int("id", id).
+		Int("change", change.ID).
+		Time("effectiveAt", change.EffectiveAt).
+		Msg("`Update` scheduled")
+	mw.poke()
+
+	return current, nil
+}
+
+func (mw *ServiceSchedulerMiddleware) Delete(ctx context.Context, id int) error {
+	return mw.inner.Delete(ctx, id)
+}
+
+func (mw *ServiceSchedulerMiddleware) Restore(ctx context.Context, id int) (Employee, error) {
+	return mw.inner.Restore(ctx, id)
+}
+
+func (mw *ServiceSchedulerMiddleware) Batch(ctx context.Context, req BatchRequest) ([]BatchResult, error) {
+	return mw.inner.Batch(ctx, req)
+}
+
+// Pending lists the changes scheduled for employee id, the soonest first
+func (mw *ServiceSchedulerMiddleware) Pending(ctx context.Context, id int) ([]PendingChange, error) {
+	if _, err := mw.inner.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	changes, err := mw.store.List(ctx, id)
+	if err != nil {
+		return nil, mw.storeError(ctx, "`Pending` failed", err)
+	}
+
+	return changes, nil
+}
+
+// Cancel drops the pending change changeID of employee id
+func (mw *ServiceSchedulerMiddleware) Cancel(ctx context.Context, id, changeID int) error {
+	mw.mtx.Lock()
+	defer mw.mtx.Unlock()
+
+	changes, err := mw.store.List(ctx, id)
+	if err != nil {
+		return mw.storeError(ctx, "`Cancel` failed", err)
+	}
+	found := false
+	for _, c := range changes {
+		found = found || c.ID == changeID
+	}
+	if found {
+		err = mw.store.Remove(ctx, changeID)
+	}
+	// the change may have been applied in the meantime
+	if !found || errors.As(err, &ErrNotFound{}) {
+		ctxLogger(ctx, mw.log).Info().
+			Int("id", id).
+			Int("change", changeID).
+			Msg("`Cancel` not found")
+		return ErrNotFound{ID: changeID}
+	}
+	if err != nil {
+		return mw.storeError(ctx, "`Cancel` failed", err)
+	}
+
+	ctxLogger(ctx, mw.log).Info().
+		Int("id", id).
+		Int("change", changeID).
+		Msg("`Update` cancelled")
+	mw.poke()
+
+	return nil
+}
+
+func (mw *ServiceSchedulerMiddleware) storeError(ctx context.Context, msg string, err error) error {
+	ctxLogger(ctx, mw.log).Error().
+		Err(err).
+		Msg(msg)
+
+	return ErrServerError
+}
+
+// poke makes the scheduler look at the pending changes again
+func (mw *ServiceSchedulerMiddleware) poke() {
+	select {
+	case mw.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (mw *ServiceSchedulerMiddleware) run() {
+	defer mw.wg.Done()
+
+	wait := time.Duration(0)
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-mw.stop:
+			timer.Stop()
+			return
+		case <-mw.wake:
+			timer.Stop()
+			wait = mw.untilNext()
+		case <-timer.C:
+			if mw.applyDue() {
+				wait = mw.untilNext()
+			} else {
+				wait = scheduleRetryDelay
+			}
+		}
+	}
+}
+
+// untilNext returns how long until the soonest pending change is due
+func (mw *ServiceSchedulerMiddleware) untilNext() time.Duration {
+	changes, err := mw.store.List(context.Background(), 0)
+	if err != nil {
+		mw.log.Error().
+			Err(err).
+			Msg("listing pending changes failed")
+		return scheduleRetryDelay
+	}
+	if len(changes) == 0 {
+		return maxScheduleWait
+	}
+
+	return min(max(time.Until(changes[0].EffectiveAt), 0), maxScheduleWait)
+}
+
+// applyDue applies the changes that took effect, reporting false if
+// any of them has to be tried again later
+func (mw *ServiceSchedulerMiddleware) applyDue() bool {
+	ctx := context.Background()
+	changes, err := mw.store.List(ctx, 0)
+	if err != nil {
+		mw.log.Error().
+			Err(err).
+			Msg("listing pending changes failed")
+		return false
+	}
+
+	now := time.Now()
+	for _, c := range changes {
+		if c.EffectiveAt.After(now) {
+			break
+		}
+		if !mw.apply(ctx, c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// apply claims c by removing it from the store before updating the
+// employee, so that a change is never applied twice. Changes that fail
+// for reasons of the store are put back to be tried again, and apply
+// reports false.
+func (mw *ServiceSchedulerMiddleware) apply(ctx context.Context, c PendingChange) bool {
+	mw.mtx.Lock()
+	defer mw.mtx.Unlock()
+
+	err := mw.store.Remove(ctx, c.ID)
+	if errors.As(err, &ErrNotFound{}) {
+		// cancelled in the meantime
+		return true
+	}
+	if err != nil {
+		mw.log.Error().
+			Err(err).
+			Int("change", c.ID).
+			Msg("claiming pending change failed")
+		return false
+	}
+
+	// the change is made on behalf of whoever scheduled it
+	actx := ctx
+	if c.Actor != "" {
+		actx = ContextWithPrincipal(ctx, Principal{Subject: c.Actor})
+	}
+	_, err = mw.inner.Update(actx, c.EmployeeID, c.Attrs)
+	if errors.Is(err, ErrServerError) {
+		// given back under its ID, so that it can still be cancelled
+		if perr := mw.store.Put(ctx, c); perr != nil {
+			mw.log.Error().
+				Err(perr).
+				Int("id", c.EmployeeID).
+				Int("change", c.ID).
+				Msg("applying pending change failed, dropped")
+			return false
+		}
+		mw.log.Error().
+			Err(err).
+			Int("id", c.EmployeeID).
+			Int("change", c.ID).
+			Msg("applying pending change failed, will retry")
+		return false
+	}
+	if err != nil {
+		mw.log.Warn().
+			Err(err).
+			Int("id", c.EmployeeID).
+			Int("change", c.ID).
+			Msg("pending change rejected, dropped")
+	} else {
+		mw.log.Info().
+			Int("id", c.EmployeeID).
+			Int("change", c.ID).
+			Msg("pending change applied")
+	}
+
+	return true
+}
@@ -0,0 +1,216 @@
+package ecrud_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+)
+
+// slowUpdates holds updates back until release is closed, announcing
+// each on entered
+type slowUpdates struct {
+	ecrud.Service
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *slowUpdates) Update(ctx context.Context, id int, attrs ecrud.EmployeeAttrs) (ecrud.Employee, error) {
+	s.entered <- struct{}{}
+	<-s.release
+	return s.Service.Update(ctx, id, attrs)
+}
+
+// failingUpdates fails every update as the store would, announcing each
+// on failed
+type failingUpdates struct {
+	ecrud.Service
+	failed chan struct{}
+}
+
+func (f *failingUpdates) Update(ctx context.Context, id int, attrs ecrud.EmployeeAttrs) (ecrud.Employee, error) {
+	f.failed <- struct{}{}
+	return ecrud.Employee{}, ecrud.ErrServerError
+}
+
+func TestServiceSchedulerMiddleware(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	ring := ecrud.NewAuditRing(0)
+	stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+		1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+	}, &log)
+	sched := ecrud.NewServiceSchedulerMiddleware(ecrud.NewServiceAuditMiddleware(stub, ring, &log), ecrud.NewPendingMemory(), &log)
+	defer sched.Close()
+	svc := ecrud.NewServiceValidationMiddleware(sched, &log)
+	hr := ecrud.ContextWithPrincipal(ctx, ecrud.Principal{Subject: "payroll", Roles: []string{ecrud.RoleHR}})
+	dept := "Retail"
+
+	t.Run("applies changes once they take effect", func(tt *testing.T) {
+		as := assert.New(tt)
+		at := time.Now().Add(50 * time.Millisecond)
+		e, err := svc.Update(hr, 1, ecrud.EmployeeAttrs{Department: &dept, EffectiveAt: &at})
+		as.NoError(err)
+		as.Nil(e.Department)
+		changes, err := sched.Pending(ctx, 1)
+		as.NoError(err)
+		if as.Len(changes, 1) {
+			as.Equal("payroll", changes[0].Actor)
+			as.Nil(changes[0].Attrs.EffectiveAt)
+		}
+
+		as.Eventually(func() bool {
+			e, err := svc.Get(ctx, 1)
+			return err == nil && e.Department != nil && *e.Department == dept
+		}, time.Second, 5*time.Millisecond)
+		changes, err = sched.Pending(ctx, 1)
+		as.NoError(err)
+		as.Empty(changes)
+
+		// on behalf of whoever scheduled the change
+		records, err := ring.Query(ctx, ecrud.AuditQuery{TargetID: 1, Field: "department"})
+		as.NoError(err)
+		if as.Len(records, 1) {
+			as.Equal("payroll", records[0].Actor)
+		}
+	})
+
+	t.Run("cancels pending changes", func(tt *testing.T) {
+		as := assert.New(tt)
+		at := time.Now().Add(time.Hour)
+		_, err := svc.Update(hr, 1, ecrud.EmployeeAttrs{Department: &dept, EffectiveAt: &at})
+		as.NoError(err)
+		changes, err := sched.Pending(ctx, 1)
+		as.NoError(err)
+		if !as.Len(changes, 1) {
+			return
+		}
+
+		as.ErrorAs(sched.Cancel(ctx, 2, changes[0].ID), &ecrud.ErrNotFound{})
+		as.NoError(sched.Cancel(ctx, 1, changes[0].ID))
+		as.ErrorAs(sched.Cancel(ctx, 1, changes[0].ID), &ecrud.ErrNotFound{})
+		changes, err = sched.Pending(ctx, 1)
+		as.NoError(err)
+		as.Empty(changes)
+		_, err = sched.Pending(ctx, 99)
+		as.ErrorAs(err, &ecrud.ErrNotFound{})
+	})
+
+	t.Run("does not cancel changes being applied", func(tt *testing.T) {
+		as := assert.New(tt)
+		slow := &slowUpdates{Service: stub, entered: make(chan struct{}), release: make(chan struct{})}
+		sched := ecrud.NewServiceSchedulerMiddleware(slow, ecrud.NewPendingMemory(), &log)
+		defer sched.Close()
+		at := time.Now().Add(20 * time.Millisecond)
+		role := "CTO"
+		_, err := sched.Update(hr, 1, ecrud.EmployeeAttrs{Role: &role, EffectiveAt: &at})
+		as.NoError(err)
+		changes, err := sched.Pending(ctx, 1)
+		as.NoError(err)
+		if !as.Len(changes, 1) {
+			return
+		}
+
+		<-slow.entered
+		cancelled := make(chan error, 1)
+		go func() {
+			cancelled <- sched.Cancel(ctx, 1, changes[0].ID)
+		}()
+		// until the change being applied is done with
+		as.Never(func() bool { return len(cancelled) > 0 }, 50*time.Millisecond, 5*time.Millisecond)
+		close(slow.release)
+		as.ErrorAs(<-cancelled, &ecrud.ErrNotFound{})
+		e, err := stub.Get(ctx, 1)
+		as.NoError(err)
+		as.Equal(&role, e.Role)
+	})
+
+	t.Run("keeps changes that failed to apply cancellable", func(tt *testing.T) {
+		as := assert.New(tt)
+		failing := &failingUpdates{Service: stub, failed: make(chan struct{}, 1)}
+		sched := ecrud.NewServiceSchedulerMiddleware(failing, ecrud.NewPendingMemory(), &log)
+		defer sched.Close()
+		at := time.Now().Add(20 * time.Millisecond)
+		role := "CTO"
+		_, err := sched.Update(hr, 1, ecrud.EmployeeAttrs{Role: &role, EffectiveAt: &at})
+		as.NoError(err)
+		changes, err := sched.Pending(ctx, 1)
+		as.NoError(err)
+		if !as.Len(changes, 1) {
+			return
+		}
+
+		<-failing.failed
+		as.NoError(sched.Cancel(ctx, 1, changes[0].ID))
+		changes, err = sched.Pending(ctx, 1)
+		as.NoError(err)
+		as.Empty(changes)
+	})
+
+	t.Run("validates changes when they are scheduled", func(tt *testing.T) {
+		as := assert.New(tt)
+		at := time.Now().Add(time.Hour)
+		em, v := "x", 1
+		var ebr ecrud.ErrBadRequest
+		_, err := svc.Update(hr, 1, ecrud.EmployeeAttrs{Email: &em, EffectiveAt: &at})
+		as.ErrorAs(err, &ebr)
+		_, err = svc.Update(hr, 1, ecrud.EmployeeAttrs{Department: &dept, Version: &v, EffectiveAt: &at})
+		as.ErrorAs(err, &ebr)
+		_, err = svc.Update(hr, 99, ecrud.EmployeeAttrs{Department: &dept, EffectiveAt: &at})
+		as.ErrorAs(err, &ecrud.ErrNotFound{})
+		_, err = svc.Batch(hr, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			{Op: ecrud.BatchUpdate, ID: 1, Attrs: ecrud.EmployeeAttrs{Department: &dept, EffectiveAt: &at}},
+		}})
+		as.ErrorAs(err, &ecrud.ErrBatchFailed{})
+		changes, err := sched.Pending(ctx, 1)
+		as.NoError(err)
+		as.Empty(changes)
+	})
+}
+
+func TestPendingFile(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("changes survive reopening", func(tt *testing.T) {
+		as := assert.New(tt)
+		path := filepath.Join(tt.TempDir(), "pending.json")
+		f, err := ecrud.OpenPendingFile(path)
+		as.NoError(err)
+		dept := "Retail"
+		at := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+		first, err := f.Add(ctx, ecrud.PendingChange{EmployeeID: 1, EffectiveAt: at, Attrs: ecrud.EmployeeAttrs{Department: &dept}})
+		as.NoError(err)
+		second, err := f.Add(ctx, ecrud.PendingChange{EmployeeID: 2, EffectiveAt: at.Add(-time.Hour)})
+		as.NoError(err)
+		as.NoError(f.Remove(ctx, second.ID))
+
+		f, err = ecrud.OpenPendingFile(path)
+		as.NoError(err)
+		changes, err := f.List(ctx, 0)
+		as.NoError(err)
+		if as.Len(changes, 1) {
+			as.Equal(first.ID, changes[0].ID)
+			as.Equal(dept, *changes[0].Attrs.Department)
+			as.True(at.Equal(changes[0].EffectiveAt))
+		}
+		// ids are never reused
+		third, err := f.Add(ctx, ecrud.PendingChange{EmployeeID: 1, EffectiveAt: at})
+		as.NoError(err)
+		as.Greater(third.ID, second.ID)
+
+		// changes given back keep their ids
+		as.NoError(f.Put(ctx, second))
+		f, err = ecrud.OpenPendingFile(path)
+		as.NoError(err)
+		changes, err = f.List(ctx, 2)
+		as.NoError(err)
+		if as.Len(changes, 1) {
+			as.Equal(second.ID, changes[0].ID)
+		}
+	})
+}
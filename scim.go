@@ -0,0 +1,692 @@
+package ecrud
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+// SCIM 2.0 (RFC 7643, RFC 7644) schema URNs. Employees are exposed as
+// core Users with the enterprise extension for their department and an
+// eCRUD extension for the date of birth, which has no SCIM counterpart.
+const (
+	SCIMUserSchema       = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMEnterpriseSchema = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	SCIMEmployeeSchema   = "urn:ecrud:params:scim:schemas:extension:employee:2.0:User"
+
+	scimListResponseSchema          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimPatchOpSchema               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	scimErrorSchema                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimSchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+	scimResourceTypeSchema          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// SCIMContentType is the media type of SCIM requests and responses
+const SCIMContentType = "application/scim+json"
+
+// scimBasePath is where NewHTTPServer mounts the SCIM endpoints
+const scimBasePath = "/scim/v2"
+
+type scimUser struct {
+	Schemas    []string        `json:"schemas"`
+	ID         string          `json:"id,omitempty"`
+	UserName   string          `json:"userName"`
+	Name       scimName        `json:"name"`
+	Emails     []scimEmail     `json:"emails,omitempty"`
+	Active     *bool           `json:"active,omitempty"`
+	Title      *string         `json:"title,omitempty"`
+	Enterprise *scimEnterprise `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
+	Employee   *scimEmployee   `json:"urn:ecrud:params:scim:schemas:extension:employee:2.0:User,omitempty"`
+	Meta       *scimMeta       `json:"meta,omitempty"`
+}
+
+type scimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimEnterprise struct {
+	Department *string `json:"department,omitempty"`
+}
+
+type scimEmployee struct {
+	DateOfBirth string `json:"dateOfBirth"`
+}
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+	Version      string `json:"version,omitempty"`
+}
+
+type scimListResponse struct {
+	Schemas      []string   `json:"schemas"`
+	TotalResults int        `json:"totalResults"`
+	StartIndex   int        `json:"startIndex"`
+	ItemsPerPage int        `json:"itemsPerPage"`
+	Resources    []scimUser `json:"Resources"`
+}
+
+// scimError is both a SCIM error response and an error for failures
+// that only exist at the SCIM layer, ie. an unparseable filter
+type scimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   int      `json:"status,string"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+func newSCIMError(status int, scimType, detail string) scimError {
+	return scimError{
+		Schemas:  []string{scimErrorSchema},
+		Status:   status,
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+func (e scimError) Error() string {
+	return e.Detail
+}
+
+// scimUserFrom describes e as a SCIM User
+func scimUserFrom(e Employee) scimUser {
+	id := strconv.Itoa(e.ID)
+	u := scimUser{
+		Schemas:  []string{SCIMUserSchema, SCIMEmployeeSchema},
+		ID:       id,
+		UserName: e.Email,
+		Name: scimName{
+			Formatted:  e.FirstName + " " + e.LastName,
+			GivenName:  e.FirstName,
+			FamilyName: e.LastName,
+		},
+		Emails:   []scimEmail{{Value: e.Email, Type: "work", Primary: true}},
+		Active:   e.IsActive,
+		Title:    e.Role,
+		Employee: &scimEmployee{DateOfBirth: e.DateOfBirth},
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Location:     scimBasePath + "/Users/" + id,
+			Version:      etag(e.Version),
+		},
+	}
+	if e.Department != nil {
+		u.Schemas = append(u.Schemas, SCIMEnterpriseSchema)
+		u.Enterprise = &scimEnterprise{Department: e.Department}
+	}
+
+	return u
+}
+
+// employee returns the record u describes. userName is the email
+// address; the primary email is only used when userName is missing.
+func (u scimUser) employee() Employee {
+	e := Employee{
+		FirstName: u.Name.GivenName,
+		LastName:  u.Name.FamilyName,
+		Email:     u.UserName,
+		IsActive:  u.Active,
+		Role:      u.Title,
+	}
+	if e.Email == "" {
+		for i, em := range u.Emails {
+			if i == 0 || em.Primary {
+				e.Email = em.Value
+			}
+		}
+	}
+	if u.Enterprise != nil {
+		e.Department = u.Enterprise.Department
+	}
+	if u.Employee != nil {
+		e.DateOfBirth = u.Employee.DateOfBirth
+	}
+
+	return e
+}
+
+// scimCreateAttrs turns u into the attrs of a new record. Missing
+// required attributes are left nil so validation reports them.
+func scimCreateAttrs(u scimUser) EmployeeAttrs {
+	e := u.employee()
+	nonEmpty := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+
+	return EmployeeAttrs{
+		FirstName:   nonEmpty(e.FirstName),
+		LastName:    nonEmpty(e.LastName),
+		DateOfBirth: nonEmpty(e.DateOfBirth),
+		Email:       nonEmpty(e.Email),
+		IsActive:    e.IsActive,
+		Department:  e.Department,
+		Role:        e.Role,
+	}
+}
+
+// scimReplaceAttrs returns the attrs that turn current into the record
+// u describes, pinned to current's version, and whether anything
+// changes at all. Optional attributes missing from u are cleared.
+func scimReplaceAttrs(current Employee, u scimUser) (EmployeeAttrs, bool) {
+	var (
+		want    = u.employee()
+		attrs   = EmployeeAttrs{Version: &current.Version}
+		changed bool
+	)
+	required := func(want, have string) *string {
+		if want == have {
+			return nil
+		}
+		changed = true
+		return &want
+	}
+	attrs.FirstName = required(want.FirstName, current.FirstName)
+	attrs.LastName = required(want.LastName, current.LastName)
+	attrs.DateOfBirth = required(want.DateOfBirth, current.DateOfBirth)
+	attrs.Email = required(want.Email, current.Email)
+	attrs.IsActive = scimOptional(&attrs, &changed, "isActive", want.IsActive, current.IsActive)
+	attrs.Department = scimOptional(&attrs, &changed, "department", want.Department, current.Department)
+	attrs.Role = scimOptional(&attrs, &changed, "role", want.Role, current.Role)
+
+	return attrs, changed
+}
+
+func scimOptional[T comparable](attrs *EmployeeAttrs, changed *bool, name string, want, have *T) *T {
+	switch {
+	case want == nil && have == nil:
+		return nil
+	case want == nil:
+		attrs.Clear = append(attrs.Clear, name)
+		*changed = true
+		return nil
+	case have != nil && *want == *have:
+		return nil
+	default:
+		*changed = true
+		return want
+	}
+}
+
+// NewSCIMServer returns an http.Handler serving the SCIM 2.0 Users
+// endpoints on top of svc. NewHTTPServer mounts it under /scim/v2.
+func NewSCIMServer(svc Service, log *zerolog.Logger) http.Handler {
+	hndlr := &scimHandler{
+		httpHandler: &httpHandler{
+			svc: svc,
+			log: log,
+		},
+	}
+	mux := chi.NewRouter()
+	mux.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		hndlr.writeError(w, r, newSCIMError(http.StatusNotFound, "", "no such endpoint"))
+	})
+	mux.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		hndlr.writeError(w, r, newSCIMError(http.StatusMethodNotAllowed, "", r.Method+" is not supported here"))
+	})
+	mux.Get("/ServiceProviderConfig", hndlr.ServiceProviderConfig)
+	mux.Get("/ResourceTypes", hndlr.ResourceTypes)
+	mux.Get("/Schemas", hndlr.Schemas)
+	mux.Get("/Schemas/{schemaID}", hndlr.Schema)
+	mux.Route("/Users", func(r chi.Router) {
+		r.Get("/", hndlr.List)
+		r.Post("/", hndlr.Create)
+		r.Route("/{userID}", func(rr chi.Router) {
+			rr.Get("/", hndlr.Get)
+			rr.Put("/", hndlr.Replace)
+			rr.Patch("/", hndlr.Patch)
+			rr.Delete("/", hndlr.Delete)
+		})
+	})
+
+	return mux
+}
+
+// scimHandler serves SCIM requests, reusing the plain HTTP handler's
+// service and precondition helpers
+type scimHandler struct {
+	*httpHandler
+}
+
+func (hndlr *scimHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var filter scimFilter
+	if v := q.Get("filter"); v != "" {
+		var err error
+		if filter, err = parseSCIMFilter(v); err != nil {
+			hndlr.writeError(w, r, err)
+			return
+		}
+	}
+	startIndex, count := 1, DefaultListLimit
+	if v := q.Get("startIndex"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			hndlr.writeError(w, r, newSCIMError(http.StatusBadRequest, "invalidValue", "startIndex: "+ReasonMalformed))
+			return
+		}
+		startIndex = max(n, 1)
+	}
+	if v := q.Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			hndlr.writeError(w, r, newSCIMError(http.StatusBadRequest, "invalidValue", "count: "+ReasonMalformed))
+			return
+		}
+		count = min(max(n, 0), MaxListLimit)
+	}
+
+	// the Service cannot filter on most SCIM attributes, so every
+	// record is read and filtered here
+	var (
+		matched []Employee
+		opts    = ListOptions{Limit: MaxListLimit}
+	)
+	for {
+		page, err := hndlr.svc.List(r.Context(), opts)
+		if err != nil {
+			hndlr.writeError(w, r, err)
+			return
+		}
+		for _, e := range page.Employees {
+			if filter.matches(e) {
+				matched = append(matched, e)
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+
+	resp := scimListResponse{
+		Schemas:      []string{scimListResponseSchema},
+		TotalResults: len(matched),
+		StartIndex:   startIndex,
+		Resources:    []scimUser{},
+	}
+	for i := startIndex - 1; i < len(matched) && len(resp.Resources) < count; i++ {
+		resp.Resources = append(resp.Resources, scimUserFrom(matched[i]))
+	}
+	resp.ItemsPerPage = len(resp.Resources)
+
+	hndlr.write(w, http.StatusOK, resp)
+}
+
+func (hndlr *scimHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := scimUserID(r)
+	if err != nil {
+		hndlr.writeError(w, r, err)
+		return
+	}
+	employee, err := hndlr.svc.Get(r.Context(), id)
+	if err != nil {
+		hndlr.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(employee.Version))
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagListMatches(inm, employee.Version, false) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	hndlr.write(w, http.StatusOK, scimUserFrom(employee))
+}
+
+func (hndlr *scimHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var u scimUser
+	if err := decodeSCIM(r, &u); err != nil {
+		hndlr.writeError(w, r, err)
+		return
+	}
+	id, err := hndlr.svc.Create(r.Context(), scimCreateAttrs(u))
+	if err != nil {
+		hndlr.writeError(w, r, err)
+		return
+	}
+	employee, err := hndlr.svc.Get(r.Context(), id)
+	if err != nil {
+		hndlr.writeError(w, r, err)
+		return
+	}
+
+	created := scimUserFrom(employee)
+	w.Header().Set("Location", created.Meta.Location)
+	w.Header().Set("ETag", created.Meta.Version)
+	hndlr.write(w, http.StatusCreated, created)
+}
+
+// Replace implements PUT: attributes missing from the body are cleared
+func (hndlr *scimHandler) Replace(w http.ResponseWriter, r *http.Request) {
+	var u scimUser
+	if err := decodeSCIM(r, &u); err != nil {
+		hndlr.writeError(w, r, err)
+		return
+	}
+	hndlr.replace(w, r, func(scimUser) (scimUser, error) {
+		return u, nil
+	})
+}
+
+func (hndlr *scimHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	var req scimPatchRequest
+	if err := decodeSCIM(r, &req); err != nil {
+		hndlr.writeError(w, r, err)
+		return
+	}
+	hndlr.replace(w, r, func(u scimUser) (scimUser, error) {
+		for _, op := range req.Operations {
+			if err := op.applyTo(&u); err != nil {
+				return u, err
+			}
+		}
+		return u, nil
+	})
+}
+
+// replace reads the user, lets change derive its new state and writes
+// back whatever differs, pinned to the version that was read
+func (hndlr *scimHandler) replace(w http.ResponseWriter, r *http.Request, change func(scimUser) (scimUser, error)) {
+	id, err := scimUserID(r)
+	if err != nil {
+		hndlr.writeError(w, r, err)
+		return
+	}
+	current, err := hndlr.svc.Get(r.Context(), id)
+	if err != nil {
+		hndlr.writeError(w, r, err)
+		return
+	}
+	if im := r.Header.Get("If-Match"); im != "" && !etagListMatches(im, current.Version, true) {
+		hndlr.writeError(w, r, ErrConflict{ID: id, Version: current.Version})
+		return
+	}
+	u, err := change(scimUserFrom(current))
+	if err != nil {
+		hndlr.writeError(w, r, err)
+		return
+	}
+	employee := current
+	if attrs, changed := scimReplaceAttrs(current, u); changed {
+		employee, err = hndlr.svc.Update(r.Context(), id, attrs)
+		if err != nil {
+			hndlr.writeError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("ETag", etag(employee.Version))
+	hndlr.write(w, http.StatusOK, scimUserFrom(employee))
+}
+
+func (hndlr *scimHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := scimUserID(r)
+	if err != nil {
+		hndlr.writeError(w, r, err)
+		return
+	}
+	if err = hndlr.svc.Delete(r.Context(), id); err != nil {
+		hndlr.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (hndlr *scimHandler) ServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	type supported struct {
+		Supported bool `json:"supported"`
+	}
+	hndlr.write(w, http.StatusOK, map[string]any{
+		"schemas": []string{scimServiceProviderConfigSchema},
+		"patch":   supported{true},
+		"bulk": map[string]any{
+			"supported":      false,
+			"maxOperations":  0,
+			"maxPayloadSize": 0,
+		},
+		"filter": map[string]any{
+			"supported":  true,
+			"maxResults": MaxListLimit,
+		},
+		"changePassword":        supported{false},
+		"sort":                  supported{false},
+		"etag":                  supported{true},
+		"authenticationSchemes": []any{},
+		"meta": scimMeta{
+			ResourceType: "ServiceProviderConfig",
+			Location:     scimBasePath + "/ServiceProviderConfig",
+		},
+	})
+}
+
+func (hndlr *scimHandler) ResourceTypes(w http.ResponseWriter, r *http.Request) {
+	userType := map[string]any{
+		"schemas":     []string{scimResourceTypeSchema},
+		"id":          "User",
+		"name":        "User",
+		"endpoint":    "/Users",
+		"description": "Employee",
+		"schema":      SCIMUserSchema,
+		"schemaExtensions": []map[string]any{
+			{"schema": SCIMEnterpriseSchema, "required": false},
+			{"schema": SCIMEmployeeSchema, "required": true},
+		},
+		"meta": scimMeta{
+			ResourceType: "ResourceType",
+			Location:     scimBasePath + "/ResourceTypes/User",
+		},
+	}
+	hndlr.write(w, http.StatusOK, map[string]any{
+		"schemas":      []string{scimListResponseSchema},
+		"totalResults": 1,
+		"startIndex":   1,
+		"itemsPerPage": 1,
+		"Resources":    []any{userType},
+	})
+}
+
+func (hndlr *scimHandler) Schemas(w http.ResponseWriter, r *http.Request) {
+	hndlr.write(w, http.StatusOK, scimListResponseOf(scimSchemas))
+}
+
+func (hndlr *scimHandler) Schema(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "schemaID")
+	for _, s := range scimSchemas {
+		if s.ID == id {
+			hndlr.write(w, http.StatusOK, s)
+			return
+		}
+	}
+
+	hndlr.writeError(w, r, newSCIMError(http.StatusNotFound, "", "unknown schema "+id))
+}
+
+func scimListResponseOf[T any](resources []T) map[string]any {
+	return map[string]any{
+		"schemas":      []string{scimListResponseSchema},
+		"totalResults": len(resources),
+		"startIndex":   1,
+		"itemsPerPage": len(resources),
+		"Resources":    resources,
+	}
+}
+
+// scimUserID reads the user id from the URL path. SCIM ids are opaque
+// strings, so one that is not a number simply does not exist.
+func scimUserID(r *http.Request) (int, error) {
+	v := chi.URLParam(r, "userID")
+	id, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, newSCIMError(http.StatusNotFound, "", "user "+v+" not found")
+	}
+
+	return id, nil
+}
+
+// decodeSCIM decodes a SCIM request body into v. Plain JSON is accepted
+// too since not every client sets the SCIM media type.
+func decodeSCIM(r *http.Request, v any) error {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mt != SCIMContentType && mt != "application/json") {
+			return ErrUnsupportedMediaType{
+				ContentType: ct,
+				Supported:   []string{SCIMContentType, "application/json"},
+			}
+		}
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return newSCIMError(http.StatusBadRequest, "invalidSyntax", err.Error())
+	}
+
+	return nil
+}
+
+func (hndlr *scimHandler) write(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", SCIMContentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		hndlr.log.Error().
+			Err(err).
+			Msg("response encoding failed")
+	}
+}
+
+// writeError writes err as a SCIM error response. Domain errors are
+// mapped through their Problem so that statuses match the rest of the
+// API; a taken email is the SCIM uniqueness error.
+func (hndlr *scimHandler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var serr scimError
+	if !errors.As(err, &serr) {
+		p := NewProblem(err)
+		serr = newSCIMError(p.Status, "", p.Detail)
+		switch p.Code {
+		case CodeInvalidParams:
+			serr.ScimType = "invalidValue"
+			for _, fe := range p.InvalidParams {
+				if fe.Field == "email" && fe.Reason == ReasonTaken {
+					serr.Status = http.StatusConflict
+					serr.ScimType = "uniqueness"
+				}
+			}
+		case CodeMalformedBody:
+			serr.ScimType = "invalidSyntax"
+		case CodeServerError:
+			ctxLogger(r.Context(), hndlr.log).Error().
+				Err(err).
+				Msg("request failed")
+		}
+		if p.Version != nil {
+			w.Header().Set("ETag", etag(*p.Version))
+		}
+	}
+	if serr.Status == StatusClientClosedRequest {
+		w.WriteHeader(serr.Status)
+		return
+	}
+
+	hndlr.write(w, serr.Status, serr)
+}
+
+// scimAttribute describes an attribute in a /Schemas resource
+type scimAttribute struct {
+	Name          string          `json:"name"`
+	Type          string          `json:"type"`
+	MultiValued   bool            `json:"multiValued"`
+	Required      bool            `json:"required"`
+	CaseExact     bool            `json:"caseExact"`
+	Mutability    string          `json:"mutability"`
+	Returned      string          `json:"returned"`
+	Uniqueness    string          `json:"uniqueness"`
+	SubAttributes []scimAttribute `json:"subAttributes,omitempty"`
+}
+
+type scimSchema struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Attributes  []scimAttribute `json:"attributes"`
+}
+
+func scimAttr(name, typ string, required bool, sub ...scimAttribute) scimAttribute {
+	return scimAttribute{
+		Name:          name,
+		Type:          typ,
+		Required:      required,
+		Mutability:    "readWrite",
+		Returned:      "default",
+		Uniqueness:    "none",
+		SubAttributes: sub,
+	}
+}
+
+// scimSchemas lists the attributes that are mapped onto Employee fields;
+// any other attribute is ignored
+var scimSchemas = func() []scimSchema {
+	userName := scimAttr("userName", "string", true)
+	userName.Uniqueness = "server"
+	formatted := scimAttr("formatted", "string", false)
+	formatted.Mutability = "readOnly"
+	emails := scimAttr("emails", "complex", false,
+		scimAttr("value", "string", true),
+		scimAttr("type", "string", false),
+		scimAttr("primary", "boolean", false),
+	)
+	emails.MultiValued = true
+
+	return []scimSchema{
+		{
+			Schemas:     []string{scimSchemaSchema},
+			ID:          SCIMUserSchema,
+			Name:        "User",
+			Description: "Employee",
+			Attributes: []scimAttribute{
+				userName,
+				scimAttr("name", "complex", true,
+					scimAttr("givenName", "string", true),
+					scimAttr("familyName", "string", true),
+					formatted,
+				),
+				emails,
+				scimAttr("active", "boolean", false),
+				scimAttr("title", "string", false),
+			},
+		},
+		{
+			Schemas:     []string{scimSchemaSchema},
+			ID:          SCIMEnterpriseSchema,
+			Name:        "EnterpriseUser",
+			Description: "Enterprise User",
+			Attributes: []scimAttribute{
+				scimAttr("department", "string", false),
+			},
+		},
+		{
+			Schemas:     []string{scimSchemaSchema},
+			ID:          SCIMEmployeeSchema,
+			Name:        "Employee",
+			Description: "eCRUD employee attributes without a SCIM counterpart",
+			Attributes: []scimAttribute{
+				scimAttr("dateOfBirth", "string", true),
+			},
+		},
+	}
+}()
@@ -0,0 +1,239 @@
+package ecrud_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+)
+
+func TestSCIM(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	dept := "Engineering"
+	stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+		1: {
+			FirstName:   "David",
+			LastName:    "Ebreo",
+			DateOfBirth: "2001-04-15",
+			Email:       "hire@me.com",
+			Department:  &dept,
+		},
+	}, &log)
+	svc := ecrud.NewServiceValidationMiddleware(stub, &log)
+	hndlr := ecrud.NewHTTPServer(svc, &log)
+
+	type user struct {
+		ID       string `json:"id"`
+		UserName string `json:"userName"`
+		Name     struct {
+			GivenName  string `json:"givenName"`
+			FamilyName string `json:"familyName"`
+		} `json:"name"`
+		Active     *bool   `json:"active"`
+		Title      *string `json:"title"`
+		Enterprise *struct {
+			Department *string `json:"department"`
+		} `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"`
+		Meta struct {
+			Version string `json:"version"`
+		} `json:"meta"`
+	}
+	type scimError struct {
+		Status   string `json:"status"`
+		ScimType string `json:"scimType"`
+	}
+	do := func(method, target, body string) *http.Response {
+		var r *http.Request
+		if body == "" {
+			r = httptest.NewRequest(method, target, nil)
+		} else {
+			r = httptest.NewRequest(method, target, bytes.NewBufferString(body))
+			r.Header.Set("Content-Type", ecrud.SCIMContentType)
+		}
+		w := httptest.NewRecorder()
+		hndlr.ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	t.Run("`Get` maps employee fields onto SCIM attributes", func(tt *testing.T) {
+		as := assert.New(tt)
+		resp := do(http.MethodGet, "/scim/v2/Users/1", "")
+		as.Equal(http.StatusOK, resp.StatusCode)
+		as.Equal(ecrud.SCIMContentType, resp.Header.Get("Content-Type"))
+		u := user{}
+		as.NoError(json.NewDecoder(resp.Body).Decode(&u))
+		as.Equal("1", u.ID)
+		as.Equal("hire@me.com", u.UserName)
+		as.Equal("David", u.Name.GivenName)
+		as.Equal("Ebreo", u.Name.FamilyName)
+		if as.NotNil(u.Enterprise) {
+			as.Equal(dept, *u.Enterprise.Department)
+		}
+		as.Equal(resp.Header.Get("ETag"), u.Meta.Version)
+
+		resp = do(http.MethodGet, "/scim/v2/Users/jdoe", "")
+		as.Equal(http.StatusNotFound, resp.StatusCode)
+		e := scimError{}
+		as.NoError(json.NewDecoder(resp.Body).Decode(&e))
+		as.Equal("404", e.Status)
+	})
+
+	t.Run("`Create` provisions an employee", func(tt *testing.T) {
+		as := assert.New(tt)
+		body := `{
+			"schemas": [
+				"urn:ietf:params:scim:schemas:core:2.0:User",
+				"urn:ecrud:params:scim:schemas:extension:employee:2.0:User"
+			],
+			"userName": "tim@apple.com",
+			"name": {"givenName": "Tim", "familyName": "Cook"},
+			"active": true,
+			"title": "CEO",
+			"externalId": "00u1",
+			"urn:ecrud:params:scim:schemas:extension:employee:2.0:User": {"dateOfBirth": "1960-11-01"}
+		}`
+		resp := do(http.MethodPost, "/scim/v2/Users", body)
+		as.Equal(http.StatusCreated, resp.StatusCode)
+		u := user{}
+		as.NoError(json.NewDecoder(resp.Body).Decode(&u))
+		as.Equal("/scim/v2/Users/"+u.ID, resp.Header.Get("Location"))
+		as.Equal("CEO", *u.Title)
+
+		resp = do(http.MethodPost, "/scim/v2/Users", body)
+		as.Equal(http.StatusConflict, resp.StatusCode)
+		e := scimError{}
+		as.NoError(json.NewDecoder(resp.Body).Decode(&e))
+		as.Equal("uniqueness", e.ScimType)
+
+		resp = do(http.MethodPost, "/scim/v2/Users", `{"userName": "phil@apple.com"}`)
+		as.Equal(http.StatusBadRequest, resp.StatusCode)
+		as.NoError(json.NewDecoder(resp.Body).Decode(&e))
+		as.Equal("invalidValue", e.ScimType)
+	})
+
+	t.Run("`List` filters users", func(tt *testing.T) {
+		as := assert.New(tt)
+		list := struct {
+			TotalResults int    `json:"totalResults"`
+			Resources    []user `json:"Resources"`
+		}{}
+
+		filter := url.QueryEscape(`userName eq "HIRE@me.com"`)
+		resp := do(http.MethodGet, "/scim/v2/Users?filter="+filter, "")
+		as.Equal(http.StatusOK, resp.StatusCode)
+		as.NoError(json.NewDecoder(resp.Body).Decode(&list))
+		if as.Equal(1, list.TotalResults) {
+			as.Equal("1", list.Resources[0].ID)
+		}
+
+		filter = url.QueryEscape(`title pr and name.familyName sw "co"`)
+		resp = do(http.MethodGet, "/scim/v2/Users?filter="+filter, "")
+		as.NoError(json.NewDecoder(resp.Body).Decode(&list))
+		if as.Equal(1, list.TotalResults) {
+			as.Equal("tim@apple.com", list.Resources[0].UserName)
+		}
+
+		resp = do(http.MethodGet, "/scim/v2/Users?count=1", "")
+		as.NoError(json.NewDecoder(resp.Body).Decode(&list))
+		as.Equal(2, list.TotalResults)
+		as.Len(list.Resources, 1)
+
+		filter = url.QueryEscape(`userName eq "x" or title pr`)
+		resp = do(http.MethodGet, "/scim/v2/Users?filter="+filter, "")
+		as.Equal(http.StatusBadRequest, resp.StatusCode)
+		e := scimError{}
+		as.NoError(json.NewDecoder(resp.Body).Decode(&e))
+		as.Equal("invalidFilter", e.ScimType)
+	})
+
+	t.Run("`Patch` applies operations", func(tt *testing.T) {
+		as := assert.New(tt)
+		resp := do(http.MethodPatch, "/scim/v2/Users/1", `{
+			"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+			"Operations": [
+				{"op": "Replace", "path": "active", "value": "False"},
+				{"op": "add", "path": "title", "value": "CTO"},
+				{"op": "remove", "path": "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department"},
+				{"op": "replace", "value": {"name": {"givenName": "Dave"}, "displayName": "ignored"}}
+			]
+		}`)
+		as.Equal(http.StatusOK, resp.StatusCode)
+
+		e, err := svc.Get(ctx, 1)
+		as.NoError(err)
+		as.False(*e.IsActive)
+		as.Equal("CTO", *e.Role)
+		as.Nil(e.Department)
+		as.Equal("Dave", e.FirstName)
+		as.Equal("Ebreo", e.LastName)
+
+		resp = do(http.MethodPatch, "/scim/v2/Users/1", `{
+			"Operations": [{"op": "remove", "path": "name.familyName"}]
+		}`)
+		as.Equal(http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("`Replace` clears missing attributes", func(tt *testing.T) {
+		as := assert.New(tt)
+		before, err := svc.Get(ctx, 1)
+		as.NoError(err)
+
+		r := httptest.NewRequest(http.MethodPut, "/scim/v2/Users/1", bytes.NewBufferString(`{
+			"userName": "hire@me.com",
+			"name": {"givenName": "David", "familyName": "Ebreo"},
+			"urn:ecrud:params:scim:schemas:extension:employee:2.0:User": {"dateOfBirth": "2001-04-15"}
+		}`))
+		r.Header.Set("If-Match", `"1"`)
+		w := httptest.NewRecorder()
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusPreconditionFailed, w.Result().StatusCode)
+
+		r = httptest.NewRequest(http.MethodPut, "/scim/v2/Users/1", bytes.NewBufferString(`{
+			"userName": "hire@me.com",
+			"name": {"givenName": "David", "familyName": "Ebreo"},
+			"urn:ecrud:params:scim:schemas:extension:employee:2.0:User": {"dateOfBirth": "2001-04-15"}
+		}`))
+		w = httptest.NewRecorder()
+		hndlr.ServeHTTP(w, r)
+		as.Equal(http.StatusOK, w.Result().StatusCode)
+
+		e, err := svc.Get(ctx, 1)
+		as.NoError(err)
+		as.Equal("David", e.FirstName)
+		as.Nil(e.IsActive)
+		as.Nil(e.Role)
+		as.Equal(before.Version+1, e.Version)
+	})
+
+	t.Run("`Delete` deprovisions an employee", func(tt *testing.T) {
+		as := assert.New(tt)
+		resp := do(http.MethodDelete, "/scim/v2/Users/1", "")
+		as.Equal(http.StatusNoContent, resp.StatusCode)
+		resp = do(http.MethodDelete, "/scim/v2/Users/1", "")
+		as.Equal(http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("serves discovery endpoints", func(tt *testing.T) {
+		as := assert.New(tt)
+		for _, path := range []string{
+			"/scim/v2/ServiceProviderConfig",
+			"/scim/v2/ResourceTypes",
+			"/scim/v2/Schemas",
+			"/scim/v2/Schemas/" + ecrud.SCIMEnterpriseSchema,
+		} {
+			resp := do(http.MethodGet, path, "")
+			as.Equal(http.StatusOK, resp.StatusCode, path)
+		}
+		resp := do(http.MethodGet, "/scim/v2/Groups", "")
+		as.Equal(http.StatusNotFound, resp.StatusCode)
+	})
+}
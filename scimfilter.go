@@ -0,0 +1,383 @@
+package ecrud
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// scimFilter is a parsed SCIM filter expression. Only comparisons
+// joined by "and" are supported, which covers what identity providers
+// send, ie. `userName eq "jdoe@example.com"`.
+type scimFilter []scimComparison
+
+type scimComparison struct {
+	attr  string
+	op    string
+	value any
+}
+
+// scimFilterOps are the supported comparison operators
+var scimFilterOps = map[string]struct{}{
+	"eq": {}, "ne": {}, "co": {}, "sw": {}, "ew": {},
+	"gt": {}, "ge": {}, "lt": {}, "le": {}, "pr": {},
+}
+
+func invalidFilter(detail string) scimError {
+	return newSCIMError(http.StatusBadRequest, "invalidFilter", detail)
+}
+
+func parseSCIMFilter(s string) (scimFilter, error) {
+	tokens, err := scimFilterTokens(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var filter scimFilter
+	for len(tokens) > 0 {
+		if len(filter) > 0 {
+			if !strings.EqualFold(tokens[0], "and") {
+				return nil, invalidFilter("only \"and\" is supported to combine comparisons")
+			}
+			tokens = tokens[1:]
+		}
+		if len(tokens) < 2 {
+			return nil, invalidFilter("incomplete comparison")
+		}
+
+		c := scimComparison{
+			attr: scimAttrPath(tokens[0]),
+			op:   strings.ToLower(tokens[1]),
+		}
+		if _, ok := scimFilterAttrs[c.attr]; !ok {
+			return nil, invalidFilter("unsupported attribute " + tokens[0])
+		}
+		if _, ok := scimFilterOps[c.op]; !ok {
+			return nil, invalidFilter("unsupported operator " + tokens[1])
+		}
+		tokens = tokens[2:]
+		if c.op != "pr" {
+			if len(tokens) == 0 {
+				return nil, invalidFilter("missing value for " + c.attr)
+			}
+			if err = json.Unmarshal([]byte(tokens[0]), &c.value); err != nil {
+				return nil, invalidFilter("malformed value " + tokens[0])
+			}
+			tokens = tokens[1:]
+		}
+		filter = append(filter, c)
+	}
+
+	return filter, nil
+}
+
+// scimFilterTokens splits a filter on whitespace, keeping quoted strings
+// intact including their quotes
+func scimFilterTokens(s string) ([]string, error) {
+	var (
+		tokens []string
+		start  = -1
+		quoted bool
+	)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+			if start < 0 {
+				start = i
+			}
+		case !quoted && (c == ' ' || c == '\t'):
+			if start >= 0 {
+				tokens = append(tokens, s[start:i])
+				start = -1
+			}
+		case start < 0:
+			start = i
+		}
+	}
+	if quoted {
+		return nil, invalidFilter("unterminated string")
+	}
+	if start >= 0 {
+		tokens = append(tokens, s[start:])
+	}
+
+	return tokens, nil
+}
+
+// scimAttrPath normalizes an attribute path: names are case
+// insensitive, schema URN prefixes are dropped since no two schemas
+// share an attribute name, and value filters such as
+// `emails[type eq "work"]` are ignored as there is only one email.
+func scimAttrPath(path string) string {
+	path = strings.ToLower(path)
+	for _, urn := range []string{SCIMUserSchema, SCIMEnterpriseSchema, SCIMEmployeeSchema} {
+		urn = strings.ToLower(urn)
+		if path == urn {
+			return ""
+		}
+		if strings.HasPrefix(path, urn+":") {
+			path = path[len(urn)+1:]
+			break
+		}
+	}
+	if i := strings.IndexByte(path, '['); i >= 0 {
+		if j := strings.IndexByte(path[i:], ']'); j >= 0 {
+			path = path[:i] + path[i+j+1:]
+		}
+	}
+	if path == "emails" {
+		path = "emails.value"
+	}
+
+	return path
+}
+
+// scimFilterAttrs reads the value of a filterable attribute, nil when
+// the attribute is not set
+var scimFilterAttrs = map[string]func(Employee) any{
+	"id":              func(e Employee) any { return strconv.Itoa(e.ID) },
+	"username":        func(e Employee) any { return e.Email },
+	"emails.value":    func(e Employee) any { return e.Email },
+	"name.givenname":  func(e Employee) any { return e.FirstName },
+	"name.familyname": func(e Employee) any { return e.LastName },
+	"dateofbirth":     func(e Employee) any { return e.DateOfBirth },
+	"active": func(e Employee) any {
+		if e.IsActive == nil {
+			return nil
+		}
+		return *e.IsActive
+	},
+	"title": func(e Employee) any {
+		if e.Role == nil {
+			return nil
+		}
+		return *e.Role
+	},
+	"department": func(e Employee) any {
+		if e.Department == nil {
+			return nil
+		}
+		return *e.Department
+	},
+}
+
+func (f scimFilter) matches(e Employee) bool {
+	for _, c := range f {
+		if !c.matches(scimFilterAttrs[c.attr](e)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matches compares strings case insensitively, as none of the mapped
+// attributes is case exact
+func (c scimComparison) matches(have any) bool {
+	if c.op == "pr" {
+		return have != nil && have != ""
+	}
+	if have == nil {
+		return c.op == "ne" && c.value != nil
+	}
+
+	switch want := c.value.(type) {
+	case string:
+		h, ok := have.(string)
+		if !ok {
+			return c.op == "ne"
+		}
+		h, want = strings.ToLower(h), strings.ToLower(want)
+		switch c.op {
+		case "eq":
+			return h == want
+		case "ne":
+			return h != want
+		case "co":
+			return strings.Contains(h, want)
+		case "sw":
+			return strings.HasPrefix(h, want)
+		case "ew":
+			return strings.HasSuffix(h, want)
+		case "gt":
+			return h > want
+		case "ge":
+			return h >= want
+		case "lt":
+			return h < want
+		case "le":
+			return h <= want
+		}
+	case bool:
+		switch c.op {
+		case "eq":
+			return have == want
+		case "ne":
+			return have != want
+		}
+	}
+
+	return c.op == "ne"
+}
+
+type scimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []scimPatchOperation `json:"Operations"`
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func invalidPatch(scimType, detail string) scimError {
+	return newSCIMError(http.StatusBadRequest, scimType, detail)
+}
+
+// applyTo applies op to u. Add and replace are the same thing for the
+// single valued attributes Employee has. Attributes that are not mapped
+// onto Employee fields are ignored, as identity providers routinely
+// send more than a service provider stores.
+func (op scimPatchOperation) applyTo(u *scimUser) error {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+		if op.Path == "" {
+			return scimSetObject(u, "", op.Value)
+		}
+		return scimSet(u, scimAttrPath(op.Path), op.Value)
+	case "remove":
+		if op.Path == "" {
+			return invalidPatch("noTarget", "remove requires a path")
+		}
+		scimRemove(u, scimAttrPath(op.Path))
+		return nil
+	default:
+		return invalidPatch("invalidSyntax", "unsupported op "+op.Op)
+	}
+}
+
+// scimSetObject sets every member of an object value, each relative to
+// prefix
+func scimSetObject(u *scimUser, prefix string, value json.RawMessage) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(value, &members); err != nil {
+		return invalidPatch("invalidValue", "value must be an object")
+	}
+	for name, v := range members {
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if err := scimSet(u, scimAttrPath(path), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scimSet(u *scimUser, path string, value json.RawMessage) error {
+	if string(value) == "null" {
+		scimRemove(u, path)
+		return nil
+	}
+
+	var err error
+	switch path {
+	case "", "name":
+		// a schema URN or complex attribute holding sub-attributes
+		return scimSetObject(u, path, value)
+	case "username", "emails.value":
+		err = scimSetEmail(u, value)
+	case "name.givenname":
+		err = json.Unmarshal(value, &u.Name.GivenName)
+	case "name.familyname":
+		err = json.Unmarshal(value, &u.Name.FamilyName)
+	case "active":
+		var v bool
+		if v, err = scimBool(value); err == nil {
+			u.Active = &v
+		}
+	case "title":
+		var v string
+		if err = json.Unmarshal(value, &v); err == nil {
+			u.Title = &v
+		}
+	case "department":
+		var v string
+		if err = json.Unmarshal(value, &v); err == nil {
+			u.Enterprise = &scimEnterprise{Department: &v}
+		}
+	case "dateofbirth":
+		var v string
+		if err = json.Unmarshal(value, &v); err == nil {
+			u.Employee = &scimEmployee{DateOfBirth: v}
+		}
+	}
+	if err != nil {
+		return invalidPatch("invalidValue", "malformed value for "+path)
+	}
+
+	return nil
+}
+
+// scimSetEmail sets the email address from a string or, when the whole
+// emails attribute is replaced, from its primary or else first entry
+func scimSetEmail(u *scimUser, value json.RawMessage) error {
+	var v string
+	if err := json.Unmarshal(value, &v); err == nil {
+		u.UserName = v
+		return nil
+	}
+	var emails []scimEmail
+	if err := json.Unmarshal(value, &emails); err != nil || len(emails) == 0 {
+		return invalidPatch("invalidValue", "malformed value for emails")
+	}
+	u.UserName, u.Emails = "", emails
+	u.UserName = u.employee().Email
+
+	return nil
+}
+
+// scimBool accepts "True" and "False" strings next to JSON booleans,
+// since some identity providers send booleans that way
+func scimBool(value json.RawMessage) (bool, error) {
+	var v bool
+	if err := json.Unmarshal(value, &v); err == nil {
+		return v, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return false, err
+	}
+
+	return strconv.ParseBool(strings.ToLower(s))
+}
+
+// scimRemove unsets path. Removing a required attribute leaves it empty
+// so that validation rejects the change.
+func scimRemove(u *scimUser, path string) {
+	switch path {
+	case "username", "emails.value":
+		u.UserName = ""
+	case "name":
+		u.Name = scimName{}
+	case "name.givenname":
+		u.Name.GivenName = ""
+	case "name.familyname":
+		u.Name.FamilyName = ""
+	case "active":
+		u.Active = nil
+	case "title":
+		u.Title = nil
+	case "department":
+		u.Enterprise = nil
+	case "dateofbirth":
+		u.Employee = nil
+	}
+}
@@ -1,8 +1,10 @@
 package ecrud
 
 import (
+	"context"
+	"errors"
 	"net/mail"
-	"sync"
+	"slices"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -10,81 +12,445 @@ import (
 
 // Service is complete domain interface of eCRUD
 type Service interface {
-	List() []Employee
-	Get(int) (Employee, error)
-	Create(EmployeeAttrs) (int, error)
-	Update(int, EmployeeAttrs) error
-	Delete(int) error
+	List(context.Context, ListOptions) (EmployeePage, error)
+	Get(context.Context, int, ...GetOption) (Employee, error)
+	Create(context.Context, EmployeeAttrs) (int, error)
+	Update(context.Context, int, EmployeeAttrs) (Employee, error)
+	// Delete tombstones a record, which is then left out of reads
+	// unless asked for until it is restored or purged
+	Delete(context.Context, int) error
+	// Restore brings a deleted record back, provided its email was not
+	// taken in the meantime. Restoring a record that is not deleted
+	// returns it unchanged.
+	Restore(context.Context, int) (Employee, error)
+	// Batch applies a mixed list of operations all-or-nothing. If any
+	// operation fails, none is applied and ErrBatchFailed is returned.
+	Batch(context.Context, BatchRequest) ([]BatchResult, error)
+}
+
+// GetOptions changes what Service.Get returns
+type GetOptions struct {
+	// IncludeDeleted returns tombstoned records too
+	IncludeDeleted bool
+	// AsOf returns the record as it was at that instant
+	AsOf *time.Time
+}
+
+// GetOption sets a GetOptions field
+type GetOption func(*GetOptions)
+
+// WithDeleted makes Get return tombstoned records too
+func WithDeleted() GetOption {
+	return func(o *GetOptions) {
+		o.IncludeDeleted = true
+	}
+}
+
+// AsOf makes Get return the record as it was at t
+func AsOf(t time.Time) GetOption {
+	return func(o *GetOptions) {
+		o.AsOf = &t
+	}
+}
+
+func newGetOptions(opts []GetOption) GetOptions {
+	var o GetOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
 }
 
 // ServiceStub is a "stub" implementation of Service
 type ServiceStub struct {
-	mtx     *sync.RWMutex
+	stubState
+	mtx     *rwlock
+	log     *zerolog.Logger
+	journal *Journal
+	feed    *ChangeFeed
+}
+
+var _ Service = (*ServiceStub)(nil)
+
+// stubState is the data guarded by ServiceStub's lock. Mutations are
+// first checked and built by the prepare* methods, which leave the state
+// untouched, then applied with put/remove once they are durable.
+// Tombstoned records stay in records but their emails are free to take
+// and left out of dedup. history holds every version of each record,
+// the last one being the current record.
+type stubState struct {
 	records map[int]Employee
+	history map[int][]employeeVersion
 	dedup   map[string]struct{}
 	seq     int
-	log     *zerolog.Logger
 }
 
-var _ Service = (*ServiceStub)(nil)
+// StubOption configures optional ServiceStub behavior
+type StubOption func(*ServiceStub)
 
-func NewServiceStub(records map[int]Employee, logr *zerolog.Logger) *ServiceStub {
-	seq := 0
+// WithJournal makes every ServiceStub mutation durable by writing it to j
+// before it is applied in memory. If j recovered state from a previous
+// run, that state replaces the records passed to NewServiceStub;
+// otherwise the given records become the journal's first snapshot.
+func WithJournal(j *Journal) StubOption {
+	return func(stub *ServiceStub) {
+		stub.journal = j
+	}
+}
+
+// WithChangeFeed publishes a ChangeEvent to feed for every mutation,
+// once it has been applied
+func WithChangeFeed(feed *ChangeFeed) StubOption {
+	return func(stub *ServiceStub) {
+		stub.feed = feed
+	}
+}
+
+func NewServiceStub(records map[int]Employee, logr *zerolog.Logger, opts ...StubOption) *ServiceStub {
+	stub := &ServiceStub{
+		mtx: newRWLock(),
+		log: logr,
+	}
+	for _, opt := range opts {
+		opt(stub)
+	}
+
+	var (
+		history = map[int][]employeeVersion{}
+		seq     int
+		seeded  = stub.journal != nil
+	)
+	if stub.journal != nil {
+		if recovered, rechistory, recseq, ok := stub.journal.recoveredState(); ok {
+			records, history, seq = recovered, rechistory, recseq
+			seeded = false
+		}
+	}
+
+	if records == nil {
+		records = map[int]Employee{}
+	}
 	dedup := map[string]struct{}{}
 	for id, e := range records {
 		if id > seq {
 			seq = id
 		}
-		dedup[e.Email] = struct{}{}
+		// the map key is authoritative, seed records may omit the id
+		e.ID = id
+		if e.Version == 0 {
+			// seed records predate versioning
+			e.Version = 1
+		}
+		records[id] = e
+		if e.DeletedAt == nil {
+			dedup[e.Email] = struct{}{}
+		}
+		if len(history[id]) == 0 {
+			// records that predate history are taken to have always
+			// been as they are
+			history[id] = []employeeVersion{{Employee: e}}
+		}
 	}
-	return &ServiceStub{
-		mtx:     &sync.RWMutex{},
-		records: records,
-		seq:     seq,
-		dedup:   dedup,
-		log:     logr,
+	if seeded {
+		// only once the seed is normalized, so that it is persisted as
+		// it is served
+		if err := stub.journal.snapshot(records, history, seq); err != nil {
+			stub.log.Error().
+				Err(err).
+				Msg("writing initial snapshot failed")
+		}
 	}
+	stub.records = records
+	stub.history = history
+	stub.seq = seq
+	stub.dedup = dedup
+
+	return stub
 }
 
-func (stub *ServiceStub) List() (employees []Employee) {
-	stub.mtx.RLock()
+func (stub *ServiceStub) List(ctx context.Context, opts ListOptions) (EmployeePage, error) {
+	if err := stub.mtx.RLock(ctx); err != nil {
+		return EmployeePage{}, err
+	}
 	defer stub.mtx.RUnlock()
 
-	for _, e := range stub.records {
-		employees = append(employees, e)
+	employees := make([]Employee, 0, len(stub.records))
+	for id, e := range stub.records {
+		if opts.AsOf != nil {
+			var found bool
+			if e, found = versionAt(stub.history[id], *opts.AsOf); !found {
+				continue
+			}
+		}
+		if e.DeletedAt == nil || opts.IncludeDeleted {
+			employees = append(employees, e)
+		}
 	}
 
-	return employees
+	return paginate(employees, opts)
 }
 
-func (stub *ServiceStub) Get(id int) (Employee, error) {
-	stub.mtx.RLock()
+func (stub *ServiceStub) Get(ctx context.Context, id int, opts ...GetOption) (Employee, error) {
+	if err := stub.mtx.RLock(ctx); err != nil {
+		return Employee{}, err
+	}
 	defer stub.mtx.RUnlock()
 
+	o := newGetOptions(opts)
 	e, found := stub.records[id]
-	if !found {
-		stub.log.Info().
+	if found && o.AsOf != nil {
+		e, found = versionAt(stub.history[id], *o.AsOf)
+	}
+	if !found || (e.DeletedAt != nil && !o.IncludeDeleted) {
+		ctxLogger(ctx, stub.log).Info().
 			Int("id", id).
 			Msg("`Get` not found")
-		return e, ErrNotFound{ID: id}
+		return Employee{}, ErrNotFound{ID: id}
+	}
+
+	return e, nil
+}
+
+func (stub *ServiceStub) Create(ctx context.Context, attrs EmployeeAttrs) (int, error) {
+	if err := stub.mtx.Lock(ctx); err != nil {
+		return 0, err
+	}
+	defer stub.mtx.Unlock()
+
+	e, err := stub.prepareCreate(attrs)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	if err = stub.persist(ctx, putEntry(e, now)); err != nil {
+		return 0, err
+	}
+
+	stub.put(e, now)
+	stub.compact(ctx)
+	stub.publish(EventCreated, e.ID, nil, &e)
+
+	return e.ID, nil
+}
+
+func (stub *ServiceStub) Update(ctx context.Context, id int, attrs EmployeeAttrs) (Employee, error) {
+	if err := stub.mtx.Lock(ctx); err != nil {
+		return Employee{}, err
+	}
+	defer stub.mtx.Unlock()
+
+	e, err := stub.prepareUpdate(id, attrs)
+	if err != nil {
+		stub.logRejected(ctx, "`Update`", id, attrs, err)
+		return Employee{}, err
 	}
+	now := time.Now().UTC()
+	if err = stub.persist(ctx, putEntry(e, now)); err != nil {
+		return Employee{}, err
+	}
+
+	before := stub.records[id]
+	stub.put(e, now)
+	stub.compact(ctx)
+	stub.publish(EventUpdated, id, &before, &e)
 
 	return e, nil
 }
 
-func (stub *ServiceStub) Create(attrs EmployeeAttrs) (int, error) {
-	stub.mtx.Lock()
+func (stub *ServiceStub) Delete(ctx context.Context, id int) error {
+	if err := stub.mtx.Lock(ctx); err != nil {
+		return err
+	}
+	defer stub.mtx.Unlock()
+
+	now := time.Now().UTC()
+	e, err := stub.prepareDelete(id, now)
+	if err != nil {
+		stub.logRejected(ctx, "`Delete`", id, EmployeeAttrs{}, err)
+		return err
+	}
+	if err = stub.persist(ctx, putEntry(e, now)); err != nil {
+		return err
+	}
+
+	before := stub.records[id]
+	stub.put(e, now)
+	stub.compact(ctx)
+	stub.publish(EventDeleted, id, &before, nil)
+
+	return nil
+}
+
+func (stub *ServiceStub) Restore(ctx context.Context, id int) (Employee, error) {
+	if err := stub.mtx.Lock(ctx); err != nil {
+		return Employee{}, err
+	}
 	defer stub.mtx.Unlock()
 
-	if _, exists := stub.dedup[*attrs.Email]; exists {
-		return 0, ErrBadRequest{
-			Fields: []string{"email"},
+	before, found := stub.records[id]
+	if found && before.DeletedAt == nil {
+		return before, nil
+	}
+	e, err := stub.prepareRestore(id)
+	if err != nil {
+		stub.logRejected(ctx, "`Restore`", id, EmployeeAttrs{}, err)
+		return Employee{}, err
+	}
+	now := time.Now().UTC()
+	if err = stub.persist(ctx, putEntry(e, now)); err != nil {
+		return Employee{}, err
+	}
+
+	stub.put(e, now)
+	stub.compact(ctx)
+	stub.publish(EventRestored, id, &before, &e)
+
+	return e, nil
+}
+
+// Purge hard deletes the records tombstoned before t
+func (stub *ServiceStub) Purge(ctx context.Context, t time.Time) (int, error) {
+	if err := stub.mtx.Lock(ctx); err != nil {
+		return 0, err
+	}
+	defer stub.mtx.Unlock()
+
+	var entries []journalEntry
+	for id, e := range stub.records {
+		if e.DeletedAt != nil && e.DeletedAt.Before(t) {
+			entries = append(entries, deleteEntry(id))
+		}
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	if err := stub.persist(ctx, journalEntry{Op: journalOpBatch, Entries: entries}); err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		stub.remove(entry.ID)
+	}
+	stub.compact(ctx)
+
+	return len(entries), nil
+}
+
+// Batch applies every operation to a copy of the state and only swaps
+// it in, with a single journal entry, once all of them succeeded.
+func (stub *ServiceStub) Batch(ctx context.Context, req BatchRequest) ([]BatchResult, error) {
+	if err := stub.mtx.Lock(ctx); err != nil {
+		return nil, err
+	}
+	defer stub.mtx.Unlock()
+
+	var (
+		now     = time.Now().UTC()
+		staged  = stub.stubState.clone()
+		results = make([]BatchResult, len(req.Ops))
+		entries = make([]journalEntry, 0, len(req.Ops))
+		events  = make([]ChangeEvent, 0, len(req.Ops))
+		failed  bool
+	)
+	for i, op := range req.Ops {
+		results[i] = BatchResult{Index: i, Op: op.Op, ID: op.ID}
+
+		var (
+			e   Employee
+			err error
+		)
+		switch op.Op {
+		case BatchCreate:
+			e, err = staged.prepareCreate(op.Attrs)
+		case BatchUpdate:
+			e, err = staged.prepareUpdate(op.ID, op.Attrs)
+		case BatchDelete:
+			e, err = staged.prepareDelete(op.ID, now)
+		default:
+			err = badRequest("op", ReasonUnknown)
+		}
+		if err != nil {
+			stub.logRejected(ctx, "`Batch`", op.ID, op.Attrs, err)
+			results[i].Err = err
+			failed = true
+			continue
+		}
+
+		before := staged.records[op.ID]
+		ev := ChangeEvent{ID: op.ID}
+		switch op.Op {
+		case BatchDelete:
+			staged.put(e, now)
+			entries = append(entries, putEntry(e, now))
+			ev.Type, ev.Before = EventDeleted, &before
+		case BatchUpdate:
+			staged.put(e, now)
+			entries = append(entries, putEntry(e, now))
+			ev.Type, ev.Before, ev.After = EventUpdated, &before, &e
+		default:
+			staged.put(e, now)
+			results[i].ID = e.ID
+			entries = append(entries, putEntry(e, now))
+			ev.Type, ev.ID, ev.After = EventCreated, e.ID, &e
+		}
+		events = append(events, ev)
+	}
+
+	if failed {
+		return results, ErrBatchFailed{Results: results}
+	}
+	if req.DryRun {
+		return results, nil
+	}
+	if err := stub.persist(ctx, journalEntry{Op: journalOpBatch, Entries: entries}); err != nil {
+		return results, err
+	}
+
+	stub.stubState = staged
+	stub.compact(ctx)
+	for _, ev := range events {
+		stub.publish(ev.Type, ev.ID, ev.Before, ev.After)
+	}
+
+	return results, nil
+}
+
+func (st *stubState) clone() stubState {
+	records := make(map[int]Employee, len(st.records))
+	for id, e := range st.records {
+		records[id] = e
+	}
+	history := make(map[int][]employeeVersion, len(st.history))
+	for id, versions := range st.history {
+		// clipped so that appending to either copy never shares memory
+		history[id] = slices.Clip(versions)
+	}
+	dedup := make(map[string]struct{}, len(st.dedup))
+	for email := range st.dedup {
+		dedup[email] = struct{}{}
+	}
+
+	return stubState{
+		records: records,
+		history: history,
+		dedup:   dedup,
+		seq:     st.seq,
+	}
+}
+
+func (st *stubState) prepareCreate(attrs EmployeeAttrs) (Employee, error) {
+	if _, exists := st.dedup[*attrs.Email]; exists {
+		return Employee{}, badRequest("email", ReasonTaken)
+	}
+	if attrs.ManagerID != nil {
+		if err := st.checkManager(0, *attrs.ManagerID); err != nil {
+			return Employee{}, err
 		}
 	}
 
-	stub.seq += 1
-	stub.records[stub.seq] = Employee{
-		ID:          stub.seq,
+	return Employee{
+		ID:          st.seq + 1,
 		FirstName:   *attrs.FirstName,
 		LastName:    *attrs.LastName,
 		DateOfBirth: *attrs.DateOfBirth,
@@ -92,63 +458,207 @@ func (stub *ServiceStub) Create(attrs EmployeeAttrs) (int, error) {
 		IsActive:    attrs.IsActive,
 		Department:  attrs.Department,
 		Role:        attrs.Role,
+		ManagerID:   attrs.ManagerID,
+		Version:     1,
+	}, nil
+}
+
+func (st *stubState) prepareUpdate(id int, attrs EmployeeAttrs) (Employee, error) {
+	e, found := st.records[id]
+	if !found || e.DeletedAt != nil {
+		return Employee{}, ErrNotFound{ID: id}
+	}
+	if attrs.Version != nil && *attrs.Version != e.Version {
+		return Employee{}, ErrConflict{ID: id, Version: e.Version}
+	}
+	if attrs.Email != nil && *attrs.Email != e.Email {
+		if _, exists := st.dedup[*attrs.Email]; exists {
+			return Employee{}, badRequest("email", ReasonTaken)
+		}
+	}
+	if attrs.ManagerID != nil && !equalIntPtr(attrs.ManagerID, e.ManagerID) {
+		if err := st.checkManager(id, *attrs.ManagerID); err != nil {
+			return Employee{}, err
+		}
 	}
 
-	return stub.seq, nil
+	e = attrs.applyTo(e)
+	e.Version++
+
+	return e, nil
 }
 
-func (stub *ServiceStub) Update(id int, attrs EmployeeAttrs) error {
-	stub.mtx.Lock()
-	defer stub.mtx.Unlock()
+// prepareDelete returns the tombstone of id, deleted at t
+func (st *stubState) prepareDelete(id int, t time.Time) (Employee, error) {
+	e, found := st.records[id]
+	if !found || e.DeletedAt != nil {
+		return Employee{}, ErrNotFound{ID: id}
+	}
+	if reports := st.reports(id); len(reports) > 0 {
+		return Employee{}, ErrHasReports{ID: id, Reports: reports}
+	}
+	e.DeletedAt = &t
+	e.Version++
 
-	e, found := stub.records[id]
+	return e, nil
+}
+
+func (st *stubState) prepareRestore(id int) (Employee, error) {
+	e, found := st.records[id]
 	if !found {
-		stub.log.Info().
-			Int("id", id).
-			Msg("`Update` not found")
-		return ErrNotFound{ID: id}
+		return Employee{}, ErrNotFound{ID: id}
+	}
+	if _, exists := st.dedup[e.Email]; exists {
+		return Employee{}, badRequest("email", ReasonTaken)
+	}
+	if e.ManagerID != nil {
+		// a manager deleted in the meantime is not brought back
+		if m, found := st.records[*e.ManagerID]; !found || m.DeletedAt != nil {
+			e.ManagerID = nil
+		}
 	}
+	e.DeletedAt = nil
+	e.Version++
+
+	return e, nil
+}
 
-	if attrs.FirstName != nil {
-		e.FirstName = *attrs.FirstName
+// checkManager rejects managerID unless it is a live employee that does
+// not, directly or not, report to id. id is 0 for new records.
+func (st *stubState) checkManager(id, managerID int) error {
+	m, found := st.records[managerID]
+	if !found || m.DeletedAt != nil {
+		return badRequest("managerId", ReasonUnknown)
 	}
-	if attrs.LastName != nil {
-		e.LastName = *attrs.LastName
+	for depth := 0; depth <= len(st.records); depth++ {
+		if m.ID == id {
+			return badRequest("managerId", ReasonCycle)
+		}
+		if m.ManagerID == nil {
+			return nil
+		}
+		// a purged manager ends the chain like a missing one
+		if m, found = st.records[*m.ManagerID]; !found {
+			return nil
+		}
 	}
-	if attrs.DateOfBirth != nil {
-		e.DateOfBirth = *attrs.DateOfBirth
+
+	return nil
+}
+
+// reports lists the live employees reporting to id, in id order
+func (st *stubState) reports(id int) []int {
+	var reports []int
+	for _, e := range st.records {
+		if e.DeletedAt == nil && e.ManagerID != nil && *e.ManagerID == id {
+			reports = append(reports, e.ID)
+		}
 	}
-	if attrs.Email != nil {
-		e.Email = *attrs.Email
+	slices.Sort(reports)
+
+	return reports
+}
+
+// put stores e as its version from at on, keeping the email index and
+// id sequence in step
+func (st *stubState) put(e Employee, at time.Time) {
+	if old, found := st.records[e.ID]; found && old.DeletedAt == nil {
+		delete(st.dedup, old.Email)
 	}
-	if attrs.IsActive != nil {
-		e.IsActive = attrs.IsActive
+	st.records[e.ID] = e
+	st.history[e.ID] = append(st.history[e.ID], employeeVersion{At: at, Employee: e})
+	if e.DeletedAt == nil {
+		st.dedup[e.Email] = struct{}{}
 	}
-	if attrs.Department != nil {
-		e.Department = attrs.Department
+	if e.ID > st.seq {
+		st.seq = e.ID
+	}
+}
+
+func (st *stubState) remove(id int) {
+	if e, found := st.records[id]; found {
+		if e.DeletedAt == nil {
+			delete(st.dedup, e.Email)
+		}
+		delete(st.records, id)
+		delete(st.history, id)
+	}
+}
+
+func (stub *ServiceStub) logRejected(ctx context.Context, op string, id int, attrs EmployeeAttrs, err error) {
+	var (
+		errnf ErrNotFound
+		errcf ErrConflict
+		errhr ErrHasReports
+	)
+	switch {
+	case errors.As(err, &errnf):
+		ctxLogger(ctx, stub.log).Info().
+			Int("id", id).
+			Msg(op + " not found")
+	case errors.As(err, &errhr):
+		ctxLogger(ctx, stub.log).Info().
+			Int("id", id).
+			Ints("reports", errhr.Reports).
+			Msg(op + " has reports")
+	case errors.As(err, &errcf):
+		ctxLogger(ctx, stub.log).Info().
+			Int("id", id).
+			Int("version", errcf.Version).
+			Int("expected", *attrs.Version).
+			Msg(op + " conflict")
 	}
-	if attrs.Role != nil {
-		e.Role = attrs.Role
+}
+
+// publish is a no-op when the stub has no change feed. Callers must hold
+// the write lock so that events are numbered in the order they were
+// applied.
+func (stub *ServiceStub) publish(typ string, id int, before, after *Employee) {
+	if stub.feed != nil {
+		stub.feed.publish(typ, id, before, after)
 	}
+}
 
-	stub.records[id] = e
+// persist writes entry ahead of applying it in memory. It is a no-op
+// when the stub has no journal. Callers must hold the write lock.
+func (stub *ServiceStub) persist(ctx context.Context, entry journalEntry) error {
+	if stub.journal == nil {
+		return nil
+	}
+	if err := stub.journal.append(entry); err != nil {
+		ctxLogger(ctx, stub.log).Error().
+			Err(err).
+			Int("id", entry.ID).
+			Str("op", entry.Op).
+			Msg("journal append failed")
+		return ErrServerError
+	}
 
 	return nil
 }
 
-func (stub *ServiceStub) Delete(id int) error {
-	stub.mtx.Lock()
-	defer stub.mtx.Unlock()
-
-	e, found := stub.records[id]
-	if !found {
-		return ErrNotFound{ID: id}
+// compact snapshots the current state once the journal has grown past
+// its threshold. A failed snapshot is not fatal since the journal still
+// holds every entry. Callers must hold the write lock.
+func (stub *ServiceStub) compact(ctx context.Context) {
+	if stub.journal == nil || !stub.journal.NeedsSnapshot() {
+		return
 	}
+	if err := stub.journal.snapshot(stub.records, stub.history, stub.seq); err != nil {
+		ctxLogger(ctx, stub.log).Error().
+			Err(err).
+			Msg("journal snapshot failed")
+	}
+}
 
-	delete(stub.records, id)
-	delete(stub.dedup, e.Email)
+// ctxLogger returns the request-scoped logger carried by ctx, if any,
+// so domain logs can be correlated with the request that caused them.
+func ctxLogger(ctx context.Context, fallback *zerolog.Logger) *zerolog.Logger {
+	if l := zerolog.Ctx(ctx); l.GetLevel() != zerolog.Disabled {
+		return l
+	}
 
-	return nil
+	return fallback
 }
 
 // ServiceValidationMiddleware is a middleware that validates request parameters
@@ -168,90 +678,297 @@ func NewServiceValidationMiddleware(svc Service, log *zerolog.Logger) *ServiceVa
 	}
 }
 
-func (mw *ServiceValidationMiddleware) List() (employees []Employee) {
-	return mw.inner.List()
+func (mw *ServiceValidationMiddleware) List(ctx context.Context, opts ListOptions) (EmployeePage, error) {
+	var ebr ErrBadRequest
+	if opts.Limit < 0 || opts.Limit > MaxListLimit {
+		ebr.Add("limit", ReasonOutOfRange)
+	}
+	if opts.Offset < 0 {
+		ebr.Add("offset", ReasonOutOfRange)
+	} else if opts.Offset > 0 && opts.Cursor != "" {
+		ebr.Add("offset", ReasonExclusive)
+	}
+	if opts.Cursor != "" {
+		if _, ok := decodeCursor(opts.Cursor); !ok {
+			ebr.Add("cursor", ReasonMalformed)
+		}
+	}
+	if opts.Sort != "" {
+		if _, ok := sortFields[opts.Sort]; !ok {
+			ebr.Add("sort", ReasonUnknown)
+		}
+	}
+	if opts.DateOfBirthFrom != nil {
+		if _, err := time.Parse(time.DateOnly, *opts.DateOfBirthFrom); err != nil {
+			ebr.Add("dateOfBirthFrom", ReasonMalformed)
+		}
+	}
+	if opts.DateOfBirthTo != nil {
+		if _, err := time.Parse(time.DateOnly, *opts.DateOfBirthTo); err != nil {
+			ebr.Add("dateOfBirthTo", ReasonMalformed)
+		}
+	}
+
+	if !ebr.Empty() {
+		ctxLogger(ctx, mw.log).Info().
+			Strs("fields", ebr.Fields).
+			Msg("`List` bad request")
+		return EmployeePage{}, ebr
+	}
+
+	return mw.inner.List(ctx, opts)
+}
+
+func (mw *ServiceValidationMiddleware) Get(ctx context.Context, id int, opts ...GetOption) (Employee, error) {
+	return mw.inner.Get(ctx, id, opts...)
 }
 
-func (mw *ServiceValidationMiddleware) Get(id int) (Employee, error) {
-	return mw.inner.Get(id)
+func (mw *ServiceValidationMiddleware) Create(ctx context.Context, attrs EmployeeAttrs) (int, error) {
+	if ebr := validateCreate(attrs); !ebr.Empty() {
+		ctxLogger(ctx, mw.log).Info().
+			Strs("fields", ebr.Fields).
+			Msg("`Create` bad request")
+		return 0, ebr
+	}
+
+	return mw.inner.Create(ctx, attrs)
 }
 
-func (mw *ServiceValidationMiddleware) Create(attrs EmployeeAttrs) (int, error) {
-	var witherrors []string
-	if attrs.FirstName == nil || len(*attrs.FirstName) <= 1 {
-		witherrors = append(witherrors, "firstName")
+func (mw *ServiceValidationMiddleware) Update(ctx context.Context, id int, attrs EmployeeAttrs) (Employee, error) {
+	if ebr := validateUpdate(attrs); !ebr.Empty() {
+		ctxLogger(ctx, mw.log).Info().
+			Int("id", id).
+			Strs("fields", ebr.Fields).
+			Msg("`Update` bad request")
+		return Employee{}, ebr
 	}
-	if attrs.LastName == nil || len(*attrs.LastName) <= 1 {
-		witherrors = append(witherrors, "lastName")
+
+	return mw.inner.Update(ctx, id, attrs)
+}
+
+func (mw *ServiceValidationMiddleware) Delete(ctx context.Context, id int) error {
+	return mw.inner.Delete(ctx, id)
+}
+
+func (mw *ServiceValidationMiddleware) Restore(ctx context.Context, id int) (Employee, error) {
+	return mw.inner.Restore(ctx, id)
+}
+
+// Batch validates every operation up front so that a batch with any
+// invalid operation never reaches the store
+func (mw *ServiceValidationMiddleware) Batch(ctx context.Context, req BatchRequest) ([]BatchResult, error) {
+	if len(req.Ops) == 0 || len(req.Ops) > MaxBatchOps {
+		ctxLogger(ctx, mw.log).Info().
+			Int("ops", len(req.Ops)).
+			Msg("`Batch` bad request")
+		return nil, badRequest("ops", ReasonOutOfRange)
+	}
+
+	var (
+		results = make([]BatchResult, len(req.Ops))
+		failed  bool
+	)
+	for i, op := range req.Ops {
+		results[i] = BatchResult{Index: i, Op: op.Op, ID: op.ID}
+
+		var ebr ErrBadRequest
+		switch op.Op {
+		case BatchCreate:
+			ebr = validateCreate(op.Attrs)
+		case BatchUpdate:
+			ebr = validateUpdate(op.Attrs)
+			if op.Attrs.EffectiveAt != nil {
+				ebr.Add("effectiveAt", ReasonUnsupported)
+			}
+		case BatchDelete:
+		default:
+			ebr.Add("op", ReasonUnknown)
+		}
+		if !ebr.Empty() {
+			results[i].Err = ebr
+			failed = true
+		}
+	}
+
+	if failed {
+		ctxLogger(ctx, mw.log).Info().
+			Int("ops", len(req.Ops)).
+			Msg("`Batch` bad request")
+		return results, ErrBatchFailed{Results: results}
+	}
+
+	return mw.inner.Batch(ctx, req)
+}
+
+func validateCreate(attrs EmployeeAttrs) ErrBadRequest {
+	var ebr ErrBadRequest
+	if attrs.FirstName == nil {
+		ebr.Add("firstName", ReasonRequired)
+	} else if len(*attrs.FirstName) <= 1 {
+		ebr.Add("firstName", ReasonTooShort)
+	}
+	if attrs.LastName == nil {
+		ebr.Add("lastName", ReasonRequired)
+	} else if len(*attrs.LastName) <= 1 {
+		ebr.Add("lastName", ReasonTooShort)
 	}
 	if attrs.DateOfBirth == nil {
-		witherrors = append(witherrors, "dateOfBirth")
+		ebr.Add("dateOfBirth", ReasonRequired)
 	} else if _, err := time.Parse(time.DateOnly, *attrs.DateOfBirth); err != nil {
-		witherrors = append(witherrors, "dateOfBirth")
+		ebr.Add("dateOfBirth", ReasonMalformed)
 	}
 	if attrs.Email == nil {
-		witherrors = append(witherrors, "email")
+		ebr.Add("email", ReasonRequired)
 	} else if _, err := mail.ParseAddress(*attrs.Email); err != nil {
-		witherrors = append(witherrors, "email")
+		ebr.Add("email", ReasonMalformed)
 	}
 
 	if attrs.Department != nil && len(*attrs.Department) <= 1 {
-		witherrors = append(witherrors, "department")
+		ebr.Add("department", ReasonTooShort)
 	}
 	if attrs.Role != nil && len(*attrs.Role) <= 1 {
-		witherrors = append(witherrors, "role")
+		ebr.Add("role", ReasonTooShort)
 	}
-
-	if witherrors != nil {
-		mw.log.Info().
-			Strs("fields", witherrors).
-			Msg("`Create` bad request")
-		return 0, ErrBadRequest{
-			Fields: witherrors,
-		}
+	if attrs.ManagerID != nil && *attrs.ManagerID < 1 {
+		ebr.Add("managerId", ReasonOutOfRange)
+	}
+	if attrs.EffectiveAt != nil {
+		ebr.Add("effectiveAt", ReasonUnsupported)
 	}
 
-	return mw.inner.Create(attrs)
+	return ebr
 }
 
-func (mw *ServiceValidationMiddleware) Update(id int, attrs EmployeeAttrs) error {
-	var witherrors []string
+func validateUpdate(attrs EmployeeAttrs) ErrBadRequest {
+	var ebr ErrBadRequest
 	if attrs.FirstName != nil && len(*attrs.FirstName) <= 1 {
-		witherrors = append(witherrors, "firstName")
+		ebr.Add("firstName", ReasonTooShort)
 	}
 	if attrs.LastName != nil && len(*attrs.LastName) <= 1 {
-		witherrors = append(witherrors, "lastName")
+		ebr.Add("lastName", ReasonTooShort)
 	}
 	if attrs.DateOfBirth != nil {
 		if _, err := time.Parse(time.DateOnly, *attrs.DateOfBirth); err != nil {
-			witherrors = append(witherrors, "dateOfBirth")
+			ebr.Add("dateOfBirth", ReasonMalformed)
 		}
 	}
 	if attrs.Email != nil {
 		if _, err := mail.ParseAddress(*attrs.Email); err != nil {
-			witherrors = append(witherrors, "email")
+			ebr.Add("email", ReasonMalformed)
 		}
 	}
 	if attrs.Department != nil && len(*attrs.Department) <= 1 {
-		witherrors = append(witherrors, "department")
+		ebr.Add("department", ReasonTooShort)
 	}
 	if attrs.Role != nil && len(*attrs.Role) <= 1 {
-		witherrors = append(witherrors, "role")
+		ebr.Add("role", ReasonTooShort)
+	}
+	if attrs.ManagerID != nil && *attrs.ManagerID < 1 {
+		ebr.Add("managerId", ReasonOutOfRange)
+	}
+	if attrs.Version != nil && *attrs.Version < 1 {
+		ebr.Add("version", ReasonOutOfRange)
+	} else if attrs.Version != nil && attrs.EffectiveAt != nil {
+		// the version a future change will apply to is not known yet
+		ebr.Add("version", ReasonExclusive)
+	}
+	for _, field := range attrs.Clear {
+		if _, ok := clearableFields[field]; !ok {
+			ebr.Add("clear", ReasonUnknown)
+			break
+		}
+	}
+	if (attrs.IsActive != nil && attrs.clears("isActive")) ||
+		(attrs.Department != nil && attrs.clears("department")) ||
+		(attrs.Role != nil && attrs.clears("role")) ||
+		(attrs.ManagerID != nil && attrs.clears("managerId")) {
+		ebr.Add("clear", ReasonExclusive)
 	}
 
-	if witherrors != nil {
-		mw.log.Info().
-			Int("id", id).
-			Strs("fields", witherrors).
-			Msg("`Update` bad request")
-		return ErrBadRequest{
-			Fields: witherrors,
+	return ebr
+}
+
+// maxPinnedUpdateAttempts is how often pinnedUpdate reads a record again
+// when other updates keep slipping in
+const maxPinnedUpdateAttempts = 3
+
+// pinnedUpdate updates id through svc and returns the state it was
+// applied to as before, for middlewares that report what changed.
+// Unless attrs carry a version, the update is made conditional on the
+// one just read, and read again should another update slip in between;
+// after maxPinnedUpdateAttempts the ErrConflict is returned.
+func pinnedUpdate(ctx context.Context, svc Service, id int, attrs EmployeeAttrs) (before, after Employee, err error) {
+	for attempt := 1; ; attempt++ {
+		if before, err = svc.Get(ctx, id); err != nil {
+			return before, after, err
 		}
+		pinned := attrs
+		if attrs.Version == nil {
+			pinned.Version = &before.Version
+		}
+		after, err = svc.Update(ctx, id, pinned)
+		if attrs.Version == nil && attempt < maxPinnedUpdateAttempts && errors.As(err, &ErrConflict{}) {
+			continue
+		}
+
+		return before, after, err
 	}
+}
 
-	return mw.inner.Update(id, attrs)
+// pinnedBatch applies req through svc like pinnedUpdate does single
+// updates: the first update of each record is made conditional on the
+// state read before, which is returned along with the results. Deletes
+// carry no version, so the state one that comes first was applied to is
+// best told by deletedState.
+func pinnedBatch(ctx context.Context, svc Service, req BatchRequest) (map[int]Employee, []BatchResult, error) {
+	for attempt := 1; ; attempt++ {
+		var (
+			befores = map[int]Employee{}
+			pinned  = req
+			retry   bool
+		)
+		pinned.Ops = slices.Clone(req.Ops)
+		for i, op := range pinned.Ops {
+			if op.Op != BatchUpdate && op.Op != BatchDelete {
+				continue
+			}
+			if _, seen := befores[op.ID]; seen {
+				continue
+			}
+			before, err := svc.Get(ctx, op.ID)
+			if err != nil {
+				continue
+			}
+			befores[op.ID] = before
+			if op.Op == BatchUpdate && op.Attrs.Version == nil {
+				pinned.Ops[i].Attrs.Version = &before.Version
+			}
+		}
+
+		results, err := svc.Batch(ctx, pinned)
+		var failed ErrBatchFailed
+		if attempt < maxPinnedUpdateAttempts && errors.As(err, &failed) {
+			for _, res := range failed.Results {
+				retry = retry || errors.As(res.Err, &ErrConflict{}) && req.Ops[res.Index].Attrs.Version == nil
+			}
+		}
+		if !retry {
+			return befores, results, err
+		}
+	}
 }
 
-func (mw *ServiceValidationMiddleware) Delete(id int) error {
-	return mw.inner.Delete(id)
+// deletedState returns the state the delete of before.ID was applied to.
+// Should the record have changed between reading and deleting it, that
+// state is taken from the tombstone, which keeps it under the next
+// version.
+func deletedState(ctx context.Context, svc Service, before Employee) Employee {
+	tomb, err := svc.Get(ctx, before.ID, WithDeleted())
+	if err == nil && tomb.DeletedAt != nil && tomb.Version != before.Version+1 {
+		before = tomb
+		before.DeletedAt = nil
+		before.Version--
+	}
+
+	return before
 }
@@ -1,7 +1,10 @@
 package ecrud_test
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
@@ -10,6 +13,7 @@ import (
 )
 
 func TestServiceStub(t *testing.T) {
+	ctx := context.Background()
 	log := zerolog.Nop()
 	svc := ecrud.NewServiceStub(map[int]ecrud.Employee{
 		3: {
@@ -30,7 +34,7 @@ func TestServiceStub(t *testing.T) {
 			Email:       &em,
 			Role:        &ro,
 		}
-		id, err := svc.Create(attrs)
+		id, err := svc.Create(ctx, attrs)
 		as.NoError(err)
 		as.Greater(id, 1)
 	})
@@ -44,7 +48,7 @@ func TestServiceStub(t *testing.T) {
 			DateOfBirth: &dob,
 			Email:       &em,
 		}
-		_, err := svc.Create(attrs)
+		_, err := svc.Create(ctx, attrs)
 		concrete := ecrud.ErrBadRequest{}
 		as.ErrorAs(err, &concrete)
 		as.Contains(concrete.Fields, "email")
@@ -52,20 +56,303 @@ func TestServiceStub(t *testing.T) {
 
 	t.Run("`List` returns list of employees", func(tt *testing.T) {
 		as := assert.New(tt)
-		employees := svc.List()
-		as.NotNil(employees)
-		as.NotEmpty(employees)
+		page, err := svc.List(ctx, ecrud.ListOptions{})
+		as.NoError(err)
+		as.NotEmpty(page.Employees)
+		as.Equal(len(page.Employees), page.Total)
+	})
+
+	t.Run("`List` filters, sorts and pages", func(tt *testing.T) {
+		as := assert.New(tt)
+		ro := "CEO"
+		page, err := svc.List(ctx, ecrud.ListOptions{Role: &ro})
+		as.NoError(err)
+		as.Equal(1, page.Total)
+		as.Equal("Jobs", page.Employees[0].LastName)
+
+		page, err = svc.List(ctx, ecrud.ListOptions{Sort: "dateOfBirth", Limit: 1})
+		as.NoError(err)
+		as.Equal(2, page.Total)
+		as.Equal("Jobs", page.Employees[0].LastName)
+		as.NotEmpty(page.NextCursor)
+
+		page, err = svc.List(ctx, ecrud.ListOptions{Sort: "dateOfBirth", Limit: 1, Cursor: page.NextCursor})
+		as.NoError(err)
+		as.Equal("Ebreo", page.Employees[0].LastName)
+		as.Empty(page.NextCursor)
 	})
 
 	t.Run("`Get` returns not found on non-existent record", func(tt *testing.T) {
 		as := assert.New(tt)
-		_, err := svc.Get(99)
+		_, err := svc.Get(ctx, 99)
 		var enf ecrud.ErrNotFound
 		as.ErrorAs(err, &enf)
 	})
+
+	t.Run("`Update` rejects stale versions", func(tt *testing.T) {
+		as := assert.New(tt)
+		e, err := svc.Get(ctx, 3)
+		as.NoError(err)
+		as.Equal(1, e.Version)
+
+		ro, stale := "CTO", e.Version
+		updated, err := svc.Update(ctx, 3, ecrud.EmployeeAttrs{Role: &ro, Version: &stale})
+		as.NoError(err)
+		as.Equal(2, updated.Version)
+		as.Equal(ro, *updated.Role)
+
+		ro = "CFO"
+		_, err = svc.Update(ctx, 3, ecrud.EmployeeAttrs{Role: &ro, Version: &stale})
+		var ecf ecrud.ErrConflict
+		as.ErrorAs(err, &ecf)
+		as.Equal(2, ecf.Version)
+
+		// unversioned updates always apply
+		updated, err = svc.Update(ctx, 3, ecrud.EmployeeAttrs{Role: &ro})
+		as.NoError(err)
+		as.Equal(3, updated.Version)
+	})
+
+	t.Run("`Update` returns error on existing email", func(tt *testing.T) {
+		as := assert.New(tt)
+		page, err := svc.List(ctx, ecrud.ListOptions{Sort: "dateOfBirth", Limit: 1})
+		as.NoError(err)
+		jobs := page.Employees[0]
+
+		em := "hire@me.com"
+		_, err = svc.Update(ctx, jobs.ID, ecrud.EmployeeAttrs{Email: &em})
+		var ebr ecrud.ErrBadRequest
+		as.ErrorAs(err, &ebr)
+		as.Contains(ebr.Fields, "email")
+
+		// the old address is released once changed
+		em = "jobs@apple.com"
+		_, err = svc.Update(ctx, jobs.ID, ecrud.EmployeeAttrs{Email: &em})
+		as.NoError(err)
+		fn, ln, dob, old := "Steve", "Jobs", "1955-02-24", jobs.Email
+		_, err = svc.Create(ctx, ecrud.EmployeeAttrs{
+			FirstName:   &fn,
+			LastName:    &ln,
+			DateOfBirth: &dob,
+			Email:       &old,
+		})
+		as.NoError(err)
+	})
+
+	t.Run("`Batch` applies all operations or none", func(tt *testing.T) {
+		as := assert.New(tt)
+		fn, ln, dob, em, ro := "Tim", "Cook", "1960-11-01", "tim@apple.com", "COO"
+		create := ecrud.BatchOp{
+			Op: ecrud.BatchCreate,
+			Attrs: ecrud.EmployeeAttrs{
+				FirstName:   &fn,
+				LastName:    &ln,
+				DateOfBirth: &dob,
+				Email:       &em,
+			},
+		}
+		before, err := svc.List(ctx, ecrud.ListOptions{})
+		as.NoError(err)
+
+		// the second create takes the email of the first
+		results, err := svc.Batch(ctx, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			create,
+			{Op: ecrud.BatchUpdate, ID: 3, Attrs: ecrud.EmployeeAttrs{Role: &ro}},
+			create,
+			{Op: ecrud.BatchDelete, ID: 99},
+		}})
+		var ebf ecrud.ErrBatchFailed
+		as.ErrorAs(err, &ebf)
+		as.Len(results, 4)
+		as.NoError(results[0].Err)
+		as.NoError(results[1].Err)
+		var ebr ecrud.ErrBadRequest
+		as.ErrorAs(results[2].Err, &ebr)
+		var enf ecrud.ErrNotFound
+		as.ErrorAs(results[3].Err, &enf)
+
+		after, err := svc.List(ctx, ecrud.ListOptions{})
+		as.NoError(err)
+		as.Equal(before, after)
+
+		results, err = svc.Batch(ctx, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			create,
+			{Op: ecrud.BatchUpdate, ID: 3, Attrs: ecrud.EmployeeAttrs{Role: &ro}},
+		}})
+		as.NoError(err)
+		e, err := svc.Get(ctx, results[0].ID)
+		as.NoError(err)
+		as.Equal(em, e.Email)
+		e, err = svc.Get(ctx, 3)
+		as.NoError(err)
+		as.Equal(ro, *e.Role)
+	})
+
+	t.Run("`Delete` tombstones records until they are restored", func(tt *testing.T) {
+		as := assert.New(tt)
+		fn, ln, dob, em := "Phil", "Schiller", "1960-07-08", "phil@apple.com"
+		attrs := ecrud.EmployeeAttrs{FirstName: &fn, LastName: &ln, DateOfBirth: &dob, Email: &em}
+		id, err := svc.Create(ctx, attrs)
+		as.NoError(err)
+		as.NoError(svc.Delete(ctx, id))
+
+		var enf ecrud.ErrNotFound
+		_, err = svc.Get(ctx, id)
+		as.ErrorAs(err, &enf)
+		as.ErrorAs(svc.Delete(ctx, id), &enf)
+		_, err = svc.Update(ctx, id, attrs)
+		as.ErrorAs(err, &enf)
+		e, err := svc.Get(ctx, id, ecrud.WithDeleted())
+		as.NoError(err)
+		as.NotNil(e.DeletedAt)
+		page, err := svc.List(ctx, ecrud.ListOptions{})
+		as.NoError(err)
+		as.NotContains(page.Employees, e)
+		page, err = svc.List(ctx, ecrud.ListOptions{IncludeDeleted: true})
+		as.NoError(err)
+		as.Contains(page.Employees, e)
+
+		// the email is free to take until the record is restored
+		other, err := svc.Create(ctx, attrs)
+		as.NoError(err)
+		_, err = svc.Restore(ctx, id)
+		var ebr ecrud.ErrBadRequest
+		as.ErrorAs(err, &ebr)
+		as.NoError(svc.Delete(ctx, other))
+		e, err = svc.Restore(ctx, id)
+		as.NoError(err)
+		as.Nil(e.DeletedAt)
+		_, err = svc.Get(ctx, id)
+		as.NoError(err)
+		_, err = svc.Restore(ctx, 99)
+		as.ErrorAs(err, &enf)
+	})
+
+	t.Run("`Purge` hard deletes old tombstones", func(tt *testing.T) {
+		as := assert.New(tt)
+		fn, ln, dob, em := "Jony", "Ive", "1967-02-27", "jony@apple.com"
+		id, err := svc.Create(ctx, ecrud.EmployeeAttrs{FirstName: &fn, LastName: &ln, DateOfBirth: &dob, Email: &em})
+		as.NoError(err)
+		as.NoError(svc.Delete(ctx, id))
+
+		n, err := svc.Purge(ctx, time.Now().Add(-time.Hour))
+		as.NoError(err)
+		as.Zero(n)
+		n, err = svc.Purge(ctx, time.Now())
+		as.NoError(err)
+		as.Positive(n)
+		_, err = svc.Restore(ctx, id)
+		as.ErrorAs(err, &ecrud.ErrNotFound{})
+	})
+
+	t.Run("`Get` and `List` reconstruct past states", func(tt *testing.T) {
+		as := assert.New(tt)
+		before := time.Now()
+		fn, ln, dob, em, ro := "Craig", "Federighi", "1969-05-27", "craig@apple.com", "SVP"
+		id, err := svc.Create(ctx, ecrud.EmployeeAttrs{FirstName: &fn, LastName: &ln, DateOfBirth: &dob, Email: &em})
+		as.NoError(err)
+		created := time.Now()
+		_, err = svc.Update(ctx, id, ecrud.EmployeeAttrs{Role: &ro})
+		as.NoError(err)
+		updated := time.Now()
+		as.NoError(svc.Delete(ctx, id))
+
+		_, err = svc.Get(ctx, id, ecrud.AsOf(before))
+		as.ErrorAs(err, &ecrud.ErrNotFound{})
+		e, err := svc.Get(ctx, id, ecrud.AsOf(created))
+		as.NoError(err)
+		as.Nil(e.Role)
+		e, err = svc.Get(ctx, id, ecrud.AsOf(updated))
+		as.NoError(err)
+		as.Equal(ro, *e.Role)
+		_, err = svc.Get(ctx, id, ecrud.AsOf(time.Now()))
+		as.ErrorAs(err, &ecrud.ErrNotFound{})
+		e, err = svc.Get(ctx, id, ecrud.AsOf(time.Now()), ecrud.WithDeleted())
+		as.NoError(err)
+		as.NotNil(e.DeletedAt)
+
+		page, err := svc.List(ctx, ecrud.ListOptions{AsOf: &created, Role: &ro})
+		as.NoError(err)
+		as.Empty(page.Employees)
+		page, err = svc.List(ctx, ecrud.ListOptions{AsOf: &updated, Role: &ro})
+		as.NoError(err)
+		if as.Len(page.Employees, 1) {
+			as.Equal(id, page.Employees[0].ID)
+		}
+		// seed records have always existed
+		_, err = svc.Get(ctx, 3, ecrud.AsOf(time.Time{}))
+		as.NoError(err)
+	})
+
+	t.Run("keeps reporting lines acyclic", func(tt *testing.T) {
+		as := assert.New(tt)
+		create := func(fn string, managerID *int) int {
+			ln, dob, em := "Org", "1970-01-01", strings.ToLower(fn)+"@org.com"
+			id, err := svc.Create(ctx, ecrud.EmployeeAttrs{FirstName: &fn, LastName: &ln, DateOfBirth: &dob, Email: &em, ManagerID: managerID})
+			as.NoError(err)
+			return id
+		}
+		top := create("Top", nil)
+		mid := create("Mid", &top)
+		low := create("Low", &mid)
+
+		var ebr ecrud.ErrBadRequest
+		_, err := svc.Update(ctx, top, ecrud.EmployeeAttrs{ManagerID: &low})
+		if as.ErrorAs(err, &ebr) {
+			as.Equal([]ecrud.FieldError{{Field: "managerId", Reason: ecrud.ReasonCycle}}, ebr.Errors)
+		}
+		_, err = svc.Update(ctx, top, ecrud.EmployeeAttrs{ManagerID: &top})
+		as.ErrorAs(err, &ebr)
+		missing := 99
+		_, err = svc.Update(ctx, low, ecrud.EmployeeAttrs{ManagerID: &missing})
+		as.ErrorAs(err, &ebr)
+		page, err := svc.List(ctx, ecrud.ListOptions{ManagerID: &top})
+		as.NoError(err)
+		if as.Len(page.Employees, 1) {
+			as.Equal(mid, page.Employees[0].ID)
+		}
+
+		// managers go only once nobody reports to them
+		var ehr ecrud.ErrHasReports
+		if as.ErrorAs(svc.Delete(ctx, mid), &ehr) {
+			as.Equal([]int{low}, ehr.Reports)
+		}
+		_, err = svc.Update(ctx, low, ecrud.EmployeeAttrs{ManagerID: &top})
+		as.NoError(err)
+		as.NoError(svc.Delete(ctx, mid))
+		as.NoError(svc.Delete(ctx, low))
+		as.NoError(svc.Delete(ctx, top))
+		e, err := svc.Restore(ctx, low)
+		as.NoError(err)
+		as.Nil(e.ManagerID)
+		as.NoError(svc.Delete(ctx, low))
+
+		// a chain ending at a purged manager is no cycle
+		purged := 99
+		dangling := ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "Tim", LastName: "Cook", DateOfBirth: "1960-11-01", Email: "tim@apple.com", ManagerID: &purged},
+		}, &log)
+		fn, ln, dob, em, boss := "Phil", "Schiller", "1960-07-08", "phil@apple.com", 1
+		_, err = dangling.Create(ctx, ecrud.EmployeeAttrs{FirstName: &fn, LastName: &ln, DateOfBirth: &dob, Email: &em, ManagerID: &boss})
+		as.NoError(err)
+	})
+
+	t.Run("honors context cancellation", func(tt *testing.T) {
+		as := assert.New(tt)
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := svc.Get(cctx, 3)
+		as.ErrorIs(err, context.Canceled)
+		as.ErrorIs(svc.Delete(cctx, 3), context.Canceled)
+
+		// the cancelled delete must not have gone through
+		_, err = svc.Get(ctx, 3)
+		as.NoError(err)
+	})
 }
 
 func TestServiceMiddleware(t *testing.T) {
+	ctx := context.Background()
 	log := zerolog.Nop()
 	stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
 		1: {
@@ -86,11 +373,52 @@ func TestServiceMiddleware(t *testing.T) {
 			DateOfBirth: &dob,
 			Email:       &em,
 		}
-		_, err := svc.Create(attrs)
+		_, err := svc.Create(ctx, attrs)
 		var ebr ecrud.ErrBadRequest
 		as.ErrorAs(err, &ebr)
 		as.Contains(ebr.Fields, "dateOfBirth")
 		as.Contains(ebr.Fields, "email")
+		as.Contains(ebr.Errors, ecrud.FieldError{Field: "email", Reason: ecrud.ReasonMalformed})
+	})
+
+	t.Run("reports why `Create` params are rejected", func(tt *testing.T) {
+		as := assert.New(tt)
+		fn := "J"
+		_, err := svc.Create(ctx, ecrud.EmployeeAttrs{FirstName: &fn})
+		var ebr ecrud.ErrBadRequest
+		as.ErrorAs(err, &ebr)
+		as.Equal([]ecrud.FieldError{
+			{Field: "firstName", Reason: ecrud.ReasonTooShort},
+			{Field: "lastName", Reason: ecrud.ReasonRequired},
+			{Field: "dateOfBirth", Reason: ecrud.ReasonRequired},
+			{Field: "email", Reason: ecrud.ReasonRequired},
+		}, ebr.Errors)
+	})
+
+	t.Run("validates `List` options", func(tt *testing.T) {
+		as := assert.New(tt)
+		dob := "15-04-2001"
+		_, err := svc.List(ctx, ecrud.ListOptions{
+			Limit:           ecrud.MaxListLimit + 1,
+			Sort:            "salary",
+			Cursor:          "garbage!",
+			DateOfBirthFrom: &dob,
+		})
+		var ebr ecrud.ErrBadRequest
+		as.ErrorAs(err, &ebr)
+		as.ElementsMatch([]string{"limit", "sort", "cursor", "dateOfBirthFrom"}, ebr.Fields)
+	})
+
+	t.Run("validates `Update` clears", func(tt *testing.T) {
+		as := assert.New(tt)
+		ro := "CEO"
+		_, err := svc.Update(ctx, 1, ecrud.EmployeeAttrs{Role: &ro, Clear: []string{"role", "firstName"}})
+		var ebr ecrud.ErrBadRequest
+		as.ErrorAs(err, &ebr)
+		as.ElementsMatch([]ecrud.FieldError{
+			{Field: "clear", Reason: ecrud.ReasonUnknown},
+			{Field: "clear", Reason: ecrud.ReasonExclusive},
+		}, ebr.Errors)
 	})
 
 	t.Run("validates `Update` params", func(tt *testing.T) {
@@ -100,10 +428,36 @@ func TestServiceMiddleware(t *testing.T) {
 			DateOfBirth: &dob,
 			Email:       &em,
 		}
-		err := svc.Update(1, attrs)
+		_, err := svc.Update(ctx, 1, attrs)
 		var ebr ecrud.ErrBadRequest
 		as.ErrorAs(err, &ebr)
 		as.Contains(ebr.Fields, "dateOfBirth")
 		as.Contains(ebr.Fields, "email")
 	})
+
+	t.Run("validates `Batch` operations", func(tt *testing.T) {
+		as := assert.New(tt)
+		_, err := svc.Batch(ctx, ecrud.BatchRequest{})
+		var ebr ecrud.ErrBadRequest
+		as.ErrorAs(err, &ebr)
+		as.Equal([]string{"ops"}, ebr.Fields)
+
+		em := "notavalid-email"
+		results, err := svc.Batch(ctx, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			{Op: ecrud.BatchDelete, ID: 1},
+			{Op: ecrud.BatchUpdate, ID: 1, Attrs: ecrud.EmployeeAttrs{Email: &em}},
+			{Op: "upsert"},
+		}})
+		var ebf ecrud.ErrBatchFailed
+		as.ErrorAs(err, &ebf)
+		as.NoError(results[0].Err)
+		as.ErrorAs(results[1].Err, &ebr)
+		as.Equal([]string{"email"}, ebr.Fields)
+		as.ErrorAs(results[2].Err, &ebr)
+		as.Equal([]string{"op"}, ebr.Fields)
+
+		// nothing reached the store
+		_, err = svc.Get(ctx, 1)
+		as.NoError(err)
+	})
 }
@@ -0,0 +1,737 @@
+package ecrud
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteMigrations are applied in order; PRAGMA user_version records
+// how many have run. Only ever append to this list.
+var sqliteMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS employees (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		first_name    TEXT NOT NULL,
+		last_name     TEXT NOT NULL,
+		date_of_birth TEXT NOT NULL,
+		email         TEXT NOT NULL UNIQUE,
+		is_active     INTEGER,
+		department    TEXT,
+		role          TEXT
+	)`,
+	`ALTER TABLE employees ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+	// tombstones free their email, so the table is rebuilt to make it
+	// unique among live records only, keeping the id sequence
+	`CREATE TABLE employees_new (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		first_name    TEXT NOT NULL,
+		last_name     TEXT NOT NULL,
+		date_of_birth TEXT NOT NULL,
+		email         TEXT NOT NULL,
+		is_active     INTEGER,
+		department    TEXT,
+		role          TEXT,
+		version       INTEGER NOT NULL DEFAULT 1,
+		deleted_at    TEXT
+	);
+	INSERT INTO employees_new (id, first_name, last_name, date_of_birth, email, is_active, department, role, version)
+		SELECT id, first_name, last_name, date_of_birth, email, is_active, department, role, version FROM employees;
+	DELETE FROM sqlite_sequence WHERE name = 'employees_new';
+	INSERT INTO sqlite_sequence (name, seq) SELECT 'employees_new', seq FROM sqlite_sequence WHERE name = 'employees';
+	DROP TABLE employees;
+	ALTER TABLE employees_new RENAME TO employees;
+	CREATE UNIQUE INDEX employees_live_email ON employees (email) WHERE deleted_at IS NULL;
+	CREATE INDEX employees_deleted_at ON employees (deleted_at) WHERE deleted_at IS NOT NULL`,
+	// every version of every record, kept by triggers so that no write
+	// can skip it. Existing records are taken to have always been as
+	// they are; purged ones lose their history.
+	`CREATE TABLE employee_versions (
+		id            INTEGER NOT NULL,
+		first_name    TEXT NOT NULL,
+		last_name     TEXT NOT NULL,
+		date_of_birth TEXT NOT NULL,
+		email         TEXT NOT NULL,
+		is_active     INTEGER,
+		department    TEXT,
+		role          TEXT,
+		version       INTEGER NOT NULL,
+		deleted_at    TEXT,
+		valid_from    TEXT NOT NULL,
+		PRIMARY KEY (id, version)
+	);
+	INSERT INTO employee_versions
+		SELECT id, first_name, last_name, date_of_birth, email, is_active, department, role, version, deleted_at, '' FROM employees;
+	CREATE TRIGGER employees_version_insert AFTER INSERT ON employees BEGIN
+		INSERT INTO employee_versions VALUES (NEW.id, NEW.first_name, NEW.last_name, NEW.date_of_birth, NEW.email,
+			NEW.is_active, NEW.department, NEW.role, NEW.version, NEW.deleted_at,
+			strftime('%Y-%m-%dT%H:%M:%f', 'now') || '000000Z');
+	END;
+	CREATE TRIGGER employees_version_update AFTER UPDATE ON employees BEGIN
+		INSERT INTO employee_versions VALUES (NEW.id, NEW.first_name, NEW.last_name, NEW.date_of_birth, NEW.email,
+			NEW.is_active, NEW.department, NEW.role, NEW.version, NEW.deleted_at,
+			strftime('%Y-%m-%dT%H:%M:%f', 'now') || '000000Z');
+	END;
+	CREATE TRIGGER employees_version_delete AFTER DELETE ON employees BEGIN
+		DELETE FROM employee_versions WHERE id = OLD.id;
+	END`,
+	// the version triggers name their columns from now on, as the new
+	// one comes after valid_from
+	`ALTER TABLE employees ADD COLUMN manager_id INTEGER;
+	ALTER TABLE employee_versions ADD COLUMN manager_id INTEGER;
+	CREATE INDEX employees_manager_id ON employees (manager_id) WHERE manager_id IS NOT NULL;
+	DROP TRIGGER employees_version_insert;
+	DROP TRIGGER employees_version_update;
+	CREATE TRIGGER employees_version_insert AFTER INSERT ON employees BEGIN
+		INSERT INTO employee_versions (` + sqliteColumns + `, valid_from)
+		VALUES (NEW.id, NEW.first_name, NEW.last_name, NEW.date_of_birth, NEW.email,
+			NEW.is_active, NEW.department, NEW.role, NEW.manager_id, NEW.version, NEW.deleted_at,
+			strftime('%Y-%m-%dT%H:%M:%f', 'now') || '000000Z');
+	END;
+	CREATE TRIGGER employees_version_update AFTER UPDATE ON employees BEGIN
+		INSERT INTO employee_versions (` + sqliteColumns + `, valid_from)
+		VALUES (NEW.id, NEW.first_name, NEW.last_name, NEW.date_of_birth, NEW.email,
+			NEW.is_active, NEW.department, NEW.role, NEW.manager_id, NEW.version, NEW.deleted_at,
+			strftime('%Y-%m-%dT%H:%M:%f', 'now') || '000000Z');
+	END`,
+}
+
+const sqliteColumns = `id, first_name, last_name, date_of_birth, email, is_active, department, role, manager_id, version, deleted_at`
+
+// sqliteTimeLayout stores timestamps in UTC at a fixed width, so that
+// they sort as text. Versions are timed by SQLite itself, to the
+// millisecond, and padded to the same width.
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// sqliteVersionsAsOf shadows the employees table with the versions
+// current at a given instant, passed twice, so that reads run unchanged
+// against the past
+const sqliteVersionsAsOf = `WITH employees AS (
+	SELECT ` + sqliteColumns + ` FROM employee_versions v
+	WHERE valid_from <= ? AND version = (
+		SELECT MAX(version) FROM employee_versions WHERE id = v.id AND valid_from <= ?
+	)
+) `
+
+// sqliteSortColumns maps ListOptions.Sort values onto columns
+var sqliteSortColumns = map[string]string{
+	"id":          "id",
+	"firstName":   "first_name",
+	"lastName":    "last_name",
+	"dateOfBirth": "date_of_birth",
+	"email":       "email",
+	"department":  "department",
+	"role":        "role",
+}
+
+// ServiceSQLite is a Service implementation backed by a local SQLite
+// database file. Unlike ServiceStub, records survive process restarts
+// and email uniqueness is enforced by the schema.
+type ServiceSQLite struct {
+	db  *sql.DB
+	log *zerolog.Logger
+}
+
+var _ Service = (*ServiceSQLite)(nil)
+
+// NewServiceSQLite opens (or creates) the SQLite database at dsn and
+// ensures the schema exists. Use ":memory:" for a throwaway database.
+func NewServiceSQLite(dsn string, logr *zerolog.Logger) (*ServiceSQLite, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite serializes writers anyway; a single connection also keeps
+	// ":memory:" databases from being split across the pool.
+	db.SetMaxOpenConns(1)
+
+	if err = migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &ServiceSQLite{
+		db:  db,
+		log: logr,
+	}, nil
+}
+
+func migrateSQLite(db *sql.DB) error {
+	var applied int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&applied); err != nil {
+		return err
+	}
+
+	for i := applied; i < len(sqliteMigrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		// PRAGMA does not accept bound parameters
+		if _, err = tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close releases the underlying database handle
+func (svc *ServiceSQLite) Close() error {
+	return svc.db.Close()
+}
+
+func (svc *ServiceSQLite) List(ctx context.Context, opts ListOptions) (EmployeePage, error) {
+	offset, err := opts.start()
+	if err != nil {
+		return EmployeePage{}, err
+	}
+
+	var (
+		where []string
+		args  []any
+	)
+	if !opts.IncludeDeleted {
+		where = append(where, "deleted_at IS NULL")
+	}
+	if opts.Department != nil {
+		where = append(where, "department = ?")
+		args = append(args, *opts.Department)
+	}
+	if opts.Role != nil {
+		where = append(where, "role = ?")
+		args = append(args, *opts.Role)
+	}
+	if opts.IsActive != nil {
+		where = append(where, "is_active = ?")
+		args = append(args, *opts.IsActive)
+	}
+	if opts.ManagerID != nil {
+		where = append(where, "manager_id = ?")
+		args = append(args, *opts.ManagerID)
+	}
+	if opts.DateOfBirthFrom != nil {
+		where = append(where, "date_of_birth >= ?")
+		args = append(args, *opts.DateOfBirthFrom)
+	}
+	if opts.DateOfBirthTo != nil {
+		where = append(where, "date_of_birth <= ?")
+		args = append(args, *opts.DateOfBirthTo)
+	}
+	cond := ""
+	if where != nil {
+		cond = " WHERE " + strings.Join(where, " AND ")
+	}
+	with := ""
+	if opts.AsOf != nil {
+		asOf := opts.AsOf.UTC().Format(sqliteTimeLayout)
+		with = sqliteVersionsAsOf
+		args = append([]any{asOf, asOf}, args...)
+	}
+
+	var total int
+	err = svc.db.QueryRowContext(ctx, with+`SELECT COUNT(*) FROM employees`+cond, args...).Scan(&total)
+	if err != nil {
+		return EmployeePage{}, svc.dbError(ctx, "`List` count failed", err)
+	}
+
+	dir := "ASC"
+	if opts.Desc {
+		dir = "DESC"
+	}
+	order := "id " + dir
+	if col, ok := sqliteSortColumns[opts.Sort]; ok && col != "id" {
+		order = col + " " + dir + ", " + order
+	}
+	limit := -1
+	if opts.Limit > 0 {
+		limit = opts.Limit
+	}
+	query := with + `SELECT ` + sqliteColumns + ` FROM employees` + cond +
+		` ORDER BY ` + order + ` LIMIT ? OFFSET ?`
+
+	rows, err := svc.db.QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return EmployeePage{}, svc.dbError(ctx, "`List` query failed", err)
+	}
+	defer rows.Close()
+
+	employees := []Employee{}
+	for rows.Next() {
+		e, err := scanEmployee(rows)
+		if err != nil {
+			return EmployeePage{}, svc.dbError(ctx, "`List` scan failed", err)
+		}
+		employees = append(employees, e)
+	}
+	if err = rows.Err(); err != nil {
+		return EmployeePage{}, svc.dbError(ctx, "`List` iteration failed", err)
+	}
+
+	return EmployeePage{
+		Employees:  employees,
+		Total:      total,
+		NextCursor: opts.nextCursor(offset, len(employees), total),
+	}, nil
+}
+
+func (svc *ServiceSQLite) Get(ctx context.Context, id int, opts ...GetOption) (Employee, error) {
+	o := newGetOptions(opts)
+	query, args := `SELECT `+sqliteColumns+` FROM employees WHERE id = ?`, []any{id}
+	if !o.IncludeDeleted {
+		query += ` AND deleted_at IS NULL`
+	}
+	if o.AsOf != nil {
+		asOf := o.AsOf.UTC().Format(sqliteTimeLayout)
+		query = sqliteVersionsAsOf + query
+		args = []any{asOf, asOf, id}
+	}
+	row := svc.db.QueryRowContext(ctx, query, args...)
+	e, err := scanEmployee(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		ctxLogger(ctx, svc.log).Info().
+			Int("id", id).
+			Msg("`Get` not found")
+		return e, ErrNotFound{ID: id}
+	}
+	if err != nil {
+		return e, svc.dbError(ctx, "`Get` query failed", err)
+	}
+
+	return e, nil
+}
+
+func (svc *ServiceSQLite) Create(ctx context.Context, attrs EmployeeAttrs) (int, error) {
+	var id int
+	err := svc.inTx(ctx, "`Create`", func(tx *sql.Tx) (err error) {
+		id, err = svc.create(ctx, tx, attrs)
+		return err
+	})
+
+	return id, err
+}
+
+func (svc *ServiceSQLite) create(ctx context.Context, q sqlQuerier, attrs EmployeeAttrs) (int, error) {
+	if attrs.ManagerID != nil {
+		if err := svc.checkManager(ctx, q, 0, *attrs.ManagerID); err != nil {
+			return 0, err
+		}
+	}
+	res, err := q.ExecContext(
+		ctx,
+		`INSERT INTO employees (first_name, last_name, date_of_birth, email, is_active, department, role, manager_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		*attrs.FirstName,
+		*attrs.LastName,
+		*attrs.DateOfBirth,
+		*attrs.Email,
+		attrs.IsActive,
+		attrs.Department,
+		attrs.Role,
+		attrs.ManagerID,
+	)
+	if err != nil {
+		return 0, svc.writeError(ctx, "`Create`", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, svc.dbError(ctx, "`Create` reading id failed", err)
+	}
+
+	return int(id), nil
+}
+
+func (svc *ServiceSQLite) Update(ctx context.Context, id int, attrs EmployeeAttrs) (Employee, error) {
+	var e Employee
+	err := svc.inTx(ctx, "`Update`", func(tx *sql.Tx) (err error) {
+		e, err = svc.update(ctx, tx, id, attrs)
+		return err
+	})
+
+	return e, err
+}
+
+func (svc *ServiceSQLite) update(ctx context.Context, q sqlQuerier, id int, attrs EmployeeAttrs) (Employee, error) {
+	// NULL parameters leave the column untouched, matching the
+	// "nil means unchanged" semantics of EmployeeAttrs, unless the
+	// column is explicitly cleared.
+	row := q.QueryRowContext(
+		ctx,
+		`UPDATE employees SET
+			first_name    = COALESCE(?, first_name),
+			last_name     = COALESCE(?, last_name),
+			date_of_birth = COALESCE(?, date_of_birth),
+			email         = COALESCE(?, email),
+			is_active     = CASE WHEN ? THEN NULL ELSE COALESCE(?, is_active) END,
+			department    = CASE WHEN ? THEN NULL ELSE COALESCE(?, department) END,
+			role          = CASE WHEN ? THEN NULL ELSE COALESCE(?, role) END,
+			manager_id    = CASE WHEN ? THEN NULL ELSE COALESCE(?, manager_id) END,
+			version       = version + 1
+		WHERE id = ? AND version = COALESCE(?, version) AND deleted_at IS NULL
+		RETURNING `+sqliteColumns,
+		attrs.FirstName,
+		attrs.LastName,
+		attrs.DateOfBirth,
+		attrs.Email,
+		attrs.IsActive == nil && attrs.clears("isActive"),
+		attrs.IsActive,
+		attrs.Department == nil && attrs.clears("department"),
+		attrs.Department,
+		attrs.Role == nil && attrs.clears("role"),
+		attrs.Role,
+		attrs.ManagerID == nil && attrs.clears("managerId"),
+		attrs.ManagerID,
+		id,
+		attrs.Version,
+	)
+	e, err := scanEmployee(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Employee{}, svc.updateMiss(ctx, q, id, attrs)
+	}
+	if err != nil {
+		return Employee{}, svc.writeError(ctx, "`Update`", err)
+	}
+	// checked against the updated row, the caller rolls a failure back
+	if attrs.ManagerID != nil {
+		if err := svc.checkManager(ctx, q, id, *attrs.ManagerID); err != nil {
+			return Employee{}, err
+		}
+	}
+
+	return e, nil
+}
+
+// updateMiss works out why an UPDATE matched no row: either the record
+// does not exist or its version moved on.
+func (svc *ServiceSQLite) updateMiss(ctx context.Context, q sqlQuerier, id int, attrs EmployeeAttrs) error {
+	var version int
+	err := sql.ErrNoRows
+	if attrs.Version != nil {
+		err = q.QueryRowContext(ctx, `SELECT version FROM employees WHERE id = ? AND deleted_at IS NULL`, id).Scan(&version)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		ctxLogger(ctx, svc.log).Info().
+			Int("id", id).
+			Msg("`Update` not found")
+		return ErrNotFound{ID: id}
+	}
+	if err != nil {
+		return svc.dbError(ctx, "`Update` version lookup failed", err)
+	}
+
+	ctxLogger(ctx, svc.log).Info().
+		Int("id", id).
+		Int("version", version).
+		Int("expected", *attrs.Version).
+		Msg("`Update` conflict")
+	return ErrConflict{ID: id, Version: version}
+}
+
+func (svc *ServiceSQLite) Delete(ctx context.Context, id int) error {
+	return svc.inTx(ctx, "`Delete`", func(tx *sql.Tx) error {
+		return svc.delete(ctx, tx, id)
+	})
+}
+
+func (svc *ServiceSQLite) delete(ctx context.Context, q sqlQuerier, id int) error {
+	reports, err := svc.reports(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	if len(reports) > 0 {
+		ctxLogger(ctx, svc.log).Info().
+			Int("id", id).
+			Ints("reports", reports).
+			Msg("`Delete` has reports")
+		return ErrHasReports{ID: id, Reports: reports}
+	}
+
+	res, err := q.ExecContext(
+		ctx,
+		`UPDATE employees SET deleted_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL`,
+		time.Now().UTC().Format(sqliteTimeLayout),
+		id,
+	)
+	if err != nil {
+		return svc.writeError(ctx, "`Delete`", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return svc.dbError(ctx, "`Delete` reading affected rows failed", err)
+	}
+	if n == 0 {
+		return ErrNotFound{ID: id}
+	}
+
+	return nil
+}
+
+func (svc *ServiceSQLite) Restore(ctx context.Context, id int) (Employee, error) {
+	row := svc.db.QueryRowContext(
+		ctx,
+		`UPDATE employees SET deleted_at = NULL, version = version + 1,
+			-- a manager deleted in the meantime is not brought back
+			manager_id = CASE WHEN EXISTS (
+				SELECT 1 FROM employees m WHERE m.id = employees.manager_id AND m.deleted_at IS NULL
+			) THEN manager_id END
+		WHERE id = ? AND deleted_at IS NOT NULL
+		RETURNING `+sqliteColumns,
+		id,
+	)
+	e, err := scanEmployee(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		// either missing or not deleted
+		return svc.Get(ctx, id)
+	}
+	if err != nil {
+		return Employee{}, svc.writeError(ctx, "`Restore`", err)
+	}
+
+	return e, nil
+}
+
+// Purge hard deletes the records tombstoned before t
+func (svc *ServiceSQLite) Purge(ctx context.Context, t time.Time) (int, error) {
+	res, err := svc.db.ExecContext(
+		ctx,
+		`DELETE FROM employees WHERE deleted_at IS NOT NULL AND deleted_at < ?`,
+		t.UTC().Format(sqliteTimeLayout),
+	)
+	if err != nil {
+		return 0, svc.dbError(ctx, "`Purge` query failed", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, svc.dbError(ctx, "`Purge` reading affected rows failed", err)
+	}
+
+	return int(n), nil
+}
+
+// Batch runs every operation in one transaction, rolled back if any
+// failed or on a dry run. Every operation is attempted so that every
+// failure is reported, not just the first.
+func (svc *ServiceSQLite) Batch(ctx context.Context, req BatchRequest) ([]BatchResult, error) {
+	tx, err := svc.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, svc.dbError(ctx, "`Batch` begin failed", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		results = make([]BatchResult, len(req.Ops))
+		failed  bool
+	)
+	for i, op := range req.Ops {
+		results[i] = BatchResult{Index: i, Op: op.Op, ID: op.ID}
+
+		var err error
+		switch op.Op {
+		case BatchCreate:
+			results[i].ID, err = svc.create(ctx, tx, op.Attrs)
+		case BatchUpdate:
+			_, err = svc.update(ctx, tx, op.ID, op.Attrs)
+		case BatchDelete:
+			err = svc.delete(ctx, tx, op.ID)
+		default:
+			err = badRequest("op", ReasonUnknown)
+		}
+		if err != nil {
+			if errors.Is(err, ErrServerError) || ctx.Err() != nil {
+				return results, err
+			}
+			results[i].Err = err
+			failed = true
+		}
+	}
+
+	if failed {
+		return results, ErrBatchFailed{Results: results}
+	}
+	if req.DryRun {
+		return results, nil
+	}
+	if err = tx.Commit(); err != nil {
+		return results, svc.dbError(ctx, "`Batch` commit failed", err)
+	}
+
+	return results, nil
+}
+
+// sqlQuerier is satisfied by both *sql.DB and *sql.Tx
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// inTx runs fn in a transaction, committed only if fn succeeds, so that
+// the checks of a write see the same records it does
+func (svc *ServiceSQLite) inTx(ctx context.Context, op string, fn func(tx *sql.Tx) error) error {
+	tx, err := svc.db.BeginTx(ctx, nil)
+	if err != nil {
+		return svc.dbError(ctx, op+" begin failed", err)
+	}
+	defer tx.Rollback()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return svc.dbError(ctx, op+" commit failed", err)
+	}
+
+	return nil
+}
+
+// checkManager rejects managerID unless it is a live employee that does
+// not, directly or not, report to id. id is 0 for new records.
+func (svc *ServiceSQLite) checkManager(ctx context.Context, q sqlQuerier, id, managerID int) error {
+	var live, cycle bool
+	// UNION drops repeated ids, which ends the walk should a cycle
+	// already exist
+	err := q.QueryRowContext(
+		ctx,
+		`SELECT
+			EXISTS (SELECT 1 FROM employees WHERE id = ? AND deleted_at IS NULL),
+			EXISTS (
+				WITH RECURSIVE chain (id) AS (
+					SELECT ?
+					UNION
+					SELECT e.manager_id FROM employees e JOIN chain c ON e.id = c.id
+					WHERE e.manager_id IS NOT NULL
+				)
+				SELECT 1 FROM chain WHERE id = ?
+			)`,
+		managerID,
+		managerID,
+		id,
+	).Scan(&live, &cycle)
+	switch {
+	case err != nil:
+		return svc.dbError(ctx, "manager lookup failed", err)
+	case !live:
+		return badRequest("managerId", ReasonUnknown)
+	case cycle:
+		return badRequest("managerId", ReasonCycle)
+	}
+
+	return nil
+}
+
+// reports lists the live employees reporting to id, in id order
+func (svc *ServiceSQLite) reports(ctx context.Context, q sqlQuerier, id int) ([]int, error) {
+	rows, err := q.QueryContext(ctx, `SELECT id FROM employees WHERE manager_id = ? AND deleted_at IS NULL ORDER BY id`, id)
+	if err != nil {
+		return nil, svc.dbError(ctx, "reports query failed", err)
+	}
+	defer rows.Close()
+
+	var reports []int
+	for rows.Next() {
+		var report int
+		if err = rows.Scan(&report); err != nil {
+			return nil, svc.dbError(ctx, "reports scan failed", err)
+		}
+		reports = append(reports, report)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, svc.dbError(ctx, "reports iteration failed", err)
+	}
+
+	return reports, nil
+}
+
+// writeError translates a failed write into a domain error. A unique
+// constraint violation can only come from the email column.
+func (svc *ServiceSQLite) writeError(ctx context.Context, op string, err error) error {
+	var serr *sqlite.Error
+	if errors.As(err, &serr) && serr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return badRequest("email", ReasonTaken)
+	}
+
+	return svc.dbError(ctx, op+" query failed", err)
+}
+
+// dbError logs an unexpected database failure and hides it behind
+// ErrServerError, unless it was caused by the caller giving up.
+func (svc *ServiceSQLite) dbError(ctx context.Context, msg string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	ctxLogger(ctx, svc.log).Error().
+		Err(err).
+		Msg(msg)
+	return ErrServerError
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanEmployee(row rowScanner) (Employee, error) {
+	var (
+		e          Employee
+		isActive   sql.NullBool
+		department sql.NullString
+		role       sql.NullString
+		managerID  sql.NullInt64
+		deletedAt  sql.NullString
+	)
+	err := row.Scan(
+		&e.ID,
+		&e.FirstName,
+		&e.LastName,
+		&e.DateOfBirth,
+		&e.Email,
+		&isActive,
+		&department,
+		&role,
+		&managerID,
+		&e.Version,
+		&deletedAt,
+	)
+	if err != nil {
+		return Employee{}, err
+	}
+
+	if isActive.Valid {
+		e.IsActive = &isActive.Bool
+	}
+	if department.Valid {
+		e.Department = &department.String
+	}
+	if role.Valid {
+		e.Role = &role.String
+	}
+	if managerID.Valid {
+		id := int(managerID.Int64)
+		e.ManagerID = &id
+	}
+	if deletedAt.Valid {
+		t, err := time.Parse(sqliteTimeLayout, deletedAt.String)
+		if err != nil {
+			return Employee{}, err
+		}
+		e.DeletedAt = &t
+	}
+
+	return e, nil
+}
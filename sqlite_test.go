@@ -0,0 +1,340 @@
+package ecrud_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+)
+
+func TestServiceSQLite(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	dbpath := filepath.Join(t.TempDir(), "ecrud.db")
+	svc, err := ecrud.NewServiceSQLite(dbpath, &log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+
+	fn, ln, dob, em, dept := "David", "Ebreo", "2001-08-15", "hire@me.com", "Engineering"
+	seeded, err := svc.Create(ctx, ecrud.EmployeeAttrs{
+		FirstName:   &fn,
+		LastName:    &ln,
+		DateOfBirth: &dob,
+		Email:       &em,
+		Department:  &dept,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("`Create` increments id", func(tt *testing.T) {
+		as := assert.New(tt)
+		fn, ln, dob, em, ro := "Steve", "Jobs", "1955-02-24", "steve@apple.com", "CEO"
+		attrs := ecrud.EmployeeAttrs{
+			FirstName:   &fn,
+			LastName:    &ln,
+			DateOfBirth: &dob,
+			Email:       &em,
+			Role:        &ro,
+		}
+		id, err := svc.Create(ctx, attrs)
+		as.NoError(err)
+		as.Greater(id, seeded)
+	})
+
+	t.Run("`Create` returns error on existing email", func(tt *testing.T) {
+		as := assert.New(tt)
+		fn, ln, dob, em := "Linus", "Torvalds", "1969-12-28", "hire@me.com"
+		attrs := ecrud.EmployeeAttrs{
+			FirstName:   &fn,
+			LastName:    &ln,
+			DateOfBirth: &dob,
+			Email:       &em,
+		}
+		_, err := svc.Create(ctx, attrs)
+		concrete := ecrud.ErrBadRequest{}
+		as.ErrorAs(err, &concrete)
+		as.Contains(concrete.Fields, "email")
+	})
+
+	t.Run("`Update` leaves unspecified fields unchanged", func(tt *testing.T) {
+		as := assert.New(tt)
+		ro := "Staff Engineer"
+		updated, err := svc.Update(ctx, seeded, ecrud.EmployeeAttrs{Role: &ro})
+		as.NoError(err)
+		as.Equal(ro, *updated.Role)
+		as.Equal(2, updated.Version)
+
+		e, err := svc.Get(ctx, seeded)
+		as.NoError(err)
+		as.Equal("David", e.FirstName)
+		as.Equal(dept, *e.Department)
+		as.Equal(ro, *e.Role)
+		as.Nil(e.IsActive)
+	})
+
+	t.Run("`Update` clears optional fields", func(tt *testing.T) {
+		as := assert.New(tt)
+		updated, err := svc.Update(ctx, seeded, ecrud.EmployeeAttrs{Clear: []string{"department"}})
+		as.NoError(err)
+		as.Nil(updated.Department)
+		as.NotNil(updated.Role)
+
+		updated, err = svc.Update(ctx, seeded, ecrud.EmployeeAttrs{Department: &dept})
+		as.NoError(err)
+		as.Equal(dept, *updated.Department)
+	})
+
+	t.Run("`Update` rejects stale versions", func(tt *testing.T) {
+		as := assert.New(tt)
+		stale, ro := 1, "Principal Engineer"
+		_, err := svc.Update(ctx, seeded, ecrud.EmployeeAttrs{Role: &ro, Version: &stale})
+		var ecf ecrud.ErrConflict
+		as.ErrorAs(err, &ecf)
+		as.Equal(4, ecf.Version)
+
+		_, err = svc.Update(ctx, 99, ecrud.EmployeeAttrs{Role: &ro, Version: &stale})
+		var enf ecrud.ErrNotFound
+		as.ErrorAs(err, &enf)
+	})
+
+	t.Run("`List` returns list of employees", func(tt *testing.T) {
+		as := assert.New(tt)
+		page, err := svc.List(ctx, ecrud.ListOptions{})
+		as.NoError(err)
+		as.Len(page.Employees, 2)
+		as.Equal(2, page.Total)
+	})
+
+	t.Run("`List` filters, sorts and pages", func(tt *testing.T) {
+		as := assert.New(tt)
+		page, err := svc.List(ctx, ecrud.ListOptions{Department: &dept})
+		as.NoError(err)
+		as.Equal(1, page.Total)
+		as.Equal(seeded, page.Employees[0].ID)
+
+		page, err = svc.List(ctx, ecrud.ListOptions{Sort: "lastName", Desc: true, Limit: 1})
+		as.NoError(err)
+		as.Equal(2, page.Total)
+		as.Equal("Jobs", page.Employees[0].LastName)
+		as.NotEmpty(page.NextCursor)
+
+		page, err = svc.List(ctx, ecrud.ListOptions{Sort: "lastName", Desc: true, Limit: 1, Cursor: page.NextCursor})
+		as.NoError(err)
+		as.Equal("Ebreo", page.Employees[0].LastName)
+		as.Empty(page.NextCursor)
+
+		from := "1990-01-01"
+		page, err = svc.List(ctx, ecrud.ListOptions{DateOfBirthFrom: &from})
+		as.NoError(err)
+		as.Equal(1, page.Total)
+		as.Equal(seeded, page.Employees[0].ID)
+	})
+
+	t.Run("`Batch` rolls back when an operation fails", func(tt *testing.T) {
+		as := assert.New(tt)
+		fn, ln, dob, em, ro := "Tim", "Cook", "1960-11-01", "tim@apple.com", "COO"
+		create := ecrud.BatchOp{
+			Op: ecrud.BatchCreate,
+			Attrs: ecrud.EmployeeAttrs{
+				FirstName:   &fn,
+				LastName:    &ln,
+				DateOfBirth: &dob,
+				Email:       &em,
+			},
+		}
+		before, err := svc.Get(ctx, seeded)
+		as.NoError(err)
+
+		results, err := svc.Batch(ctx, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			create,
+			{Op: ecrud.BatchUpdate, ID: seeded, Attrs: ecrud.EmployeeAttrs{Role: &ro}},
+			create,
+		}})
+		var ebf ecrud.ErrBatchFailed
+		as.ErrorAs(err, &ebf)
+		as.NoError(results[0].Err)
+		var ebr ecrud.ErrBadRequest
+		as.ErrorAs(results[2].Err, &ebr)
+		after, err := svc.Get(ctx, seeded)
+		as.NoError(err)
+		as.Equal(before, after)
+		page, err := svc.List(ctx, ecrud.ListOptions{})
+		as.NoError(err)
+		for _, e := range page.Employees {
+			as.NotEqual(em, e.Email)
+		}
+
+		results, err = svc.Batch(ctx, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			create,
+			{Op: ecrud.BatchUpdate, ID: seeded, Attrs: ecrud.EmployeeAttrs{Role: &ro}},
+		}})
+		as.NoError(err)
+		as.NoError(svc.Delete(ctx, results[0].ID))
+		after, err = svc.Get(ctx, seeded)
+		as.NoError(err)
+		as.Equal(ro, *after.Role)
+	})
+
+	t.Run("records survive reopening the database", func(tt *testing.T) {
+		as := assert.New(tt)
+		reopened, err := ecrud.NewServiceSQLite(dbpath, &log)
+		as.NoError(err)
+		defer reopened.Close()
+		e, err := reopened.Get(ctx, seeded)
+		as.NoError(err)
+		as.Equal("hire@me.com", e.Email)
+	})
+
+	t.Run("`Delete` frees the email", func(tt *testing.T) {
+		as := assert.New(tt)
+		as.NoError(svc.Delete(ctx, seeded))
+		_, err := svc.Get(ctx, seeded)
+		var enf ecrud.ErrNotFound
+		as.ErrorAs(err, &enf)
+		as.ErrorAs(svc.Delete(ctx, seeded), &enf)
+		e, err := svc.Get(ctx, seeded, ecrud.WithDeleted())
+		as.NoError(err)
+		as.NotNil(e.DeletedAt)
+		page, err := svc.List(ctx, ecrud.ListOptions{IncludeDeleted: true})
+		as.NoError(err)
+		as.Contains(page.Employees, e)
+
+		fn, ln, dob, em := "Linus", "Torvalds", "1969-12-28", "hire@me.com"
+		linus, err := svc.Create(ctx, ecrud.EmployeeAttrs{
+			FirstName:   &fn,
+			LastName:    &ln,
+			DateOfBirth: &dob,
+			Email:       &em,
+		})
+		as.NoError(err)
+
+		// until the deleted record is restored
+		_, err = svc.Restore(ctx, seeded)
+		var ebr ecrud.ErrBadRequest
+		as.ErrorAs(err, &ebr)
+		as.NoError(svc.Delete(ctx, linus))
+		e, err = svc.Restore(ctx, seeded)
+		as.NoError(err)
+		as.Nil(e.DeletedAt)
+		as.Equal("hire@me.com", e.Email)
+	})
+
+	t.Run("`Purge` hard deletes old tombstones", func(tt *testing.T) {
+		as := assert.New(tt)
+		as.NoError(svc.Delete(ctx, seeded))
+		n, err := svc.Purge(ctx, time.Now().Add(-time.Hour))
+		as.NoError(err)
+		as.Zero(n)
+		n, err = svc.Purge(ctx, time.Now())
+		as.NoError(err)
+		as.Positive(n)
+		_, err = svc.Restore(ctx, seeded)
+		as.ErrorAs(err, &ecrud.ErrNotFound{})
+	})
+
+	t.Run("`Get` and `List` reconstruct past states", func(tt *testing.T) {
+		as := assert.New(tt)
+		// versions are timed to the millisecond
+		tick := func() time.Time {
+			time.Sleep(2 * time.Millisecond)
+			t := time.Now()
+			time.Sleep(2 * time.Millisecond)
+			return t
+		}
+		before := tick()
+		fn, ln, dob, em, ro := "Craig", "Federighi", "1969-05-27", "craig@apple.com", "SVP"
+		id, err := svc.Create(ctx, ecrud.EmployeeAttrs{FirstName: &fn, LastName: &ln, DateOfBirth: &dob, Email: &em})
+		as.NoError(err)
+		created := tick()
+		_, err = svc.Update(ctx, id, ecrud.EmployeeAttrs{Role: &ro})
+		as.NoError(err)
+		updated := tick()
+		as.NoError(svc.Delete(ctx, id))
+		deleted := tick()
+
+		_, err = svc.Get(ctx, id, ecrud.AsOf(before))
+		as.ErrorAs(err, &ecrud.ErrNotFound{})
+		e, err := svc.Get(ctx, id, ecrud.AsOf(created))
+		as.NoError(err)
+		as.Nil(e.Role)
+		e, err = svc.Get(ctx, id, ecrud.AsOf(updated))
+		as.NoError(err)
+		as.Equal(ro, *e.Role)
+		_, err = svc.Get(ctx, id, ecrud.AsOf(deleted))
+		as.ErrorAs(err, &ecrud.ErrNotFound{})
+		e, err = svc.Get(ctx, id, ecrud.AsOf(deleted), ecrud.WithDeleted())
+		as.NoError(err)
+		as.NotNil(e.DeletedAt)
+
+		page, err := svc.List(ctx, ecrud.ListOptions{AsOf: &created, Role: &ro})
+		as.NoError(err)
+		as.Empty(page.Employees)
+		page, err = svc.List(ctx, ecrud.ListOptions{AsOf: &updated, Role: &ro})
+		as.NoError(err)
+		as.Equal(1, page.Total)
+		if as.Len(page.Employees, 1) {
+			as.Equal(id, page.Employees[0].ID)
+		}
+	})
+
+	t.Run("keeps reporting lines acyclic", func(tt *testing.T) {
+		as := assert.New(tt)
+		create := func(fn string, managerID *int) int {
+			ln, dob, em := "Org", "1970-01-01", strings.ToLower(fn)+"@org.com"
+			id, err := svc.Create(ctx, ecrud.EmployeeAttrs{FirstName: &fn, LastName: &ln, DateOfBirth: &dob, Email: &em, ManagerID: managerID})
+			as.NoError(err)
+			return id
+		}
+		top := create("Top", nil)
+		mid := create("Mid", &top)
+		low := create("Low", &mid)
+
+		var ebr ecrud.ErrBadRequest
+		_, err := svc.Update(ctx, top, ecrud.EmployeeAttrs{ManagerID: &low})
+		if as.ErrorAs(err, &ebr) {
+			as.Equal([]ecrud.FieldError{{Field: "managerId", Reason: ecrud.ReasonCycle}}, ebr.Errors)
+		}
+		// the rejected update was rolled back
+		e, err := svc.Get(ctx, top)
+		as.NoError(err)
+		as.Nil(e.ManagerID)
+		missing := 99
+		_, err = svc.Create(ctx, ecrud.EmployeeAttrs{FirstName: &fn, LastName: &ln, DateOfBirth: &dob, Email: &em, ManagerID: &missing})
+		as.ErrorAs(err, &ebr)
+		page, err := svc.List(ctx, ecrud.ListOptions{ManagerID: &mid})
+		as.NoError(err)
+		if as.Len(page.Employees, 1) {
+			as.Equal(low, page.Employees[0].ID)
+			as.Equal(mid, *page.Employees[0].ManagerID)
+		}
+
+		var ehr ecrud.ErrHasReports
+		if as.ErrorAs(svc.Delete(ctx, mid), &ehr) {
+			as.Equal([]int{low}, ehr.Reports)
+		}
+		_, err = svc.Update(ctx, low, ecrud.EmployeeAttrs{ManagerID: &top})
+		as.NoError(err)
+		as.NoError(svc.Delete(ctx, mid))
+		as.NoError(svc.Delete(ctx, low))
+		as.NoError(svc.Delete(ctx, top))
+		e, err = svc.Restore(ctx, low)
+		as.NoError(err)
+		as.Nil(e.ManagerID)
+	})
+
+	t.Run("`Get` returns not found on non-existent record", func(tt *testing.T) {
+		as := assert.New(tt)
+		_, err := svc.Get(ctx, 99)
+		var enf ecrud.ErrNotFound
+		as.ErrorAs(err, &enf)
+	})
+}
@@ -0,0 +1,199 @@
+package ecrud
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// How VisibilityPolicy masks dates of birth
+const (
+	// DateOfBirthRedacted blanks dates of birth out
+	DateOfBirthRedacted = "redacted"
+	// DateOfBirthMonthDay keeps month and day, formatted as in
+	// ISO 8601 "--MM-DD", so that birthdays can still be celebrated
+	DateOfBirthMonthDay = "month-day"
+)
+
+// VisibilityPolicy decides which callers see the PII fields of an
+// Employee, dateOfBirth and email, in full. Admins, HR and employees
+// looking at their own record do; everybody else gets the date of
+// birth masked as DateOfBirth says and the email reduced to its first
+// character and domain, ie. "h***@me.com". The zero value redacts
+// dates of birth.
+type VisibilityPolicy struct {
+	DateOfBirth string
+}
+
+// seesPII reports whether the caller of ctx may see e's PII in full
+func seesPII(ctx context.Context, e Employee) bool {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return false
+	}
+
+	return p.HasRole(RoleAdmin) || p.HasRole(RoleHR) || (p.EmployeeID != 0 && p.EmployeeID == e.ID)
+}
+
+// Mask returns e as the caller of ctx may see it
+func (vp VisibilityPolicy) Mask(ctx context.Context, e Employee) Employee {
+	if seesPII(ctx, e) {
+		return e
+	}
+	e.DateOfBirth = vp.maskDateOfBirth(e.DateOfBirth)
+	e.Email = maskEmail(e.Email)
+
+	return e
+}
+
+func (vp VisibilityPolicy) maskDateOfBirth(dob string) string {
+	// dates are validated as YYYY-MM-DD
+	if vp.DateOfBirth == DateOfBirthMonthDay && len(dob) == len("2006-01-02") {
+		return "--" + dob[5:]
+	}
+
+	return ""
+}
+
+func maskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return "***"
+	}
+
+	return local[:1] + "***@" + domain
+}
+
+// maskEvent masks the records of ev as the caller of ctx may see them
+func (vp VisibilityPolicy) maskEvent(ctx context.Context, ev ChangeEvent) ChangeEvent {
+	for _, e := range []**Employee{&ev.Before, &ev.After} {
+		if *e != nil {
+			masked := vp.Mask(ctx, **e)
+			*e = &masked
+		}
+	}
+
+	return ev
+}
+
+// ServiceVisibilityMiddleware is a middleware that masks the PII of the
+// records returned to the principal attached to the context, according
+// to a VisibilityPolicy. Listing options that would reveal masked
+// fields through the order or filtering of records are forbidden.
+type ServiceVisibilityMiddleware struct {
+	inner  Service
+	policy VisibilityPolicy
+	log    *zerolog.Logger
+}
+
+var _ Service = (*ServiceVisibilityMiddleware)(nil)
+
+func NewServiceVisibilityMiddleware(svc Service, policy VisibilityPolicy, log *zerolog.Logger) *ServiceVisibilityMiddleware {
+	return &ServiceVisibilityMiddleware{
+		inner:  svc,
+		policy: policy,
+		log:    log,
+	}
+}
+
+func (mw *ServiceVisibilityMiddleware) List(ctx context.Context, opts ListOptions) (EmployeePage, error) {
+	// an employee's own record does not make the others visible
+	if !seesPII(ctx, Employee{}) {
+		if opts.Sort == "email" || opts.Sort == "dateOfBirth" {
+			return EmployeePage{}, mw.forbidden(ctx, "sorting by "+opts.Sort)
+		}
+		if opts.DateOfBirthFrom != nil || opts.DateOfBirthTo != nil {
+			return EmployeePage{}, mw.forbidden(ctx, "filtering by dateOfBirth")
+		}
+	}
+
+	page, err := mw.inner.List(ctx, opts)
+	if err != nil {
+		return page, err
+	}
+	for i, e := range page.Employees {
+		page.Employees[i] = mw.policy.Mask(ctx, e)
+	}
+
+	return page, nil
+}
+
+func (mw *ServiceVisibilityMiddleware) Get(ctx context.Context, id int, opts ...GetOption) (Employee, error) {
+	e, err := mw.inner.Get(ctx, id, opts...)
+	if err != nil {
+		return e, err
+	}
+
+	return mw.policy.Mask(ctx, e), nil
+}
+
+func (mw *ServiceVisibilityMiddleware) Create(ctx context.Context, attrs EmployeeAttrs) (int, error) {
+	return mw.inner.Create(ctx, attrs)
+}
+
+func (mw *ServiceVisibilityMiddleware) Update(ctx context.Context, id int, attrs EmployeeAttrs) (Employee, error) {
+	e, err := mw.inner.Update(ctx, id, mw.unmask(ctx, id, attrs))
+	if err != nil {
+		return e, err
+	}
+
+	return mw.policy.Mask(ctx, e), nil
+}
+
+func (mw *ServiceVisibilityMiddleware) Delete(ctx context.Context, id int) error {
+	return mw.inner.Delete(ctx, id)
+}
+
+func (mw *ServiceVisibilityMiddleware) Restore(ctx context.Context, id int) (Employee, error) {
+	e, err := mw.inner.Restore(ctx, id)
+	if err != nil {
+		return e, err
+	}
+
+	return mw.policy.Mask(ctx, e), nil
+}
+
+func (mw *ServiceVisibilityMiddleware) Batch(ctx context.Context, req BatchRequest) ([]BatchResult, error) {
+	ops := make([]BatchOp, len(req.Ops))
+	for i, op := range req.Ops {
+		if op.Op == BatchUpdate {
+			op.Attrs = mw.unmask(ctx, op.ID, op.Attrs)
+		}
+		ops[i] = op
+	}
+	req.Ops = ops
+
+	return mw.inner.Batch(ctx, req)
+}
+
+// unmask leaves the PII fields of attrs that hold the masked current
+// value unchanged, so that clients writing back a record they read, ie.
+// with a SCIM PUT, do not overwrite the real values with masked ones
+func (mw *ServiceVisibilityMiddleware) unmask(ctx context.Context, id int, attrs EmployeeAttrs) EmployeeAttrs {
+	if attrs.DateOfBirth == nil && attrs.Email == nil {
+		return attrs
+	}
+	current, err := mw.inner.Get(ctx, id)
+	if err != nil || seesPII(ctx, current) {
+		// missing records are left to the inner Service to report
+		return attrs
+	}
+
+	masked := mw.policy.Mask(ctx, current)
+	if attrs.DateOfBirth != nil && *attrs.DateOfBirth == masked.DateOfBirth {
+		attrs.DateOfBirth = nil
+	}
+	if attrs.Email != nil && *attrs.Email == masked.Email {
+		attrs.Email = nil
+	}
+
+	return attrs
+}
+
+func (mw *ServiceVisibilityMiddleware) forbidden(ctx context.Context, what string) error {
+	ctxLogger(ctx, mw.log).Info().
+		Msg("`List` " + what + " forbidden")
+
+	return ErrForbidden{Reason: what + " requires the " + RoleHR + " role"}
+}
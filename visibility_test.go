@@ -0,0 +1,156 @@
+package ecrud_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+)
+
+func TestServiceVisibilityMiddleware(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	newService := func(policy ecrud.VisibilityPolicy) ecrud.Service {
+		stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+			2: {FirstName: "Tim", LastName: "Cook", DateOfBirth: "1960-11-01", Email: "tim@apple.com"},
+		}, &log)
+		return ecrud.NewServiceVisibilityMiddleware(ecrud.NewServiceValidationMiddleware(stub, &log), policy, &log)
+	}
+	reader := ecrud.ContextWithPrincipal(ctx, ecrud.Principal{Subject: "david", EmployeeID: 1})
+	hr := ecrud.ContextWithPrincipal(ctx, ecrud.Principal{Subject: "payroll", Roles: []string{ecrud.RoleHR}})
+
+	t.Run("masks PII for callers without the hr role", func(tt *testing.T) {
+		as := assert.New(tt)
+		svc := newService(ecrud.VisibilityPolicy{})
+
+		e, err := svc.Get(reader, 2)
+		as.NoError(err)
+		as.Equal("", e.DateOfBirth)
+		as.Equal("t***@apple.com", e.Email)
+		as.Equal("Tim", e.FirstName)
+
+		e, err = svc.Get(hr, 2)
+		as.NoError(err)
+		as.Equal("1960-11-01", e.DateOfBirth)
+		as.Equal("tim@apple.com", e.Email)
+
+		page, err := svc.List(reader, ecrud.ListOptions{})
+		as.NoError(err)
+		if as.Len(page.Employees, 2) {
+			// their own record is not masked
+			as.Equal("hire@me.com", page.Employees[0].Email)
+			as.Equal("t***@apple.com", page.Employees[1].Email)
+		}
+	})
+
+	t.Run("reduces dates of birth to month and day", func(tt *testing.T) {
+		as := assert.New(tt)
+		svc := newService(ecrud.VisibilityPolicy{DateOfBirth: ecrud.DateOfBirthMonthDay})
+		e, err := svc.Get(reader, 2)
+		as.NoError(err)
+		as.Equal("--11-01", e.DateOfBirth)
+	})
+
+	t.Run("forbids listing by masked fields", func(tt *testing.T) {
+		as := assert.New(tt)
+		svc := newService(ecrud.VisibilityPolicy{})
+		from := "1960-01-01"
+		_, err := svc.List(reader, ecrud.ListOptions{DateOfBirthFrom: &from})
+		as.ErrorAs(err, &ecrud.ErrForbidden{})
+		_, err = svc.List(reader, ecrud.ListOptions{Sort: "email"})
+		as.ErrorAs(err, &ecrud.ErrForbidden{})
+		_, err = svc.List(hr, ecrud.ListOptions{Sort: "email", DateOfBirthFrom: &from})
+		as.NoError(err)
+	})
+
+	t.Run("leaves fields written back masked unchanged", func(tt *testing.T) {
+		as := assert.New(tt)
+		svc := newService(ecrud.VisibilityPolicy{DateOfBirth: ecrud.DateOfBirthMonthDay})
+		e, err := svc.Get(reader, 2)
+		as.NoError(err)
+		ro := "CEO"
+		e, err = svc.Update(reader, 2, ecrud.EmployeeAttrs{Email: &e.Email, DateOfBirth: &e.DateOfBirth, Role: &ro})
+		as.NoError(err)
+		as.Equal("t***@apple.com", e.Email)
+
+		e, err = svc.Get(hr, 2)
+		as.NoError(err)
+		as.Equal("tim@apple.com", e.Email)
+		as.Equal("1960-11-01", e.DateOfBirth)
+		as.Equal("CEO", *e.Role)
+	})
+}
+
+func TestHTTPVisibility(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	feed := ecrud.NewChangeFeed(ecrud.DefaultChangeFeedSize)
+	stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+		1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+	}, &log, ecrud.WithChangeFeed(feed))
+	policy := ecrud.VisibilityPolicy{}
+	svc := ecrud.NewServiceVisibilityMiddleware(stub, policy, &log)
+	srv := httptest.NewServer(ecrud.NewHTTPServer(svc, &log,
+		ecrud.WithEventStream(feed),
+		ecrud.WithVisibilityPolicy(policy),
+		ecrud.WithAuthentication(ecrud.NewAPIKeyAuthenticator(map[string]ecrud.Principal{
+			"reader": {Subject: "reader"},
+		})),
+	))
+	defer srv.Close()
+	get := func(tt *testing.T, path string) *http.Response {
+		r, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		r.Header.Set(ecrud.APIKeyHeader, "reader")
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		return resp
+	}
+
+	t.Run("masks CSV exports", func(tt *testing.T) {
+		as := assert.New(tt)
+		resp := get(tt, "/employees.csv")
+		defer resp.Body.Close()
+		records, err := csv.NewReader(resp.Body).ReadAll()
+		as.NoError(err)
+		if as.Len(records, 2) {
+			as.Contains(records[1], "h***@me.com")
+			as.NotContains(records[1], "2001-04-15")
+		}
+	})
+
+	t.Run("masks streamed events", func(tt *testing.T) {
+		as := assert.New(tt)
+		resp := get(tt, "/employees/events")
+		defer resp.Body.Close()
+		ro := "CEO"
+		_, err := stub.Update(ctx, 1, ecrud.EmployeeAttrs{Role: &ro})
+		as.NoError(err)
+
+		lines := bufio.NewScanner(resp.Body)
+		received := false
+		for !received && lines.Scan() {
+			data, ok := strings.CutPrefix(lines.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			ev := ecrud.ChangeEvent{}
+			as.NoError(json.Unmarshal([]byte(data), &ev))
+			as.Equal("h***@me.com", ev.Before.Email)
+			as.Equal("", ev.After.DateOfBirth)
+			received = true
+		}
+		as.True(received)
+	})
+}
@@ -0,0 +1,696 @@
+package ecrud
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mrand "math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/semaphore"
+)
+
+// Webhook event types. A single update may emit several of them, ie.
+// an employee that is deactivated while moving department.
+const (
+	WebhookEmployeeCreated           = "employee.created"
+	WebhookEmployeeUpdated           = "employee.updated"
+	WebhookEmployeeDeleted           = "employee.deleted"
+	WebhookEmployeeRestored          = "employee.restored"
+	WebhookEmployeeTerminated        = "employee.terminated"
+	WebhookEmployeeDepartmentChanged = "employee.department_changed"
+)
+
+// webhookEvents lists every event type a webhook may subscribe to
+var webhookEvents = map[string]struct{}{
+	WebhookEmployeeCreated:           {},
+	WebhookEmployeeUpdated:           {},
+	WebhookEmployeeDeleted:           {},
+	WebhookEmployeeRestored:          {},
+	WebhookEmployeeTerminated:        {},
+	WebhookEmployeeDepartmentChanged: {},
+}
+
+// Headers sent with every delivery
+const (
+	WebhookSignatureHeader = "X-Ecrud-Signature"
+	WebhookEventHeader     = "X-Ecrud-Event"
+	WebhookDeliveryHeader  = "X-Ecrud-Delivery"
+)
+
+const (
+	// DefaultWebhookAttempts is how often a delivery is tried before it
+	// is dead lettered
+	DefaultWebhookAttempts = 6
+	// DefaultWebhookBackoff is the delay before the first retry; it
+	// doubles with every further attempt
+	DefaultWebhookBackoff = time.Second
+	// maxWebhookBackoff caps the delay between two attempts
+	maxWebhookBackoff = 5 * time.Minute
+	// webhookConcurrency caps the number of requests in flight
+	webhookConcurrency = 16
+)
+
+// Webhook is a subscription to employee lifecycle events. Secret is
+// only returned when the webhook is created.
+type Webhook struct {
+	ID     int      `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active bool     `json:"active"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+// WebhookAttrs is used to create/update a webhook. Like EmployeeAttrs,
+// nil fields are left unchanged on update. Events defaults to every
+// event type and Secret to a random one.
+type WebhookAttrs struct {
+	URL    *string   `json:"url"`
+	Events *[]string `json:"events,omitempty"`
+	Active *bool     `json:"active,omitempty"`
+	Secret *string   `json:"secret,omitempty"`
+}
+
+// WebhookPayload is the JSON body POSTed to webhooks. Employee is the
+// record after the change, or before it for deletes; Previous is the
+// record before an update.
+type WebhookPayload struct {
+	DeliveryID int       `json:"deliveryId"`
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurredAt"`
+	Employee   Employee  `json:"employee"`
+	Previous   *Employee `json:"previous,omitempty"`
+}
+
+// WebhookDelivery is a payload on its way to a webhook, or a dead
+// letter once every attempt failed
+type WebhookDelivery struct {
+	ID        int             `json:"id"`
+	WebhookID int             `json:"webhookId"`
+	Event     string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"lastError,omitempty"`
+}
+
+// Webhooks keeps webhook subscriptions and delivers events to them in
+// the background. Subscriptions, pending deliveries and dead letters
+// are kept in memory only.
+type Webhooks struct {
+	mtx         sync.Mutex
+	hooks       map[int]Webhook
+	secrets     map[int]string
+	deadLetters map[int]WebhookDelivery
+	hookSeq     int
+	deliverySeq int
+
+	hc       *http.Client
+	attempts int
+	backoff  time.Duration
+	log      *zerolog.Logger
+	sem      *semaphore.Weighted
+	wg       sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// WebhookOption configures optional Webhooks behavior
+type WebhookOption func(*Webhooks)
+
+// WithWebhookHTTPClient sends deliveries through hc. The default client
+// times out after 10 seconds.
+func WithWebhookHTTPClient(hc *http.Client) WebhookOption {
+	return func(w *Webhooks) {
+		w.hc = hc
+	}
+}
+
+// WithWebhookRetries tries each delivery up to attempts times, waiting
+// backoff before the first retry and twice as long before each next one
+func WithWebhookRetries(attempts int, backoff time.Duration) WebhookOption {
+	return func(w *Webhooks) {
+		w.attempts = attempts
+		w.backoff = backoff
+	}
+}
+
+func NewWebhooks(log *zerolog.Logger, opts ...WebhookOption) *Webhooks {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Webhooks{
+		hooks:       map[int]Webhook{},
+		secrets:     map[int]string{},
+		deadLetters: map[int]WebhookDelivery{},
+		hc:          &http.Client{Timeout: 10 * time.Second},
+		attempts:    DefaultWebhookAttempts,
+		backoff:     DefaultWebhookBackoff,
+		log:         log,
+		sem:         semaphore.NewWeighted(webhookConcurrency),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// Close stops delivering and waits for the requests in flight.
+// Deliveries still waiting for a retry are dropped.
+func (w *Webhooks) Close() {
+	w.cancel()
+	w.wg.Wait()
+}
+
+func (w *Webhooks) List(ctx context.Context) ([]Webhook, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	hooks := make([]Webhook, 0, len(w.hooks))
+	for _, hook := range w.hooks {
+		hooks = append(hooks, hook)
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].ID < hooks[j].ID })
+
+	return hooks, nil
+}
+
+func (w *Webhooks) Get(ctx context.Context, id int) (Webhook, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	hook, found := w.hooks[id]
+	if !found {
+		return Webhook{}, ErrNotFound{ID: id}
+	}
+
+	return hook, nil
+}
+
+func (w *Webhooks) Create(ctx context.Context, attrs WebhookAttrs) (Webhook, error) {
+	ebr := validateWebhook(attrs)
+	if attrs.URL == nil {
+		ebr.Add("url", ReasonRequired)
+	}
+	if !ebr.Empty() {
+		return Webhook{}, ebr
+	}
+
+	secret := ""
+	if attrs.Secret != nil {
+		secret = *attrs.Secret
+	} else {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return Webhook{}, err
+		}
+		secret = hex.EncodeToString(b)
+	}
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	w.hookSeq++
+	hook := attrs.applyTo(Webhook{ID: w.hookSeq, Active: true, Events: allWebhookEvents()})
+	w.hooks[hook.ID] = hook
+	w.secrets[hook.ID] = secret
+	hook.Secret = secret
+
+	return hook, nil
+}
+
+func (w *Webhooks) Update(ctx context.Context, id int, attrs WebhookAttrs) (Webhook, error) {
+	if ebr := validateWebhook(attrs); !ebr.Empty() {
+		return Webhook{}, ebr
+	}
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	hook, found := w.hooks[id]
+	if !found {
+		return Webhook{}, ErrNotFound{ID: id}
+	}
+	hook = attrs.applyTo(hook)
+	w.hooks[id] = hook
+	if attrs.Secret != nil {
+		w.secrets[id] = *attrs.Secret
+	}
+
+	return hook, nil
+}
+
+// Delete removes a webhook. Deliveries to it that are waiting for a
+// retry are dropped.
+func (w *Webhooks) Delete(ctx context.Context, id int) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if _, found := w.hooks[id]; !found {
+		return ErrNotFound{ID: id}
+	}
+	delete(w.hooks, id)
+	delete(w.secrets, id)
+
+	return nil
+}
+
+func validateWebhook(attrs WebhookAttrs) ErrBadRequest {
+	var ebr ErrBadRequest
+	if attrs.URL != nil {
+		u, err := url.Parse(*attrs.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			ebr.Add("url", ReasonMalformed)
+		}
+	}
+	if attrs.Events != nil {
+		for _, ev := range *attrs.Events {
+			if _, ok := webhookEvents[ev]; !ok {
+				ebr.Add("events", ReasonUnknown)
+				break
+			}
+		}
+	}
+	if attrs.Secret != nil && len(*attrs.Secret) < 16 {
+		ebr.Add("secret", ReasonTooShort)
+	}
+
+	return ebr
+}
+
+func (attrs WebhookAttrs) applyTo(hook Webhook) Webhook {
+	if attrs.URL != nil {
+		hook.URL = *attrs.URL
+	}
+	if attrs.Events != nil {
+		hook.Events = *attrs.Events
+	}
+	if len(hook.Events) == 0 {
+		hook.Events = allWebhookEvents()
+	}
+	if attrs.Active != nil {
+		hook.Active = *attrs.Active
+	}
+
+	return hook
+}
+
+func allWebhookEvents() []string {
+	events := make([]string, 0, len(webhookEvents))
+	for ev := range webhookEvents {
+		events = append(events, ev)
+	}
+	sort.Strings(events)
+
+	return events
+}
+
+// DeadLetters lists the deliveries that failed every attempt
+func (w *Webhooks) DeadLetters(ctx context.Context) ([]WebhookDelivery, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	letters := make([]WebhookDelivery, 0, len(w.deadLetters))
+	for _, d := range w.deadLetters {
+		letters = append(letters, d)
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i].ID < letters[j].ID })
+
+	return letters, nil
+}
+
+// Replay retries a dead letter with a fresh set of attempts. The
+// payload keeps its delivery ID so that receivers can deduplicate.
+func (w *Webhooks) Replay(ctx context.Context, deliveryID int) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	d, found := w.deadLetters[deliveryID]
+	if !found {
+		return ErrNotFound{ID: deliveryID}
+	}
+	if _, found = w.hooks[d.WebhookID]; !found {
+		return ErrNotFound{ID: d.WebhookID}
+	}
+	delete(w.deadLetters, deliveryID)
+	d.Attempts, d.LastError = 0, ""
+	w.start(d)
+
+	return nil
+}
+
+// publish queues a delivery of every event the change emits to each
+// active webhook subscribed to it. Either before or after is nil for
+// creates and deletes.
+func (w *Webhooks) publish(before, after *Employee) {
+	var (
+		events   []string
+		employee = after
+		previous = before
+	)
+	switch {
+	case before == nil:
+		events = []string{WebhookEmployeeCreated}
+	case after == nil:
+		events = []string{WebhookEmployeeDeleted}
+		employee, previous = before, nil
+	case before.DeletedAt != nil:
+		events = []string{WebhookEmployeeRestored}
+	default:
+		events = []string{WebhookEmployeeUpdated}
+		if after.IsActive != nil && !*after.IsActive && (before.IsActive == nil || *before.IsActive) {
+			events = append(events, WebhookEmployeeTerminated)
+		}
+		if !equalStringPtr(before.Department, after.Department) {
+			events = append(events, WebhookEmployeeDepartmentChanged)
+		}
+	}
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	now := time.Now().UTC()
+	for _, hook := range w.hooks {
+		if !hook.Active {
+			continue
+		}
+		for _, ev := range events {
+			if !hook.subscribes(ev) {
+				continue
+			}
+			w.deliverySeq++
+			payload, err := json.Marshal(WebhookPayload{
+				DeliveryID: w.deliverySeq,
+				Event:      ev,
+				OccurredAt: now,
+				Employee:   *employee,
+				Previous:   previous,
+			})
+			if err != nil {
+				w.log.Error().
+					Err(err).
+					Msg("webhook payload encoding failed")
+				continue
+			}
+			w.start(WebhookDelivery{
+				ID:        w.deliverySeq,
+				WebhookID: hook.ID,
+				Event:     ev,
+				Payload:   payload,
+			})
+		}
+	}
+}
+
+func (hook Webhook) subscribes(event string) bool {
+	for _, ev := range hook.Events {
+		if ev == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+func equalStringPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// start delivers d in the background, retrying with backoff until it
+// succeeds or runs out of attempts
+func (w *Webhooks) start(d WebhookDelivery) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for {
+			err := w.attempt(d)
+			if err == nil || errors.Is(err, context.Canceled) {
+				return
+			}
+			d.Attempts++
+			d.LastError = err.Error()
+			if errors.Is(err, errWebhookGone) {
+				return
+			}
+			if d.Attempts >= w.attempts {
+				w.deadLetter(d)
+				return
+			}
+
+			delay := min(w.backoff<<(d.Attempts-1), maxWebhookBackoff)
+			// jitter spreads out retries to a receiver that recovers
+			delay = delay/2 + time.Duration(mrand.Int63n(int64(delay/2)+1))
+			t := time.NewTimer(delay)
+			select {
+			case <-w.ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// errWebhookGone stops the retries of deliveries to deleted webhooks
+var errWebhookGone = errors.New("webhook was deleted")
+
+func (w *Webhooks) attempt(d WebhookDelivery) error {
+	w.mtx.Lock()
+	hook, found := w.hooks[d.WebhookID]
+	secret := w.secrets[d.WebhookID]
+	w.mtx.Unlock()
+	if !found {
+		return errWebhookGone
+	}
+
+	if err := w.sem.Acquire(w.ctx, 1); err != nil {
+		return err
+	}
+	defer w.sem.Release(1)
+
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, hook.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, d.Event)
+	req.Header.Set(WebhookDeliveryHeader, strconv.Itoa(d.ID))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(secret, time.Now(), d.Payload))
+
+	resp, err := w.hc.Do(req)
+	if err != nil {
+		if w.ctx.Err() != nil {
+			return context.Canceled
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (w *Webhooks) deadLetter(d WebhookDelivery) {
+	w.log.Warn().
+		Int("webhookID", d.WebhookID).
+		Int("deliveryID", d.ID).
+		Str("error", d.LastError).
+		Msg("webhook delivery failed")
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.deadLetters[d.ID] = d
+}
+
+// SignWebhook computes the WebhookSignatureHeader value for a payload
+// sent at t: "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<payload>">".
+// Signing the timestamp lets receivers reject replayed requests.
+func SignWebhook(secret string, t time.Time, payload []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+
+	return "t=" + ts + ",v1=" + webhookMAC(secret, ts, payload)
+}
+
+// VerifyWebhook checks a WebhookSignatureHeader value against the
+// payload it came with, rejecting signatures older than tolerance
+func VerifyWebhook(secret, header string, payload []byte, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return errors.New("malformed webhook signature")
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return errors.New("webhook signature expired")
+	}
+	if !hmac.Equal([]byte(sig), []byte(webhookMAC(secret, ts, payload))) {
+		return errors.New("webhook signature mismatch")
+	}
+
+	return nil
+}
+
+func webhookMAC(secret, ts string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ServiceWebhookMiddleware publishes the changes made through the inner
+// Service to webhooks once they succeeded. Changes are made conditional
+// on the records read before them, so Previous is the state a change
+// was applied to.
+type ServiceWebhookMiddleware struct {
+	inner Service
+	hooks *Webhooks
+}
+
+var _ Service = (*ServiceWebhookMiddleware)(nil)
+
+func NewServiceWebhookMiddleware(svc Service, hooks *Webhooks) *ServiceWebhookMiddleware {
+	return &ServiceWebhookMiddleware{
+		inner: svc,
+		hooks: hooks,
+	}
+}
+
+func (mw *ServiceWebhookMiddleware) List(ctx context.Context, opts ListOptions) (EmployeePage, error) {
+	return mw.inner.List(ctx, opts)
+}
+
+func (mw *ServiceWebhookMiddleware) Get(ctx context.Context, id int, opts ...GetOption) (Employee, error) {
+	return mw.inner.Get(ctx, id, opts...)
+}
+
+func (mw *ServiceWebhookMiddleware) Create(ctx context.Context, attrs EmployeeAttrs) (int, error) {
+	id, err := mw.inner.Create(ctx, attrs)
+	if err != nil {
+		return id, err
+	}
+	// the change is made, a caller giving up now must not lose its events
+	if after, err := mw.inner.Get(context.WithoutCancel(ctx), id); err == nil {
+		mw.hooks.publish(nil, &after)
+	}
+
+	return id, nil
+}
+
+func (mw *ServiceWebhookMiddleware) Update(ctx context.Context, id int, attrs EmployeeAttrs) (Employee, error) {
+	before, after, err := pinnedUpdate(ctx, mw.inner, id, attrs)
+	if err != nil {
+		return after, err
+	}
+	mw.hooks.publish(&before, &after)
+
+	return after, nil
+}
+
+func (mw *ServiceWebhookMiddleware) Delete(ctx context.Context, id int) error {
+	before, err := mw.inner.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err = mw.inner.Delete(ctx, id); err != nil {
+		return err
+	}
+	before = deletedState(context.WithoutCancel(ctx), mw.inner, before)
+	mw.hooks.publish(&before, nil)
+
+	return nil
+}
+
+func (mw *ServiceWebhookMiddleware) Restore(ctx context.Context, id int) (Employee, error) {
+	before, err := mw.inner.Get(ctx, id, WithDeleted())
+	if err != nil {
+		return Employee{}, err
+	}
+	after, err := mw.inner.Restore(ctx, id)
+	if err != nil {
+		return after, err
+	}
+	if before.DeletedAt != nil {
+		mw.hooks.publish(&before, &after)
+	}
+
+	return after, nil
+}
+
+func (mw *ServiceWebhookMiddleware) Batch(ctx context.Context, req BatchRequest) ([]BatchResult, error) {
+	if req.DryRun {
+		return mw.inner.Batch(ctx, req)
+	}
+
+	befores, results, err := pinnedBatch(ctx, mw.inner, req)
+	if err != nil {
+		return results, err
+	}
+	// operations on the same record are published as a single change,
+	// from its state before the batch to the one the last op left
+	ctx = context.WithoutCancel(ctx)
+	var (
+		ids   []int
+		first = map[int]string{}
+		last  = map[int]string{}
+	)
+	for _, res := range results {
+		if _, seen := last[res.ID]; !seen {
+			ids = append(ids, res.ID)
+			first[res.ID] = res.Op
+		}
+		last[res.ID] = res.Op
+	}
+	for _, id := range ids {
+		before, found := befores[id]
+		switch last[id] {
+		case BatchCreate:
+			if after, err := mw.inner.Get(ctx, id); err == nil {
+				mw.hooks.publish(nil, &after)
+			}
+		case BatchUpdate:
+			if after, err := mw.inner.Get(ctx, id); err == nil && found {
+				mw.hooks.publish(&before, &after)
+			}
+		case BatchDelete:
+			if found && first[id] == BatchDelete {
+				before = deletedState(ctx, mw.inner, before)
+			}
+			if found {
+				mw.hooks.publish(&before, nil)
+			}
+		}
+	}
+
+	return results, nil
+}
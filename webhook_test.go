@@ -0,0 +1,291 @@
+package ecrud_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arhyth/ecrud"
+)
+
+// receiver records the payloads POSTed to it, failing the first
+// `failures` requests
+type receiver struct {
+	mtx      sync.Mutex
+	failures int
+	secret   string
+	payloads chan ecrud.WebhookPayload
+	errs     chan error
+}
+
+func newReceiver(secret string, failures int) (*receiver, *httptest.Server) {
+	rcv := &receiver{
+		failures: failures,
+		secret:   secret,
+		payloads: make(chan ecrud.WebhookPayload, 16),
+		errs:     make(chan error, 16),
+	}
+
+	return rcv, httptest.NewServer(rcv)
+}
+
+func (rcv *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if err := ecrud.VerifyWebhook(rcv.secret, r.Header.Get(ecrud.WebhookSignatureHeader), body, time.Minute); err != nil {
+		rcv.errs <- err
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	rcv.mtx.Lock()
+	fail := rcv.failures > 0
+	rcv.failures--
+	rcv.mtx.Unlock()
+	if fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var p ecrud.WebhookPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		rcv.errs <- err
+		return
+	}
+	if r.Header.Get(ecrud.WebhookEventHeader) != p.Event {
+		rcv.errs <- fmt.Errorf("event header %q for a %s payload", r.Header.Get(ecrud.WebhookEventHeader), p.Event)
+	}
+	rcv.payloads <- p
+}
+
+func (rcv *receiver) next(tt *testing.T) ecrud.WebhookPayload {
+	select {
+	case p := <-rcv.payloads:
+		return p
+	case err := <-rcv.errs:
+		tt.Fatal(err)
+	case <-time.After(5 * time.Second):
+		tt.Fatal("no delivery")
+	}
+
+	return ecrud.WebhookPayload{}
+}
+
+func TestWebhooks(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+	secret := "0123456789abcdef"
+	newService := func(hooks *ecrud.Webhooks) ecrud.Service {
+		stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+		}, &log)
+		return ecrud.NewServiceWebhookMiddleware(stub, hooks)
+	}
+
+	t.Run("delivers signed lifecycle events", func(tt *testing.T) {
+		as := assert.New(tt)
+		rcv, srv := newReceiver(secret, 0)
+		defer srv.Close()
+		hooks := ecrud.NewWebhooks(&log)
+		defer hooks.Close()
+		svc := newService(hooks)
+		_, err := hooks.Create(ctx, ecrud.WebhookAttrs{URL: &srv.URL, Secret: &secret})
+		as.NoError(err)
+
+		fn, ln, dob, em := "Tim", "Cook", "1960-11-01", "tim@apple.com"
+		id, err := svc.Create(ctx, ecrud.EmployeeAttrs{FirstName: &fn, LastName: &ln, DateOfBirth: &dob, Email: &em})
+		as.NoError(err)
+		p := rcv.next(tt)
+		as.Equal(ecrud.WebhookEmployeeCreated, p.Event)
+		as.Equal(id, p.Employee.ID)
+		as.Nil(p.Previous)
+
+		// deliveries for a single change may arrive in any order
+		active, dept := false, "Sales"
+		_, err = svc.Update(ctx, id, ecrud.EmployeeAttrs{IsActive: &active, Department: &dept})
+		as.NoError(err)
+		events := []string{}
+		for i := 0; i < 3; i++ {
+			p = rcv.next(tt)
+			events = append(events, p.Event)
+			if as.NotNil(p.Previous) {
+				as.Nil(p.Previous.Department)
+			}
+		}
+		as.ElementsMatch([]string{
+			ecrud.WebhookEmployeeUpdated,
+			ecrud.WebhookEmployeeTerminated,
+			ecrud.WebhookEmployeeDepartmentChanged,
+		}, events)
+
+		as.NoError(svc.Delete(ctx, id))
+		p = rcv.next(tt)
+		as.Equal(ecrud.WebhookEmployeeDeleted, p.Event)
+		as.Equal("Sales", *p.Employee.Department)
+	})
+
+	t.Run("only delivers subscribed events to active webhooks", func(tt *testing.T) {
+		as := assert.New(tt)
+		rcv, srv := newReceiver(secret, 0)
+		defer srv.Close()
+		hooks := ecrud.NewWebhooks(&log)
+		defer hooks.Close()
+		svc := newService(hooks)
+		events := []string{ecrud.WebhookEmployeeDeleted}
+		hook, err := hooks.Create(ctx, ecrud.WebhookAttrs{URL: &srv.URL, Events: &events, Secret: &secret})
+		as.NoError(err)
+
+		ro := "CTO"
+		_, err = svc.Update(ctx, 1, ecrud.EmployeeAttrs{Role: &ro})
+		as.NoError(err)
+		as.NoError(svc.Delete(ctx, 1))
+		as.Equal(ecrud.WebhookEmployeeDeleted, rcv.next(tt).Event)
+
+		inactive := false
+		_, err = hooks.Update(ctx, hook.ID, ecrud.WebhookAttrs{Active: &inactive})
+		as.NoError(err)
+		fn, ln, dob, em := "Tim", "Cook", "1960-11-01", "tim@apple.com"
+		id, err := svc.Create(ctx, ecrud.EmployeeAttrs{FirstName: &fn, LastName: &ln, DateOfBirth: &dob, Email: &em})
+		as.NoError(err)
+		as.NoError(svc.Delete(ctx, id))
+		hooks.Close()
+		as.Empty(rcv.payloads)
+	})
+
+	t.Run("reports the state a change was applied to", func(tt *testing.T) {
+		as := assert.New(tt)
+		rcv, srv := newReceiver(secret, 0)
+		defer srv.Close()
+		hooks := ecrud.NewWebhooks(&log)
+		defer hooks.Close()
+		stub := ecrud.NewServiceStub(map[int]ecrud.Employee{
+			1: {FirstName: "David", LastName: "Ebreo", DateOfBirth: "2001-04-15", Email: "hire@me.com"},
+		}, &log)
+		racing := &racingWrites{Service: stub}
+		svc := ecrud.NewServiceWebhookMiddleware(racing, hooks)
+		events := []string{ecrud.WebhookEmployeeUpdated, ecrud.WebhookEmployeeDeleted}
+		_, err := hooks.Create(ctx, ecrud.WebhookAttrs{URL: &srv.URL, Events: &events, Secret: &secret})
+		as.NoError(err)
+
+		dept, ceo, cto := "Retail", "CEO", "CTO"
+		racing.race, racing.races = func() {
+			_, err := stub.Update(ctx, 1, ecrud.EmployeeAttrs{Department: &dept})
+			as.NoError(err)
+		}, 1
+		_, err = svc.Update(ctx, 1, ecrud.EmployeeAttrs{Role: &ceo})
+		as.NoError(err)
+		p := rcv.next(tt)
+		if as.NotNil(p.Previous) && as.NotNil(p.Previous.Department) {
+			as.Equal(dept, *p.Previous.Department)
+		}
+
+		racing.race, racing.races = func() {
+			_, err := stub.Update(ctx, 1, ecrud.EmployeeAttrs{Role: &cto})
+			as.NoError(err)
+		}, 1
+		as.NoError(svc.Delete(ctx, 1))
+		p = rcv.next(tt)
+		as.Equal(ecrud.WebhookEmployeeDeleted, p.Event)
+		if as.NotNil(p.Employee.Role) {
+			as.Equal(cto, *p.Employee.Role)
+		}
+		hooks.Close()
+		as.Empty(rcv.payloads)
+	})
+
+	t.Run("publishes one event per record of a batch", func(tt *testing.T) {
+		as := assert.New(tt)
+		rcv, srv := newReceiver(secret, 0)
+		defer srv.Close()
+		hooks := ecrud.NewWebhooks(&log)
+		defer hooks.Close()
+		svc := newService(hooks)
+		events := []string{ecrud.WebhookEmployeeUpdated}
+		_, err := hooks.Create(ctx, ecrud.WebhookAttrs{URL: &srv.URL, Events: &events, Secret: &secret})
+		as.NoError(err)
+
+		ro, dept := "CTO", "Sales"
+		_, err = svc.Batch(ctx, ecrud.BatchRequest{Ops: []ecrud.BatchOp{
+			{Op: ecrud.BatchUpdate, ID: 1, Attrs: ecrud.EmployeeAttrs{Role: &ro}},
+			{Op: ecrud.BatchUpdate, ID: 1, Attrs: ecrud.EmployeeAttrs{Department: &dept}},
+		}})
+		as.NoError(err)
+		p := rcv.next(tt)
+		if as.NotNil(p.Previous) {
+			as.Nil(p.Previous.Role)
+			as.Nil(p.Previous.Department)
+		}
+		as.Equal(ro, *p.Employee.Role)
+		as.Equal(dept, *p.Employee.Department)
+		hooks.Close()
+		as.Empty(rcv.payloads)
+	})
+
+	t.Run("retries, then dead letters until replayed", func(tt *testing.T) {
+		as := assert.New(tt)
+		rcv, srv := newReceiver(secret, 3)
+		defer srv.Close()
+		hooks := ecrud.NewWebhooks(&log, ecrud.WithWebhookRetries(2, time.Millisecond))
+		defer hooks.Close()
+		svc := newService(hooks)
+		_, err := hooks.Create(ctx, ecrud.WebhookAttrs{URL: &srv.URL, Secret: &secret})
+		as.NoError(err)
+
+		ro := "CTO"
+		_, err = svc.Update(ctx, 1, ecrud.EmployeeAttrs{Role: &ro})
+		as.NoError(err)
+		var letters []ecrud.WebhookDelivery
+		as.Eventually(func() bool {
+			letters, _ = hooks.DeadLetters(ctx)
+			return len(letters) == 1
+		}, 5*time.Second, time.Millisecond)
+		if as.Len(letters, 1) {
+			as.Equal(2, letters[0].Attempts)
+			as.NotEmpty(letters[0].LastError)
+		}
+
+		// the receiver fails once more, which the replay retries
+		as.NoError(hooks.Replay(ctx, letters[0].ID))
+		p := rcv.next(tt)
+		as.Equal(letters[0].ID, p.DeliveryID)
+		as.Equal("CTO", *p.Employee.Role)
+		letters, err = hooks.DeadLetters(ctx)
+		as.NoError(err)
+		as.Empty(letters)
+		as.ErrorAs(hooks.Replay(ctx, p.DeliveryID), &ecrud.ErrNotFound{})
+	})
+
+	t.Run("validates webhooks", func(tt *testing.T) {
+		as := assert.New(tt)
+		hooks := ecrud.NewWebhooks(&log)
+		defer hooks.Close()
+
+		url, short, events := "localhost:8080", "secret", []string{"employee.hired"}
+		_, err := hooks.Create(ctx, ecrud.WebhookAttrs{URL: &url, Secret: &short, Events: &events})
+		bad := ecrud.ErrBadRequest{}
+		if as.ErrorAs(err, &bad) {
+			as.ElementsMatch([]string{"url", "secret", "events"}, bad.Fields)
+		}
+
+		url = "https://example.com/hook"
+		hook, err := hooks.Create(ctx, ecrud.WebhookAttrs{URL: &url})
+		as.NoError(err)
+		as.Len(hook.Secret, 64)
+		as.True(hook.Active)
+		as.Len(hook.Events, 6)
+
+		hook, err = hooks.Get(ctx, hook.ID)
+		as.NoError(err)
+		as.Empty(hook.Secret)
+		as.NoError(hooks.Delete(ctx, hook.ID))
+		as.ErrorAs(hooks.Delete(ctx, hook.ID), &ecrud.ErrNotFound{})
+	})
+}